@@ -3,6 +3,7 @@ package cmd
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 	"time"
@@ -16,14 +17,21 @@ var secretType string
 var ownerApplication string
 var sourceURL string
 var addGit bool
+var addTags []string
+var addDescription string
+var addFields []string
+var addPlainFields []string
+var addFile string
+var addGenerate bool
+var addPolicy string
 
 const defaultAddTTL = 30 * 24 * time.Hour
 
 var addCmd = &cobra.Command{
-	Use:     "add <key> <secret>",
+	Use:     "add <key> [secret]",
 	Short:   "Store a secret",
-	Long:    "Store a secret.\n\nIf key/secret args are omitted, locksmith prompts interactively. During interactive add,\noptional rotation metadata is also prompted:\n- secret type: password | api_key | oauth_token | token\n- owner app: provider/application identifier (for example: github, gitlab)\n- source URL: rotation endpoint URL\n\nAll metadata fields are optional and may be left blank.",
-	Example: "  locksmith add my/key my-secret\n  locksmith add my/key my-secret --type oauth_token --owner-app github --source-url https://api.github.com\n  locksmith add\n  locksmith add github.com myuser --git",
+	Long:    "Store a secret.\n\nIf key/secret args are omitted, locksmith prompts interactively. During interactive add,\noptional rotation metadata is also prompted:\n- secret type: password | api_key | oauth_token | token\n- owner app: provider/application identifier (for example: github, gitlab)\n- source URL: rotation endpoint URL\n\nAll metadata fields are optional and may be left blank.\n\nWith --field or --plain-field, a structured secret is stored instead of a single value.\nA field given without '=value' is prompted for. Sensitive (--field) values are masked by\n'locksmith get' unless requested with --field; read one with 'locksmith get <key> --field <name>'\nor reference it as locksmith://<key>#<name>.\n\nWith --generate, a random value is generated from the generate policy the key and type select\n(or the one named by --policy) instead of being given; see 'locksmith generate'.\n\nWith --file, the contents of a file (kubeconfig, service-account JSON, certificate) are stored.\n'locksmith run' and 'locksmith exec' write it to a private temporary file for the child's lifetime\nwhen referenced as locksmith-file://<key>.",
+	Example: "  locksmith add my/key my-secret\n  locksmith add my/key my-secret --type oauth_token --owner-app github --source-url https://api.github.com\n  locksmith add aws/prod/key my-secret --tag prod --description \"CI deploy key\"\n  locksmith add db/prod --plain-field host=db.internal --plain-field user=app --field password\n  locksmith add k8s/prod --file ~/.kube/config\n  locksmith add db/prod/password --generate --type password\n  locksmith add\n  locksmith add github.com myuser --git",
 	Args:    cobra.MaximumNArgs(2),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if addGit {
@@ -145,24 +153,41 @@ var addCmd = &cobra.Command{
 			key = strings.TrimSpace(input)
 		}
 
-		if secret == "" {
+		var fields []locksmith.Field
+		var fileSecret *locksmith.Secret
+		if addGenerate {
+			if secret != "" || addFile != "" || len(addFields) > 0 || len(addPlainFields) > 0 {
+				return fmt.Errorf("--generate cannot be combined with a secret value, --file or fields")
+			}
+		} else if addPolicy != "" {
+			return fmt.Errorf("--policy requires --generate")
+		} else if addFile != "" {
+			if secret != "" || len(addFields) > 0 || len(addPlainFields) > 0 {
+				return fmt.Errorf("--file cannot be combined with a secret value or fields")
+			}
+			data, err := readSecretFile(cmd, addFile)
+			if err != nil {
+				return err
+			}
+			file := locksmith.NewFileSecret(addFile, data)
+			fileSecret = &file
+		} else if len(addFields) > 0 || len(addPlainFields) > 0 {
+			if secret != "" {
+				return fmt.Errorf("a secret value cannot be combined with --field or --plain-field")
+			}
+			var err error
+			fields, err = parseFieldFlags(cmd, reader)
+			if err != nil {
+				return err
+			}
+		} else if secret == "" {
 			promptMode = true
 			_, _ = fmt.Fprint(cmd.OutOrStdout(), "Secret: ")
-
-			// Use masked input if stdin is a terminal, otherwise fall back to normal input (for tests)
-			if term.IsTerminal(int(os.Stdin.Fd())) {
-				secretInput, err := term.ReadPassword(int(os.Stdin.Fd()))
-				if err != nil {
-					return fmt.Errorf("error reading secret: %w", err)
-				}
-				secret = string(secretInput)
-			} else {
-				input, err := reader.ReadString('\n')
-				if err != nil {
-					return fmt.Errorf("error reading secret: %w", err)
-				}
-				secret = strings.TrimRight(input, "\r\n")
+			input, err := readSecretInput(reader)
+			if err != nil {
+				return fmt.Errorf("error reading secret: %w", err)
 			}
+			secret = input
 		}
 
 		if promptMode {
@@ -194,28 +219,41 @@ var addCmd = &cobra.Command{
 			}
 		}
 
-		secretBytes := []byte(secret)
-
 		if key == "" {
 			return fmt.Errorf("key cannot be empty")
 		}
+
+		newSecret := locksmith.Secret{Value: []byte(secret)}
+		if addGenerate {
+			_, policy, err := selectGeneratePolicy(key, locksmith.ParseSecretType(secretType), addPolicy)
+			if err != nil {
+				return err
+			}
+			if newSecret.Value, err = locksmith.GenerateValue(policy); err != nil {
+				return fmt.Errorf("error generating secret: %w", err)
+			}
+		} else if fileSecret != nil {
+			newSecret = *fileSecret
+		} else if fields != nil {
+			var err error
+			if newSecret, err = locksmith.NewFieldSecret(fields); err != nil {
+				return err
+			}
+		}
+		secretBytes := newSecret.Value
 		if len(secretBytes) == 0 {
 			return fmt.Errorf("secret cannot be empty")
 		}
 
 		expiresAt := time.Now().Add(defaultAddTTL)
-		typedSecretType := locksmith.ParseSecretType(secretType)
-		// Use SetWithContext to persist secret metadata used for rotator auto-loading.
-		if err := ls.SetWithContext(
-			key,
-			secretBytes,
-			expiresAt,
-			globalBiometricReqs,
-			typedSecretType,
-			ownerApplication,
-			sourceURL,
-			nil,
-		); err != nil {
+		// Persist the metadata used for rotator auto-loading and search.
+		newSecret.ExpiresAt = expiresAt
+		newSecret.SecretType = locksmith.ParseSecretType(secretType)
+		newSecret.OwnerApplication = ownerApplication
+		newSecret.SourceURL = sourceURL
+		newSecret.Tags = addTags
+		newSecret.Description = addDescription
+		if err := ls.PutSecret(key, newSecret, globalBiometricReqs); err != nil {
 			return fmt.Errorf("error saving secret: %w", err)
 		}
 
@@ -235,4 +273,70 @@ func init() {
 	addCmd.Flags().StringVar(&ownerApplication, "owner-app", "", "Optional owner application/provider identifier (for example: github, gitlab)")
 	addCmd.Flags().StringVar(&sourceURL, "source-url", "", "Optional source endpoint URL used by rotator selection")
 	addCmd.Flags().BoolVar(&addGit, "git", false, "Store a Git credential (format: add <host> <username> --git)")
+	addCmd.Flags().StringSliceVar(&addTags, "tag", nil, "Tag the secret for search (repeatable or comma-separated, e.g. --tag prod,team-a)")
+	addCmd.Flags().StringVar(&addDescription, "description", "", "Optional free-text description")
+	addCmd.Flags().StringArrayVar(&addFields, "field", nil, "Add a sensitive field to a structured secret (name=value, or name to be prompted; repeatable)")
+	addCmd.Flags().StringArrayVar(&addPlainFields, "plain-field", nil, "Add a non-sensitive field, e.g. host=db.internal (repeatable)")
+	addCmd.Flags().StringVar(&addFile, "file", "", "Store the contents of a file ('-' reads standard input)")
+	addCmd.Flags().BoolVar(&addGenerate, "generate", false, "Generate a random value from the matching generate policy")
+	addCmd.Flags().StringVar(&addPolicy, "policy", "", "Generate policy to use with --generate")
+}
+
+// readSecretFile reads the file given to --file, or standard input for "-".
+func readSecretFile(cmd *cobra.Command, path string) ([]byte, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(cmd.InOrStdin())
+	} else {
+		data, err = os.ReadFile(path) // #nosec G304 -- user-supplied path is intentional
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading file: %w", err)
+	}
+	return data, nil
+}
+
+// parseFieldFlags builds the fields of a structured secret from --field and
+// --plain-field, prompting for sensitive values given without '='.
+func parseFieldFlags(cmd *cobra.Command, reader *bufio.Reader) ([]locksmith.Field, error) {
+	var fields []locksmith.Field
+	for _, f := range addPlainFields {
+		name, value, ok := strings.Cut(f, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid --plain-field '%s': expected name=value", f)
+		}
+		fields = append(fields, locksmith.Field{Name: strings.TrimSpace(name), Value: value})
+	}
+	for _, f := range addFields {
+		name, value, ok := strings.Cut(f, "=")
+		name = strings.TrimSpace(name)
+		if !ok {
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%s: ", name)
+			input, err := readSecretInput(reader)
+			if err != nil {
+				return nil, fmt.Errorf("error reading field '%s': %w", name, err)
+			}
+			value = input
+		}
+		fields = append(fields, locksmith.Field{Name: name, Value: value, Sensitive: true})
+	}
+	return fields, nil
+}
+
+// readSecretInput reads a line without echo when stdin is a terminal, and
+// falls back to normal input otherwise (for tests and pipes).
+func readSecretInput(reader *bufio.Reader) (string, error) {
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		input, err := term.ReadPassword(int(os.Stdin.Fd()))
+		if err != nil {
+			return "", err
+		}
+		return string(input), nil
+	}
+	input, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(input, "\r\n"), nil
 }
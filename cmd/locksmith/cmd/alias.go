@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/bonjoski/locksmith/v2/pkg/locksmith"
+	"github.com/spf13/cobra"
+)
+
+var aliasCmd = &cobra.Command{
+	Use:   "alias",
+	Short: "Manage key aliases",
+	Long: `An alias is a key name that refers to another key, optionally in another vault.
+Reads, writes, history, rotation and the git credential helper follow it, so tools that
+expect a fixed key (e.g. github/gh/token for 'locksmith exec gh') can use a secret stored
+under a different name. Aliases are kept under 'aliases:' in ~/.locksmith/config.yml.`,
+}
+
+var aliasAddCmd = &cobra.Command{
+	Use:     "add <alias> <target>",
+	Short:   "Make <alias> refer to <target> ([@vault/]key)",
+	Example: "  locksmith alias add github/gh/token github/work/pat\n  locksmith alias add db/password @work/db/prod/password",
+	Args:    cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		alias := args[0]
+		if ref, err := locksmith.ParseRef(alias); err != nil || ref.Key != alias {
+			return fmt.Errorf("invalid alias '%s': use a plain key name", alias)
+		}
+		ref, err := locksmith.ParseAliasTarget(args[1])
+		if err != nil {
+			return err
+		}
+		target := locksmith.FormatAliasTarget(ref)
+
+		// An alias would hide a secret stored under the same name.
+		if keys, err := ls.ListKeyNames(); err == nil {
+			for _, key := range keys {
+				if key == alias {
+					return fmt.Errorf("a secret named '%s' already exists", alias)
+				}
+			}
+		}
+
+		aliases := make(map[string]string, len(cfg.Aliases)+1)
+		for k, v := range cfg.Aliases {
+			aliases[k] = v
+		}
+		aliases[alias] = target
+		check := *cfg
+		check.Aliases = aliases
+		if _, _, err := check.ResolveAlias(locksmith.SelectVaultName(cfg, globalVault), alias); err != nil {
+			return err
+		}
+
+		if err := locksmith.SetConfigValue([]string{"aliases", alias}, target); err != nil {
+			return fmt.Errorf("error saving alias: %w", err)
+		}
+		cfg.Aliases = aliases
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Added alias '%s' -> '%s'\n", alias, target)
+		return nil
+	},
+}
+
+var aliasRemoveCmd = &cobra.Command{
+	Use:     "rm <alias>",
+	Aliases: []string{"remove"},
+	Short:   "Remove an alias (the key it refers to is kept)",
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		alias := args[0]
+		removed, err := locksmith.DeleteConfigValue([]string{"aliases", alias})
+		if err != nil {
+			return fmt.Errorf("error removing alias: %w", err)
+		}
+		if !removed {
+			return fmt.Errorf("alias '%s' does not exist", alias)
+		}
+		delete(cfg.Aliases, alias)
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Removed alias '%s'\n", alias)
+		return nil
+	},
+}
+
+var aliasListCmd = &cobra.Command{
+	Use:     "ls",
+	Aliases: []string{"list"},
+	Short:   "List aliases",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(cfg.Aliases) == 0 {
+			_, _ = fmt.Fprintln(cmd.OutOrStdout(), "No aliases configured.")
+			return nil
+		}
+		names := make([]string, 0, len(cfg.Aliases))
+		for name := range cfg.Aliases {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%-30s -> %s\n", name, cfg.Aliases[name])
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(aliasCmd)
+	aliasCmd.AddCommand(aliasAddCmd)
+	aliasCmd.AddCommand(aliasRemoveCmd)
+	aliasCmd.AddCommand(aliasListCmd)
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bonjoski/locksmith/v2/pkg/locksmith"
+)
+
+func TestAliasCommands(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	outBuf, _ := setupTest()
+	ls.Backend = newMemBackend()
+
+	if err := ls.PutSecret("github/work/pat", locksmith.Secret{Value: []byte("ghp_1")}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	rootCmd.SetArgs([]string{"alias", "add", "github/gh/token", "locksmith://github/work/pat"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("alias add: %v", err)
+	}
+	if !strings.Contains(outBuf.String(), "'github/gh/token' -> 'github/work/pat'") {
+		t.Errorf("unexpected output %q", outBuf.String())
+	}
+	saved, err := locksmith.LoadConfig()
+	if err != nil || saved.Aliases["github/gh/token"] != "github/work/pat" {
+		t.Fatalf("alias not persisted: %+v, %v", saved.Aliases, err)
+	}
+
+	// Reads, writes and the git credential helper follow the alias.
+	if v, err := ls.Get("github/gh/token"); err != nil || string(v) != "ghp_1" {
+		t.Errorf("Get through alias = %q, %v", v, err)
+	}
+	if err := ls.PutSecret("github/gh/token", locksmith.Secret{Value: []byte("ghp_2")}, false); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := ls.Get("github/work/pat"); string(v) != "ghp_2" {
+		t.Errorf("write through alias not visible on the target: %q", v)
+	}
+	outBuf.Reset()
+	rootCmd.SetIn(strings.NewReader("protocol=https\nhost=github.com\n\n"))
+	rootCmd.SetArgs([]string{"credential", "get"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("credential get: %v", err)
+	}
+	if !strings.Contains(outBuf.String(), "password=ghp_2") {
+		t.Errorf("credential helper did not follow the alias: %q", outBuf.String())
+	}
+
+	for _, args := range [][]string{
+		{"alias", "add", "github/work/pat", "github/gh/token"}, // existing secret
+		{"alias", "add", "a", "b"},                             // fine on its own...
+		{"alias", "add", "b", "a"},                             // ...but this closes a cycle
+		{"alias", "add", "c", "github/work/pat#field"},
+	} {
+		rootCmd.SetArgs(args)
+		err := rootCmd.Execute()
+		if args[2] == "a" {
+			if err != nil {
+				t.Fatalf("alias add a b: %v", err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("expected %v to fail", args)
+		}
+	}
+	if err := ls.Delete("github/gh/token"); err == nil || !strings.Contains(err.Error(), "alias rm") {
+		t.Errorf("expected Delete to refuse an alias, got %v", err)
+	}
+
+	outBuf.Reset()
+	rootCmd.SetArgs([]string{"alias", "ls"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("alias ls: %v", err)
+	}
+	if !strings.Contains(outBuf.String(), "github/gh/token") || !strings.Contains(outBuf.String(), "-> b") {
+		t.Errorf("unexpected alias ls output:\n%s", outBuf.String())
+	}
+
+	rootCmd.SetArgs([]string{"alias", "rm", "github/gh/token"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("alias rm: %v", err)
+	}
+	if _, err := ls.Get("github/work/pat"); err != nil {
+		t.Errorf("removing the alias removed the target: %v", err)
+	}
+	rootCmd.SetArgs([]string{"alias", "rm", "github/gh/token"})
+	if err := rootCmd.Execute(); err == nil {
+		t.Error("expected removing a missing alias to fail")
+	}
+}
@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bonjoski/locksmith/v2/pkg/locksmith"
+	"github.com/spf13/cobra"
+)
+
+var (
+	backendRepair       bool
+	migrateFrom         string
+	migrateTo           string
+	migrateFromOptions  map[string]string
+	migrateToOptions    map[string]string
+	migrateDryRun       bool
+	migrateConflict     string
+	migrateDeleteSource bool
+)
+
+var backendCmd = &cobra.Command{
+	Use:   "backend",
+	Short: "Inspect and maintain storage backends",
+}
+
+var backendVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Compare the tiers of a tiered backend",
+	Long: `Compare the primary and secondary tiers of the tiered backend: key sets,
+and the decoded value and metadata of every item stored in both. Reading
+items may prompt for authentication. With --repair, missing items are copied to the tier that
+lacks them and mismatched items are resolved in favour of the most recently
+created secret. Exits non-zero when the tiers have diverged and --repair was
+not given.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tiered, ok := ls.Backend.(*locksmith.TieredBackend)
+		if !ok {
+			return fmt.Errorf("backend verify requires the '%s' backend (set backend.name in config.yml or pass --backend %s)", locksmith.BackendTiered, locksmith.BackendTiered)
+		}
+
+		prompt := ls.Options.PromptMessage
+		if prompt == "" {
+			prompt = "Authentication required to verify backend tiers"
+		}
+		report, err := tiered.Verify(ls.Service, ls.Options.RequireBiometrics, prompt)
+		if err != nil {
+			return fmt.Errorf("error verifying backend: %w", err)
+		}
+
+		out := cmd.OutOrStdout()
+		if !report.Diverged() {
+			_, _ = fmt.Fprintf(out, "Backend tiers are in sync (%d keys).\n", len(report.InSync))
+			return nil
+		}
+
+		_, _ = fmt.Fprintf(out, "In sync: %d\n", len(report.InSync))
+		printKeySection(cmd, "Missing from secondary", report.OnlyPrimary)
+		printKeySection(cmd, "Missing from primary", report.OnlySecondary)
+		printKeySection(cmd, "Content differs", report.Mismatched)
+		if len(report.Unreadable) > 0 {
+			keys := make([]string, 0, len(report.Unreadable))
+			for k := range report.Unreadable {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			_, _ = fmt.Fprintf(out, "Unreadable (%d):\n", len(keys))
+			for _, k := range keys {
+				_, _ = fmt.Fprintf(out, "  - %s: %v\n", k, report.Unreadable[k])
+			}
+		}
+
+		if !backendRepair {
+			return fmt.Errorf("backend tiers have diverged; rerun with --repair to resync")
+		}
+
+		repaired, err := tiered.Repair(ls.Service, report, ls.Options.RequireBiometrics, prompt)
+		_, _ = fmt.Fprintf(out, "Repaired %d key(s).\n", len(repaired))
+		if err != nil {
+			return fmt.Errorf("error repairing backend: %w", err)
+		}
+		return nil
+	},
+}
+
+var backendMigrateCmd = &cobra.Command{
+	Use:   "migrate --from <backend> --to <backend>",
+	Short: "Copy all secrets from one backend to another",
+	Long: `Copy every secret from one registered backend to another, preserving
+creation and expiration dates, type, owner application, source URL and
+metadata. Each copy is read back and compared with the source. Backend
+options come from config.yml when it configures the same backend and can be
+set or overridden with --from-option/--to-option key=value.`,
+	Example: `  locksmith backend migrate --from native --to file --dry-run
+  locksmith backend migrate --from native --to file --to-option path=~/vault.json --conflict rename --delete-source`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if migrateFrom == "" || migrateTo == "" {
+			return fmt.Errorf("both --from and --to are required")
+		}
+		conflict, err := locksmith.ParseConflictPolicy(migrateConflict)
+		if err != nil {
+			return err
+		}
+
+		from, err := openNamedBackend(migrateFrom, migrateFromOptions)
+		if err != nil {
+			return fmt.Errorf("error opening source backend: %w", err)
+		}
+		to, err := openNamedBackend(migrateTo, migrateToOptions)
+		if err != nil {
+			return fmt.Errorf("error opening target backend: %w", err)
+		}
+
+		out := cmd.OutOrStdout()
+		if migrateDryRun {
+			_, _ = fmt.Fprintln(out, "Dry run: no secrets will be written or deleted.")
+		}
+
+		prompt := ls.Options.PromptMessage
+		if prompt == "" {
+			prompt = "Authentication required to migrate secrets"
+		}
+		results, err := locksmith.MigrateSecrets(from, to, locksmith.MigrateOptions{
+			Service:       ls.Service,
+			Conflict:      conflict,
+			DryRun:        migrateDryRun,
+			DeleteSource:  migrateDeleteSource,
+			UseBiometrics: ls.Options.RequireBiometrics,
+			Prompt:        prompt,
+			Progress: func(r locksmith.MigrateResult) {
+				line := fmt.Sprintf("%-11s %s", r.Action, r.Key)
+				if r.TargetKey != r.Key {
+					line += " -> " + r.TargetKey
+				}
+				if r.SourceDeleted {
+					line += " (source deleted)"
+				}
+				if r.Err != nil {
+					line += ": " + r.Err.Error()
+				}
+				_, _ = fmt.Fprintln(out, line)
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("error migrating secrets: %w", err)
+		}
+
+		counts := make(map[locksmith.MigrateAction]int)
+		failed := 0
+		for _, r := range results {
+			counts[r.Action]++
+			if r.Err != nil {
+				failed++
+			}
+		}
+		_, _ = fmt.Fprintf(out, "\n%d key(s): %d copied, %d overwritten, %d renamed, %d skipped, %d failed\n",
+			len(results),
+			counts[locksmith.MigrateCopied], counts[locksmith.MigrateOverwritten], counts[locksmith.MigrateRenamed],
+			counts[locksmith.MigrateSkipped], counts[locksmith.MigrateFailed])
+		if failed > 0 {
+			return fmt.Errorf("%d key(s) could not be migrated cleanly", failed)
+		}
+		return nil
+	},
+}
+
+// openNamedBackend opens a registered backend, starting from the config
+// file's options when it configures the same backend.
+func openNamedBackend(name string, overrides map[string]string) (locksmith.Backend, error) {
+	options := make(map[string]string)
+	if cfg != nil && strings.EqualFold(strings.TrimSpace(cfg.Backend.Name), strings.TrimSpace(name)) {
+		for k, v := range cfg.Backend.Options {
+			options[k] = v
+		}
+	}
+	for k, v := range overrides {
+		options[k] = v
+	}
+	return locksmith.Backends.Open(locksmith.BackendConfig{Name: name, Options: options})
+}
+
+func printKeySection(cmd *cobra.Command, title string, keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+	_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%s (%d):\n", title, len(keys))
+	for _, k := range keys {
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "  - %s\n", k)
+	}
+}
+
+func init() {
+	backendVerifyCmd.Flags().BoolVar(&backendRepair, "repair", false, "Copy missing or stale items between tiers")
+	backendMigrateCmd.Flags().StringVar(&migrateFrom, "from", "", "Source backend name")
+	backendMigrateCmd.Flags().StringVar(&migrateTo, "to", "", "Target backend name")
+	backendMigrateCmd.Flags().StringToStringVar(&migrateFromOptions, "from-option", nil, "Source backend option key=value (repeatable)")
+	backendMigrateCmd.Flags().StringToStringVar(&migrateToOptions, "to-option", nil, "Target backend option key=value (repeatable)")
+	backendMigrateCmd.Flags().BoolVar(&migrateDryRun, "dry-run", false, "Show what would be migrated without writing anything")
+	backendMigrateCmd.Flags().StringVar(&migrateConflict, "conflict", "skip", "What to do when a key exists in the target: skip|overwrite|rename")
+	backendMigrateCmd.Flags().BoolVar(&migrateDeleteSource, "delete-source", false, "Delete each secret from the source after a verified copy")
+
+	backendCmd.AddCommand(backendVerifyCmd)
+	backendCmd.AddCommand(backendMigrateCmd)
+	rootCmd.AddCommand(backendCmd)
+}
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/bonjoski/locksmith/v2/pkg/locksmith"
+)
+
+// memBackend is a simple in-memory Backend keyed by account.
+type memBackend struct {
+	items map[string][]byte
+}
+
+func newMemBackend() *memBackend {
+	return &memBackend{items: make(map[string][]byte)}
+}
+
+func (m *memBackend) Set(service, account string, data []byte, requireBiometrics bool) error {
+	m.items[account] = append([]byte(nil), data...)
+	return nil
+}
+
+func (m *memBackend) Get(service, account string, useBiometrics bool, prompt string) ([]byte, error) {
+	data, ok := m.items[account]
+	if !ok {
+		return nil, locksmith.ErrNotFound
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (m *memBackend) Delete(service, account string, useBiometrics bool, prompt string) error {
+	delete(m.items, account)
+	return nil
+}
+
+func (m *memBackend) List(service string, useBiometrics bool, prompt string) ([]string, error) {
+	keys := make([]string, 0, len(m.items))
+	for k := range m.items {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func TestBackendVerifyRequiresTiered(t *testing.T) {
+	_, _ = setupTest()
+	rootCmd.SetArgs([]string{"backend", "verify"})
+	err := rootCmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "tiered") {
+		t.Fatalf("expected tiered backend error, got %v", err)
+	}
+}
+
+func TestBackendVerifyAndRepair(t *testing.T) {
+	outBuf, _ := setupTest()
+	primary, secondary := newMemBackend(), newMemBackend()
+	ls.Backend = &locksmith.TieredBackend{Primary: primary, Secondary: secondary}
+
+	_ = primary.Set(ls.Service, "both", []byte("v"), false)
+	_ = secondary.Set(ls.Service, "both", []byte("v"), false)
+	_ = secondary.Set(ls.Service, "restored", []byte("r"), false)
+
+	rootCmd.SetArgs([]string{"backend", "verify"})
+	if err := rootCmd.Execute(); err == nil {
+		t.Fatal("expected non-zero exit for diverged tiers")
+	}
+	if out := outBuf.String(); !strings.Contains(out, "Missing from primary (1):") || !strings.Contains(out, "  - restored") {
+		t.Errorf("unexpected verify output:\n%s", out)
+	}
+
+	outBuf.Reset()
+	rootCmd.SetArgs([]string{"backend", "verify", "--repair"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("verify --repair: %v", err)
+	}
+	if !strings.Contains(outBuf.String(), "Repaired 1 key(s).") {
+		t.Errorf("unexpected repair output:\n%s", outBuf.String())
+	}
+	if string(primary.items["restored"]) != "r" {
+		t.Error("item not restored to primary")
+	}
+
+	outBuf.Reset()
+	backendRepair = false
+	rootCmd.SetArgs([]string{"backend", "verify"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("verify after repair: %v", err)
+	}
+	if !strings.Contains(outBuf.String(), "Backend tiers are in sync (2 keys).") {
+		t.Errorf("unexpected output:\n%s", outBuf.String())
+	}
+}
+
+func TestBackendMigrateCommand(t *testing.T) {
+	outBuf, _ := setupTest()
+	src, dst := newMemBackend(), newMemBackend()
+	_ = src.Set(ls.Service, "alpha", []byte(`{"value":"YQ=="}`), false)
+	_ = dst.Set(ls.Service, "alpha", []byte("existing"), false)
+	_ = src.Set(ls.Service, "beta", []byte(`{"value":"Yg=="}`), false)
+
+	var gotOptions map[string]string
+	_ = locksmith.Backends.Register("test-migrate-src", func(map[string]string) (locksmith.Backend, error) { return src, nil })
+	_ = locksmith.Backends.Register("test-migrate-dst", func(options map[string]string) (locksmith.Backend, error) {
+		gotOptions = options
+		return dst, nil
+	})
+	defer func() {
+		migrateFrom, migrateTo, migrateConflict = "", "", "skip"
+		migrateDryRun, migrateDeleteSource = false, false
+		migrateToOptions = nil
+	}()
+
+	rootCmd.SetArgs([]string{"backend", "migrate", "--from", "test-migrate-src", "--to", "test-migrate-dst", "--dry-run", "--to-option", "path=/tmp/x"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if _, ok := dst.items["beta"]; ok {
+		t.Fatal("dry run wrote to target")
+	}
+	if gotOptions["path"] != "/tmp/x" {
+		t.Errorf("--to-option not passed: %v", gotOptions)
+	}
+	if out := outBuf.String(); !strings.Contains(out, "skipped     alpha") || !strings.Contains(out, "copied      beta") {
+		t.Errorf("unexpected dry-run output:\n%s", out)
+	}
+
+	outBuf.Reset()
+	rootCmd.SetArgs([]string{"backend", "migrate", "--from", "test-migrate-src", "--to", "test-migrate-dst", "--dry-run=false", "--conflict", "rename", "--delete-source"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if string(dst.items["alpha.migrated"]) != `{"value":"YQ=="}` || string(dst.items["alpha"]) != "existing" {
+		t.Errorf("unexpected target contents: %v", dst.items)
+	}
+	if len(src.items) != 0 {
+		t.Errorf("source should be emptied: %v", src.items)
+	}
+	if out := outBuf.String(); !strings.Contains(out, "renamed     alpha -> alpha.migrated (source deleted)") || !strings.Contains(out, "2 key(s): 1 copied, 0 overwritten, 1 renamed, 0 skipped, 0 failed") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+
+	rootCmd.SetArgs([]string{"backend", "migrate", "--from", "test-migrate-src", "--to", "test-migrate-dst", "--conflict", "merge"})
+	if err := rootCmd.Execute(); err == nil {
+		t.Error("expected error for unknown conflict policy")
+	}
+}
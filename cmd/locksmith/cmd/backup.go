@@ -0,0 +1,319 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"github.com/bonjoski/locksmith/v2/pkg/agent"
+	"github.com/bonjoski/locksmith/v2/pkg/locksmith"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// backupPassphraseEnv is consulted for the bundle passphrase before
+// prompting, for scripted backups.
+const backupPassphraseEnv = "LOCKSMITH_BACKUP_PASSPHRASE" // #nosec G101 -- env var name, not a credential
+
+var (
+	backupRecipients     []string
+	backupRecipientsFile string
+	backupIdentities     []string
+	backupDryRun         bool
+	backupConflict       string
+)
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Create and restore encrypted backups of a vault",
+	Long: `A backup bundle is a single file holding every secret of the vault with its metadata, and the SSH
+agent's key records (~/.locksmith/ssh_keys.json). It is encrypted with age, to a passphrase
+(prompted for, or read from ` + backupPassphraseEnv + `) or to age recipients. Every secret is
+checked against a SHA-256 digest in the bundle's manifest before anything is restored.`,
+}
+
+var backupCreateCmd = &cobra.Command{
+	Use:     "create <file>",
+	Short:   "Write a backup bundle of the vault ('-' writes to standard output)",
+	Example: "  locksmith backup create ~/locksmith-$(date +%F).backup\n  locksmith backup create vault.backup --recipient age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p",
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		recipients, err := backupRecipientList(cmd)
+		if err != nil {
+			return err
+		}
+		sshKeys, err := loadSSHKeyRecordsJSON()
+		if err != nil {
+			return err
+		}
+
+		var out io.Writer = cmd.OutOrStdout()
+		path := args[0]
+		if path != "-" {
+			f, err := os.OpenFile(filepath.Clean(path), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+			if err != nil {
+				return fmt.Errorf("error creating backup file: %w", err)
+			}
+			defer f.Close()
+			out = f
+		}
+		manifest, err := ls.CreateBackup(out, locksmith.BackupOptions{Recipients: recipients, SSHKeys: sshKeys})
+		if err != nil {
+			if path != "-" {
+				_ = os.Remove(path)
+			}
+			return fmt.Errorf("error creating backup: %w", err)
+		}
+		if path != "-" {
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Backed up %d secrets and %d SSH key records to %s\n", len(manifest.Entries), manifest.SSHKeys, path)
+		}
+		return nil
+	},
+}
+
+var backupRestoreCmd = &cobra.Command{
+	Use:   "restore <file> [pattern...]",
+	Short: "Restore secrets from a backup bundle",
+	Long: `Restore the secrets of a backup bundle, or only those whose key matches one of the glob patterns
+('*' does not cross '/'). With --dry-run, the bundle's contents are listed from its manifest and
+no value is decrypted or written. The SSH key records of restored ssh/<name> keys are merged
+into ~/.locksmith/ssh_keys.json.
+
+Keys that already exist are skipped unless --conflict is overwrite (the old value is kept in
+history) or rename (the restored key gets a .restored suffix).`,
+	Example: "  locksmith backup restore vault.backup --dry-run\n  locksmith backup restore vault.backup 'db/*' 'ssh/*'\n  locksmith backup restore vault.backup --identity ~/.config/age/key.txt --conflict overwrite",
+	Args:    cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		conflict, err := locksmith.ParseConflictPolicy(backupConflict)
+		if err != nil {
+			return err
+		}
+		identities, err := backupIdentityList()
+		if err != nil {
+			return err
+		}
+		data, err := readSecretFile(cmd, args[0])
+		if err != nil {
+			return err
+		}
+		b, err := locksmith.OpenBackup(bytes.NewReader(data), identities...)
+		if err != nil {
+			return fmt.Errorf("error opening backup: %w", err)
+		}
+
+		out := cmd.OutOrStdout()
+		m := b.Manifest
+		_, _ = fmt.Fprintf(out, "Backup of vault '%s' from %s: %d secrets, %d SSH key records\n",
+			m.Vault, m.CreatedAt.Local().Format(time.RFC822), len(m.Entries), m.SSHKeys)
+		if backupDryRun {
+			_, _ = fmt.Fprintln(out, "Dry run: no secrets will be decrypted or written.")
+		}
+		results, sshKeys, err := ls.Restore(b, locksmith.RestoreOptions{
+			Patterns:          args[1:],
+			Conflict:          conflict,
+			DryRun:            backupDryRun,
+			RequireBiometrics: globalBiometricReqs,
+			Progress: func(r locksmith.RestoreResult) {
+				line := fmt.Sprintf("%-11s %s", r.Action, r.Key)
+				if r.TargetKey != r.Key {
+					line += " -> " + r.TargetKey
+				}
+				if r.Err != nil {
+					line += ": " + r.Err.Error()
+				}
+				_, _ = fmt.Fprintln(out, line)
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("error restoring backup: %w", err)
+		}
+
+		counts := make(map[locksmith.RestoreAction]int)
+		for _, r := range results {
+			counts[r.Action]++
+		}
+		merged, err := mergeSSHKeyRecords(sshKeys, results)
+		if err != nil {
+			return fmt.Errorf("error restoring SSH key records: %w", err)
+		}
+		_, _ = fmt.Fprintf(out, "\n%d key(s): %d restored, %d overwritten, %d renamed, %d skipped, %d failed; %d SSH key records merged\n",
+			len(results),
+			counts[locksmith.RestoreRestored], counts[locksmith.RestoreOverwritten], counts[locksmith.RestoreRenamed],
+			counts[locksmith.RestoreSkipped], counts[locksmith.RestoreFailed], merged)
+		if n := counts[locksmith.RestoreFailed]; n > 0 {
+			return fmt.Errorf("%d key(s) could not be restored", n)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(backupCmd)
+	backupCmd.AddCommand(backupCreateCmd)
+	backupCmd.AddCommand(backupRestoreCmd)
+	backupCreateCmd.Flags().StringArrayVar(&backupRecipients, "recipient", nil, "Encrypt to an age recipient (age1...) instead of a passphrase (repeatable)")
+	backupCreateCmd.Flags().StringVar(&backupRecipientsFile, "recipients-file", "", "Encrypt to the age recipients listed in a file")
+	backupRestoreCmd.Flags().StringArrayVar(&backupIdentities, "identity", nil, "age identity file to decrypt with instead of a passphrase (repeatable)")
+	backupRestoreCmd.Flags().BoolVar(&backupDryRun, "dry-run", false, "List the bundle's contents and what would be restored, without decrypting values")
+	backupRestoreCmd.Flags().StringVar(&backupConflict, "conflict", "skip", "What to do when a key exists: skip|overwrite|rename")
+}
+
+// backupRecipientList returns the recipients given by flags, or a passphrase
+// recipient when there are none.
+func backupRecipientList(cmd *cobra.Command) ([]age.Recipient, error) {
+	var lines []string
+	lines = append(lines, backupRecipients...)
+	if backupRecipientsFile != "" {
+		data, err := os.ReadFile(filepath.Clean(backupRecipientsFile))
+		if err != nil {
+			return nil, fmt.Errorf("error reading recipients file: %w", err)
+		}
+		lines = append(lines, string(data))
+	}
+	if len(lines) > 0 {
+		recipients, err := age.ParseRecipients(strings.NewReader(strings.Join(lines, "\n")))
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient: %w", err)
+		}
+		return recipients, nil
+	}
+
+	passphrase, err := readBackupPassphrase(true)
+	if err != nil {
+		return nil, err
+	}
+	recipient, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return []age.Recipient{recipient}, nil
+}
+
+// backupIdentityList returns the identities given by --identity, or a
+// passphrase identity when there are none.
+func backupIdentityList() ([]age.Identity, error) {
+	if len(backupIdentities) == 0 {
+		passphrase, err := readBackupPassphrase(false)
+		if err != nil {
+			return nil, err
+		}
+		identity, err := age.NewScryptIdentity(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		return []age.Identity{identity}, nil
+	}
+	var identities []age.Identity
+	for _, path := range backupIdentities {
+		f, err := os.Open(filepath.Clean(path))
+		if err != nil {
+			return nil, fmt.Errorf("error reading identity file: %w", err)
+		}
+		ids, err := age.ParseIdentities(f)
+		_ = f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid identity file %s: %w", path, err)
+		}
+		identities = append(identities, ids...)
+	}
+	return identities, nil
+}
+
+// readBackupPassphrase reads the bundle passphrase from the environment or
+// the terminal; confirm asks for it twice.
+func readBackupPassphrase(confirm bool) (string, error) {
+	if p := os.Getenv(backupPassphraseEnv); p != "" {
+		return p, nil
+	}
+	fd := int(os.Stdin.Fd()) // #nosec G115 -- file descriptors fit in int
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("no terminal available to prompt for a passphrase; set %s or use age recipients", backupPassphraseEnv)
+	}
+	_, _ = fmt.Fprint(os.Stderr, "Backup passphrase: ")
+	first, err := term.ReadPassword(fd)
+	_, _ = fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("error reading passphrase: %w", err)
+	}
+	if len(first) == 0 {
+		return "", fmt.Errorf("passphrase cannot be empty")
+	}
+	if confirm {
+		_, _ = fmt.Fprint(os.Stderr, "Confirm passphrase: ")
+		second, err := term.ReadPassword(fd)
+		_, _ = fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("error reading passphrase: %w", err)
+		}
+		if !bytes.Equal(first, second) {
+			return "", fmt.Errorf("passphrases do not match")
+		}
+	}
+	return string(first), nil
+}
+
+func loadSSHKeyRecordsJSON() (json.RawMessage, error) {
+	records, err := agent.LoadSSHKeyRecords()
+	if err != nil {
+		return nil, fmt.Errorf("error loading SSH key records: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(records)
+}
+
+// mergeSSHKeyRecords adds the bundle's record of every restored ssh/<name>
+// key to ssh_keys.json, under the name the key was restored as.
+func mergeSSHKeyRecords(data json.RawMessage, results []locksmith.RestoreResult) (int, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+	var bundled []agent.SSHKeyRecord
+	if err := json.Unmarshal(data, &bundled); err != nil {
+		return 0, err
+	}
+	restoredAs := make(map[string]string)
+	for _, r := range results {
+		if r.Action == locksmith.RestoreSkipped || r.Action == locksmith.RestoreFailed {
+			continue
+		}
+		if name, ok := strings.CutPrefix(r.Key, "ssh/"); ok {
+			restoredAs[name] = strings.TrimPrefix(r.TargetKey, "ssh/")
+		}
+	}
+
+	records, err := agent.LoadSSHKeyRecords()
+	if err != nil {
+		return 0, err
+	}
+	merged := 0
+	for _, rec := range bundled {
+		name, ok := restoredAs[rec.Name]
+		if !ok {
+			continue
+		}
+		rec.Name = name
+		replaced := false
+		for i := range records {
+			if records[i].Name == name {
+				records[i] = rec
+				replaced = true
+			}
+		}
+		if !replaced {
+			records = append(records, rec)
+		}
+		merged++
+	}
+	if merged == 0 {
+		return 0, nil
+	}
+	return merged, agent.SaveSSHKeyRecords(records)
+}
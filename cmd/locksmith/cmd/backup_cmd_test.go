@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/bonjoski/locksmith/v2/pkg/agent"
+	"github.com/bonjoski/locksmith/v2/pkg/locksmith"
+)
+
+func TestBackupCommands(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	outBuf, _ := setupTest()
+	ls.Backend = newMemBackend()
+
+	for key, value := range map[string]string{"ssh/work": "PRIVATE KEY", "db/prod": "pw"} {
+		if err := ls.PutSecret(key, locksmith.Secret{Value: []byte(value)}, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := agent.SaveSSHKeyRecords([]agent.SSHKeyRecord{{Name: "work", PublicKey: "ssh-ed25519 AAAA work"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	identityFile := filepath.Join(dir, "key.txt")
+	if err := os.WriteFile(identityFile, []byte(id.String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	bundle := filepath.Join(dir, "vault.backup")
+
+	rootCmd.SetArgs([]string{"backup", "create", bundle, "--recipient", id.Recipient().String()})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("backup create: %v", err)
+	}
+	if !strings.Contains(outBuf.String(), "Backed up 2 secrets and 1 SSH key records") {
+		t.Errorf("unexpected output: %s", outBuf.String())
+	}
+	if err := rootCmd.Execute(); err == nil {
+		t.Error("expected backup create to refuse to overwrite an existing file")
+	}
+
+	// Restore into an empty vault and an empty SSH key list.
+	ls.Backend = newMemBackend()
+	ls.Cache = &mockCache{secrets: make(map[string]locksmith.Secret)}
+	if err := agent.SaveSSHKeyRecords(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	outBuf.Reset()
+	rootCmd.SetArgs([]string{"backup", "restore", bundle, "ssh/*", "--identity", identityFile, "--dry-run"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("backup restore --dry-run: %v", err)
+	}
+	if !strings.Contains(outBuf.String(), "restored    ssh/work") || strings.Contains(outBuf.String(), "db/prod") {
+		t.Errorf("unexpected dry-run output:\n%s", outBuf.String())
+	}
+	if _, err := ls.Get("ssh/work"); err == nil {
+		t.Fatal("a dry run must not write")
+	}
+
+	backupDryRun = false
+	outBuf.Reset()
+	rootCmd.SetArgs([]string{"backup", "restore", bundle, "ssh/*", "--identity", identityFile})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("backup restore: %v", err)
+	}
+	if v, err := ls.Get("ssh/work"); err != nil || string(v) != "PRIVATE KEY" {
+		t.Errorf("ssh/work = %q, %v", v, err)
+	}
+	if _, err := ls.Get("db/prod"); err == nil {
+		t.Error("db/prod is outside the pattern and must not be restored")
+	}
+	records, err := agent.LoadSSHKeyRecords()
+	if err != nil || len(records) != 1 || records[0].Name != "work" {
+		t.Errorf("SSH key records = %+v, %v", records, err)
+	}
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bonjoski/locksmith/v2/pkg/locksmith"
+	"github.com/spf13/cobra"
+)
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Inspect and clear the encrypted disk cache",
+	Long: `Secrets read from the vault are kept in an encrypted disk cache for the TTL configured for their
+key (1h unless the 'cache' section of the config says otherwise), and never past their own expiry.
+Keys with a TTL of 'never' are not cached at all. The cache is encrypted under a random key kept in
+the vault's backend, optionally wrapped with a passphrase (cache.passphrase in the config).`,
+}
+
+var cacheLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List cached keys and their age (values are not read)",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		entries, err := ls.CacheEntries()
+		if err != nil {
+			return fmt.Errorf("error listing cache: %w", err)
+		}
+
+		out := cmd.OutOrStdout()
+		shown := 0
+		for _, e := range entries {
+			if strings.HasPrefix(e.Key, locksmith.HistoryPrefix) {
+				continue
+			}
+			if shown == 0 {
+				_, _ = fmt.Fprintf(out, "%-40s %-12s %s\n", "KEY", "AGE", "STATUS")
+			}
+			age, status := "N/A", "fresh"
+			switch {
+			case e.Err != nil:
+				status = "unreadable"
+			case e.Expired:
+				status = "stale"
+			}
+			if !e.CachedAt.IsZero() {
+				age = time.Since(e.CachedAt).Truncate(time.Second).String()
+			}
+			_, _ = fmt.Fprintf(out, "%-40s %-12s %s\n", truncate(e.Key, 40), age, status)
+			shown++
+		}
+		if shown == 0 {
+			_, _ = fmt.Fprintln(out, "The cache is empty.")
+		}
+		return nil
+	},
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:     "clear [glob]",
+	Short:   "Remove cached secrets, or those whose key matches glob",
+	Example: "  locksmith cache clear\n  locksmith cache clear 'prod/*'",
+	Args:    cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pattern := ""
+		if len(args) == 1 {
+			pattern = args[0]
+		}
+		n, err := ls.ClearCache(pattern)
+		if err != nil {
+			return fmt.Errorf("error clearing cache: %w", err)
+		}
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Removed %d cache entries\n", n)
+		return nil
+	},
+}
+
+var cacheGCCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Remove stale and unreadable cache entries",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		n, err := ls.GCCache()
+		if err != nil {
+			return fmt.Errorf("error collecting cache: %w", err)
+		}
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Removed %d stale cache entries\n", n)
+		return nil
+	},
+}
+
+var cacheRekeyCmd = &cobra.Command{
+	Use:   "rekey",
+	Short: "Replace the cache key and re-encrypt the cache and metadata index",
+	Long: `Replace the vault's cache key with a new random key, wrapped with a passphrase when the config
+sets cache.passphrase, and re-encrypt the fresh cache entries and the metadata index under it.
+Entries that cannot be read under the previous key, e.g. after a forgotten passphrase, are
+discarded and the index is rebuilt from the vault.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		result, err := ls.RekeyCache()
+		if err != nil {
+			return fmt.Errorf("error rekeying cache: %w", err)
+		}
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Replaced the cache key: %d cache entries re-encrypted, %d discarded\n", result.Kept, result.Discarded)
+		if result.IndexRebuilt {
+			_, _ = fmt.Fprintln(cmd.OutOrStdout(), "The metadata index could not be read under the previous key and was rebuilt.")
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheLsCmd)
+	cacheCmd.AddCommand(cacheClearCmd)
+	cacheCmd.AddCommand(cacheGCCmd)
+	cacheCmd.AddCommand(cacheRekeyCmd)
+}
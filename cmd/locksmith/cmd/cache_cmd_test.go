@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bonjoski/locksmith/v2/pkg/locksmith"
+)
+
+func TestCacheCommands(t *testing.T) {
+	outBuf, _ := setupTest()
+	ls.Backend = newMemBackend()
+	cache, err := locksmith.NewDiskCacheAt(make([]byte, 32), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ls.Cache = cache
+	for _, key := range []string{"prod/db", "dev/db"} {
+		if err := ls.PutSecret(key, locksmith.Secret{Value: []byte("hunter2")}, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rootCmd.SetArgs([]string{"cache", "ls"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("cache ls: %v", err)
+	}
+	out := outBuf.String()
+	if !strings.Contains(out, "dev/db") || !strings.Contains(out, "prod/db") || !strings.Contains(out, "fresh") {
+		t.Errorf("unexpected output %q", out)
+	}
+	if strings.Contains(out, "hunter2") {
+		t.Error("cache ls must not print values")
+	}
+
+	outBuf.Reset()
+	rootCmd.SetArgs([]string{"cache", "clear", "prod/*"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("cache clear: %v", err)
+	}
+	if !strings.Contains(outBuf.String(), "Removed 1 cache entries") {
+		t.Errorf("unexpected output %q", outBuf.String())
+	}
+
+	outBuf.Reset()
+	rootCmd.SetArgs([]string{"cache", "gc"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("cache gc: %v", err)
+	}
+	if !strings.Contains(outBuf.String(), "Removed 0 stale cache entries") {
+		t.Errorf("unexpected output %q", outBuf.String())
+	}
+
+	outBuf.Reset()
+	rootCmd.SetArgs([]string{"cache", "clear"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("cache clear: %v", err)
+	}
+	outBuf.Reset()
+	rootCmd.SetArgs([]string{"cache", "ls"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("cache ls: %v", err)
+	}
+	if !strings.Contains(outBuf.String(), "The cache is empty.") {
+		t.Errorf("unexpected output %q", outBuf.String())
+	}
+
+	// A cache constructed with an explicit key has no cache key to replace.
+	rootCmd.SetArgs([]string{"cache", "rekey"})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "has no cache key") {
+		t.Errorf("expected rekey to fail, got %v", err)
+	}
+}
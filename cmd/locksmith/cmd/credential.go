@@ -96,6 +96,10 @@ func findGitSingleUserSecret(host string) (*locksmith.Secret, string, string) {
 	if err != nil {
 		return nil, "", ""
 	}
+	// Aliases are not stored in the backend but resolve like keys.
+	for alias := range cfg.Aliases {
+		keys = append(keys, alias)
+	}
 	prefix := fmt.Sprintf("git/%s/", host)
 	var matchingKeys []string
 	for _, k := range keys {
@@ -239,6 +243,10 @@ func handleErase(cmd *cobra.Command, inputs map[string]string) error {
 	}
 
 	for _, k := range keysToDelete {
+		// Erasing through an alias would delete the key it points at.
+		if cfg.IsAlias(k) {
+			continue
+		}
 		// Check if it exists first
 		secret, err := ls.GetWithMetadata(k)
 		if err == nil && secret != nil {
@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/bonjoski/locksmith/v2/pkg/locksmith"
+	"github.com/bonjoski/locksmith/v2/pkg/session"
+	"github.com/spf13/cobra"
+)
+
+var (
+	daemonIdleTimeout     string
+	daemonAbsoluteTimeout string
+)
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Run the session daemon so one prompt covers a work session",
+	Long: `Run the per-user session daemon in the foreground. Once 'locksmith unlock' has opened the session,
+the daemon holds the secrets read by locksmith, git-credential-locksmith, summon-locksmith and the
+SSH agent in memory, so other processes need not authenticate again until the session is locked
+with 'locksmith lock', has been idle for the idle timeout (15m) or reaches the absolute timeout
+(8h). Timeouts come from the 'daemon' section of the config, overridden by the flags.
+
+The daemon listens on ~/.locksmith/daemon.sock (or $` + session.SocketEnv + `), which only its owner can
+connect to, and answers only processes of the same user. It is not available on Windows.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		idle, absolute, err := cfg.DaemonTimeouts()
+		if err != nil {
+			return err
+		}
+		if daemonIdleTimeout != "" {
+			if idle, err = locksmith.ParseDaemonTimeout(daemonIdleTimeout); err != nil {
+				return err
+			}
+		}
+		if daemonAbsoluteTimeout != "" {
+			if absolute, err = locksmith.ParseDaemonTimeout(daemonAbsoluteTimeout); err != nil {
+				return err
+			}
+		}
+
+		path, err := session.SocketPath()
+		if err != nil {
+			return err
+		}
+		listener, err := session.Listen(path)
+		if err != nil {
+			return fmt.Errorf("error starting daemon: %w", err)
+		}
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		go func() {
+			<-ctx.Done()
+			_ = listener.Close()
+		}()
+
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Locksmith daemon listening on %s (locked; run 'locksmith unlock')\n", path)
+		return session.NewServer(idle, absolute).Serve(listener)
+	},
+}
+
+var unlockCmd = &cobra.Command{
+	Use:   "unlock [glob...]",
+	Short: "Unlock the session daemon, preloading secrets behind one prompt",
+	Long: `Authenticate once and open a session in the running daemon. The vault's keys matching one of the
+globs, or all of them when none are given, are read up front; whatever else is read until the
+session is locked is held as well.`,
+	Example: "  locksmith unlock\n  locksmith unlock 'prod/*' --vault work",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := runningDaemon()
+		if err != nil {
+			return err
+		}
+		items, err := ls.SessionItems(args)
+		if err != nil {
+			return fmt.Errorf("error unlocking session: %w", err)
+		}
+		defer func() {
+			for _, item := range items {
+				for i := range item.Data {
+					item.Data[i] = 0
+				}
+			}
+		}()
+		if len(items) == 0 {
+			return fmt.Errorf("error unlocking session: no secrets selected")
+		}
+		if err := client.Unlock(items); err != nil {
+			return fmt.Errorf("error unlocking session: %w", err)
+		}
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Unlocked the session with %d secrets of vault '%s'\n", len(items), ls.Vault)
+		return nil
+	},
+}
+
+var lockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "Lock the session daemon, wiping the secrets it holds",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := runningDaemon()
+		if err != nil {
+			_, _ = fmt.Fprintln(cmd.OutOrStdout(), "The locksmith daemon is not running.")
+			return nil
+		}
+		if err := client.Lock(); err != nil {
+			return fmt.Errorf("error locking session: %w", err)
+		}
+		_, _ = fmt.Fprintln(cmd.OutOrStdout(), "Locked the session")
+		return nil
+	},
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show whether the session daemon is running and unlocked",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
+		client := session.Lookup()
+		if client == nil {
+			_, _ = fmt.Fprintln(out, "The locksmith daemon is not running.")
+			return nil
+		}
+		st, err := client.Status()
+		if err != nil {
+			_, _ = fmt.Fprintln(out, "The locksmith daemon is not running.")
+			return nil
+		}
+		if !st.Unlocked {
+			_, _ = fmt.Fprintf(out, "The locksmith daemon (pid %d) is locked.\n", st.PID)
+			return nil
+		}
+		_, _ = fmt.Fprintf(out, "The locksmith daemon (pid %d) is unlocked, holding %d secrets.\n", st.PID, st.Items)
+		if !st.IdleExpiresAt.IsZero() {
+			_, _ = fmt.Fprintf(out, "Locks when idle in: %s\n", time.Until(st.IdleExpiresAt).Truncate(time.Second))
+		}
+		if !st.ExpiresAt.IsZero() {
+			_, _ = fmt.Fprintf(out, "Locks at:           %s\n", st.ExpiresAt.Local().Format("2006-01-02 15:04:05"))
+		}
+		return nil
+	},
+}
+
+// runningDaemon returns a client of the user's daemon if it answers.
+func runningDaemon() (*session.Client, error) {
+	client := session.Lookup()
+	if client != nil {
+		if _, err := client.Status(); err == nil {
+			return client, nil
+		}
+	}
+	return nil, fmt.Errorf("the locksmith daemon is not running; start it with 'locksmith daemon'")
+}
+
+func init() {
+	rootCmd.AddCommand(daemonCmd)
+	rootCmd.AddCommand(unlockCmd)
+	rootCmd.AddCommand(lockCmd)
+	rootCmd.AddCommand(statusCmd)
+	daemonCmd.Flags().StringVar(&daemonIdleTimeout, "idle-timeout", "", "Lock after this long unused, e.g. 15m (0 disables)")
+	daemonCmd.Flags().StringVar(&daemonAbsoluteTimeout, "absolute-timeout", "", "Lock this long after unlocking, e.g. 8h (0 disables)")
+}
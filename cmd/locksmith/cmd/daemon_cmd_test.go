@@ -0,0 +1,80 @@
+//go:build !windows
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bonjoski/locksmith/v2/pkg/locksmith"
+	"github.com/bonjoski/locksmith/v2/pkg/session"
+)
+
+func TestSessionCommands(t *testing.T) {
+	outBuf, _ := setupTest()
+	ls.Backend = newMemBackend()
+	for _, key := range []string{"prod/db", "dev/db"} {
+		if err := ls.PutSecret(key, locksmith.Secret{Value: []byte("hunter2")}, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "lsd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "daemon.sock")
+	t.Setenv(session.SocketEnv, path)
+
+	run := func(args ...string) string {
+		t.Helper()
+		outBuf.Reset()
+		rootCmd.SetArgs(args)
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("%s: %v", args[0], err)
+		}
+		return outBuf.String()
+	}
+
+	if out := run("status"); !strings.Contains(out, "not running") {
+		t.Errorf("unexpected status %q", out)
+	}
+	rootCmd.SetArgs([]string{"unlock"})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "not running") {
+		t.Errorf("expected unlock to fail without a daemon, got %v", err)
+	}
+
+	listener, err := session.Listen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = session.NewServer(time.Hour, time.Hour).Serve(listener) }()
+	defer func() { _ = listener.Close() }()
+
+	if out := run("status"); !strings.Contains(out, "is locked") {
+		t.Errorf("unexpected status %q", out)
+	}
+	rootCmd.SetArgs([]string{"unlock", "nomatch/*"})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "no secrets match") {
+		t.Errorf("expected unlock to refuse an empty selection, got %v", err)
+	}
+	if out := run("status"); !strings.Contains(out, "is locked") {
+		t.Errorf("an empty selection must not unlock the session: %q", out)
+	}
+	if out := run("unlock", "prod/*"); !strings.Contains(out, "Unlocked the session with 1 secrets") {
+		t.Errorf("unexpected unlock output %q", out)
+	}
+	if out := run("status"); !strings.Contains(out, "unlocked, holding 1 secrets") || !strings.Contains(out, "Locks at") {
+		t.Errorf("unexpected status %q", out)
+	}
+	if out := run("lock"); !strings.Contains(out, "Locked the session") {
+		t.Errorf("unexpected lock output %q", out)
+	}
+	if out := run("status"); !strings.Contains(out, "is locked") {
+		t.Errorf("unexpected status %q", out)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/bonjoski/locksmith/v2/pkg/locksmith"
 	"github.com/spf13/cobra"
 )
 
@@ -128,6 +129,9 @@ func cacheFilePath() (string, error) {
 		return "", fmt.Errorf("could not determine boot time: %w", err)
 	}
 	name := fmt.Sprintf("locksmith_env_%d_%d", os.Getuid(), boot.Unix())
+	if ls != nil && ls.Vault != "" && ls.Vault != locksmith.DefaultVaultName {
+		name += "_" + ls.Vault
+	}
 	return filepath.Join(os.TempDir(), name), nil
 }
 
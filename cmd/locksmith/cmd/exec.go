@@ -15,7 +15,8 @@ Built-in integrations:
   - gh   (injects GH_TOKEN from locksmith://github/gh/token)
   - glab (injects GITLAB_TOKEN from locksmith://gitlab/glab/token)
 
-You can override or define integration profiles in ~/.locksmith/config.yml under "integrations".`,
+You can override or define integration profiles in ~/.locksmith/config.yml under "integrations".
+Profile values may use locksmith-file://<key> to pass a secret as a temporary file path.`,
 	Args: cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		integrationName := args[0]
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAddAndGetStructuredSecret(t *testing.T) {
+	_, _ = setupTest()
+	ls.Backend = newMemBackend()
+
+	// The password is prompted for because it is given without a value.
+	rootCmd.SetIn(strings.NewReader("hunter2\n"))
+	rootCmd.SetArgs([]string{"add", "db/prod", "--plain-field", "host=db.internal", "--plain-field", "user=app", "--field", "password"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	secret, err := ls.GetWithMetadata("db/prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields, err := secret.Fields()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fields) != 3 || fields[2].Name != "password" || fields[2].Value != "hunter2" || !fields[2].Sensitive || fields[0].Sensitive {
+		t.Errorf("unexpected fields %+v", fields)
+	}
+	if v, err := ls.ResolveRef("locksmith://db/prod#host"); err != nil || string(v) != "db.internal" {
+		t.Errorf("ResolveRef = %q, %v", v, err)
+	}
+
+	rootCmd.SetArgs([]string{"get", "db/prod", "--field", "port"})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "field not found") {
+		t.Errorf("expected missing field error, got %v", err)
+	}
+
+	addFields, addPlainFields = nil, nil
+	rootCmd.SetArgs([]string{"add", "db/dev", "value", "--field", "password=x"})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "cannot be combined") {
+		t.Errorf("expected an error mixing a value and fields, got %v", err)
+	}
+
+	addFields, addPlainFields = nil, nil
+	rootCmd.SetArgs([]string{"add", "db/dev", "--plain-field", "host"})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "expected name=value") {
+		t.Errorf("expected a --plain-field syntax error, got %v", err)
+	}
+}
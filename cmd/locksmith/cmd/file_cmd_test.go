@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bonjoski/locksmith/v2/pkg/locksmith"
+)
+
+func TestAddFileSecret(t *testing.T) {
+	_, _ = setupTest()
+	ls.Backend = newMemBackend()
+
+	path := filepath.Join(t.TempDir(), "sa.json")
+	if err := os.WriteFile(path, []byte("{\"type\":\"service_account\"}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	rootCmd.SetArgs([]string{"add", "gcp/ci", "--file", path})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("add --file: %v", err)
+	}
+
+	secret, err := ls.GetWithMetadata("gcp/ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret.Kind != locksmith.SecretKindFile || secret.Metadata[locksmith.FileNameMetadataKey] != "sa.json" {
+		t.Errorf("unexpected file secret %+v", secret)
+	}
+	if string(secret.Value) != "{\"type\":\"service_account\"}\n" {
+		t.Errorf("contents not stored verbatim: %q", secret.Value)
+	}
+
+	addFile = ""
+	rootCmd.SetArgs([]string{"add", "gcp/ci", "value", "--file", path})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "cannot be combined") {
+		t.Errorf("expected an error combining --file and a value, got %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/bonjoski/locksmith/v2/pkg/locksmith"
+)
+
+func TestGenerateCommand(t *testing.T) {
+	outBuf, _ := setupTest()
+	ls.Backend = newMemBackend()
+	cfg.Generate = map[string]locksmith.GeneratePolicy{
+		"wifi": {SecretType: locksmith.SecretTypePassword, Format: locksmith.GenerateFormatDiceware, Length: 4, Separator: "."},
+	}
+
+	rootCmd.SetArgs([]string{"generate", "app/signing-key", "--format", "hex", "--length", "16", "--print", "--tag", "prod"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	printed := strings.TrimSpace(outBuf.String())
+	if raw, err := hex.DecodeString(printed); err != nil || len(raw) != 16 {
+		t.Errorf("expected 16 hex-encoded bytes, got %q", printed)
+	}
+	secret, err := ls.GetWithMetadata("app/signing-key")
+	if err != nil || string(secret.Value) != printed || len(secret.Tags) != 1 {
+		t.Errorf("stored secret %+v does not match printed value, %v", secret, err)
+	}
+
+	// add --generate picks the policy by secret type.
+	outBuf.Reset()
+	rootCmd.SetArgs([]string{"add", "wifi/home", "--generate", "--type", "password"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("add --generate: %v", err)
+	}
+	value, err := ls.Get("wifi/home")
+	if err != nil || len(strings.Split(string(value), ".")) != 4 {
+		t.Errorf("expected a four word passphrase, got %q, %v", value, err)
+	}
+
+	rootCmd.SetArgs([]string{"add", "wifi/guest", "value", "--generate"})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "cannot be combined") {
+		t.Errorf("expected --generate with a value to fail, got %v", err)
+	}
+
+	addGenerate = false
+	rootCmd.SetArgs([]string{"generate", "x", "--policy", "missing"})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "no generate policy") {
+		t.Errorf("expected an unknown policy error, got %v", err)
+	}
+}
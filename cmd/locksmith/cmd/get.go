@@ -12,23 +12,51 @@ import (
 var (
 	jsonOutput bool
 	noNewline  bool
+	getVersion int
+	getField   string
+	getReveal  bool
 )
 
+// maskedValue replaces sensitive field values when a structured secret is
+// printed as a whole.
+const maskedValue = "********"
+
 var getCmd = &cobra.Command{
 	Use:   "get <key>",
 	Short: "Retrieve a secret",
+	Long:  "Retrieve a secret.\n\nFor structured secrets, every field is printed as name=value with sensitive values masked;\nuse --field to print a single field's value, or --reveal to print them all.\nTOTP seeds are only printed with --reveal; use 'locksmith otp' for the current code.",
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		key := args[0]
 
-		secret, err := ls.GetWithMetadata(key)
+		var secret *locksmith.Secret
+		var err error
+		if getVersion != 0 {
+			secret, err = ls.GetVersion(key, getVersion)
+		} else {
+			secret, err = ls.GetWithMetadata(key)
+		}
 		if err != nil {
 			return fmt.Errorf("error retrieving secret: %w", err)
 		}
 		defer secret.Zero()
 
+		if secret.SecretType == locksmith.SecretTypeTOTP && !secret.IsStructured() && !getReveal {
+			return fmt.Errorf("'%s' is a TOTP seed: use 'locksmith otp %s' for the current code, or --reveal to print the seed", key, key)
+		}
+
+		var value []byte
+		if getField != "" {
+			if !secret.IsStructured() {
+				return fmt.Errorf("'%s' is not a structured secret", key)
+			}
+			if value, err = secret.Field(getField); err != nil {
+				return fmt.Errorf("error retrieving secret: %w", err)
+			}
+		}
+
 		if jsonOutput {
-			return outputJSON(key, secret, cfg)
+			return outputJSON(key, secret, value, cfg)
 		}
 
 		if cfg.Notifications.ShowOnGet {
@@ -36,29 +64,70 @@ var getCmd = &cobra.Command{
 			notifier.NotifyExpiration(key, secret)
 		}
 
-		if noNewline {
-			fmt.Print(string(secret.Value))
+		if secret.IsStructured() && getField == "" {
+			fields, err := secret.Fields()
+			if err != nil {
+				return err
+			}
+			for _, f := range fields {
+				if f.Sensitive && !getReveal {
+					f.Value = maskedValue
+				}
+				fmt.Printf("%s=%s\n", f.Name, f.Value)
+			}
+			return nil
+		}
+		if getField == "" {
+			value = secret.Value
+		}
+
+		// File contents are written verbatim so 'get key > file' round-trips.
+		if noNewline || (secret.Kind == locksmith.SecretKindFile && getField == "") {
+			fmt.Print(string(value))
 		} else {
-			fmt.Println(string(secret.Value))
+			fmt.Println(string(value))
 		}
 
 		return nil
 	},
 }
 
-func outputJSON(key string, secret *locksmith.Secret, config *locksmith.Config) error {
+func outputJSON(key string, secret *locksmith.Secret, fieldValue []byte, config *locksmith.Config) error {
 	threshold, _ := config.GetExpiringThreshold()
 	status := secret.GetExpirationStatus(threshold)
 
 	output := map[string]interface{}{
 		"key":         key,
-		"value":       string(secret.Value),
 		"created_at":  secret.CreatedAt,
 		"expires_at":  secret.ExpiresAt,
 		"expires_in":  secret.TimeUntilExpiration().String(),
 		"is_expired":  secret.IsExpired(),
 		"is_expiring": status == locksmith.StatusExpiring,
 	}
+	if secret.Version > 0 {
+		output["version"] = secret.Version
+	}
+	if secret.WrittenBy != "" {
+		output["written_by"] = secret.WrittenBy
+	}
+	switch {
+	case getField != "":
+		output["field"] = getField
+		output["value"] = string(fieldValue)
+	case secret.IsStructured():
+		fields, err := secret.Fields()
+		if err != nil {
+			return err
+		}
+		for i := range fields {
+			if fields[i].Sensitive && !getReveal {
+				fields[i].Value = maskedValue
+			}
+		}
+		output["fields"] = fields
+	default:
+		output["value"] = string(secret.Value)
+	}
 
 	enc := json.NewEncoder(os.Stdout)
 	enc.SetIndent("", "  ")
@@ -69,4 +138,7 @@ func init() {
 	rootCmd.AddCommand(getCmd)
 	getCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output in JSON format")
 	getCmd.Flags().BoolVarP(&noNewline, "no-newline", "n", false, "Do not print a trailing newline")
+	getCmd.Flags().IntVar(&getVersion, "version", 0, "Retrieve a specific version from the secret's history (see 'locksmith history')")
+	getCmd.Flags().StringVar(&getField, "field", "", "Print a single field of a structured secret")
+	getCmd.Flags().BoolVar(&getReveal, "reveal", false, "Print sensitive fields and TOTP seeds")
 }
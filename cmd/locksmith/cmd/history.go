@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+var rollbackTo int
+
+var historyCmd = &cobra.Command{
+	Use:   "history <key>",
+	Short: "List the stored versions of a secret",
+	Long:  "List the current and previous versions of a secret, newest first, with who or what wrote each one. Values are not shown; use 'locksmith get <key> --version N' to read one.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key := args[0]
+		versions, err := ls.History(key)
+		if err != nil {
+			return fmt.Errorf("error reading history: %w", err)
+		}
+
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%-9s %-25s %-25s %s\n", "VERSION", "CREATED", "EXPIRES", "WRITTEN BY")
+		for i, v := range versions {
+			version := strconv.Itoa(v.Version)
+			if i == 0 {
+				version += "*"
+			}
+			writer := v.WrittenBy
+			if writer == "" {
+				writer = "N/A"
+			}
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%-9s %-25s %-25s %s\n",
+				version, formatDateTime(v.CreatedAt), formatDateTime(v.ExpiresAt), writer)
+			v.Zero()
+		}
+		return nil
+	},
+}
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback <key>",
+	Short: "Restore a previous version of a secret",
+	Long:  "Restore a previous version of a secret (the one before the current version unless --to is given). The restored value is written as a new version, so the value it replaces stays in the history.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key := args[0]
+		if rollbackTo < 0 {
+			return fmt.Errorf("--to must be a positive version number")
+		}
+		restored, err := ls.Rollback(key, rollbackTo)
+		if err != nil {
+			return fmt.Errorf("error rolling back secret: %w", err)
+		}
+		defer restored.Zero()
+
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Restored '%s' as version %d\n", key, restored.Version)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	rootCmd.AddCommand(rollbackCmd)
+	rollbackCmd.Flags().IntVar(&rollbackTo, "to", 0, "Version to restore (default: the previous version)")
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bonjoski/locksmith/v2/pkg/locksmith"
+)
+
+func TestHistoryAndRollbackCommands(t *testing.T) {
+	outBuf, _ := setupTest()
+	ls.Backend = newMemBackend()
+	ls.Options.Writer = "user:tester"
+
+	for _, v := range []string{"first", "second"} {
+		if err := ls.PutSecret("api/token", locksmith.Secret{Value: []byte(v)}, false); err != nil {
+			t.Fatalf("PutSecret: %v", err)
+		}
+	}
+
+	rootCmd.SetArgs([]string{"history", "api/token"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	out := outBuf.String()
+	if !strings.Contains(out, "WRITTEN BY") || !strings.Contains(out, "2*") || !strings.Contains(out, "user:tester") {
+		t.Errorf("unexpected history output:\n%s", out)
+	}
+	if strings.Contains(out, "first") || strings.Contains(out, "second") {
+		t.Errorf("history must not print secret values:\n%s", out)
+	}
+
+	rootCmd.SetArgs([]string{"get", "api/token", "--version", "5"})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "no version 5") {
+		t.Errorf("expected missing version error, got %v", err)
+	}
+
+	outBuf.Reset()
+	rootCmd.SetArgs([]string{"rollback", "api/token"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	if !strings.Contains(outBuf.String(), "Restored 'api/token' as version 3") {
+		t.Errorf("unexpected rollback output: %s", outBuf.String())
+	}
+	if v, _ := ls.Get("api/token"); string(v) != "first" {
+		t.Errorf("after rollback got %q, want first", v)
+	}
+
+	rollbackTo = 0
+	rootCmd.SetArgs([]string{"rollback", "api/token", "--to", "3"})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "already at version 3") {
+		t.Errorf("expected already-current error, got %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/bonjoski/locksmith/v2/pkg/locksmith"
+	"github.com/spf13/cobra"
+)
+
+var (
+	importFormat      string
+	importKeyTemplate string
+	importConflict    string
+	importDryRun      bool
+	importTags        []string
+	importType        string
+	importOwnerApp    string
+	importTTL         time.Duration
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Import secrets from a .env file, password-manager export or CSV",
+	Long: `Import secrets from a file ('-' reads standard input; set --format then).
+
+Formats (detected from the file name or contents unless --format is set):
+  env        KEY=value lines; the variable name is the key
+  bitwarden  unencrypted Bitwarden JSON export: logins (password, username, first URI) and secure notes
+  csv        CSV with a header row, as exported by KeePassXC, 1Password or Bitwarden (aliases: keepassxc,
+             1password). Recognized columns: title/name, group/folder, username, password or value, url,
+             notes, tags, and key, secret_type, owner_application, description, expires_at
+  locksmith  JSON: {"version": 1, "secrets": [{"key", "value", "secret_type", "owner_application",
+             "source_url", "tags", "description", "expires_at", "metadata"}]}
+
+Password-manager entries are stored under <folder>/<title>, slugged, with the folder added as a
+tag, the URL as source URL and the username in the metadata. --key-template replaces the key with
+a Go template over .Key, .Name, .Folder, .Username and .SecretType; slug, lower and upper are
+available as functions.
+
+Keys that already exist, or were imported earlier in the same run, are skipped unless --conflict is
+overwrite (the old value is kept in history) or rename (the import gets an .imported suffix).
+Entries without an expiry expire after --ttl; --ttl 0 means never.`,
+	Example: `  locksmith import .env --key-template 'myapp/{{.Name | lower}}' --tag myapp --dry-run
+  locksmith import bitwarden_export.json --conflict rename
+  locksmith import keepassxc.csv --key-template 'work/{{slug .Name}}/{{slug .Username}}'
+  cat secrets.json | locksmith import - --format locksmith`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := locksmith.ParseImportFormat(importFormat)
+		if err != nil {
+			return err
+		}
+		conflict, err := locksmith.ParseConflictPolicy(importConflict)
+		if err != nil {
+			return err
+		}
+		if args[0] == "-" && format == "" {
+			return fmt.Errorf("--format is required when reading standard input")
+		}
+
+		data, err := readSecretFile(cmd, args[0])
+		if err != nil {
+			return err
+		}
+		defer func() {
+			for i := range data {
+				data[i] = 0
+			}
+		}()
+		if format == "" {
+			if format, err = locksmith.DetectImportFormat(args[0], data); err != nil {
+				return err
+			}
+		}
+		entries, err := locksmith.ParseImport(bytes.NewReader(data), format)
+		if err != nil {
+			return fmt.Errorf("error reading %s file: %w", format, err)
+		}
+		defer func() {
+			for i := range entries {
+				for j := range entries[i].Value {
+					entries[i].Value[j] = 0
+				}
+			}
+		}()
+
+		out := cmd.OutOrStdout()
+		if importDryRun {
+			_, _ = fmt.Fprintln(out, "Dry run: no secrets will be written.")
+		}
+		results, err := ls.Import(entries, locksmith.ImportOptions{
+			KeyTemplate:       importKeyTemplate,
+			Conflict:          conflict,
+			DryRun:            importDryRun,
+			Tags:              importTags,
+			SecretType:        locksmith.ParseSecretType(importType),
+			OwnerApplication:  importOwnerApp,
+			TTL:               importTTL,
+			RequireBiometrics: globalBiometricReqs,
+			Progress: func(r locksmith.ImportResult) {
+				line := fmt.Sprintf("%-11s %s", r.Action, r.Name)
+				if r.Key != r.Name {
+					line += " -> " + r.Key
+				}
+				if r.Err != nil {
+					line += ": " + r.Err.Error()
+				}
+				_, _ = fmt.Fprintln(out, line)
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("error importing secrets: %w", err)
+		}
+
+		counts := make(map[locksmith.ImportAction]int)
+		for _, r := range results {
+			counts[r.Action]++
+		}
+		_, _ = fmt.Fprintf(out, "\n%d entries: %d imported, %d overwritten, %d renamed, %d skipped, %d failed\n",
+			len(results),
+			counts[locksmith.ImportCreated], counts[locksmith.ImportOverwritten], counts[locksmith.ImportRenamed],
+			counts[locksmith.ImportSkipped], counts[locksmith.ImportFailed])
+		if n := counts[locksmith.ImportFailed]; n > 0 {
+			return fmt.Errorf("%d entries could not be imported", n)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+	importCmd.Flags().StringVar(&importFormat, "format", "", "env | bitwarden | csv | keepassxc | 1password | locksmith (default: detect)")
+	importCmd.Flags().StringVar(&importKeyTemplate, "key-template", "", "Go template for each key, e.g. 'myapp/{{.Name | lower}}'")
+	importCmd.Flags().StringVar(&importConflict, "conflict", "skip", "What to do when a key exists: skip|overwrite|rename")
+	importCmd.Flags().BoolVar(&importDryRun, "dry-run", false, "Show what would be imported without writing anything")
+	importCmd.Flags().StringSliceVar(&importTags, "tag", nil, "Tag every imported secret (repeatable or comma-separated)")
+	importCmd.Flags().StringVar(&importType, "type", "", "Secret type for entries that do not set one: password|api_key|oauth_token|token")
+	importCmd.Flags().StringVar(&importOwnerApp, "owner-app", "", "Owner application for entries that do not set one")
+	importCmd.Flags().DurationVar(&importTTL, "ttl", defaultAddTTL, "Expiry for entries without one (0: never expire)")
+}
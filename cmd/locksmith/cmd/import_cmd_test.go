@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestImportCommand(t *testing.T) {
+	outBuf, _ := setupTest()
+	ls.Backend = newMemBackend()
+
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("# app settings\nexport DB_PASSWORD=hunter2\nAPI_TOKEN='abc'\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	rootCmd.SetArgs([]string{"import", envFile, "--key-template", "myapp/{{.Name | lower}}", "--dry-run"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("import --dry-run: %v", err)
+	}
+	if !strings.Contains(outBuf.String(), "imported    DB_PASSWORD -> myapp/db_password") {
+		t.Errorf("unexpected dry-run output:\n%s", outBuf.String())
+	}
+	if _, err := ls.Get("myapp/db_password"); err == nil {
+		t.Fatal("a dry run must not write")
+	}
+
+	outBuf.Reset()
+	importDryRun = false
+	rootCmd.SetArgs([]string{"import", envFile, "--key-template", "myapp/{{.Name | lower}}", "--tag", "myapp", "--type", "api_key"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	secret, err := ls.GetWithMetadata("myapp/api_token")
+	if err != nil || string(secret.Value) != "abc" || string(secret.SecretType) != "api_key" ||
+		len(secret.Tags) != 1 || secret.ExpiresAt.IsZero() {
+		t.Errorf("unexpected imported secret %+v, %v", secret, err)
+	}
+
+	// Running it again skips existing keys.
+	outBuf.Reset()
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("second import: %v", err)
+	}
+	if !strings.Contains(outBuf.String(), "2 entries: 0 imported, 0 overwritten, 0 renamed, 2 skipped, 0 failed") {
+		t.Errorf("expected both entries to be skipped:\n%s", outBuf.String())
+	}
+
+	rootCmd.SetArgs([]string{"import", "-"})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "--format is required") {
+		t.Errorf("expected standard input without --format to fail, got %v", err)
+	}
+}
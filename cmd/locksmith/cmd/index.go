@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var indexCmd = &cobra.Command{
+	Use:   "index",
+	Short: "Manage the encrypted metadata index",
+	Long: `Each vault keeps an encrypted, authenticated index of the metadata (never the values) of its
+secrets. It is updated on every write, delete and rotation, so 'locksmith list --details', expiry
+status and rotation scans are accurate without reading, and authenticating for, each secret.`,
+}
+
+var indexRebuildCmd = &cobra.Command{
+	Use:   "rebuild",
+	Short: "Recreate the metadata index from the vault",
+	Long:  "Recreate the metadata index from the vault, e.g. after it was reported corrupt or secrets were written by other tools. Keys whose metadata the backend cannot list are read, with a single authentication prompt.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		n, err := ls.RebuildIndex()
+		if err != nil {
+			return fmt.Errorf("error rebuilding index: %w", err)
+		}
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Rebuilt the metadata index (%d secrets)\n", n)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(indexCmd)
+	indexCmd.AddCommand(indexRebuildCmd)
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bonjoski/locksmith/v2/pkg/locksmith"
+)
+
+func TestIndexRebuildCommand(t *testing.T) {
+	outBuf, _ := setupTest()
+	ls.Backend = newMemBackend()
+
+	rootCmd.SetArgs([]string{"index", "rebuild"})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "no metadata index") {
+		t.Errorf("expected an error without an index, got %v", err)
+	}
+
+	index, err := locksmith.NewMetadataIndex(bytes.Repeat([]byte{1}, 32), filepath.Join(t.TempDir(), locksmith.IndexFileName), ls.Service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ls.Index = index
+	for _, key := range []string{"a", "b"} {
+		if err := ls.PutSecret(key, locksmith.Secret{Value: []byte("v")}, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := index.Replace(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	outBuf.Reset()
+	rootCmd.SetArgs([]string{"index", "rebuild"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("index rebuild: %v", err)
+	}
+	if !strings.Contains(outBuf.String(), "(2 secrets)") {
+		t.Errorf("unexpected output %q", outBuf.String())
+	}
+	if entries, err := index.Load(); err != nil || len(entries) != 2 {
+		t.Errorf("index has %d entries, %v", len(entries), err)
+	}
+}
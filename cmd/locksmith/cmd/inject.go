@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	injectInput  string
+	injectOutput string
+	injectFIFO   bool
+)
+
+var injectCmd = &cobra.Command{
+	Use:   "inject -i <template> [-o <output>]",
+	Short: "Render a template with secrets",
+	Long: `Render a Go template, replacing secret references with their values.
+
+Template functions:
+  {{ secret "db/password" }}              a secret (locksmith:// references work too)
+  {{ secret "db/prod" "user" }}           a field of a structured secret
+  {{ secret "db/prod#user" }}             the same
+  {{ meta "db/password" "expires_at" }}   metadata: created_at, expires_at, type, owner,
+                                          source_url, version, written_by, description,
+                                          tags or a custom metadata key
+  base64, base64decode, json, shell, trim quoting and encoding helpers, e.g.
+  {{ secret "npm/token" | json }}
+
+All references are resolved before anything is written, with one authentication
+prompt per vault. Output goes to stdout unless -o is given; files are written with
+mode 0600. With --fifo, -o is created as a named pipe that serves the rendered
+output to a single reader and is removed afterwards.`,
+	Example: "  locksmith inject -i application.yml.tmpl -o application.yml\n" +
+		"  locksmith inject -i .npmrc.tmpl -o ~/.npmrc\n" +
+		"  locksmith inject -i compose.override.tmpl -o /tmp/compose.yml --fifo &\n" +
+		"  docker compose -f compose.yml -f /tmp/compose.yml up",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if injectInput == "" {
+			return fmt.Errorf("a template is required (-i <file>, or -i - for stdin)")
+		}
+		if injectFIFO && injectOutput == "" {
+			return fmt.Errorf("--fifo requires -o <path>")
+		}
+
+		var text []byte
+		var err error
+		if injectInput == "-" {
+			text, err = io.ReadAll(cmd.InOrStdin())
+		} else {
+			text, err = os.ReadFile(injectInput) // #nosec G304 -- user-supplied template path is intentional
+		}
+		if err != nil {
+			return fmt.Errorf("error reading template: %w", err)
+		}
+
+		rendered, err := ls.RenderTemplate(filepath.Base(injectInput), string(text))
+		if err != nil {
+			return fmt.Errorf("error rendering template: %w", err)
+		}
+		defer func() {
+			for i := range rendered {
+				rendered[i] = 0
+			}
+		}()
+
+		switch {
+		case injectFIFO:
+			return writeFIFO(injectOutput, rendered)
+		case injectOutput != "":
+			return writePrivateFile(injectOutput, rendered)
+		default:
+			_, err := cmd.OutOrStdout().Write(rendered)
+			return err
+		}
+	},
+}
+
+// writePrivateFile replaces path with data, readable only by the owner. The
+// data is written to a temporary file in the same directory and renamed, so
+// readers never see a partial file and an existing file's mode is not kept.
+func writePrivateFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("error writing output: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if err := tmp.Chmod(0600); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("error writing output: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("error writing output: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing output: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error writing output: %w", err)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(injectCmd)
+	injectCmd.Flags().StringVarP(&injectInput, "input", "i", "", "Template file ('-' reads standard input)")
+	injectCmd.Flags().StringVarP(&injectOutput, "output", "o", "", "Output file (default: stdout)")
+	injectCmd.Flags().BoolVar(&injectFIFO, "fifo", false, "Serve the output through a named pipe at -o that is removed after one read")
+}
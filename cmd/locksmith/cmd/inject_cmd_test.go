@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bonjoski/locksmith/v2/pkg/locksmith"
+)
+
+func TestInjectCommand(t *testing.T) {
+	outBuf, _ := setupTest()
+	ls.Backend = newMemBackend()
+	_ = ls.PutSecret("npm/token", locksmith.Secret{Value: []byte("tok")}, false)
+
+	dir := t.TempDir()
+	tmpl := filepath.Join(dir, "npmrc.tmpl")
+	if err := os.WriteFile(tmpl, []byte(`//registry.npmjs.org/:_authToken={{ secret "npm/token" }}`+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rootCmd.SetArgs([]string{"inject", "-i", tmpl})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("inject: %v", err)
+	}
+	if outBuf.String() != "//registry.npmjs.org/:_authToken=tok\n" {
+		t.Errorf("unexpected stdout %q", outBuf.String())
+	}
+
+	out := filepath.Join(dir, ".npmrc")
+	if err := os.WriteFile(out, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rootCmd.SetArgs([]string{"inject", "-i", tmpl, "-o", out})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("inject -o: %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil || !strings.Contains(string(data), "_authToken=tok") {
+		t.Fatalf("output = %q, %v", data, err)
+	}
+	if info, _ := os.Stat(out); runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("output mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	injectOutput = ""
+	missing := filepath.Join(dir, "bad.tmpl")
+	_ = os.WriteFile(missing, []byte(`{{ secret "nope" }}`), 0644)
+	rootCmd.SetArgs([]string{"inject", "-i", missing, "-o", filepath.Join(dir, "never")})
+	if err := rootCmd.Execute(); err == nil {
+		t.Error("expected an error for a missing secret")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "never")); !os.IsNotExist(err) {
+		t.Error("no output should be written when rendering fails")
+	}
+}
+
+func TestInjectFIFO(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("named pipes are not supported on Windows")
+	}
+	_, _ = setupTest()
+	ls.Backend = newMemBackend()
+	_ = ls.PutSecret("api/key", locksmith.Secret{Value: []byte("k")}, false)
+
+	dir := t.TempDir()
+	tmpl := filepath.Join(dir, "t")
+	_ = os.WriteFile(tmpl, []byte(`key={{ secret "api/key" }}`), 0644)
+	fifo := filepath.Join(dir, "out")
+
+	done := make(chan error, 1)
+	go func() {
+		rootCmd.SetArgs([]string{"inject", "-i", tmpl, "-o", fifo, "--fifo"})
+		done <- rootCmd.Execute()
+	}()
+
+	var data []byte
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if info, err := os.Stat(fifo); err == nil && info.Mode()&os.ModeNamedPipe != 0 {
+			data, _ = os.ReadFile(fifo)
+			break
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("inject --fifo: %v", err)
+	}
+	if string(data) != "key=k" {
+		t.Errorf("read %q from fifo", data)
+	}
+	if _, err := os.Stat(fifo); !os.IsNotExist(err) {
+		t.Error("fifo should be removed after it is read")
+	}
+}
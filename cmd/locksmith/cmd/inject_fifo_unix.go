@@ -0,0 +1,29 @@
+//go:build !windows
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// writeFIFO creates a named pipe at path, blocks until one reader has
+// consumed data, and removes the pipe.
+func writeFIFO(path string, data []byte) error {
+	if err := syscall.Mkfifo(path, 0600); err != nil {
+		return fmt.Errorf("error creating fifo: %w", err)
+	}
+	defer func() { _ = os.Remove(path) }()
+
+	// Opening for writing blocks until a reader opens the pipe.
+	f, err := os.OpenFile(path, os.O_WRONLY, 0) // #nosec G304 -- pipe created above
+	if err != nil {
+		return fmt.Errorf("error opening fifo: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("error writing fifo: %w", err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,9 @@
+//go:build windows
+
+package cmd
+
+import "fmt"
+
+func writeFIFO(path string, data []byte) error {
+	return fmt.Errorf("--fifo is not supported on Windows")
+}
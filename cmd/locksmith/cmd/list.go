@@ -11,13 +11,19 @@ import (
 )
 
 var listDetails bool
+var listFilter string
 
 var listCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List stored keys (or full metadata with --details)",
-	Long:  "List stored secrets. By default this shows a concise table. Use --details to show full metadata for each secret, including secret type, owner app, source URL, and metadata map. Detailed metadata is returned from listing/cache paths and does not perform per-key secret reads.",
+	Long:  "List stored secrets. By default this shows a concise table. Use --details to show full metadata for each secret, including secret type, owner app, source URL, tags, description, and metadata map. Detailed metadata comes from the cache, backend item attributes or the vault's encrypted metadata index (see 'locksmith index') and does not perform per-key secret reads. Use --filter with a search query (see 'locksmith search --help') to narrow the list.",
 	Args:  cobra.NoArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		query, err := locksmith.ParseQuery(listFilter)
+		if err != nil {
+			return fmt.Errorf("invalid filter: %w", err)
+		}
+
 		items, err := ls.ListWithMetadata()
 		if err != nil {
 			return fmt.Errorf("error listing secrets: %w", err)
@@ -27,95 +33,116 @@ var listCmd = &cobra.Command{
 			_, _ = fmt.Fprintln(cmd.OutOrStdout(), "No secrets stored.")
 			return nil
 		}
-
-		threshold, _ := cfg.GetExpiringThreshold()
-		keys := make([]string, 0, len(items))
-		for key := range items {
-			keys = append(keys, key)
+		if !query.Empty() {
+			items = query.Filter(items)
+			if len(items) == 0 {
+				_, _ = fmt.Fprintln(cmd.OutOrStdout(), "No secrets match the filter.")
+				return nil
+			}
 		}
-		sort.Strings(keys)
 
-		if listDetails {
-			for i, key := range keys {
-				metadata := items[key]
-				if i > 0 {
-					_, _ = fmt.Fprintln(cmd.OutOrStdout())
-				}
+		printSecretList(cmd, items, listDetails)
+		return nil
+	},
+}
 
-				status := "unknown"
-				if !metadata.ExpiresAt.IsZero() {
-					switch metadata.GetExpirationStatus(threshold) {
-					case locksmith.StatusExpired:
-						status = "expired"
-					case locksmith.StatusExpiring:
-						status = "expiring"
-					default:
-						status = "valid"
-					}
-				}
+// printSecretList renders items as the list table, or as one block per
+// secret when details is set.
+func printSecretList(cmd *cobra.Command, items map[string]*locksmith.SecretMetadata, details bool) {
+	threshold, _ := cfg.GetExpiringThreshold()
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
 
-				secretTypeVal := string(metadata.SecretType)
-				if secretTypeVal == "" {
-					secretTypeVal = "N/A"
-				}
+	if details {
+		for i, key := range keys {
+			metadata := items[key]
+			if i > 0 {
+				_, _ = fmt.Fprintln(cmd.OutOrStdout())
+			}
 
-				ownerAppVal := metadata.OwnerApplication
-				if ownerAppVal == "" {
-					ownerAppVal = "N/A"
+			status := "unknown"
+			if !metadata.ExpiresAt.IsZero() {
+				switch metadata.GetExpirationStatus(threshold) {
+				case locksmith.StatusExpired:
+					status = "expired"
+				case locksmith.StatusExpiring:
+					status = "expiring"
+				default:
+					status = "valid"
 				}
+			}
 
-				sourceURLVal := metadata.SourceURL
-				if sourceURLVal == "" {
-					sourceURLVal = "N/A"
-				}
+			secretTypeVal := string(metadata.SecretType)
+			if secretTypeVal == "" {
+				secretTypeVal = "N/A"
+			}
 
-				_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Key:        %s\n", key)
-				_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Status:     %s\n", status)
-				_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Created:    %s\n", formatDateTime(metadata.CreatedAt))
-				_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Expires:    %s\n", formatDateTime(metadata.ExpiresAt))
-				_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Type:       %s\n", secretTypeVal)
-				_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Owner App:  %s\n", ownerAppVal)
-				_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Source URL: %s\n", sourceURLVal)
-				_, _ = fmt.Fprintln(cmd.OutOrStdout(), "Metadata:")
-
-				if len(metadata.Metadata) == 0 {
-					_, _ = fmt.Fprintln(cmd.OutOrStdout(), "  (none)")
-					continue
-				}
+			ownerAppVal := metadata.OwnerApplication
+			if ownerAppVal == "" {
+				ownerAppVal = "N/A"
+			}
 
-				metaKeys := make([]string, 0, len(metadata.Metadata))
-				for mk := range metadata.Metadata {
-					metaKeys = append(metaKeys, mk)
-				}
-				sort.Strings(metaKeys)
-				for _, mk := range metaKeys {
-					_, _ = fmt.Fprintf(cmd.OutOrStdout(), "  %s: %s\n", mk, formatMetadataValue(mk, metadata.Metadata[mk]))
-				}
+			sourceURLVal := metadata.SourceURL
+			if sourceURLVal == "" {
+				sourceURLVal = "N/A"
 			}
-			return nil
-		}
 
-		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%-30s %-20s %-20s %-12s\n", "KEY", "CREATED", "EXPIRES", "STATUS")
-		_, _ = fmt.Fprintln(cmd.OutOrStdout(), strings.Repeat("-", 84))
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Key:        %s\n", key)
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Status:     %s\n", status)
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Created:    %s\n", formatDateTime(metadata.CreatedAt))
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Expires:    %s\n", formatDateTime(metadata.ExpiresAt))
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Type:       %s\n", secretTypeVal)
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Owner App:  %s\n", ownerAppVal)
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Source URL: %s\n", sourceURLVal)
+			if len(metadata.Tags) > 0 {
+				_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Tags:       %s\n", strings.Join(metadata.Tags, ", "))
+			}
+			if metadata.Kind == locksmith.SecretKindFields {
+				_, _ = fmt.Fprintln(cmd.OutOrStdout(), "Kind:       structured (fields)")
+			}
+			if metadata.Description != "" {
+				_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Desc:       %s\n", formatMetadataValue("description", metadata.Description))
+			}
+			_, _ = fmt.Fprintln(cmd.OutOrStdout(), "Metadata:")
 
-		for _, key := range keys {
-			metadata := items[key]
-			if metadata.ExpiresAt.IsZero() {
-				_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%-30s %-20s %-20s %-12s\n",
-					truncate(key, 30), "N/A", "N/A", "Unknown")
+			if len(metadata.Metadata) == 0 {
+				_, _ = fmt.Fprintln(cmd.OutOrStdout(), "  (none)")
 				continue
 			}
 
-			status := getStatusDisplay(metadata, threshold, cfg.Notifications.ShowOnList)
-			expiresStr := metadata.ExpiresAt.Format("2006-01-02")
-			createdStr := metadata.CreatedAt.Format("2006-01-02")
+			metaKeys := make([]string, 0, len(metadata.Metadata))
+			for mk := range metadata.Metadata {
+				metaKeys = append(metaKeys, mk)
+			}
+			sort.Strings(metaKeys)
+			for _, mk := range metaKeys {
+				_, _ = fmt.Fprintf(cmd.OutOrStdout(), "  %s: %s\n", mk, formatMetadataValue(mk, metadata.Metadata[mk]))
+			}
+		}
+		return
+	}
+
+	_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%-30s %-20s %-20s %-12s\n", "KEY", "CREATED", "EXPIRES", "STATUS")
+	_, _ = fmt.Fprintln(cmd.OutOrStdout(), strings.Repeat("-", 84))
 
-			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%-30s %-20s %-20s %s\n",
-				truncate(key, 30), createdStr, expiresStr, status)
+	for _, key := range keys {
+		metadata := items[key]
+		if metadata.ExpiresAt.IsZero() {
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%-30s %-20s %-20s %-12s\n",
+				truncate(key, 30), "N/A", "N/A", "Unknown")
+			continue
 		}
 
-		return nil
-	},
+		status := getStatusDisplay(metadata, threshold, cfg.Notifications.ShowOnList)
+		expiresStr := metadata.ExpiresAt.Format("2006-01-02")
+		createdStr := metadata.CreatedAt.Format("2006-01-02")
+
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%-30s %-20s %-20s %s\n",
+			truncate(key, 30), createdStr, expiresStr, status)
+	}
 }
 
 func getStatusDisplay(metadata *locksmith.SecretMetadata, threshold time.Duration, showStatus bool) string {
@@ -185,4 +212,5 @@ func isSensitiveMetadataKey(key string) bool {
 func init() {
 	rootCmd.AddCommand(listCmd)
 	listCmd.Flags().BoolVar(&listDetails, "details", false, "Show full metadata for each secret in detailed view")
+	listCmd.Flags().StringVar(&listFilter, "filter", "", "Only list secrets matching a search query, e.g. 'tag:prod owner:github'")
 }
@@ -21,6 +21,8 @@ Biometric authentication is strictly enforced for all tool calls.`,
 			RequireBiometrics: true,
 			PromptMessage:     "AI is requesting access to '%s'. Touch ID to permit.",
 			BypassCache:       true,
+			Backend:           globalBackend,
+			Vault:             globalVault,
 		}
 		lsMcp, err := locksmith.NewWithOptions(opts)
 		if err != nil {
@@ -55,11 +57,38 @@ func newMCPServer(lsMcp *locksmith.Locksmith) *mcp.Server {
 		Name:        "locksmith_get_secret",
 		Description: "Retrieve a secret by its name. Requires biometric authentication.",
 	}, func(ctx context.Context, req *mcp.CallToolRequest, in GetSecretInput) (*mcp.CallToolResult, any, error) {
-		val, err := lsMcp.Get(in.Name)
+		secret, err := lsMcp.GetWithMetadata(in.Name)
 		if err != nil {
 			return nil, nil, err
 		}
-		return nil, string(val), nil
+		defer secret.Zero()
+		// Never hand a TOTP seed to an assistant; it can ask for a code.
+		if secret.SecretType == locksmith.SecretTypeTOTP {
+			return nil, nil, fmt.Errorf("'%s' is a TOTP seed; use locksmith_get_otp for the current code", in.Name)
+		}
+		if secret.IsStructured() {
+			return nil, nil, fmt.Errorf("'%s' is a structured secret and cannot be returned as a single value", in.Name)
+		}
+		return nil, string(secret.Value), nil
+	})
+
+	// locksmith_get_otp
+	type GetOTPInput struct {
+		Name string `json:"name" jsonschema:"The name of the TOTP secret"`
+	}
+	type GetOTPOutput struct {
+		Code             string `json:"code"`
+		SecondsRemaining int    `json:"seconds_remaining"`
+	}
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "locksmith_get_otp",
+		Description: "Generate the current one-time code of a TOTP secret. The seed is never returned. Requires biometric authentication.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, in GetOTPInput) (*mcp.CallToolResult, GetOTPOutput, error) {
+		code, remaining, err := lsMcp.OTP(in.Name)
+		if err != nil {
+			return nil, GetOTPOutput{}, err
+		}
+		return nil, GetOTPOutput{Code: code, SecondsRemaining: int(remaining.Seconds())}, nil
 	})
 
 	// locksmith_list_secrets
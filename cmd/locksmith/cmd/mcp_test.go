@@ -28,6 +28,12 @@ func TestMCPServer(t *testing.T) {
 		ExpiresAt: time.Now().Add(time.Hour),
 	}
 
+	mc.secrets["github/2fa"] = locksmith.Secret{
+		Value:      []byte("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"),
+		SecretType: locksmith.SecretTypeTOTP,
+		CreatedAt:  time.Now(),
+	}
+
 	// 2. Initialize MCP Server and Client
 	server := newMCPServer(lsTest)
 	clientTransport, serverTransport := mcp.NewInMemoryTransports()
@@ -63,6 +69,38 @@ func TestMCPServer(t *testing.T) {
 		}
 	})
 
+	// 4. Test Tool: locksmith_get_otp, and that seeds are withheld
+	t.Run("get_otp", func(t *testing.T) {
+		res, err := session.CallTool(ctx, &mcp.CallToolParams{
+			Name:      "locksmith_get_otp",
+			Arguments: map[string]string{"name": "github/2fa"},
+		})
+		if err != nil || res.IsError {
+			t.Fatalf("CallTool failed: %v %+v", err, res)
+		}
+		var out struct {
+			Code             string `json:"code"`
+			SecondsRemaining int    `json:"seconds_remaining"`
+		}
+		if err := json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &out); err != nil {
+			t.Fatal(err)
+		}
+		if len(out.Code) != 6 || out.SecondsRemaining < 1 || out.SecondsRemaining > 30 {
+			t.Errorf("unexpected OTP output %+v", out)
+		}
+
+		res, err = session.CallTool(ctx, &mcp.CallToolParams{
+			Name:      "locksmith_get_secret",
+			Arguments: map[string]string{"name": "github/2fa"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.IsError {
+			t.Errorf("get_secret must not return a TOTP seed: %+v", res.Content)
+		}
+	})
+
 	// 5. Test Tool: locksmith_list_secrets
 	t.Run("list_secrets", func(t *testing.T) {
 		testListSecrets(t, ctx, session)
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var otpCodeOnly bool
+
+var otpCmd = &cobra.Command{
+	Use:   "otp <key>",
+	Short: "Print the current TOTP code of a secret",
+	Long: `Print the current RFC 6238 code of a TOTP secret and how long it stays valid.
+
+Store the seed with 'locksmith add <key> <otpauth:// URI or base32 seed> --type totp'.
+A field of a structured secret can be used too: 'locksmith otp <key>#<field>'.
+The seed itself is only printed by 'locksmith get <key> --reveal'.`,
+	Example: "  locksmith otp aws/root/2fa\n  locksmith otp aws/root/2fa --code-only | pbcopy",
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		code, remaining, err := ls.OTP(args[0])
+		if err != nil {
+			return fmt.Errorf("error generating code: %w", err)
+		}
+		if otpCodeOnly {
+			_, _ = fmt.Fprintln(cmd.OutOrStdout(), code)
+			return nil
+		}
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%s (%ds remaining)\n", code, remaining/time.Second)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(otpCmd)
+	otpCmd.Flags().BoolVar(&otpCodeOnly, "code-only", false, "Print only the code")
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestOTPCommand(t *testing.T) {
+	outBuf, _ := setupTest()
+	ls.Backend = newMemBackend()
+
+	rootCmd.SetArgs([]string{"add", "github/2fa", "otpauth://totp/GitHub:alice?secret=JBSWY3DPEHPK3PXP&issuer=GitHub", "--type", "totp"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	outBuf.Reset()
+	rootCmd.SetArgs([]string{"otp", "github/2fa"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("otp: %v", err)
+	}
+	if !regexp.MustCompile(`^\d{6} \(\d+s remaining\)\n$`).MatchString(outBuf.String()) {
+		t.Errorf("unexpected otp output %q", outBuf.String())
+	}
+
+	outBuf.Reset()
+	rootCmd.SetArgs([]string{"otp", "github/2fa", "--code-only"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("otp --code-only: %v", err)
+	}
+	if !regexp.MustCompile(`^\d{6}\n$`).MatchString(outBuf.String()) {
+		t.Errorf("unexpected --code-only output %q", outBuf.String())
+	}
+
+	outBuf.Reset()
+	otpCodeOnly = false
+	rootCmd.SetArgs([]string{"get", "github/2fa"})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "--reveal") {
+		t.Errorf("expected get to refuse the seed, got %v", err)
+	}
+	if strings.Contains(outBuf.String(), "JBSWY3DPEHPK3PXP") {
+		t.Error("seed printed without --reveal")
+	}
+
+	// get prints to os.Stdout; only check that --reveal is accepted.
+	rootCmd.SetArgs([]string{"get", "github/2fa", "--reveal"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("get --reveal: %v", err)
+	}
+
+	getReveal = false
+	rootCmd.SetArgs([]string{"add", "bad/2fa", "123456", "--type", "totp"})
+	if err := rootCmd.Execute(); err == nil {
+		t.Error("expected an invalid seed to be rejected")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/bonjoski/locksmith/v2/pkg/locksmith"
 	"github.com/spf13/cobra"
@@ -13,6 +14,8 @@ var (
 	ls                  *locksmith.Locksmith
 	cfg                 *locksmith.Config
 	globalBiometricReqs bool
+	globalBackend       string
+	globalVault         string
 )
 
 var rootCmd = &cobra.Command{
@@ -29,15 +32,20 @@ var rootCmd = &cobra.Command{
 			}
 		}
 
-		globalBiometricReqs = cfg.Auth.RequireBiometrics
+		vault, err := locksmith.ResolveVault(cfg, globalVault)
+		if err != nil {
+			return err
+		}
+		globalBiometricReqs = vault.Auth.RequireBiometrics
 
 		// Initialize Locksmith
 		if ls == nil {
 			opts := locksmith.Options{
 				RequireBiometrics: true, // EXE always requires biometrics
-				PromptMessage:     cfg.Auth.PromptMessage,
+				PromptMessage:     vault.Auth.PromptMessage,
+				Backend:           globalBackend,
+				Vault:             vault.Name,
 			}
-			var err error
 			ls, err = locksmith.NewWithOptions(opts)
 			if err != nil {
 				return fmt.Errorf("error initializing locksmith: %w", err)
@@ -46,7 +54,7 @@ var rootCmd = &cobra.Command{
 		} else {
 			// Apply config to injected test double
 			ls.Options.RequireBiometrics = globalBiometricReqs
-			ls.Options.PromptMessage = cfg.Auth.PromptMessage
+			ls.Options.PromptMessage = vault.Auth.PromptMessage
 			ls.Config = cfg
 		}
 
@@ -74,4 +82,7 @@ func Execute(v string) {
 }
 
 func init() {
+	rootCmd.PersistentFlags().StringVar(&globalVault, "vault", "", "Named vault to use (overrides "+locksmith.VaultEnv+" and default_vault)")
+	rootCmd.PersistentFlags().StringVar(&globalBackend, "backend", "",
+		"Secret storage backend, overriding config and "+locksmith.BackendEnv+": "+strings.Join(append([]string{locksmith.BackendAuto}, locksmith.Backends.Names()...), "|"))
 }
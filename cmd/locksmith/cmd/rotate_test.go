@@ -4,7 +4,6 @@ package cmd
 
 import (
 	"encoding/json"
-	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -25,9 +24,10 @@ func (m *mockRotateCLIBackend) Set(service, account string, data []byte, require
 func (m *mockRotateCLIBackend) Get(service, account string, useBiometrics bool, prompt string) ([]byte, error) {
 	data, ok := m.secrets[account]
 	if !ok {
-		return nil, fmt.Errorf("secret not found")
+		return nil, locksmith.ErrNotFound
 	}
-	return data, nil
+	// Callers zero what they read, as with the native backends.
+	return append([]byte(nil), data...), nil
 }
 
 func (m *mockRotateCLIBackend) Delete(service, account string, useBiometrics bool, prompt string) error {
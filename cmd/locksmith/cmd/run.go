@@ -19,7 +19,11 @@ Supported formats:
   - Environment variables prefixed with LOCKSMITH_SECRET_:
     e.g. LOCKSMITH_SECRET_DB_PASSWORD=db/password resolves to DB_PASSWORD=<value>
   - Environment variables whose value starts with locksmith://:
-    e.g. DATABASE_URL=locksmith://db/password resolves to DATABASE_URL=<value>`,
+    e.g. DATABASE_URL=locksmith://db/password resolves to DATABASE_URL=<value>
+  - Environment variables whose value starts with locksmith-file://:
+    e.g. KUBECONFIG=locksmith-file://k8s/prod writes the secret to a private 0600 file
+    (under $XDG_RUNTIME_DIR when set) and sets KUBECONFIG to its path. The file is
+    overwritten and removed when the command exits.`,
 	Args: cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Run command using global locksmith instance (ls)
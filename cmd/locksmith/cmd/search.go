@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var searchDetails bool
+
+var searchCmd = &cobra.Command{
+	Use:   "search <query>...",
+	Short: "Find secrets by tag, owner, type, key or expiry",
+	Long: `Find secrets whose metadata matches a query. Terms are separated by
+spaces and must all match; a leading '-' negates a term.
+
+  tag:prod            has the tag (globs allowed: tag:team-*)
+  owner:github        owner application
+  type:oauth_token    secret type
+  key:aws/*           key name (glob; '*' does not cross '/')
+  writer:rotator:*    who wrote the current version
+  meta.env:prod       metadata value
+  source:gitlab.com   source URL contains the text
+  desc:"deploy key"   description contains the text
+  expires<14d         expires within 14 days or has expired (also >, <=, >=)
+  created>90d         created more than 90 days ago
+  aws                 key or description contains the text
+
+Quote terms containing '<' or '>' for the shell, or write expires:<14d.
+Like 'list', search reads only listing metadata, not secret values.`,
+	Example: "  locksmith search tag:prod owner:github 'expires<14d' type:oauth_token\n  locksmith search key:aws/* -tag:dev",
+	Args:    cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Re-quote arguments the shell already unquoted so that
+		// desc:"deploy key" stays a single term.
+		terms := make([]string, len(args))
+		for i, a := range args {
+			if strings.ContainsAny(a, " \t") {
+				a = `"` + a + `"`
+			}
+			terms[i] = a
+		}
+		items, err := ls.Search(strings.Join(terms, " "))
+		if err != nil {
+			return fmt.Errorf("error searching secrets: %w", err)
+		}
+		if len(items) == 0 {
+			_, _ = fmt.Fprintln(cmd.OutOrStdout(), "No secrets match the query.")
+			return nil
+		}
+		printSecretList(cmd, items, searchDetails)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(searchCmd)
+	searchCmd.Flags().BoolVar(&searchDetails, "details", false, "Show full metadata for each match")
+}
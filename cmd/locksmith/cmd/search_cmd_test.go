@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTagAndSearchCommands(t *testing.T) {
+	outBuf, _ := setupTest()
+	ls.Backend = newMemBackend()
+
+	for _, args := range [][]string{
+		{"add", "aws/prod/key", "v1", "--tag", "prod,aws", "--description", "CI deploy key"},
+		{"add", "aws/dev/key", "v2", "--tag", "dev"},
+		{"add", "github/token", "v3"},
+	} {
+		addTags, addDescription = nil, ""
+		rootCmd.SetArgs(args)
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("%v: %v", args, err)
+		}
+	}
+
+	outBuf.Reset()
+	rootCmd.SetArgs([]string{"search", "tag:prod", "key:aws/*/key"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	out := outBuf.String()
+	if !strings.Contains(out, "aws/prod/key") || strings.Contains(out, "aws/dev/key") || strings.Contains(out, "github/token") {
+		t.Errorf("unexpected search output:\n%s", out)
+	}
+
+	outBuf.Reset()
+	rootCmd.SetArgs([]string{"tag", "github/token", "prod"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("tag: %v", err)
+	}
+	if !strings.Contains(outBuf.String(), "Updated 'github/token' (tags: prod)") {
+		t.Errorf("unexpected tag output: %s", outBuf.String())
+	}
+	if v, _ := ls.Get("github/token"); string(v) != "v3" {
+		t.Errorf("tagging changed the value to %q", v)
+	}
+
+	outBuf.Reset()
+	listFilter = ""
+	rootCmd.SetArgs([]string{"list", "--filter", "-tag:prod"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("list --filter: %v", err)
+	}
+	out = outBuf.String()
+	if !strings.Contains(out, "aws/dev/key") || strings.Contains(out, "github/token") || strings.Contains(out, "aws/prod/key") {
+		t.Errorf("unexpected filtered list:\n%s", out)
+	}
+
+	outBuf.Reset()
+	rootCmd.SetArgs([]string{"tag", "aws/prod/key", "--remove", "aws", "--description", "rotated weekly"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("tag --remove: %v", err)
+	}
+	secret, err := ls.GetWithMetadata("aws/prod/key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(secret.Tags, ",") != "prod" || secret.Description != "rotated weekly" {
+		t.Errorf("unexpected metadata after tag: %v %q", secret.Tags, secret.Description)
+	}
+
+	rootCmd.SetArgs([]string{"search", "colour:red"})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), "unknown search field") {
+		t.Errorf("expected parse error, got %v", err)
+	}
+}
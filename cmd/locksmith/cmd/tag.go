@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bonjoski/locksmith/v2/pkg/locksmith"
+	"github.com/spf13/cobra"
+)
+
+var (
+	tagRemove      []string
+	tagDescription string
+)
+
+var tagCmd = &cobra.Command{
+	Use:   "tag <key> [tag]...",
+	Short: "Add or remove tags and set the description of a secret",
+	Long:  "Add tags to a secret, remove them with --remove, or set its description with --description. The value is unchanged; the updated metadata is written as a new version.",
+	Example: "  locksmith tag aws/prod/key prod team-a\n" +
+		"  locksmith tag aws/prod/key --remove team-a --description \"CI deploy key\"",
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key, add := args[0], args[1:]
+		if len(add) == 0 && len(tagRemove) == 0 && !cmd.Flags().Changed("description") {
+			return fmt.Errorf("nothing to change: give tags to add, --remove or --description")
+		}
+
+		secret, err := ls.GetWithMetadata(key)
+		if err != nil {
+			return fmt.Errorf("error retrieving secret: %w", err)
+		}
+		defer secret.Zero()
+
+		remove := make(map[string]bool, len(tagRemove))
+		for _, t := range tagRemove {
+			remove[strings.ToLower(strings.TrimSpace(t))] = true
+		}
+		var tags []string
+		for _, t := range append(secret.Tags, add...) {
+			if !remove[strings.ToLower(strings.TrimSpace(t))] {
+				tags = append(tags, t)
+			}
+		}
+
+		tags, err = locksmith.NormalizeTags(tags)
+		if err != nil {
+			return err
+		}
+
+		updated := *secret
+		updated.Tags = tags
+		updated.WrittenBy = ""
+		if cmd.Flags().Changed("description") {
+			updated.Description = tagDescription
+		}
+		if err := ls.PutSecret(key, updated, globalBiometricReqs); err != nil {
+			return fmt.Errorf("error saving secret: %w", err)
+		}
+
+		current := "(none)"
+		if len(updated.Tags) > 0 {
+			current = strings.Join(updated.Tags, ", ")
+		}
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Updated '%s' (tags: %s)\n", key, current)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(tagCmd)
+	tagCmd.Flags().StringSliceVar(&tagRemove, "remove", nil, "Tags to remove (repeatable or comma-separated)")
+	tagCmd.Flags().StringVar(&tagDescription, "description", "", "Set the description (empty clears it)")
+}
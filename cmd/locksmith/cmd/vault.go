@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bonjoski/locksmith/v2/pkg/locksmith"
+	"github.com/spf13/cobra"
+)
+
+var (
+	vaultService           string
+	vaultBackendName       string
+	vaultBackendOptions    map[string]string
+	vaultRequireBiometrics string
+	vaultPromptMessage     string
+	vaultSetDefault        bool
+	vaultPurge             bool
+)
+
+var vaultCmd = &cobra.Command{
+	Use:   "vault",
+	Short: "Manage named vaults",
+	Long: `Named vaults keep separate sets of secrets (e.g. personal, work, per-client),
+each with its own keychain service, cache directory and optional backend and
+auth policy. Select a vault with --vault, LOCKSMITH_VAULT or default_vault in
+~/.locksmith/config.yml. References can address another vault explicitly:
+locksmith://@work/db/password.`,
+	// Vault management only needs the config, so a missing or broken vault
+	// selection does not prevent fixing it.
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if cfg == nil {
+			var err error
+			cfg, err = locksmith.LoadConfig()
+			if err != nil {
+				return fmt.Errorf("error loading config: %w", err)
+			}
+		}
+		return nil
+	},
+}
+
+var vaultCreateCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "Create a named vault",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		if err := locksmith.ValidateVaultName(name); err != nil {
+			return err
+		}
+		if name == locksmith.DefaultVaultName {
+			return fmt.Errorf("vault '%s' always exists", name)
+		}
+		if _, exists := cfg.Vaults[name]; exists {
+			return fmt.Errorf("vault '%s' already exists", name)
+		}
+
+		vc := locksmith.VaultConfig{
+			Service: strings.TrimSpace(vaultService),
+			Backend: locksmith.BackendConfig{Name: vaultBackendName, Options: vaultBackendOptions},
+		}
+		if vc.Backend.Name != "" {
+			if _, ok := locksmith.Backends.Resolve(vc.Backend.Name); !ok && !strings.EqualFold(vc.Backend.Name, locksmith.BackendAuto) {
+				return fmt.Errorf("unknown backend '%s'", vc.Backend.Name)
+			}
+		}
+		if vaultRequireBiometrics != "" || vaultPromptMessage != "" {
+			vc.Auth = &locksmith.VaultAuthConfig{PromptMessage: vaultPromptMessage}
+			if vaultRequireBiometrics != "" {
+				v, err := parseBoolFlag(vaultRequireBiometrics)
+				if err != nil {
+					return fmt.Errorf("invalid --require-biometrics: %w", err)
+				}
+				vc.Auth.RequireBiometrics = &v
+			}
+		}
+		for other, ovc := range cfg.Vaults {
+			if service := resolvedVaultService(other, ovc); service == resolvedVaultService(name, vc) {
+				return fmt.Errorf("service '%s' is already used by vault '%s'", service, other)
+			}
+		}
+
+		if err := locksmith.SetConfigValue([]string{"vaults", name}, vc); err != nil {
+			return fmt.Errorf("error saving vault: %w", err)
+		}
+		if vaultSetDefault {
+			if err := locksmith.SetConfigValue([]string{"default_vault"}, name); err != nil {
+				return fmt.Errorf("error setting default vault: %w", err)
+			}
+		}
+		if cfg.Vaults == nil {
+			cfg.Vaults = make(map[string]locksmith.VaultConfig)
+		}
+		cfg.Vaults[name] = vc
+
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Created vault '%s' (service %s)\n", name, resolvedVaultService(name, vc))
+		return nil
+	},
+}
+
+var vaultListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List vaults",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		current := locksmith.SelectVaultName(cfg, globalVault)
+		out := cmd.OutOrStdout()
+		_, _ = fmt.Fprintf(out, "  %-20s %-32s %s\n", "NAME", "SERVICE", "BACKEND")
+		for _, name := range locksmith.VaultNames(cfg) {
+			info, err := locksmith.ResolveVault(cfg, name)
+			if err != nil {
+				return err
+			}
+			marker := " "
+			if name == current {
+				marker = "*"
+			}
+			backend := info.Backend.Name
+			if backend == "" {
+				backend = locksmith.BackendAuto
+			}
+			_, _ = fmt.Fprintf(out, "%s %-20s %-32s %s\n", marker, name, info.Service, backend)
+		}
+		return nil
+	},
+}
+
+var vaultRemoveCmd = &cobra.Command{
+	Use:     "remove <name>",
+	Aliases: []string{"rm"},
+	Short:   "Remove a named vault",
+	Long: `Remove a named vault from the configuration. Its secrets are left in the
+backend unless --purge is given, in which case every secret in the vault and
+its cache directory are deleted first.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		if name == locksmith.DefaultVaultName {
+			return fmt.Errorf("the default vault cannot be removed")
+		}
+		if _, exists := cfg.Vaults[name]; !exists {
+			return fmt.Errorf("vault '%s' does not exist", name)
+		}
+
+		out := cmd.OutOrStdout()
+		if vaultPurge {
+			target, err := locksmith.NewWithOptions(locksmith.Options{RequireBiometrics: true, Backend: globalBackend, Vault: name})
+			if err != nil {
+				return fmt.Errorf("error opening vault: %w", err)
+			}
+			keys, err := target.ListKeyNames()
+			if err != nil {
+				return fmt.Errorf("error listing vault: %w", err)
+			}
+			for _, key := range keys {
+				if err := target.Delete(key); err != nil {
+					return fmt.Errorf("error deleting '%s': %w", key, err)
+				}
+			}
+			if dir, err := locksmith.VaultCacheDir(name); err == nil {
+				_ = os.RemoveAll(filepath.Dir(dir))
+			}
+			_, _ = fmt.Fprintf(out, "Deleted %d secret(s) from vault '%s'\n", len(keys), name)
+		}
+
+		if _, err := locksmith.DeleteConfigValue([]string{"vaults", name}); err != nil {
+			return fmt.Errorf("error removing vault: %w", err)
+		}
+		if cfg.DefaultVault == name {
+			if _, err := locksmith.DeleteConfigValue([]string{"default_vault"}); err != nil {
+				return fmt.Errorf("error clearing default vault: %w", err)
+			}
+			cfg.DefaultVault = ""
+		}
+		delete(cfg.Vaults, name)
+
+		_, _ = fmt.Fprintf(out, "Removed vault '%s'\n", name)
+		if !vaultPurge {
+			_, _ = fmt.Fprintln(out, "Its secrets remain in the backend; recreate the vault to access them again.")
+		}
+		return nil
+	},
+}
+
+func resolvedVaultService(name string, vc locksmith.VaultConfig) string {
+	if s := strings.TrimSpace(vc.Service); s != "" {
+		return s
+	}
+	return locksmith.DefaultService + "." + name
+}
+
+func parseBoolFlag(s string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "true", "yes", "1":
+		return true, nil
+	case "false", "no", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("expected true or false, got '%s'", s)
+}
+
+func init() {
+	vaultCreateCmd.Flags().StringVar(&vaultService, "service", "", "Keychain service name (default: "+locksmith.DefaultService+".<name>)")
+	vaultCreateCmd.Flags().StringVar(&vaultBackendName, "backend-name", "", "Backend for this vault (default: inherit the top-level backend)")
+	vaultCreateCmd.Flags().StringToStringVar(&vaultBackendOptions, "backend-option", nil, "Backend option key=value (repeatable)")
+	vaultCreateCmd.Flags().StringVar(&vaultRequireBiometrics, "require-biometrics", "", "Override auth.require_biometrics for this vault (true|false)")
+	vaultCreateCmd.Flags().StringVar(&vaultPromptMessage, "prompt-message", "", "Override auth.prompt_message for this vault")
+	vaultCreateCmd.Flags().BoolVar(&vaultSetDefault, "default", false, "Make this the default vault")
+	vaultRemoveCmd.Flags().BoolVar(&vaultPurge, "purge", false, "Delete all secrets in the vault before removing it")
+
+	vaultCmd.AddCommand(vaultCreateCmd)
+	vaultCmd.AddCommand(vaultListCmd)
+	vaultCmd.AddCommand(vaultRemoveCmd)
+	rootCmd.AddCommand(vaultCmd)
+}
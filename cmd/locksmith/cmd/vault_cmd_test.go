@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bonjoski/locksmith/v2/pkg/locksmith"
+)
+
+func TestVaultCreateListRemove(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(locksmith.VaultEnv, "")
+	outBuf, _ := setupTest()
+
+	rootCmd.SetArgs([]string{"vault", "create", "work", "--require-biometrics", "false", "--default"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("vault create: %v", err)
+	}
+	if !strings.Contains(outBuf.String(), "Created vault 'work' (service "+locksmith.DefaultService+".work)") {
+		t.Errorf("unexpected create output:\n%s", outBuf.String())
+	}
+
+	saved, err := locksmith.LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	vc, ok := saved.Vaults["work"]
+	if !ok || vc.Auth == nil || vc.Auth.RequireBiometrics == nil || *vc.Auth.RequireBiometrics {
+		t.Fatalf("vault not persisted correctly: %+v", saved.Vaults)
+	}
+	if saved.DefaultVault != "work" {
+		t.Errorf("expected default_vault=work, got %q", saved.DefaultVault)
+	}
+
+	rootCmd.SetArgs([]string{"vault", "create", "work"})
+	if err := rootCmd.Execute(); err == nil {
+		t.Error("expected error creating an existing vault")
+	}
+	rootCmd.SetArgs([]string{"vault", "create", "default"})
+	if err := rootCmd.Execute(); err == nil {
+		t.Error("expected error creating the default vault")
+	}
+
+	outBuf.Reset()
+	cfg = saved
+	rootCmd.SetArgs([]string{"vault", "list"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("vault list: %v", err)
+	}
+	out := outBuf.String()
+	if !strings.Contains(out, "  default ") || !strings.Contains(out, "* work ") {
+		t.Errorf("unexpected list output:\n%s", out)
+	}
+
+	outBuf.Reset()
+	rootCmd.SetArgs([]string{"vault", "remove", "work"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("vault remove: %v", err)
+	}
+	if !strings.Contains(outBuf.String(), "Removed vault 'work'") {
+		t.Errorf("unexpected remove output:\n%s", outBuf.String())
+	}
+	saved, err = locksmith.LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := saved.Vaults["work"]; ok || saved.DefaultVault != "" {
+		t.Errorf("vault not removed from config: %+v / %q", saved.Vaults, saved.DefaultVault)
+	}
+
+	rootCmd.SetArgs([]string{"vault", "remove", "default"})
+	if err := rootCmd.Execute(); err == nil {
+		t.Error("expected error removing the default vault")
+	}
+}
@@ -5,11 +5,12 @@ go 1.25.4
 toolchain go1.26.5
 
 require (
+	filippo.io/age v1.3.1
 	github.com/danieljoos/wincred v1.2.3
+	github.com/godbus/dbus/v5 v5.2.2
 	github.com/julian-bruyers/winhello-go v1.1.0
 	github.com/modelcontextprotocol/go-sdk v1.7.0
 	github.com/spf13/cobra v1.10.2
-	github.com/zalando/go-keyring v0.2.8
 	golang.org/x/crypto v0.54.0
 	golang.org/x/sys v0.47.0
 	golang.org/x/term v0.45.0
@@ -17,7 +18,7 @@ require (
 )
 
 require (
-	github.com/godbus/dbus/v5 v5.2.2 // indirect
+	filippo.io/hpke v0.4.0 // indirect
 	github.com/google/jsonschema-go v0.4.3 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/segmentio/asm v1.1.3 // indirect
@@ -0,0 +1,471 @@
+// Package filevault implements a locksmith Backend that stores secrets in a
+// single passphrase- or keyfile-protected file. It is intended for headless
+// hosts (CI runners, dev containers, servers) that have no OS keychain.
+package filevault
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bonjoski/locksmith/v2/pkg/filelock"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	// DefaultPassphraseEnv is the environment variable consulted for the
+	// vault passphrase when neither a keyfile nor a prompt is configured.
+	DefaultPassphraseEnv = "LOCKSMITH_VAULT_PASSPHRASE" // #nosec G101 -- env var name, not a credential
+
+	formatVersion = 1
+	kdfArgon2id   = "argon2id"
+	keyLen        = chacha20poly1305.KeySize
+	checkPhrase   = "locksmith-filevault-check"
+
+	// Bounds on the KDF parameters read from a vault file, so a corrupt or
+	// crafted file cannot crash the process or exhaust its memory.
+	maxKDFTime   = 64
+	maxKDFMemory = 1 << 20 // KiB (1 GiB)
+	minSaltLen   = 8
+)
+
+// ErrNotFound is returned by Get when the requested account does not exist.
+var ErrNotFound = errors.New("Secret not found") // match native bridge error convention
+
+// Options configures a file vault.
+type Options struct {
+	// Path of the vault file. Defaults to ~/.locksmith/vault.json.
+	Path string
+	// KeyFile, when set, is read and used as key material instead of a passphrase.
+	KeyFile string
+	// PassphraseEnv names the environment variable holding the passphrase.
+	// Defaults to DefaultPassphraseEnv.
+	PassphraseEnv string
+	// Prompt is called to obtain a passphrase when no keyfile is configured
+	// and the passphrase environment variable is empty.
+	Prompt func(message string) ([]byte, error)
+}
+
+// Vault is an encrypted, file-backed secret store. Each item is sealed with
+// XChaCha20-Poly1305 under a key derived from the passphrase with Argon2id;
+// the service and account are bound to the ciphertext as associated data.
+// Writes are atomic (temp file + rename) and serialized across processes
+// with an advisory lock next to the vault file.
+type Vault struct {
+	opts Options
+
+	mu      sync.Mutex
+	key     []byte
+	keySalt []byte
+}
+
+type kdfParams struct {
+	Name    string `json:"name"`
+	Salt    []byte `json:"salt"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+}
+
+// validate checks p against the bounds argon2.IDKey can be trusted with.
+func (p kdfParams) validate() error {
+	if p.Time == 0 || p.Time > maxKDFTime || p.Threads == 0 || len(p.Salt) < minSaltLen {
+		return fmt.Errorf("invalid argon2 parameters")
+	}
+	if p.Memory < 8*uint32(p.Threads) || p.Memory > maxKDFMemory {
+		return fmt.Errorf("invalid argon2 memory size %d KiB", p.Memory)
+	}
+	return nil
+}
+
+type sealedItem struct {
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+type vaultFile struct {
+	Version int                              `json:"version"`
+	KDF     kdfParams                        `json:"kdf"`
+	Check   sealedItem                       `json:"check"`
+	Items   map[string]map[string]sealedItem `json:"items"`
+}
+
+// DefaultPath returns the default vault location (~/.locksmith/vault.json).
+func DefaultPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".locksmith", "vault.json"), nil
+}
+
+// New returns a Vault for the given options. The vault file is created on
+// the first Set; the passphrase is only requested when an item is sealed
+// or opened.
+func New(opts Options) (*Vault, error) {
+	if strings.TrimSpace(opts.Path) == "" {
+		p, err := DefaultPath()
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve vault path: %w", err)
+		}
+		opts.Path = p
+	}
+	opts.Path = expandHome(opts.Path)
+	opts.KeyFile = expandHome(opts.KeyFile)
+	if opts.PassphraseEnv == "" {
+		opts.PassphraseEnv = DefaultPassphraseEnv
+	}
+	return &Vault{opts: opts}, nil
+}
+
+// Path returns the location of the vault file.
+func (v *Vault) Path() string {
+	return v.opts.Path
+}
+
+// Set seals data for service/account. requireBiometrics is ignored: access
+// to a file vault is gated by its passphrase or keyfile instead.
+func (v *Vault) Set(service, account string, data []byte, requireBiometrics bool) error {
+	return v.update(func(f *vaultFile, key []byte) error {
+		item, err := seal(key, data, itemAD(service, account))
+		if err != nil {
+			return err
+		}
+		if f.Items[service] == nil {
+			f.Items[service] = make(map[string]sealedItem)
+		}
+		f.Items[service][account] = item
+		return nil
+	}, true)
+}
+
+// Get opens the item stored for service/account.
+func (v *Vault) Get(service, account string, useBiometrics bool, prompt string) ([]byte, error) {
+	lock, err := v.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = lock.Release() }()
+
+	f, err := v.load()
+	if err != nil {
+		return nil, err
+	}
+	if f == nil {
+		return nil, ErrNotFound
+	}
+	item, ok := f.Items[service][account]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	key, err := v.unlock(f)
+	if err != nil {
+		return nil, err
+	}
+	data, err := open(key, item, itemAD(service, account))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt vault item '%s': %w", account, err)
+	}
+	return data, nil
+}
+
+// Delete removes service/account from the vault. Deleting a missing item is not an error.
+func (v *Vault) Delete(service, account string, useBiometrics bool, prompt string) error {
+	return v.update(func(f *vaultFile, _ []byte) error {
+		delete(f.Items[service], account)
+		if len(f.Items[service]) == 0 {
+			delete(f.Items, service)
+		}
+		return nil
+	}, false)
+}
+
+// List returns the account names stored for service. Names are kept in the
+// clear (as OS keychains do), so listing does not require the passphrase.
+func (v *Vault) List(service string, useBiometrics bool, prompt string) ([]string, error) {
+	lock, err := v.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = lock.Release() }()
+
+	f, err := v.load()
+	if err != nil {
+		return nil, err
+	}
+	if f == nil {
+		return []string{}, nil
+	}
+	keys := make([]string, 0, len(f.Items[service]))
+	for account := range f.Items[service] {
+		keys = append(keys, account)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// update runs fn against the current vault contents under the file lock and
+// atomically writes the result. When needKey is false, fn receives a nil key
+// and the passphrase is not requested.
+func (v *Vault) update(fn func(f *vaultFile, key []byte) error, needKey bool) error {
+	lock, err := v.lock()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = lock.Release() }()
+
+	f, err := v.load()
+	if err != nil {
+		return err
+	}
+	if f == nil {
+		if !needKey {
+			return nil
+		}
+		f, err = v.initFile()
+		if err != nil {
+			return err
+		}
+	}
+
+	var key []byte
+	if needKey {
+		key, err = v.unlock(f)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := fn(f, key); err != nil {
+		return err
+	}
+	return v.write(f)
+}
+
+func (v *Vault) lock() (*filelock.Lock, error) {
+	return filelock.Acquire(v.opts.Path + ".lock")
+}
+
+func (v *Vault) load() (*vaultFile, error) {
+	data, err := os.ReadFile(filepath.Clean(v.opts.Path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read vault file: %w", err)
+	}
+
+	var f vaultFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse vault file %s: %w", v.opts.Path, err)
+	}
+	if f.Version != formatVersion {
+		return nil, fmt.Errorf("unsupported vault file version %d", f.Version)
+	}
+	if f.KDF.Name != kdfArgon2id {
+		return nil, fmt.Errorf("unsupported vault key derivation '%s'", f.KDF.Name)
+	}
+	if err := f.KDF.validate(); err != nil {
+		return nil, fmt.Errorf("vault file %s: %w", v.opts.Path, err)
+	}
+	if f.Items == nil {
+		f.Items = make(map[string]map[string]sealedItem)
+	}
+	return &f, nil
+}
+
+func (v *Vault) initFile() (*vaultFile, error) {
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	f := &vaultFile{
+		Version: formatVersion,
+		KDF: kdfParams{
+			Name:    kdfArgon2id,
+			Salt:    salt,
+			Time:    3,
+			Memory:  64 * 1024,
+			Threads: 4,
+		},
+		Items: make(map[string]map[string]sealedItem),
+	}
+
+	key, err := v.deriveKey(f.KDF)
+	if err != nil {
+		return nil, err
+	}
+	check, err := seal(key, []byte(checkPhrase), []byte(checkPhrase))
+	if err != nil {
+		return nil, err
+	}
+	f.Check = check
+	return f, nil
+}
+
+// unlock derives (or reuses) the vault key and verifies it against the
+// check item so a wrong passphrase is reported as such rather than as a
+// per-item decryption failure.
+func (v *Vault) unlock(f *vaultFile) ([]byte, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.key != nil && subtle.ConstantTimeCompare(v.keySalt, f.KDF.Salt) == 1 {
+		return v.key, nil
+	}
+
+	key, err := v.deriveKeyLocked(f.KDF)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := open(key, f.Check, []byte(checkPhrase))
+	if err != nil || subtle.ConstantTimeCompare(plain, []byte(checkPhrase)) != 1 {
+		zero(key)
+		return nil, fmt.Errorf("invalid vault passphrase or keyfile for %s", v.opts.Path)
+	}
+
+	v.key = key
+	v.keySalt = append([]byte(nil), f.KDF.Salt...)
+	return key, nil
+}
+
+func (v *Vault) deriveKey(p kdfParams) ([]byte, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	key, err := v.deriveKeyLocked(p)
+	if err != nil {
+		return nil, err
+	}
+	v.key = key
+	v.keySalt = append([]byte(nil), p.Salt...)
+	return key, nil
+}
+
+func (v *Vault) deriveKeyLocked(p kdfParams) ([]byte, error) {
+	material, err := v.keyMaterial()
+	if err != nil {
+		return nil, err
+	}
+	defer zero(material)
+	return argon2.IDKey(material, p.Salt, p.Time, p.Memory, p.Threads, keyLen), nil
+}
+
+func (v *Vault) keyMaterial() ([]byte, error) {
+	if v.opts.KeyFile != "" {
+		data, err := os.ReadFile(filepath.Clean(v.opts.KeyFile))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read vault keyfile: %w", err)
+		}
+		if len(data) == 0 {
+			return nil, fmt.Errorf("vault keyfile %s is empty", v.opts.KeyFile)
+		}
+		return data, nil
+	}
+
+	if pass := os.Getenv(v.opts.PassphraseEnv); pass != "" {
+		return []byte(pass), nil
+	}
+
+	if v.opts.Prompt != nil {
+		pass, err := v.opts.Prompt(fmt.Sprintf("Passphrase for locksmith vault %s: ", v.opts.Path))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read vault passphrase: %w", err)
+		}
+		if len(pass) == 0 {
+			return nil, fmt.Errorf("vault passphrase cannot be empty")
+		}
+		return pass, nil
+	}
+
+	return nil, fmt.Errorf("file vault %s requires a passphrase (set %s) or a keyfile", v.opts.Path, v.opts.PassphraseEnv)
+}
+
+func (v *Vault) write(f *vaultFile) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(v.opts.Path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create vault directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".vault-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary vault file: %w", err)
+	}
+	tmpName := tmp.Name()
+	defer func() { _ = os.Remove(tmpName) }()
+
+	if err := tmp.Chmod(0600); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write vault file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, v.opts.Path)
+}
+
+func itemAD(service, account string) []byte {
+	return []byte("locksmith-filevault/v1\x00" + service + "\x00" + account)
+}
+
+func seal(key, plaintext, ad []byte) (sealedItem, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return sealedItem{}, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return sealedItem{}, err
+	}
+	return sealedItem{Nonce: nonce, Ciphertext: aead.Seal(nil, nonce, plaintext, ad)}, nil
+}
+
+func open(key []byte, item sealedItem, ad []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(item.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce length")
+	}
+	return aead.Open(nil, item.Nonce, item.Ciphertext, ad)
+}
+
+func expandHome(p string) string {
+	if !strings.HasPrefix(p, "~/") {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return p
+	}
+	return filepath.Join(home, p[2:])
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
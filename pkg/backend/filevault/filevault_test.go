@@ -0,0 +1,191 @@
+package filevault
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func newTestVault(t *testing.T) *Vault {
+	t.Helper()
+	t.Setenv(DefaultPassphraseEnv, "correct horse battery staple")
+	v, err := New(Options{Path: filepath.Join(t.TempDir(), "vault.json")})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return v
+}
+
+func TestVaultRoundTrip(t *testing.T) {
+	v := newTestVault(t)
+
+	if err := v.Set("svc", "db/password", []byte("hunter2"), true); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := v.Set("svc", "api/key", []byte("abc"), false); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := v.Set("other", "api/key", []byte("xyz"), false); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	got, err := v.Get("svc", "db/password", false, "")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if !bytes.Equal(got, []byte("hunter2")) {
+		t.Errorf("expected hunter2, got %q", got)
+	}
+
+	keys, err := v.List("svc", false, "")
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if strings.Join(keys, ",") != "api/key,db/password" {
+		t.Errorf("unexpected keys: %v", keys)
+	}
+
+	if err := v.Delete("svc", "db/password", false, ""); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := v.Get("svc", "db/password", false, ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound after delete, got %v", err)
+	}
+
+	info, err := os.Stat(v.Path())
+	if err != nil {
+		t.Fatalf("stat vault: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("expected vault mode 0600, got %o", perm)
+	}
+	raw, _ := os.ReadFile(v.Path())
+	if bytes.Contains(raw, []byte("hunter2")) || bytes.Contains(raw, []byte("xyz")) {
+		t.Error("vault file contains plaintext secret")
+	}
+}
+
+func TestVaultWrongPassphrase(t *testing.T) {
+	v := newTestVault(t)
+	if err := v.Set("svc", "k", []byte("v"), false); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	t.Setenv(DefaultPassphraseEnv, "wrong")
+	other, _ := New(Options{Path: v.Path()})
+	if _, err := other.Get("svc", "k", false, ""); err == nil || !strings.Contains(err.Error(), "invalid vault passphrase") {
+		t.Errorf("expected invalid passphrase error, got %v", err)
+	}
+}
+
+func TestVaultRejectsInvalidKDFParams(t *testing.T) {
+	v := newTestVault(t)
+	if err := v.Set("svc", "k", []byte("v"), false); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	raw, err := os.ReadFile(v.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, edit := range map[string]func(p *kdfParams){
+		"zero time":    func(p *kdfParams) { p.Time = 0 },
+		"zero threads": func(p *kdfParams) { p.Threads = 0 },
+		"huge memory":  func(p *kdfParams) { p.Memory = 1 << 31 },
+		"no salt":      func(p *kdfParams) { p.Salt = nil },
+	} {
+		var f vaultFile
+		if err := json.Unmarshal(raw, &f); err != nil {
+			t.Fatal(err)
+		}
+		edit(&f.KDF)
+		data, _ := json.Marshal(f)
+		if err := os.WriteFile(v.Path(), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		other, _ := New(Options{Path: v.Path()})
+		if _, err := other.Get("svc", "k", false, ""); err == nil || !strings.Contains(err.Error(), "invalid argon2") {
+			t.Errorf("%s: expected the parameters to be rejected, got %v", name, err)
+		}
+	}
+}
+
+func TestVaultKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "vault.key")
+	if err := os.WriteFile(keyFile, []byte("0123456789abcdef0123456789abcdef"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(DefaultPassphraseEnv, "")
+
+	v, _ := New(Options{Path: filepath.Join(dir, "vault.json"), KeyFile: keyFile})
+	if err := v.Set("svc", "k", []byte("v"), false); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	got, err := v.Get("svc", "k", false, "")
+	if err != nil || string(got) != "v" {
+		t.Fatalf("Get = %q, %v", got, err)
+	}
+}
+
+func TestVaultRequiresKeyMaterial(t *testing.T) {
+	t.Setenv(DefaultPassphraseEnv, "")
+	v, _ := New(Options{Path: filepath.Join(t.TempDir(), "vault.json")})
+	if err := v.Set("svc", "k", []byte("v"), false); err == nil {
+		t.Fatal("expected error without passphrase or keyfile")
+	}
+
+	// Listing an absent vault needs no key material.
+	keys, err := v.List("svc", false, "")
+	if err != nil || len(keys) != 0 {
+		t.Errorf("List = %v, %v", keys, err)
+	}
+}
+
+func TestVaultItemsBoundToAccount(t *testing.T) {
+	v := newTestVault(t)
+	_ = v.Set("svc", "a", []byte("value-a"), false)
+	_ = v.Set("svc", "b", []byte("value-b"), false)
+
+	f, err := v.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Items["svc"]["a"], f.Items["svc"]["b"] = f.Items["svc"]["b"], f.Items["svc"]["a"]
+	if err := v.write(f); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := v.Get("svc", "a", false, ""); err == nil {
+		t.Error("expected swapped ciphertext to fail authentication")
+	}
+}
+
+func TestVaultConcurrentWriters(t *testing.T) {
+	v := newTestVault(t)
+	// Warm the key so the test does not spend its time in Argon2.
+	_ = v.Set("svc", "seed", []byte("x"), false)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			other, _ := New(Options{Path: v.Path()})
+			other.key, other.keySalt = v.key, v.keySalt
+			if err := other.Set("svc", string(rune('a'+i)), []byte("v"), false); err != nil {
+				t.Errorf("Set %d failed: %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	keys, _ := v.List("svc", false, "")
+	if len(keys) != 9 {
+		t.Errorf("expected 9 keys after concurrent writes, got %d: %v", len(keys), keys)
+	}
+}
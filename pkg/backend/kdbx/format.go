@@ -0,0 +1,622 @@
+package kdbx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/bonjoski/locksmith/v2/pkg/backend/kdbx/internal/argon2"
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/salsa20"
+)
+
+// File signature and supported format version (KDBX 4.x).
+const (
+	sig1         uint32 = 0x9AA2D903
+	sig2         uint32 = 0xB54BFB67
+	versionMajor        = 4
+	version40    uint32 = 0x00040000
+
+	blockSize = 1 << 20
+)
+
+// Outer header field IDs.
+const (
+	hdrEndOfHeader      = 0
+	hdrCipherID         = 2
+	hdrCompressionFlags = 3
+	hdrMasterSeed       = 4
+	hdrEncryptionIV     = 7
+	hdrKdfParameters    = 11
+	hdrPublicCustomData = 12
+)
+
+// Inner header field IDs.
+const (
+	innerEndOfHeader = 0
+	innerStreamID    = 1
+	innerStreamKey   = 2
+	innerBinary      = 3
+)
+
+// Inner random stream algorithms used to obfuscate protected values.
+const (
+	streamSalsa20  = 2
+	streamChaCha20 = 3
+)
+
+var (
+	cipherAES256   = mustUUID("31c1f2e6bf714350be5805216afc5aff")
+	cipherChaCha20 = mustUUID("d6038a2b8b6f4cb5a524339a31dbb59a")
+	cipherTwofish  = mustUUID("ad68f29f576f4bb9a36ad47af965346c")
+
+	kdfAES      = mustUUID("c9d9f39a628a4460bf740d08c18a4fea")
+	kdfAESKDBX3 = mustUUID("7c02bb8279a74ac0927d114a00648238")
+	kdfArgon2d  = mustUUID("ef636ddf8c29444b91f7a9a403e30a0c")
+	kdfArgon2id = mustUUID("9e298b1956db4773b23dfc3ec6f0a1e6")
+
+	salsa20Nonce = []byte{0xE8, 0x30, 0x09, 0x4B, 0x97, 0x20, 0x5D, 0x2A}
+)
+
+// ErrInvalidKey is returned when the HMAC of the header does not verify,
+// which in practice means the password or keyfile is wrong.
+var ErrInvalidKey = errors.New("invalid KDBX password or keyfile")
+
+// header is the unencrypted outer header of a KDBX 4 file. Fields locksmith
+// does not interpret are kept so they are written back unchanged.
+type header struct {
+	version     uint32
+	cipherID    []byte
+	compression uint32
+	masterSeed  []byte
+	iv          []byte
+	kdf         variantDict
+	publicData  []byte
+	unknown     []headerField
+}
+
+type headerField struct {
+	id   byte
+	data []byte
+}
+
+// innerHeader precedes the XML payload inside the encrypted stream.
+type innerHeader struct {
+	streamID  uint32
+	streamKey []byte
+	binaries  [][]byte
+}
+
+// database is a decrypted KDBX file: its headers and XML document.
+type database struct {
+	header header
+	inner  innerHeader
+	doc    *node
+}
+
+// compositeKey combines the credentials as KeePass does:
+// SHA-256(SHA-256(password) || keyfile key).
+func compositeKey(password, keyFileKey []byte) []byte {
+	h := sha256.New()
+	if password != nil {
+		pw := sha256.Sum256(password)
+		h.Write(pw[:])
+	}
+	if keyFileKey != nil {
+		h.Write(keyFileKey)
+	}
+	return h.Sum(nil)
+}
+
+// transformKey runs the header's KDF over the composite key.
+func transformKey(kdf variantDict, composite []byte) ([]byte, error) {
+	uuid, _ := kdf.bytes("$UUID")
+	switch {
+	case bytes.Equal(uuid, kdfArgon2d), bytes.Equal(uuid, kdfArgon2id):
+		salt, ok := kdf.bytes("S")
+		if !ok {
+			return nil, fmt.Errorf("argon2 parameters missing salt")
+		}
+		iterations, _ := kdf.uint64("I")
+		memory, _ := kdf.uint64("M")
+		parallelism, _ := kdf.uint32("P")
+		version, _ := kdf.uint32("V")
+		if version != argon2.Version {
+			return nil, fmt.Errorf("unsupported argon2 version 0x%x", version)
+		}
+		if iterations == 0 || iterations > math.MaxUint32 || parallelism == 0 || parallelism > math.MaxUint8 {
+			return nil, fmt.Errorf("invalid argon2 parameters")
+		}
+		memKiB := memory / 1024
+		if memKiB == 0 || memKiB > math.MaxUint32 {
+			return nil, fmt.Errorf("invalid argon2 memory size %d", memory)
+		}
+		secret, _ := kdf.bytes("K")
+		assoc, _ := kdf.bytes("A")
+		derive := argon2.IDKey
+		if bytes.Equal(uuid, kdfArgon2d) {
+			derive = argon2.DKey
+		}
+		return derive(composite, salt, secret, assoc, uint32(iterations), uint32(memKiB), uint8(parallelism), 32), nil
+
+	case bytes.Equal(uuid, kdfAES), bytes.Equal(uuid, kdfAESKDBX3):
+		seed, ok := kdf.bytes("S")
+		if !ok || len(seed) != 32 {
+			return nil, fmt.Errorf("AES-KDF parameters missing seed")
+		}
+		rounds, _ := kdf.uint64("R")
+		block, err := aes.NewCipher(seed)
+		if err != nil {
+			return nil, err
+		}
+		key := append([]byte(nil), composite...)
+		for i := uint64(0); i < rounds; i++ {
+			block.Encrypt(key[:16], key[:16])
+			block.Encrypt(key[16:], key[16:])
+		}
+		sum := sha256.Sum256(key)
+		return sum[:], nil
+	}
+	return nil, fmt.Errorf("unsupported KDF %x", uuid)
+}
+
+// decode parses and decrypts a KDBX 4 file. transform maps the KDF
+// parameters to the transformed key so callers can cache it.
+func decode(data []byte, transform func(kdf variantDict) ([]byte, error)) (*database, []byte, error) {
+	r := bytes.NewReader(data)
+	h, headerBytes, err := readHeader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var storedHash, storedMAC [32]byte
+	if _, err := io.ReadFull(r, storedHash[:]); err != nil {
+		return nil, nil, fmt.Errorf("truncated KDBX header hash")
+	}
+	if _, err := io.ReadFull(r, storedMAC[:]); err != nil {
+		return nil, nil, fmt.Errorf("truncated KDBX header HMAC")
+	}
+	hash := sha256.Sum256(headerBytes)
+	if subtle.ConstantTimeCompare(hash[:], storedHash[:]) != 1 {
+		return nil, nil, fmt.Errorf("KDBX header is corrupted")
+	}
+
+	transformed, err := transform(h.kdf)
+	if err != nil {
+		return nil, nil, err
+	}
+	encKey, macKey := deriveKeys(h.masterSeed, transformed)
+	if subtle.ConstantTimeCompare(headerMAC(macKey, headerBytes), storedMAC[:]) != 1 {
+		return nil, nil, ErrInvalidKey
+	}
+
+	ciphertext, err := readBlocks(r, macKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	plain, err := decrypt(h, encKey, ciphertext)
+	if err != nil {
+		return nil, nil, err
+	}
+	if h.compression == 1 {
+		zr, err := gzip.NewReader(bytes.NewReader(plain))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decompress KDBX payload: %w", err)
+		}
+		plain, err = io.ReadAll(zr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decompress KDBX payload: %w", err)
+		}
+	} else if h.compression != 0 {
+		return nil, nil, fmt.Errorf("unsupported KDBX compression %d", h.compression)
+	}
+
+	pr := bytes.NewReader(plain)
+	inner, err := readInnerHeader(pr)
+	if err != nil {
+		return nil, nil, err
+	}
+	doc, err := parseXML(pr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := unprotect(doc, inner); err != nil {
+		return nil, nil, err
+	}
+	return &database{header: *h, inner: *inner, doc: doc}, transformed, nil
+}
+
+// encode serialises db, generating a fresh master seed, IV and inner
+// stream key. transformed must match db.header.kdf.
+func encode(db *database, transformed []byte) ([]byte, error) {
+	h := &db.header
+	ivLen := aes.BlockSize
+	if bytes.Equal(h.cipherID, cipherChaCha20) {
+		ivLen = chacha20.NonceSize
+	}
+	var err error
+	if h.masterSeed, err = randomBytes(32); err != nil {
+		return nil, err
+	}
+	if h.iv, err = randomBytes(ivLen); err != nil {
+		return nil, err
+	}
+	db.inner.streamID = streamChaCha20
+	if db.inner.streamKey, err = randomBytes(64); err != nil {
+		return nil, err
+	}
+
+	var payload bytes.Buffer
+	writeInnerHeader(&payload, &db.inner)
+	if err := writeXML(&payload, db.doc, &db.inner); err != nil {
+		return nil, err
+	}
+
+	plain := payload.Bytes()
+	if h.compression == 1 {
+		var zbuf bytes.Buffer
+		zw := gzip.NewWriter(&zbuf)
+		if _, err := zw.Write(plain); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		plain = zbuf.Bytes()
+	}
+
+	encKey, macKey := deriveKeys(h.masterSeed, transformed)
+	ciphertext, err := encrypt(h, encKey, plain)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	headerBytes := writeHeader(h)
+	out.Write(headerBytes)
+	hash := sha256.Sum256(headerBytes)
+	out.Write(hash[:])
+	out.Write(headerMAC(macKey, headerBytes))
+	writeBlocks(&out, macKey, ciphertext)
+	return out.Bytes(), nil
+}
+
+func deriveKeys(masterSeed, transformed []byte) (encKey, macKey []byte) {
+	e := sha256.New()
+	e.Write(masterSeed)
+	e.Write(transformed)
+
+	m := sha512.New()
+	m.Write(masterSeed)
+	m.Write(transformed)
+	m.Write([]byte{1})
+	return e.Sum(nil), m.Sum(nil)
+}
+
+// blockKey derives the HMAC key for block index (math.MaxUint64 for the header).
+func blockKey(macKey []byte, index uint64) []byte {
+	var idx [8]byte
+	binary.LittleEndian.PutUint64(idx[:], index)
+	h := sha512.New()
+	h.Write(idx[:])
+	h.Write(macKey)
+	return h.Sum(nil)
+}
+
+func headerMAC(macKey, headerBytes []byte) []byte {
+	mac := hmac.New(sha256.New, blockKey(macKey, math.MaxUint64))
+	mac.Write(headerBytes)
+	return mac.Sum(nil)
+}
+
+func blockMAC(macKey []byte, index uint64, data []byte) []byte {
+	var prefix [12]byte
+	binary.LittleEndian.PutUint64(prefix[:8], index)
+	binary.LittleEndian.PutUint32(prefix[8:], uint32(len(data))) // #nosec G115 -- blocks are at most blockSize
+	mac := hmac.New(sha256.New, blockKey(macKey, index))
+	mac.Write(prefix[:])
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func readBlocks(r io.Reader, macKey []byte) ([]byte, error) {
+	var out bytes.Buffer
+	for index := uint64(0); ; index++ {
+		var stored [32]byte
+		var size uint32
+		if _, err := io.ReadFull(r, stored[:]); err != nil {
+			return nil, fmt.Errorf("truncated KDBX block %d", index)
+		}
+		if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+			return nil, fmt.Errorf("truncated KDBX block %d", index)
+		}
+		if size > math.MaxInt32 {
+			return nil, fmt.Errorf("invalid KDBX block size %d", size)
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("truncated KDBX block %d", index)
+		}
+		if subtle.ConstantTimeCompare(blockMAC(macKey, index, data), stored[:]) != 1 {
+			return nil, fmt.Errorf("KDBX block %d failed integrity check", index)
+		}
+		if size == 0 {
+			return out.Bytes(), nil
+		}
+		out.Write(data)
+	}
+}
+
+func writeBlocks(w *bytes.Buffer, macKey, data []byte) {
+	var size [4]byte
+	for index := uint64(0); ; index++ {
+		n := len(data)
+		if n > blockSize {
+			n = blockSize
+		}
+		chunk := data[:n]
+		data = data[n:]
+		w.Write(blockMAC(macKey, index, chunk))
+		binary.LittleEndian.PutUint32(size[:], uint32(n)) // #nosec G115 -- n <= blockSize
+		w.Write(size[:])
+		w.Write(chunk)
+		if n == 0 {
+			return
+		}
+	}
+}
+
+func decrypt(h *header, key, data []byte) ([]byte, error) {
+	switch {
+	case bytes.Equal(h.cipherID, cipherChaCha20):
+		c, err := chacha20.NewUnauthenticatedCipher(key, h.iv)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]byte, len(data))
+		c.XORKeyStream(out, data)
+		return out, nil
+
+	case bytes.Equal(h.cipherID, cipherAES256):
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		if len(h.iv) != aes.BlockSize || len(data) == 0 || len(data)%aes.BlockSize != 0 {
+			return nil, fmt.Errorf("invalid AES-CBC payload")
+		}
+		out := make([]byte, len(data))
+		cipher.NewCBCDecrypter(block, h.iv).CryptBlocks(out, data)
+		pad := int(out[len(out)-1])
+		if pad == 0 || pad > aes.BlockSize || pad > len(out) {
+			return nil, ErrInvalidKey
+		}
+		for _, b := range out[len(out)-pad:] {
+			if int(b) != pad {
+				return nil, ErrInvalidKey
+			}
+		}
+		return out[:len(out)-pad], nil
+
+	case bytes.Equal(h.cipherID, cipherTwofish):
+		return nil, fmt.Errorf("twofish-encrypted KDBX files are not supported; switch the database to ChaCha20 or AES-256")
+	}
+	return nil, fmt.Errorf("unsupported KDBX cipher %x", h.cipherID)
+}
+
+func encrypt(h *header, key, data []byte) ([]byte, error) {
+	switch {
+	case bytes.Equal(h.cipherID, cipherChaCha20):
+		c, err := chacha20.NewUnauthenticatedCipher(key, h.iv)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]byte, len(data))
+		c.XORKeyStream(out, data)
+		return out, nil
+
+	case bytes.Equal(h.cipherID, cipherAES256):
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		pad := aes.BlockSize - len(data)%aes.BlockSize
+		out := make([]byte, len(data)+pad)
+		copy(out, data)
+		for i := len(data); i < len(out); i++ {
+			out[i] = byte(pad)
+		}
+		cipher.NewCBCEncrypter(block, h.iv).CryptBlocks(out, out)
+		return out, nil
+	}
+	return nil, fmt.Errorf("unsupported KDBX cipher %x", h.cipherID)
+}
+
+// innerKeystream returns n bytes of the inner random stream.
+func innerKeystream(inner *innerHeader, n int) ([]byte, error) {
+	out := make([]byte, n)
+	switch inner.streamID {
+	case streamChaCha20:
+		sum := sha512.Sum512(inner.streamKey)
+		c, err := chacha20.NewUnauthenticatedCipher(sum[:32], sum[32:44])
+		if err != nil {
+			return nil, err
+		}
+		c.XORKeyStream(out, out)
+	case streamSalsa20:
+		key := sha256.Sum256(inner.streamKey)
+		salsa20.XORKeyStream(out, out, salsa20Nonce, &key)
+	default:
+		return nil, fmt.Errorf("unsupported KDBX inner stream %d", inner.streamID)
+	}
+	return out, nil
+}
+
+func readHeader(r *bytes.Reader) (*header, []byte, error) {
+	start := r.Size() - int64(r.Len())
+	var s1, s2, version uint32
+	if err := binary.Read(r, binary.LittleEndian, &s1); err != nil {
+		return nil, nil, fmt.Errorf("not a KDBX file")
+	}
+	if err := binary.Read(r, binary.LittleEndian, &s2); err != nil || s1 != sig1 || s2 != sig2 {
+		return nil, nil, fmt.Errorf("not a KDBX file")
+	}
+	if err := binary.Read(r, binary.LittleEndian, &version); err != nil {
+		return nil, nil, fmt.Errorf("truncated KDBX header")
+	}
+	if version>>16 != versionMajor {
+		return nil, nil, fmt.Errorf("unsupported KDBX version %d.%d (only KDBX 4 is supported)", version>>16, version&0xFFFF)
+	}
+
+	h := &header{version: version}
+	for {
+		id, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, fmt.Errorf("truncated KDBX header")
+		}
+		var size uint32
+		if err := binary.Read(r, binary.LittleEndian, &size); err != nil || int64(size) > int64(r.Len()) {
+			return nil, nil, fmt.Errorf("truncated KDBX header")
+		}
+		data := make([]byte, size)
+		_, _ = io.ReadFull(r, data)
+
+		switch id {
+		case hdrEndOfHeader:
+			end := r.Size() - int64(r.Len())
+			raw := make([]byte, end-start)
+			if _, err := r.ReadAt(raw, start); err != nil {
+				return nil, nil, err
+			}
+			if h.cipherID == nil || h.masterSeed == nil || h.iv == nil || h.kdf == nil {
+				return nil, nil, fmt.Errorf("KDBX header is missing required fields")
+			}
+			return h, raw, nil
+		case hdrCipherID:
+			h.cipherID = data
+		case hdrCompressionFlags:
+			if len(data) != 4 {
+				return nil, nil, fmt.Errorf("invalid KDBX compression flags")
+			}
+			h.compression = binary.LittleEndian.Uint32(data)
+		case hdrMasterSeed:
+			h.masterSeed = data
+		case hdrEncryptionIV:
+			h.iv = data
+		case hdrKdfParameters:
+			kdf, err := parseVariantDict(data)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid KDF parameters: %w", err)
+			}
+			h.kdf = kdf
+		case hdrPublicCustomData:
+			h.publicData = data
+		default:
+			h.unknown = append(h.unknown, headerField{id: id, data: data})
+		}
+	}
+}
+
+func writeHeader(h *header) []byte {
+	var b bytes.Buffer
+	_ = binary.Write(&b, binary.LittleEndian, sig1)
+	_ = binary.Write(&b, binary.LittleEndian, sig2)
+	_ = binary.Write(&b, binary.LittleEndian, h.version)
+
+	field := func(id byte, data []byte) {
+		b.WriteByte(id)
+		_ = binary.Write(&b, binary.LittleEndian, uint32(len(data))) // #nosec G115 -- header fields are small
+		b.Write(data)
+	}
+	var compression [4]byte
+	binary.LittleEndian.PutUint32(compression[:], h.compression)
+
+	field(hdrCipherID, h.cipherID)
+	field(hdrCompressionFlags, compression[:])
+	field(hdrMasterSeed, h.masterSeed)
+	field(hdrEncryptionIV, h.iv)
+	field(hdrKdfParameters, h.kdf.marshal())
+	if h.publicData != nil {
+		field(hdrPublicCustomData, h.publicData)
+	}
+	for _, f := range h.unknown {
+		field(f.id, f.data)
+	}
+	field(hdrEndOfHeader, []byte("\r\n\r\n"))
+	return b.Bytes()
+}
+
+func readInnerHeader(r *bytes.Reader) (*innerHeader, error) {
+	inner := &innerHeader{}
+	for {
+		id, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("truncated KDBX inner header")
+		}
+		var size uint32
+		if err := binary.Read(r, binary.LittleEndian, &size); err != nil || int64(size) > int64(r.Len()) {
+			return nil, fmt.Errorf("truncated KDBX inner header")
+		}
+		data := make([]byte, size)
+		_, _ = io.ReadFull(r, data)
+
+		switch id {
+		case innerEndOfHeader:
+			return inner, nil
+		case innerStreamID:
+			if len(data) != 4 {
+				return nil, fmt.Errorf("invalid KDBX inner stream ID")
+			}
+			inner.streamID = binary.LittleEndian.Uint32(data)
+		case innerStreamKey:
+			inner.streamKey = data
+		case innerBinary:
+			// Attachments keep their flag byte so they round-trip unchanged.
+			inner.binaries = append(inner.binaries, data)
+		}
+	}
+}
+
+func writeInnerHeader(w *bytes.Buffer, inner *innerHeader) {
+	field := func(id byte, data []byte) {
+		w.WriteByte(id)
+		_ = binary.Write(w, binary.LittleEndian, uint32(len(data))) // #nosec G115 -- attachment sizes fit in uint32
+		w.Write(data)
+	}
+	var id [4]byte
+	binary.LittleEndian.PutUint32(id[:], inner.streamID)
+	field(innerStreamID, id[:])
+	field(innerStreamKey, inner.streamKey)
+	for _, bin := range inner.binaries {
+		field(innerBinary, bin)
+	}
+	field(innerEndOfHeader, nil)
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func mustUUID(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 16 {
+		panic("kdbx: invalid UUID " + s)
+	}
+	return b
+}
@@ -0,0 +1,419 @@
+package kdbx
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPassword = "correct horse battery staple"
+
+func init() {
+	// Keep the KDFs cheap so the suite stays fast.
+	argon2Params.iterations = 1
+	argon2Params.memory = 1 << 20
+	aesKDFRounds = 10
+}
+
+func newTestStore(t *testing.T, opts Options) *Store {
+	t.Helper()
+	if opts.Path == "" {
+		opts.Path = filepath.Join(t.TempDir(), "test.kdbx")
+	}
+	if opts.PassphraseEnv == "" {
+		opts.PassphraseEnv = "LOCKSMITH_TEST_KDBX_PASSWORD"
+		t.Setenv(opts.PassphraseEnv, testPassword)
+	}
+	s, err := New(opts)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return s
+}
+
+// writeFixture creates a database at path the way another KeePass client
+// would: no locksmith fields, entries in nested groups, plus elements
+// locksmith does not interpret.
+func writeFixture(t *testing.T, s *Store, edit func(doc *node)) {
+	t.Helper()
+	db, err := s.newDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	edit(db.doc)
+	transformed, err := s.transform(db.header.kdf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := encode(db, transformed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(s.Path(), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func rawOpen(t *testing.T, path, password string) *database {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, _, err := decode(data, func(kdf variantDict) ([]byte, error) {
+		return transformKey(kdf, compositeKey([]byte(password), nil))
+	})
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return db
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	for _, kdf := range []string{KDFArgon2d, KDFArgon2id, KDFAES} {
+		for _, c := range []string{CipherChaCha20, CipherAES256} {
+			t.Run(kdf+"/"+c, func(t *testing.T) {
+				s := newTestStore(t, Options{KDF: kdf, Cipher: c})
+				expires := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+
+				err := s.SetEntry("svc", "db/prod/password", Entry{
+					Password: []byte("s3cr3t <&>"),
+					Fields:   map[string]string{"locksmith.secret_type": "password"},
+					Expires:  expires,
+				})
+				if err != nil {
+					t.Fatalf("SetEntry: %v", err)
+				}
+				if err := s.SetEntry("svc", "api-key", Entry{Password: []byte("k")}); err != nil {
+					t.Fatalf("SetEntry: %v", err)
+				}
+
+				// A fresh store has no cached key and must re-derive it.
+				fresh := newTestStore(t, Options{Path: s.Path(), PassphraseEnv: "LOCKSMITH_TEST_KDBX_PASSWORD"})
+				e, err := fresh.GetEntry("svc", "db/prod/password")
+				if err != nil {
+					t.Fatalf("GetEntry: %v", err)
+				}
+				if string(e.Password) != "s3cr3t <&>" {
+					t.Errorf("unexpected password %q", e.Password)
+				}
+				if e.Fields["locksmith.secret_type"] != "password" || e.Fields[ServiceField] != "svc" {
+					t.Errorf("unexpected fields %v", e.Fields)
+				}
+				if !e.Expires.Equal(expires) {
+					t.Errorf("expected expiry %v, got %v", expires, e.Expires)
+				}
+
+				keys, err := fresh.List("svc", false, "")
+				if err != nil {
+					t.Fatalf("List: %v", err)
+				}
+				if !reflect.DeepEqual(keys, []string{"api-key", "db/prod/password"}) {
+					t.Errorf("unexpected keys %v", keys)
+				}
+				if other, _ := fresh.List("other", false, ""); len(other) != 0 {
+					t.Errorf("entries written for svc should be hidden from other services: %v", other)
+				}
+
+				if err := fresh.Delete("svc", "api-key", false, ""); err != nil {
+					t.Fatalf("Delete: %v", err)
+				}
+				if _, err := fresh.GetEntry("svc", "api-key"); !errors.Is(err, ErrNotFound) {
+					t.Errorf("expected ErrNotFound after delete, got %v", err)
+				}
+				db := rawOpen(t, s.Path(), testPassword)
+				if deleted := db.doc.child("Root").child("DeletedObjects"); deleted == nil || len(deleted.all("DeletedObject")) != 1 {
+					t.Error("expected a DeletedObjects record")
+				}
+			})
+		}
+	}
+}
+
+func TestStoreWrongPassword(t *testing.T) {
+	s := newTestStore(t, Options{})
+	if err := s.SetEntry("svc", "k", Entry{Password: []byte("v")}); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("LOCKSMITH_TEST_KDBX_WRONG", "wrong")
+	wrong := newTestStore(t, Options{Path: s.Path(), PassphraseEnv: "LOCKSMITH_TEST_KDBX_WRONG"})
+	if _, err := wrong.GetEntry("svc", "k"); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("expected ErrInvalidKey, got %v", err)
+	}
+}
+
+func TestStoreRequiresCredentials(t *testing.T) {
+	t.Setenv("LOCKSMITH_TEST_KDBX_EMPTY", "")
+	s, err := New(Options{Path: filepath.Join(t.TempDir(), "x.kdbx"), PassphraseEnv: "LOCKSMITH_TEST_KDBX_EMPTY"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetEntry("svc", "k", Entry{Password: []byte("v")}); err == nil || !strings.Contains(err.Error(), "requires a password") {
+		t.Fatalf("expected missing password error, got %v", err)
+	}
+}
+
+func TestStoreReadsForeignEntries(t *testing.T) {
+	s := newTestStore(t, Options{Group: "Work/CI"})
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	writeFixture(t, s, func(doc *node) {
+		root := doc.child("Root").child("Group")
+		work := subgroup(subgroup(root, "Work", true), "CI", true)
+		e := newEntryNode("deploy-token", created)
+		setString(e, fieldPassword, "tok-123", true)
+		setString(e, "URL", "https://ci.example.com", false)
+		setString(e, "Recovery codes", "a b c", true)
+		e.children = append(e.children, &node{name: "CustomData", children: []*node{
+			{name: "Item", children: []*node{newNode("Key", "plugin"), newNode("Value", "kept")}},
+		}})
+		work.children = append(work.children, e)
+
+		nested := subgroup(work, "gitlab", true)
+		g := newEntryNode("runner", created)
+		setString(g, fieldPassword, "r", true)
+		nested.children = append(nested.children, g)
+
+		doc.child("Meta").children = append(doc.child("Meta").children, &node{name: "CustomIcons"})
+	})
+
+	keys, err := s.List("any-service", false, "")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if !reflect.DeepEqual(keys, []string{"deploy-token", "gitlab/runner"}) {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+
+	e, err := s.GetEntry("any-service", "deploy-token")
+	if err != nil {
+		t.Fatalf("GetEntry: %v", err)
+	}
+	if string(e.Password) != "tok-123" || e.Fields["URL"] != "https://ci.example.com" || !e.Created.Equal(created) {
+		t.Errorf("unexpected entry %+v", e)
+	}
+
+	// Updating the entry keeps fields, custom data and protection it did not touch.
+	if err := s.SetEntry("svc", "deploy-token", Entry{Password: []byte("tok-456")}); err != nil {
+		t.Fatalf("SetEntry: %v", err)
+	}
+	if keys, _ := s.List("another-service", false, ""); len(keys) != 2 {
+		t.Errorf("updating a shared entry should keep it visible to every service: %v", keys)
+	}
+	db := rawOpen(t, s.Path(), testPassword)
+	if db.doc.child("Meta").child("CustomIcons") == nil {
+		t.Error("unknown Meta element was dropped")
+	}
+	work := subgroup(subgroup(db.doc.child("Root").child("Group"), "Work", false), "CI", false)
+	entry, _, _ := findEntry(work, "svc", "deploy-token")
+	if entry == nil {
+		t.Fatal("entry not found after update")
+	}
+	if got := stringField(entry, fieldPassword); got != "tok-456" {
+		t.Errorf("password not updated: %q", got)
+	}
+	if got := stringField(entry, "Recovery codes"); got != "a b c" {
+		t.Errorf("protected custom field not preserved: %q", got)
+	}
+	if entry.child("CustomData") == nil {
+		t.Error("entry CustomData was dropped")
+	}
+	history := entry.child("History")
+	if history == nil || len(history.all("Entry")) != 1 || stringField(history.all("Entry")[0], fieldPassword) != "tok-123" {
+		t.Error("expected previous version in entry history")
+	}
+}
+
+func TestStoreManagedFieldsReplaced(t *testing.T) {
+	s := newTestStore(t, Options{})
+	if err := s.SetEntry("svc", "k", Entry{Password: []byte("v1"), Fields: map[string]string{"locksmith.meta.a": "1", "locksmith.meta.b": "2"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetEntry("svc", "k", Entry{Password: []byte("v2"), Fields: map[string]string{"locksmith.meta.a": "3"}}); err != nil {
+		t.Fatal(err)
+	}
+	e, err := s.GetEntry("svc", "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Fields["locksmith.meta.a"] != "3" {
+		t.Errorf("expected updated field, got %v", e.Fields)
+	}
+	if _, ok := e.Fields["locksmith.meta.b"]; ok {
+		t.Errorf("stale managed field kept: %v", e.Fields)
+	}
+}
+
+func TestStoreRejectsUnmappableKeys(t *testing.T) {
+	s := newTestStore(t, Options{})
+	if err := s.SetEntry("svc", "a//b", Entry{Password: []byte("v")}); err == nil {
+		t.Fatal("expected error for empty path component")
+	}
+}
+
+func TestKeyFiles(t *testing.T) {
+	dir := t.TempDir()
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	sum := sha256.Sum256(key)
+	hexKey := strings.ToUpper(hex.EncodeToString(key))
+
+	files := map[string]string{
+		"v2.keyx": `<?xml version="1.0" encoding="utf-8"?>
+<KeyFile>
+	<Meta><Version>2.0</Version></Meta>
+	<Key><Data Hash="` + hex.EncodeToString(sum[:4]) + `">` + hexKey[:32] + " " + hexKey[32:] + `</Data></Key>
+</KeyFile>`,
+		"hex.key": hexKey + "\n",
+		"raw.key": string(key),
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		got, err := readKeyFile(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(got, key) {
+			t.Errorf("%s: unexpected key %x", name, got)
+		}
+	}
+
+	other := filepath.Join(dir, "photo.jpg")
+	if err := os.WriteFile(other, []byte("not a key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readKeyFile(other)
+	want := sha256.Sum256([]byte("not a key"))
+	if err != nil || !reflect.DeepEqual(got, want[:]) {
+		t.Errorf("arbitrary files should be hashed, got %x (%v)", got, err)
+	}
+}
+
+func TestKeyFileOnlyDatabase(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "db.key")
+	if err := os.WriteFile(keyFile, []byte("some key material"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("LOCKSMITH_TEST_KDBX_EMPTY", "")
+	opts := Options{Path: filepath.Join(dir, "db.kdbx"), KeyFile: keyFile, PassphraseEnv: "LOCKSMITH_TEST_KDBX_EMPTY"}
+	s, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetEntry("svc", "k", Entry{Password: []byte("v")}); err != nil {
+		t.Fatalf("SetEntry: %v", err)
+	}
+	fresh, _ := New(opts)
+	if e, err := fresh.GetEntry("svc", "k"); err != nil || string(e.Password) != "v" {
+		t.Fatalf("GetEntry = %v, %v", e, err)
+	}
+}
+
+// TestExternalFixtures reads the databases under testdata, which were
+// written by an encoder independent of this package (see
+// testdata/README.md), so the decoder is not only checked against its own
+// output.
+func TestExternalFixtures(t *testing.T) {
+	for _, tc := range []struct {
+		file, password string
+		keyFile        bool
+	}{
+		{file: "argon2d-chacha20.kdbx", password: "fixture password"},
+		{file: "argon2id-aes256-keyfile.kdbx", password: "fixture password", keyFile: true},
+		{file: "aeskdf-chacha20-keyfile-only.kdbx", keyFile: true},
+	} {
+		t.Run(tc.file, func(t *testing.T) {
+			// The store takes a lock file next to the database, so read a copy.
+			dir := t.TempDir()
+			opts := Options{Path: copyFixture(t, tc.file, dir), PassphraseEnv: "LOCKSMITH_TEST_KDBX_FIXTURE"}
+			if tc.keyFile {
+				opts.KeyFile = copyFixture(t, "fixture.keyx", dir)
+			}
+			t.Setenv(opts.PassphraseEnv, tc.password)
+			s, err := New(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			entries, err := s.ListEntries("svc")
+			if err != nil {
+				t.Fatalf("ListEntries: %v", err)
+			}
+			if len(entries) != 2 {
+				t.Errorf("expected api-token and db/password, got %v", entries)
+			}
+			if token := entries["api-token"]; !token.Expires.Equal(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)) {
+				t.Errorf("unexpected api-token %+v", token)
+			}
+			token, err := s.GetEntry("svc", "api-token")
+			if err != nil || string(token.Password) != "tok-123" {
+				t.Errorf("GetEntry(api-token) = %+v, %v", token, err)
+			}
+			db, err := s.GetEntry("svc", "db/password")
+			if err != nil {
+				t.Fatalf("GetEntry: %v", err)
+			}
+			if string(db.Password) != "hunter2" || db.Fields["port"] != "5432" || db.Fields["ca"] != "-----BEGIN-----" {
+				t.Errorf("unexpected db/password %+v", db)
+			}
+			if !db.Created.Equal(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)) {
+				t.Errorf("unexpected creation time %v", db.Created)
+			}
+
+			root, err := New(Options{Path: opts.Path, KeyFile: opts.KeyFile, PassphraseEnv: opts.PassphraseEnv, Group: "/"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			keys, err := root.List("svc", false, "")
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			want := []string{"GitHub", "locksmith/api-token", "locksmith/db/password"}
+			if !reflect.DeepEqual(keys, want) {
+				t.Errorf("expected %v without the recycle bin, got %v", want, keys)
+			}
+			gh, err := root.GetEntry("svc", "GitHub")
+			if err != nil {
+				t.Fatalf("GetEntry: %v", err)
+			}
+			if string(gh.Password) != "github-password" || gh.Fields["UserName"] != "octocat" || gh.Fields["URL"] != "https://github.com" {
+				t.Errorf("unexpected GitHub entry %+v", gh)
+			}
+		})
+	}
+}
+
+func copyFixture(t *testing.T, name, dir string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestTimeEncoding(t *testing.T) {
+	ts := time.Date(2025, 6, 30, 8, 15, 0, 0, time.UTC)
+	got, ok := parseTime(formatTime(ts))
+	if !ok || !got.Equal(ts) {
+		t.Errorf("round trip: got %v", got)
+	}
+	if got, ok := parseTime("2020-01-02T03:04:05Z"); !ok || got.Year() != 2020 {
+		t.Errorf("ISO 8601 timestamps should parse, got %v", got)
+	}
+}
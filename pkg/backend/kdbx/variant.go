@@ -0,0 +1,138 @@
+package kdbx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// VariantDictionary value types.
+const (
+	vdEnd       = 0x00
+	vdUInt32    = 0x04
+	vdUInt64    = 0x05
+	vdBool      = 0x08
+	vdInt32     = 0x0C
+	vdInt64     = 0x0D
+	vdString    = 0x18
+	vdByteArray = 0x42
+
+	vdVersion      = 0x0100
+	vdVersionMajor = 0xFF00
+)
+
+// variantDict is a KDBX VariantDictionary (used for KDF parameters and
+// public custom data). Entry order is preserved.
+type variantDict []variantEntry
+
+type variantEntry struct {
+	typ   byte
+	key   string
+	value []byte
+}
+
+func parseVariantDict(data []byte) (variantDict, error) {
+	r := bytes.NewReader(data)
+	var version uint16
+	if err := binary.Read(r, binary.LittleEndian, &version); err != nil {
+		return nil, fmt.Errorf("truncated variant dictionary")
+	}
+	if version&vdVersionMajor > vdVersion&vdVersionMajor {
+		return nil, fmt.Errorf("unsupported variant dictionary version 0x%04x", version)
+	}
+
+	var d variantDict
+	for {
+		typ, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("truncated variant dictionary")
+		}
+		if typ == vdEnd {
+			return d, nil
+		}
+		key, err := readSized(r)
+		if err != nil {
+			return nil, err
+		}
+		value, err := readSized(r)
+		if err != nil {
+			return nil, err
+		}
+		d = append(d, variantEntry{typ: typ, key: string(key), value: value})
+	}
+}
+
+func readSized(r *bytes.Reader) ([]byte, error) {
+	var size uint32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil || int64(size) > int64(r.Len()) {
+		return nil, fmt.Errorf("truncated variant dictionary")
+	}
+	b := make([]byte, size)
+	_, _ = r.Read(b)
+	return b, nil
+}
+
+func (d variantDict) marshal() []byte {
+	var b bytes.Buffer
+	_ = binary.Write(&b, binary.LittleEndian, uint16(vdVersion))
+	for _, e := range d {
+		b.WriteByte(e.typ)
+		_ = binary.Write(&b, binary.LittleEndian, uint32(len(e.key))) // #nosec G115 -- keys are short
+		b.WriteString(e.key)
+		_ = binary.Write(&b, binary.LittleEndian, uint32(len(e.value))) // #nosec G115 -- values are short
+		b.Write(e.value)
+	}
+	b.WriteByte(vdEnd)
+	return b.Bytes()
+}
+
+func (d variantDict) get(key string, typ byte) ([]byte, bool) {
+	for _, e := range d {
+		if e.key == key && e.typ == typ {
+			return e.value, true
+		}
+	}
+	return nil, false
+}
+
+func (d variantDict) bytes(key string) ([]byte, bool) {
+	return d.get(key, vdByteArray)
+}
+
+func (d variantDict) uint32(key string) (uint32, bool) {
+	v, ok := d.get(key, vdUInt32)
+	if !ok || len(v) != 4 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint32(v), true
+}
+
+func (d variantDict) uint64(key string) (uint64, bool) {
+	v, ok := d.get(key, vdUInt64)
+	if !ok || len(v) != 8 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint64(v), true
+}
+
+func (d *variantDict) set(key string, typ byte, value []byte) {
+	for i, e := range *d {
+		if e.key == key {
+			(*d)[i] = variantEntry{typ: typ, key: key, value: value}
+			return
+		}
+	}
+	*d = append(*d, variantEntry{typ: typ, key: key, value: value})
+}
+
+func (d *variantDict) setUint32(key string, v uint32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	d.set(key, vdUInt32, b[:])
+}
+
+func (d *variantDict) setUint64(key string, v uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	d.set(key, vdUInt64, b[:])
+}
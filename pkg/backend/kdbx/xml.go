@@ -0,0 +1,309 @@
+package kdbx
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// node is a generic XML element. The KeePass document is kept as a tree
+// rather than decoded into structs so that elements locksmith does not know
+// about (plugin data, custom icons, newer KDBX 4.1 fields) survive a save.
+type node struct {
+	name     string
+	attrs    []xml.Attr
+	text     string
+	children []*node
+	// protected marks values stored with Protected="True". text holds the
+	// plaintext; the inner random stream is applied when the file is written.
+	protected bool
+}
+
+// kdbxEpoch is the origin of KDBX 4 timestamps (seconds since 0001-01-01 UTC).
+var kdbxEpoch = time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newNode(name, text string) *node {
+	return &node{name: name, text: text}
+}
+
+func (n *node) child(name string) *node {
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func (n *node) all(name string) []*node {
+	var out []*node
+	for _, c := range n.children {
+		if c.name == name {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// ensure returns the named child, appending an empty one if missing.
+func (n *node) ensure(name string) *node {
+	if c := n.child(name); c != nil {
+		return c
+	}
+	c := newNode(name, "")
+	n.children = append(n.children, c)
+	return c
+}
+
+// insertBefore inserts c before the first child named any of names, or
+// appends it when there is none.
+func (n *node) insertBefore(c *node, names ...string) {
+	for i, existing := range n.children {
+		for _, name := range names {
+			if existing.name == name {
+				n.children = append(n.children[:i], append([]*node{c}, n.children[i:]...)...)
+				return
+			}
+		}
+	}
+	n.children = append(n.children, c)
+}
+
+func (n *node) remove(c *node) {
+	for i, existing := range n.children {
+		if existing == c {
+			n.children = append(n.children[:i], n.children[i+1:]...)
+			return
+		}
+	}
+}
+
+func (n *node) clone() *node {
+	c := *n
+	c.attrs = append([]xml.Attr(nil), n.attrs...)
+	c.children = make([]*node, len(n.children))
+	for i, ch := range n.children {
+		c.children[i] = ch.clone()
+	}
+	return &c
+}
+
+func (n *node) attr(name string) string {
+	for _, a := range n.attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func (n *node) removeAttr(name string) {
+	for i, a := range n.attrs {
+		if a.Name.Local == name {
+			n.attrs = append(n.attrs[:i], n.attrs[i+1:]...)
+			return
+		}
+	}
+}
+
+// walk visits n and its descendants in document order.
+func (n *node) walk(fn func(*node)) {
+	fn(n)
+	for _, c := range n.children {
+		c.walk(fn)
+	}
+}
+
+func parseXML(r io.Reader) (*node, error) {
+	root, err := parseTree(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse KDBX XML: %w", err)
+	}
+	if root.name != "KeePassFile" {
+		return nil, fmt.Errorf("KDBX payload is not a KeePass document")
+	}
+	return root, nil
+}
+
+// parseTree reads an XML document into a node tree. Whitespace between
+// elements is dropped; text content of leaf elements is kept verbatim.
+func parseTree(r io.Reader) (*node, error) {
+	dec := xml.NewDecoder(r)
+	var stack []*node
+	var root *node
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &node{name: t.Name.Local, attrs: append([]xml.Attr(nil), t.Attr...)}
+			if len(stack) == 0 {
+				if root != nil {
+					return nil, fmt.Errorf("multiple root elements")
+				}
+				root = n
+			} else {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, n)
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			n := stack[len(stack)-1]
+			if len(n.children) > 0 && strings.TrimSpace(n.text) == "" {
+				n.text = ""
+			}
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(t)
+			}
+		}
+	}
+	if root == nil {
+		return nil, fmt.Errorf("empty document")
+	}
+	return root, nil
+}
+
+// unprotect decodes every Protected="True" value in document order.
+func unprotect(doc *node, inner *innerHeader) error {
+	var nodes []*node
+	var values [][]byte
+	total := 0
+	var decodeErr error
+	doc.walk(func(n *node) {
+		if decodeErr != nil || !strings.EqualFold(n.attr("Protected"), "True") {
+			return
+		}
+		v, err := base64.StdEncoding.DecodeString(strings.TrimSpace(n.text))
+		if err != nil {
+			decodeErr = fmt.Errorf("invalid protected value in <%s>: %w", n.name, err)
+			return
+		}
+		nodes = append(nodes, n)
+		values = append(values, v)
+		total += len(v)
+	})
+	if decodeErr != nil || len(nodes) == 0 {
+		return decodeErr
+	}
+
+	ks, err := innerKeystream(inner, total)
+	if err != nil {
+		return err
+	}
+	for i, n := range nodes {
+		v := values[i]
+		for j := range v {
+			v[j] ^= ks[j]
+		}
+		ks = ks[len(v):]
+		n.text = string(v)
+		n.protected = true
+		n.removeAttr("Protected")
+	}
+	return nil
+}
+
+// writeXML serialises doc, obfuscating protected values with the inner
+// random stream in document order.
+func writeXML(w io.Writer, doc *node, inner *innerHeader) error {
+	total := 0
+	doc.walk(func(n *node) {
+		if n.protected {
+			total += len(n.text)
+		}
+	})
+	ks, err := innerKeystream(inner, total)
+	if err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0" encoding="utf-8" standalone="yes"?>` + "\n")
+	writeNode(&b, doc, 0, &ks)
+	_, err = w.Write(b.Bytes())
+	return err
+}
+
+func writeNode(b *bytes.Buffer, n *node, depth int, ks *[]byte) {
+	indent := strings.Repeat("\t", depth)
+	b.WriteString(indent)
+	b.WriteByte('<')
+	b.WriteString(n.name)
+	for _, a := range n.attrs {
+		b.WriteByte(' ')
+		if a.Name.Space != "" {
+			b.WriteString(a.Name.Space)
+			b.WriteByte(':')
+		}
+		b.WriteString(a.Name.Local)
+		b.WriteString(`="`)
+		_ = xml.EscapeText(b, []byte(a.Value))
+		b.WriteByte('"')
+	}
+
+	text := n.text
+	if n.protected {
+		b.WriteString(` Protected="True"`)
+		v := []byte(n.text)
+		for i := range v {
+			v[i] ^= (*ks)[i]
+		}
+		*ks = (*ks)[len(v):]
+		text = base64.StdEncoding.EncodeToString(v)
+	}
+
+	switch {
+	case len(n.children) > 0:
+		b.WriteString(">\n")
+		for _, c := range n.children {
+			writeNode(b, c, depth+1, ks)
+		}
+		b.WriteString(indent)
+	case text != "":
+		b.WriteByte('>')
+		_ = xml.EscapeText(b, []byte(text))
+	default:
+		b.WriteString(" />\n")
+		return
+	}
+	b.WriteString("</")
+	b.WriteString(n.name)
+	b.WriteString(">\n")
+}
+
+// parseTime reads a KDBX 4 timestamp (base64 little-endian seconds since
+// kdbxEpoch) or the ISO 8601 form used by KDBX 3 and some exporters.
+func parseTime(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, false
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, true
+	}
+	raw, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(raw) != 8 {
+		return time.Time{}, false
+	}
+	secs := int64(binary.LittleEndian.Uint64(raw)) // #nosec G115 -- KDBX stores a signed int64
+	return time.Unix(secs+kdbxEpoch.Unix(), 0).UTC(), true
+}
+
+func formatTime(t time.Time) string {
+	secs := t.UTC().Unix() - kdbxEpoch.Unix()
+	var raw [8]byte
+	binary.LittleEndian.PutUint64(raw[:], uint64(secs)) // #nosec G115 -- round-trips the signed value
+	return base64.StdEncoding.EncodeToString(raw[:])
+}
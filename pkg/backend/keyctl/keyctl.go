@@ -0,0 +1,51 @@
+// Package keyctl implements a locksmith Backend on top of the Linux kernel
+// key retention service. Secrets live in kernel memory only, are scoped to
+// a user, session or persistent keyring, and can carry a kernel-enforced
+// expiry. It needs neither D-Bus nor a desktop session, which makes it a
+// good fit for long-running servers and SSH sessions.
+package keyctl
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Keyring scopes accepted by Options.Scope.
+const (
+	// ScopeUser stores keys in the per-UID user keyring, shared by every
+	// process of the user until the last one exits.
+	ScopeUser = "user"
+	// ScopeSession stores keys in the session keyring of the calling
+	// process (typically one login or SSH session).
+	ScopeSession = "session"
+	// ScopePersistent stores keys in the per-UID persistent keyring, which
+	// survives logouts until it expires (see /proc/sys/kernel/keys/persistent_keyring_expiry).
+	ScopePersistent = "persistent"
+)
+
+// ErrNotFound is returned by Get when the requested account does not exist.
+var ErrNotFound = errors.New("Secret not found") // match native bridge error convention
+
+// Options configures a kernel keyring backend.
+type Options struct {
+	// Scope selects the keyring: ScopeUser (default), ScopeSession or ScopePersistent.
+	Scope string
+}
+
+func normalizeScope(scope string) (string, error) {
+	switch s := strings.ToLower(strings.TrimSpace(scope)); s {
+	case "":
+		return ScopeUser, nil
+	case ScopeUser, ScopeSession, ScopePersistent:
+		return s, nil
+	default:
+		return "", fmt.Errorf("unknown keyring scope '%s' (supported: user, session, persistent)", scope)
+	}
+}
+
+// description returns the key description used for service/account. The
+// service prefix lets List find locksmith's keys among unrelated ones.
+func description(service, account string) string {
+	return service + ":" + account
+}
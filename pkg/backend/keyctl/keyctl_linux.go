@@ -0,0 +1,215 @@
+//go:build linux
+// +build linux
+
+package keyctl
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	keyType = "user"
+
+	// keyPerm grants the possessor and the owning user full access, so keys
+	// stay usable from processes that reach the keyring without possessing it.
+	keyPerm = 0x3f3f0000
+
+	// maxPayload is the kernel limit for "user" key payloads.
+	maxPayload = 32767
+)
+
+// Keyring is a Backend over a kernel keyring.
+type Keyring struct {
+	scope string
+}
+
+// New returns a Keyring for the given options.
+func New(opts Options) (*Keyring, error) {
+	scope, err := normalizeScope(opts.Scope)
+	if err != nil {
+		return nil, err
+	}
+	k := &Keyring{scope: scope}
+	if _, err := k.ringID(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Scope returns the keyring scope in use.
+func (k *Keyring) Scope() string {
+	return k.scope
+}
+
+// Set stores data for service/account without an expiry. requireBiometrics
+// is ignored: access is governed by keyring permissions instead.
+func (k *Keyring) Set(service, account string, data []byte, requireBiometrics bool) error {
+	return k.SetWithExpiry(service, account, data, time.Time{}, requireBiometrics)
+}
+
+// SetWithExpiry stores data for service/account and asks the kernel to
+// drop the key at expiresAt. A zero or past expiresAt stores the key
+// without a timeout so an already-expired secret can still be rotated.
+func (k *Keyring) SetWithExpiry(service, account string, data []byte, expiresAt time.Time, requireBiometrics bool) error {
+	if len(data) > maxPayload {
+		return fmt.Errorf("secret '%s' is too large for the kernel keyring (%d bytes, max %d)", account, len(data), maxPayload)
+	}
+	ring, err := k.ringID()
+	if err != nil {
+		return err
+	}
+
+	// add_key updates the payload in place when the key already exists.
+	id, err := unix.AddKey(keyType, description(service, account), data, ring)
+	if err != nil {
+		return fmt.Errorf("failed to add key to %s keyring: %w", k.scope, err)
+	}
+	if err := unix.KeyctlSetperm(id, keyPerm); err != nil {
+		return fmt.Errorf("failed to set key permissions: %w", err)
+	}
+
+	var timeout int
+	if !expiresAt.IsZero() {
+		if d := time.Until(expiresAt); d > 0 {
+			timeout = int(math.Ceil(math.Min(d.Seconds(), math.MaxUint32)))
+		}
+	}
+	// A timeout of 0 clears any expiry left over from a previous value.
+	if _, err := unix.KeyctlInt(unix.KEYCTL_SET_TIMEOUT, id, timeout, 0, 0); err != nil {
+		return fmt.Errorf("failed to set key timeout: %w", err)
+	}
+	return nil
+}
+
+// Get reads the payload stored for service/account.
+func (k *Keyring) Get(service, account string, useBiometrics bool, prompt string) ([]byte, error) {
+	id, err := k.search(service, account)
+	if err != nil {
+		return nil, err
+	}
+	return readKey(id)
+}
+
+// Delete invalidates the key for service/account. Deleting a missing key is not an error.
+func (k *Keyring) Delete(service, account string, useBiometrics bool, prompt string) error {
+	id, err := k.search(service, account)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if _, err := unix.KeyctlInt(unix.KEYCTL_INVALIDATE, id, 0, 0, 0); err != nil {
+		// Kernels without KEYCTL_INVALIDATE: unlinking from our keyring is
+		// enough for the key to be garbage collected.
+		ring, ringErr := k.ringID()
+		if ringErr != nil {
+			return ringErr
+		}
+		if _, err := unix.KeyctlInt(unix.KEYCTL_UNLINK, id, ring, 0, 0); err != nil {
+			return fmt.Errorf("failed to remove key: %w", err)
+		}
+	}
+	return nil
+}
+
+// List returns the sorted account names stored for service in the keyring.
+func (k *Keyring) List(service string, useBiometrics bool, prompt string) ([]string, error) {
+	ring, err := k.ringID()
+	if err != nil {
+		return nil, err
+	}
+	payload, err := readKey(ring)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s keyring: %w", k.scope, err)
+	}
+
+	prefix := description(service, "")
+	var keys []string
+	for i := 0; i+4 <= len(payload); i += 4 {
+		id := int(int32(binary.NativeEndian.Uint32(payload[i : i+4]))) // #nosec G115 -- key serials are int32
+		desc, err := unix.KeyctlString(unix.KEYCTL_DESCRIBE, id)
+		if err != nil {
+			// Keys we may not view (or that expired meanwhile) are skipped.
+			continue
+		}
+		// Format: type;uid;gid;perm;description
+		parts := strings.SplitN(desc, ";", 5)
+		if len(parts) != 5 || parts[0] != keyType || !strings.HasPrefix(parts[4], prefix) {
+			continue
+		}
+		keys = append(keys, strings.TrimPrefix(parts[4], prefix))
+	}
+	sort.Strings(keys)
+	if keys == nil {
+		keys = []string{}
+	}
+	return keys, nil
+}
+
+func (k *Keyring) search(service, account string) (int, error) {
+	ring, err := k.ringID()
+	if err != nil {
+		return 0, err
+	}
+	id, err := unix.KeyctlSearch(ring, keyType, description(service, account), 0)
+	if err != nil {
+		if errors.Is(err, unix.ENOKEY) || errors.Is(err, unix.EKEYEXPIRED) || errors.Is(err, unix.EKEYREVOKED) {
+			return 0, ErrNotFound
+		}
+		return 0, fmt.Errorf("failed to search %s keyring: %w", k.scope, err)
+	}
+	return id, nil
+}
+
+// ringID resolves the configured scope to a keyring serial, creating the
+// keyring if it does not exist yet.
+func (k *Keyring) ringID() (int, error) {
+	var (
+		id  int
+		err error
+	)
+	switch k.scope {
+	case ScopeSession:
+		id, err = unix.KeyctlGetKeyringID(unix.KEY_SPEC_SESSION_KEYRING, true)
+	case ScopePersistent:
+		// -1 selects the caller's UID; the keyring is also linked into the
+		// session keyring so that its keys are possessed.
+		id, err = unix.KeyctlInt(unix.KEYCTL_GET_PERSISTENT, -1, unix.KEY_SPEC_SESSION_KEYRING, 0, 0)
+	default:
+		id, err = unix.KeyctlGetKeyringID(unix.KEY_SPEC_USER_KEYRING, true)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("kernel %s keyring unavailable: %w", k.scope, err)
+	}
+	return id, nil
+}
+
+// readKey returns the payload of key id, growing the buffer as needed.
+func readKey(id int) ([]byte, error) {
+	buf := make([]byte, 512)
+	for {
+		n, err := unix.KeyctlBuffer(unix.KEYCTL_READ, id, buf, 0)
+		if err != nil {
+			if errors.Is(err, unix.EKEYEXPIRED) || errors.Is(err, unix.EKEYREVOKED) {
+				return nil, ErrNotFound
+			}
+			return nil, fmt.Errorf("failed to read key: %w", err)
+		}
+		if n <= len(buf) {
+			return buf[:n], nil
+		}
+		for i := range buf {
+			buf[i] = 0
+		}
+		buf = make([]byte, n)
+	}
+}
@@ -0,0 +1,143 @@
+//go:build linux
+// +build linux
+
+package keyctl
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func newTestKeyring(t *testing.T, scope string) (*Keyring, string) {
+	t.Helper()
+	k, err := New(Options{Scope: scope})
+	if err != nil {
+		t.Skipf("kernel keyring unavailable: %v", err)
+	}
+	service := fmt.Sprintf("locksmith-test-%d-%d", os.Getpid(), time.Now().UnixNano())
+	t.Cleanup(func() {
+		keys, _ := k.List(service, false, "")
+		for _, key := range keys {
+			_ = k.Delete(service, key, false, "")
+		}
+	})
+	return k, service
+}
+
+func TestRoundTrip(t *testing.T) {
+	k, service := newTestKeyring(t, ScopeUser)
+
+	if err := k.Set(service, "b", []byte("two"), false); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := k.Set(service, "a", []byte("one"), false); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := k.Set(service, "a", []byte("updated"), false); err != nil {
+		t.Fatalf("Set (update): %v", err)
+	}
+
+	got, err := k.Get(service, "a", false, "")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if string(got) != "updated" {
+		t.Fatalf("Get = %q, want %q", got, "updated")
+	}
+
+	keys, err := k.List(service, false, "")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if !reflect.DeepEqual(keys, []string{"a", "b"}) {
+		t.Fatalf("List = %v, want [a b]", keys)
+	}
+
+	if err := k.Delete(service, "a", false, ""); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := k.Get(service, "a", false, ""); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after Delete err = %v, want ErrNotFound", err)
+	}
+	if err := k.Delete(service, "a", false, ""); err != nil {
+		t.Fatalf("Delete missing key: %v", err)
+	}
+}
+
+func TestLargePayload(t *testing.T) {
+	k, service := newTestKeyring(t, ScopeUser)
+
+	data := make([]byte, 4096)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	if err := k.Set(service, "large", data, false); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	got, err := k.Get(service, "large", false, "")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if !reflect.DeepEqual(got, data) {
+		t.Fatal("payload mismatch")
+	}
+
+	if err := k.Set(service, "too-large", make([]byte, maxPayload+1), false); err == nil {
+		t.Fatal("expected error for oversized payload")
+	}
+}
+
+func TestSetWithExpiryAppliesTimeout(t *testing.T) {
+	k, service := newTestKeyring(t, ScopeUser)
+
+	if err := k.SetWithExpiry(service, "short", []byte("v"), time.Now().Add(time.Second), false); err != nil {
+		t.Fatalf("SetWithExpiry: %v", err)
+	}
+	if _, err := k.Get(service, "short", false, ""); err != nil {
+		t.Fatalf("Get before expiry: %v", err)
+	}
+
+	time.Sleep(2500 * time.Millisecond)
+	if _, err := k.Get(service, "short", false, ""); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after expiry err = %v, want ErrNotFound", err)
+	}
+
+	// Past expiry stores without a timeout.
+	if err := k.SetWithExpiry(service, "past", []byte("v"), time.Now().Add(-time.Hour), false); err != nil {
+		t.Fatalf("SetWithExpiry (past): %v", err)
+	}
+	if _, err := k.Get(service, "past", false, ""); err != nil {
+		t.Fatalf("Get past-expiry key: %v", err)
+	}
+}
+
+func TestSessionScope(t *testing.T) {
+	k, service := newTestKeyring(t, ScopeSession)
+	if err := k.Set(service, "s", []byte("v"), false); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	user, err := New(Options{Scope: ScopeUser})
+	if err != nil {
+		t.Fatal(err)
+	}
+	userRing, _ := user.ringID()
+	sessionRing, _ := k.ringID()
+	if userRing == sessionRing {
+		t.Skip("session keyring is the user keyring on this host")
+	}
+	if _, err := unix.KeyctlSearch(userRing, keyType, description(service, "s"), 0); err == nil {
+		t.Fatal("session-scoped key should not be in the user keyring")
+	}
+}
+
+func TestInvalidScope(t *testing.T) {
+	if _, err := New(Options{Scope: "thread"}); err == nil {
+		t.Fatal("expected error for unknown scope")
+	}
+}
@@ -0,0 +1,44 @@
+//go:build !linux
+// +build !linux
+
+package keyctl
+
+import (
+	"fmt"
+	"time"
+)
+
+var errUnsupported = fmt.Errorf("the kernel keyring backend is only available on Linux")
+
+// Keyring is a Backend over a kernel keyring. It is unavailable on this platform.
+type Keyring struct{}
+
+// New always fails on this platform.
+func New(opts Options) (*Keyring, error) {
+	if _, err := normalizeScope(opts.Scope); err != nil {
+		return nil, err
+	}
+	return nil, errUnsupported
+}
+
+func (k *Keyring) Scope() string { return "" }
+
+func (k *Keyring) Set(service, account string, data []byte, requireBiometrics bool) error {
+	return errUnsupported
+}
+
+func (k *Keyring) SetWithExpiry(service, account string, data []byte, expiresAt time.Time, requireBiometrics bool) error {
+	return errUnsupported
+}
+
+func (k *Keyring) Get(service, account string, useBiometrics bool, prompt string) ([]byte, error) {
+	return nil, errUnsupported
+}
+
+func (k *Keyring) Delete(service, account string, useBiometrics bool, prompt string) error {
+	return errUnsupported
+}
+
+func (k *Keyring) List(service string, useBiometrics bool, prompt string) ([]string, error) {
+	return nil, errUnsupported
+}
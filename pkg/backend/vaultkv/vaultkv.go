@@ -0,0 +1,409 @@
+// Package vaultkv implements a locksmith Backend on a HashiCorp Vault KV
+// version 2 secrets engine, for credentials shared across a team. Values
+// are written to the mount's data/ endpoint and locksmith's metadata to the
+// custom_metadata of the metadata/ endpoint.
+package vaultkv
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultMount is the KV v2 mount used when none is configured.
+	DefaultMount = "secret"
+
+	// DefaultPrefix is the path below the mount that holds locksmith's
+	// secrets. {service} is replaced with the locksmith service name.
+	DefaultPrefix = "locksmith/{service}"
+
+	valueField    = "value"
+	encodingField = "encoding"
+	encodingB64   = "base64"
+
+	requestTimeout = 30 * time.Second
+)
+
+var (
+	// ErrNotFound is returned when the secret does not exist (or its current
+	// version is deleted).
+	ErrNotFound = errors.New("Secret not found") // match native bridge error convention
+
+	// ErrUnavailable wraps failures to reach Vault (network errors, a sealed
+	// or unhealthy server) as opposed to errors Vault reported.
+	ErrUnavailable = errors.New("vault unavailable")
+)
+
+// TokenFunc returns the Vault token. It is called at the start of every
+// operation so a biometric-gated token store can authorize each remote read.
+type TokenFunc func(useBiometrics bool, prompt string) (string, error)
+
+// Options configures a Vault KV v2 client.
+type Options struct {
+	// Address of the Vault server. Defaults to $VAULT_ADDR.
+	Address string
+	// Mount is the KV v2 mount path. Defaults to DefaultMount.
+	Mount string
+	// Prefix is the path below the mount; {service} expands to the locksmith
+	// service. Defaults to DefaultPrefix.
+	Prefix string
+	// Namespace is sent as X-Vault-Namespace (Vault Enterprise). Defaults
+	// to $VAULT_NAMESPACE.
+	Namespace string
+	// Token supplies the Vault token. Required.
+	Token TokenFunc
+	// HTTPClient defaults to a client with a 30s timeout.
+	HTTPClient *http.Client
+}
+
+// Item is a secret read from Vault.
+type Item struct {
+	Value   []byte
+	Created time.Time
+	Updated time.Time
+	Version int
+	Custom  map[string]string
+}
+
+// Client talks to one KV v2 mount.
+type Client struct {
+	opts Options
+	base *url.URL
+}
+
+// New returns a Client for the given options.
+func New(opts Options) (*Client, error) {
+	if opts.Address == "" {
+		opts.Address = os.Getenv("VAULT_ADDR")
+	}
+	if strings.TrimSpace(opts.Address) == "" {
+		return nil, fmt.Errorf("vault backend requires an address (set the address option or VAULT_ADDR)")
+	}
+	base, err := url.Parse(strings.TrimRight(opts.Address, "/"))
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("invalid vault address '%s'", opts.Address)
+	}
+	if opts.Token == nil {
+		return nil, fmt.Errorf("vault backend requires a token source")
+	}
+	opts.Mount = strings.Trim(opts.Mount, "/")
+	if opts.Mount == "" {
+		opts.Mount = DefaultMount
+	}
+	if opts.Prefix == "" {
+		opts.Prefix = DefaultPrefix
+	}
+	if opts.Namespace == "" {
+		opts.Namespace = os.Getenv("VAULT_NAMESPACE")
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{Timeout: requestTimeout}
+	}
+	return &Client{opts: opts, base: base}, nil
+}
+
+// Put writes value as a new version of service/account and replaces the
+// secret's custom metadata with custom.
+func (c *Client) Put(service, account string, value []byte, custom map[string]string) error {
+	data := map[string]string{valueField: string(value)}
+	if !utf8.Valid(value) {
+		data[valueField] = base64.StdEncoding.EncodeToString(value)
+		data[encodingField] = encodingB64
+	}
+	p, err := c.path(service, account)
+	if err != nil {
+		return err
+	}
+	token, err := c.token(false, "")
+	if err != nil {
+		return err
+	}
+	if err := c.do(token, http.MethodPost, "data/"+p, map[string]any{"data": data}, nil); err != nil {
+		return err
+	}
+	if custom == nil {
+		custom = map[string]string{}
+	}
+	return c.do(token, http.MethodPost, "metadata/"+p, map[string]any{"custom_metadata": custom}, nil)
+}
+
+// Read returns the current version of service/account.
+func (c *Client) Read(service, account string, useBiometrics bool, prompt string) (*Item, error) {
+	p, err := c.path(service, account)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Data struct {
+			Data     map[string]string `json:"data"`
+			Metadata struct {
+				CreatedTime    time.Time         `json:"created_time"`
+				CustomMetadata map[string]string `json:"custom_metadata"`
+				DeletionTime   string            `json:"deletion_time"`
+				Destroyed      bool              `json:"destroyed"`
+				Version        int               `json:"version"`
+			} `json:"metadata"`
+		} `json:"data"`
+	}
+	token, err := c.token(useBiometrics, prompt)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.do(token, http.MethodGet, "data/"+p, nil, &resp); err != nil {
+		return nil, err
+	}
+	md := resp.Data.Metadata
+	if resp.Data.Data == nil || md.Destroyed || md.DeletionTime != "" {
+		return nil, ErrNotFound
+	}
+
+	value := []byte(resp.Data.Data[valueField])
+	if resp.Data.Data[encodingField] == encodingB64 {
+		value, err = base64.StdEncoding.DecodeString(resp.Data.Data[valueField])
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 value in vault secret '%s': %w", account, err)
+		}
+	}
+	item := &Item{Value: value, Updated: md.CreatedTime, Version: md.Version, Custom: md.CustomMetadata}
+
+	// The data endpoint reports when this version was written; the secret's
+	// creation time lives on the metadata endpoint.
+	if meta, err := c.metadata(token, p); err == nil {
+		item.Created = meta.CreatedTime
+		if item.Custom == nil {
+			item.Custom = meta.CustomMetadata
+		}
+	}
+	return item, nil
+}
+
+// Delete permanently removes service/account and all of its versions.
+// Deleting a missing secret is not an error.
+func (c *Client) Delete(service, account string, useBiometrics bool, prompt string) error {
+	p, err := c.path(service, account)
+	if err != nil {
+		return err
+	}
+	token, err := c.token(useBiometrics, prompt)
+	if err != nil {
+		return err
+	}
+	err = c.do(token, http.MethodDelete, "metadata/"+p, nil, nil)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// List returns the keys below service's prefix, descending into folders so
+// keys containing '/' are returned whole.
+func (c *Client) List(service string, useBiometrics bool, prompt string) ([]string, error) {
+	token, err := c.token(useBiometrics, prompt)
+	if err != nil {
+		return nil, err
+	}
+	return c.list(token, service)
+}
+
+func (c *Client) list(token, service string) ([]string, error) {
+	root, err := c.prefix(service)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		var resp struct {
+			Data struct {
+				Keys []string `json:"keys"`
+			} `json:"data"`
+		}
+		err := c.do(token, "LIST", "metadata/"+strings.TrimSuffix(root+"/"+dir, "/"), nil, &resp)
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, k := range resp.Data.Keys {
+			if strings.HasSuffix(k, "/") {
+				if err := walk(dir + k); err != nil {
+					return err
+				}
+				continue
+			}
+			keys = append(keys, dir+k)
+		}
+		return nil
+	}
+	if err := walk(""); err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Metadata is the listable part of a secret.
+type Metadata struct {
+	Created time.Time
+	Updated time.Time
+	Custom  map[string]string
+}
+
+// ListMetadata returns key -> metadata for every secret below service's
+// prefix without reading any secret values.
+func (c *Client) ListMetadata(service string, useBiometrics bool, prompt string) (map[string]Metadata, error) {
+	token, err := c.token(useBiometrics, prompt)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := c.list(token, service)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]Metadata, len(keys))
+	for _, k := range keys {
+		p, err := c.path(service, k)
+		if err != nil {
+			return nil, err
+		}
+		meta, err := c.metadata(token, p)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		out[k] = Metadata{Created: meta.CreatedTime, Updated: meta.UpdatedTime, Custom: meta.CustomMetadata}
+	}
+	return out, nil
+}
+
+type secretMetadata struct {
+	CreatedTime    time.Time         `json:"created_time"`
+	UpdatedTime    time.Time         `json:"updated_time"`
+	CustomMetadata map[string]string `json:"custom_metadata"`
+}
+
+func (c *Client) metadata(token, p string) (*secretMetadata, error) {
+	var resp struct {
+		Data secretMetadata `json:"data"`
+	}
+	if err := c.do(token, http.MethodGet, "metadata/"+p, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Data, nil
+}
+
+func (c *Client) prefix(service string) (string, error) {
+	p := strings.Trim(strings.ReplaceAll(c.opts.Prefix, "{service}", service), "/")
+	if strings.Contains("/"+p+"/", "/../") || strings.Contains("/"+p+"/", "/./") {
+		return "", fmt.Errorf("invalid vault path prefix '%s'", p)
+	}
+	return p, nil
+}
+
+// path returns the secret path below the mount for service/account.
+func (c *Client) path(service, account string) (string, error) {
+	prefix, err := c.prefix(service)
+	if err != nil {
+		return "", err
+	}
+	for _, part := range strings.Split(account, "/") {
+		if part == "" || part == "." || part == ".." {
+			return "", fmt.Errorf("key '%s' cannot be mapped to a vault path", account)
+		}
+	}
+	if prefix == "" {
+		return account, nil
+	}
+	return prefix + "/" + account, nil
+}
+
+// token fetches the Vault token once per operation, so a gated token store
+// prompts once even when the operation makes several requests.
+func (c *Client) token(useBiometrics bool, prompt string) (string, error) {
+	token, err := c.opts.Token(useBiometrics, prompt)
+	if err != nil {
+		return "", fmt.Errorf("failed to obtain vault token: %w", err)
+	}
+	if token == "" {
+		return "", fmt.Errorf("vault token is empty")
+	}
+	return token, nil
+}
+
+// do performs a request against /v1/<mount>/<p> and decodes the JSON
+// response into out when it is non-nil.
+func (c *Client) do(token, method, p string, body, out any) error {
+	u := *c.base
+	u.Path = strings.TrimRight(u.Path, "/") + "/v1/" + c.opts.Mount + "/" + p
+	u.RawPath = ""
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, u.String(), reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	req.Header.Set("X-Vault-Request", "true")
+	if c.opts.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.opts.Namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.opts.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	payload, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("%w: %s", ErrUnavailable, vaultError(resp.StatusCode, payload))
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("vault request failed: %s", vaultError(resp.StatusCode, payload))
+	}
+	if out != nil && len(payload) > 0 {
+		if err := json.Unmarshal(payload, out); err != nil {
+			return fmt.Errorf("invalid vault response: %w", err)
+		}
+	}
+	return nil
+}
+
+func vaultError(status int, payload []byte) string {
+	var body struct {
+		Errors []string `json:"errors"`
+	}
+	if json.Unmarshal(payload, &body) == nil && len(body.Errors) > 0 {
+		return fmt.Sprintf("%s (HTTP %d)", strings.Join(body.Errors, "; "), status)
+	}
+	return fmt.Sprintf("HTTP %d", status)
+}
@@ -0,0 +1,335 @@
+package vaultkv
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testToken = "s.test-token"
+
+// fakeVault is an in-memory stand-in for a KV v2 mount at secret/.
+type fakeVault struct {
+	mu      sync.Mutex
+	secrets map[string]*fakeSecret
+	down    bool
+	methods []string
+}
+
+type fakeSecret struct {
+	created  time.Time
+	versions []map[string]string
+	custom   map[string]string
+}
+
+func newFakeVault(t *testing.T) (*fakeVault, *httptest.Server) {
+	t.Helper()
+	f := &fakeVault{secrets: map[string]*fakeSecret{}}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.methods = append(f.methods, r.Method+" "+r.URL.Path)
+
+	if f.down {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"errors": []string{"Vault is sealed"}})
+		return
+	}
+	if r.Header.Get("X-Vault-Token") != testToken {
+		writeJSON(w, http.StatusForbidden, map[string]any{"errors": []string{"permission denied"}})
+		return
+	}
+
+	rest, ok := strings.CutPrefix(r.URL.Path, "/v1/secret/")
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]any{"errors": []string{}})
+		return
+	}
+	kind, p, _ := strings.Cut(rest, "/")
+
+	var body map[string]json.RawMessage
+	if r.Body != nil {
+		_ = json.NewDecoder(r.Body).Decode(&body)
+	}
+
+	switch {
+	case kind == "data" && r.Method == http.MethodPost:
+		var data map[string]string
+		_ = json.Unmarshal(body["data"], &data)
+		s := f.secrets[p]
+		if s == nil {
+			s = &fakeSecret{created: time.Now().UTC()}
+			f.secrets[p] = s
+		}
+		s.versions = append(s.versions, data)
+		writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"version": len(s.versions)}})
+	case kind == "data" && r.Method == http.MethodGet:
+		s := f.secrets[p]
+		if s == nil {
+			writeJSON(w, http.StatusNotFound, map[string]any{"errors": []string{}})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{
+			"data": s.versions[len(s.versions)-1],
+			"metadata": map[string]any{
+				"created_time":    time.Now().UTC(),
+				"custom_metadata": s.custom,
+				"deletion_time":   "",
+				"destroyed":       false,
+				"version":         len(s.versions),
+			},
+		}})
+	case kind == "metadata" && r.Method == http.MethodPost:
+		s := f.secrets[p]
+		if s == nil {
+			s = &fakeSecret{created: time.Now().UTC()}
+			f.secrets[p] = s
+		}
+		_ = json.Unmarshal(body["custom_metadata"], &s.custom)
+		w.WriteHeader(http.StatusNoContent)
+	case kind == "metadata" && r.Method == http.MethodGet && r.URL.Query().Get("list") == "":
+		s := f.secrets[p]
+		if s == nil {
+			writeJSON(w, http.StatusNotFound, map[string]any{"errors": []string{}})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{
+			"created_time":    s.created,
+			"updated_time":    s.created,
+			"custom_metadata": s.custom,
+		}})
+	case kind == "metadata" && r.Method == http.MethodDelete:
+		if f.secrets[p] == nil {
+			writeJSON(w, http.StatusNotFound, map[string]any{"errors": []string{}})
+			return
+		}
+		delete(f.secrets, p)
+		w.WriteHeader(http.StatusNoContent)
+	case kind == "metadata" && (r.Method == "LIST" || r.Method == http.MethodGet):
+		dir := strings.TrimSuffix(p, "/") + "/"
+		seen := map[string]bool{}
+		var keys []string
+		for k := range f.secrets {
+			rel, ok := strings.CutPrefix(k, dir)
+			if !ok {
+				continue
+			}
+			if i := strings.Index(rel, "/"); i >= 0 {
+				rel = rel[:i+1]
+			}
+			if !seen[rel] {
+				seen[rel] = true
+				keys = append(keys, rel)
+			}
+		}
+		if len(keys) == 0 {
+			writeJSON(w, http.StatusNotFound, map[string]any{"errors": []string{}})
+			return
+		}
+		sort.Strings(keys)
+		writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"keys": keys}})
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"errors": []string{"unsupported operation"}})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func newTestClient(t *testing.T, address string, token TokenFunc) *Client {
+	t.Helper()
+	if token == nil {
+		token = func(bool, string) (string, error) { return testToken, nil }
+	}
+	c, err := New(Options{Address: address, Token: token})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestRoundTrip(t *testing.T) {
+	f, srv := newFakeVault(t)
+	c := newTestClient(t, srv.URL, nil)
+
+	if err := c.Put("svc", "db/password", []byte("hunter2"), map[string]string{"locksmith.secret_type": "password"}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if f.secrets["locksmith/svc/db/password"] == nil {
+		t.Fatalf("secret not stored under the prefixed path; have %v", f.secrets)
+	}
+
+	item, err := c.Read("svc", "db/password", false, "")
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if string(item.Value) != "hunter2" || item.Version != 1 {
+		t.Errorf("got value %q version %d", item.Value, item.Version)
+	}
+	if item.Custom["locksmith.secret_type"] != "password" {
+		t.Errorf("custom metadata not returned: %v", item.Custom)
+	}
+	if item.Created.IsZero() {
+		t.Error("expected created time from the metadata endpoint")
+	}
+
+	if err := c.Put("svc", "db/password", []byte("hunter3"), nil); err != nil {
+		t.Fatal(err)
+	}
+	item, _ = c.Read("svc", "db/password", false, "")
+	if string(item.Value) != "hunter3" || item.Version != 2 {
+		t.Errorf("update: got value %q version %d", item.Value, item.Version)
+	}
+
+	if err := c.Delete("svc", "db/password", false, ""); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := c.Read("svc", "db/password", false, ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound after delete, got %v", err)
+	}
+	if err := c.Delete("svc", "db/password", false, ""); err != nil {
+		t.Errorf("deleting a missing secret should succeed, got %v", err)
+	}
+}
+
+func TestBinaryValue(t *testing.T) {
+	_, srv := newFakeVault(t)
+	c := newTestClient(t, srv.URL, nil)
+
+	value := []byte{0xff, 0x00, 0xfe}
+	if err := c.Put("svc", "bin", value, nil); err != nil {
+		t.Fatal(err)
+	}
+	item, err := c.Read("svc", "bin", false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(item.Value, value) {
+		t.Errorf("got %v, want %v", item.Value, value)
+	}
+}
+
+func TestListRecursesFolders(t *testing.T) {
+	_, srv := newFakeVault(t)
+	c := newTestClient(t, srv.URL, nil)
+
+	for _, k := range []string{"a", "team/b", "team/nested/c"} {
+		if err := c.Put("svc", k, []byte("v"), map[string]string{"k": k}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = c.Put("other", "hidden", []byte("v"), nil)
+
+	keys, err := c.List("svc", false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "team/b", "team/nested/c"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("List = %v, want %v", keys, want)
+	}
+
+	meta, err := c.ListMetadata("svc", false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(meta) != 3 || meta["team/nested/c"].Custom["k"] != "team/nested/c" {
+		t.Errorf("ListMetadata = %v", meta)
+	}
+
+	empty, err := c.List("nothing-here", false, "")
+	if err != nil || len(empty) != 0 {
+		t.Errorf("List of an empty prefix = %v, %v", empty, err)
+	}
+}
+
+func TestTokenFetchedOncePerOperation(t *testing.T) {
+	_, srv := newFakeVault(t)
+	var calls []bool
+	c := newTestClient(t, srv.URL, func(useBiometrics bool, prompt string) (string, error) {
+		calls = append(calls, useBiometrics)
+		return testToken, nil
+	})
+
+	_ = c.Put("svc", "k", []byte("v"), nil)
+	calls = nil
+	if _, err := c.Read("svc", "k", true, "unlock"); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 1 || !calls[0] {
+		t.Errorf("expected one gated token fetch per read, got %v", calls)
+	}
+}
+
+func TestTokenErrorStopsRequest(t *testing.T) {
+	f, srv := newFakeVault(t)
+	denied := errors.New("biometric authentication failed")
+	c := newTestClient(t, srv.URL, func(bool, string) (string, error) { return "", denied })
+
+	if _, err := c.Read("svc", "k", true, ""); !errors.Is(err, denied) {
+		t.Errorf("expected token error, got %v", err)
+	}
+	if len(f.methods) != 0 {
+		t.Errorf("no request should reach vault without a token, got %v", f.methods)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	f, srv := newFakeVault(t)
+
+	bad := newTestClient(t, srv.URL, func(bool, string) (string, error) { return "wrong", nil })
+	_, err := bad.Read("svc", "k", false, "")
+	if err == nil || errors.Is(err, ErrUnavailable) || !strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("expected vault's permission error, got %v", err)
+	}
+
+	c := newTestClient(t, srv.URL, nil)
+	f.down = true
+	if _, err := c.Read("svc", "k", false, ""); !errors.Is(err, ErrUnavailable) || !strings.Contains(err.Error(), "sealed") {
+		t.Errorf("expected ErrUnavailable for a sealed vault, got %v", err)
+	}
+
+	srv.Close()
+	if _, err := c.Read("svc", "k", false, ""); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("expected ErrUnavailable for an unreachable vault, got %v", err)
+	}
+}
+
+func TestNewValidation(t *testing.T) {
+	t.Setenv("VAULT_ADDR", "")
+	token := func(bool, string) (string, error) { return testToken, nil }
+
+	if _, err := New(Options{Token: token}); err == nil {
+		t.Error("expected an error without an address")
+	}
+	if _, err := New(Options{Address: "not a url", Token: token}); err == nil {
+		t.Error("expected an error for an invalid address")
+	}
+	if _, err := New(Options{Address: "https://vault.example.com"}); err == nil {
+		t.Error("expected an error without a token source")
+	}
+
+	t.Setenv("VAULT_ADDR", "https://vault.example.com")
+	c, err := New(Options{Token: token})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"", "a//b", "../x", "a/./b"} {
+		if _, err := c.path("svc", key); err == nil {
+			t.Errorf("expected key %q to be rejected", key)
+		}
+	}
+}
@@ -3,7 +3,7 @@
 package locksmith
 
 import (
-	"encoding/json"
+	"fmt"
 	"time"
 )
 
@@ -33,39 +33,28 @@ func (l *Locksmith) SetWithContext(
 	valCopy := make([]byte, len(value))
 	copy(valCopy, value)
 
-	secret := Secret{
+	return l.PutSecret(key, Secret{
 		Value:            valCopy,
-		CreatedAt:        time.Now(),
 		ExpiresAt:        expiresAt,
-		SecretType:       NormalizeSecretType(secretType),
+		SecretType:       secretType,
 		OwnerApplication: ownerApplication,
 		SourceURL:        sourceURL,
 		Metadata:         metadata,
-	}
-
-	data, err := json.Marshal(secret)
-	if err != nil {
-		return err
-	}
-
-	err = l.Backend.Set(l.Service, key, data, requireBiometrics)
-	if err != nil {
-		return err
-	}
-
-	// Update cache as well
-	return l.Cache.Set(key, secret, DefaultCacheTTL)
+	}, requireBiometrics)
 }
 
 // Delete removes a secret from the keychain and cache
 func (l *Locksmith) Delete(key string) error {
+	if l.Config.IsAlias(key) {
+		return fmt.Errorf("'%s' is an alias; remove it with 'locksmith alias rm %s'", key, key)
+	}
 	_ = l.Cache.Delete(key)
 	prompt := l.Options.getPrompt("Authentication required to delete secret '%s'", key)
-	return l.Backend.Delete(l.Service, key, l.Options.RequireBiometrics, prompt)
-}
-
-func zeroBytes(b []byte) {
-	for i := range b {
-		b[i] = 0
+	if err := l.Backend.Delete(l.Service, key, l.Options.RequireBiometrics, prompt); err != nil {
+		return err
 	}
+	l.sessionForget(key)
+	l.indexRemove(key)
+	l.deleteHistory(key)
+	return nil
 }
@@ -4,7 +4,6 @@
 package locksmith
 
 import (
-	"encoding/json"
 	"fmt"
 	"time"
 )
@@ -29,45 +28,39 @@ func (l *Locksmith) SetWithContext(
 	// Copy the value to avoid zeroing affecting cache storage
 	valCopy := make([]byte, len(value))
 	copy(valCopy, value)
-	// Prepare secret struct with copied value
-	secret := Secret{
+	// Store via backend (biometric flag ignored)
+	err := l.PutSecret(key, Secret{
 		Value:            valCopy,
-		CreatedAt:        time.Now(),
 		ExpiresAt:        expiresAt,
-		SecretType:       NormalizeSecretType(secretType),
+		SecretType:       secretType,
 		OwnerApplication: ownerApplication,
 		SourceURL:        sourceURL,
 		Metadata:         metadata,
-	}
-	// Marshal secret to JSON
-	data, err := json.Marshal(secret)
-	if err != nil {
-		// Zero out original value before returning
-		for i := range value {
-			value[i] = 0
-		}
-		return err
-	}
-	// Store via backend (biometric flag ignored)
-	err = l.Backend.Set(l.Service, key, data, requireBiometrics)
+	}, requireBiometrics)
 	// Zero out the original secret value after storage to avoid lingering plaintext
 	for i := range value {
 		value[i] = 0
 	}
-	if err != nil {
-		return err
-	}
-	// Update cache with secret containing copied value
-	return l.Cache.Set(key, secret, DefaultCacheTTL)
+	return err
 }
 
 // Delete removes a secret from the backend and cache.
 func (l *Locksmith) Delete(key string) error {
+	if l.Config.IsAlias(key) {
+		return fmt.Errorf("'%s' is an alias; remove it with 'locksmith alias rm %s'", key, key)
+	}
 	// Remove from cache if present
 	_ = l.Cache.Delete(key)
 	// Prompt for authentication (still uses configured prompt)
 	prompt := l.Options.getPrompt("Authentication required to delete secret '%s'", key)
-	return l.Backend.Delete(l.Service, key, l.Options.RequireBiometrics, prompt)
+	if err := l.Backend.Delete(l.Service, key, l.Options.RequireBiometrics, prompt); err != nil {
+		return err
+	}
+	l.sessionForget(key)
+	l.indexRemove(key)
+	// Remove the key's version history with it
+	l.deleteHistory(key)
+	return nil
 }
 
 // RotateSecret is unavailable when compiled without the locksmith_admin tag.
@@ -75,6 +68,10 @@ func (l *Locksmith) RotateSecret(key string) error {
 	return fmt.Errorf("rotation unavailable in this compile profile; rebuild with -tags locksmith_admin")
 }
 
+func (l *Locksmith) rotateSecret(key string) error {
+	return l.RotateSecret(key)
+}
+
 // RotateExpiringSecrets is unavailable when compiled without the locksmith_admin tag.
 func (l *Locksmith) RotateExpiringSecrets() (rotated []string, skipped []string, failed map[string]error, err error) {
 	return nil, nil, nil, fmt.Errorf("rotation unavailable in this compile profile; rebuild with -tags locksmith_admin")
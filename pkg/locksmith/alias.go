@@ -0,0 +1,90 @@
+package locksmith
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// maxAliasDepth bounds alias chains; longer chains are reported as cycles.
+const maxAliasDepth = 16
+
+// ErrAliasCycle is returned when following aliases leads back to an alias
+// already visited.
+var ErrAliasCycle = errors.New("alias cycle")
+
+// ParseAliasTarget parses the target of an alias: a key, optionally in
+// another vault (@work/github/pat) and with the locksmith:// scheme. Fields
+// and ?otp are not allowed; reference them through the alias instead.
+func ParseAliasTarget(target string) (SecretRef, error) {
+	ref, err := ParseRef(target)
+	if err != nil {
+		return SecretRef{}, err
+	}
+	if ref.Field != "" || ref.OTP {
+		return SecretRef{}, fmt.Errorf("alias target '%s' must name a key, not a field or code", target)
+	}
+	return ref, nil
+}
+
+// ResolveAlias follows the aliases configured under `aliases:` from key in
+// vault and returns the vault and key they end at. A key that is not an
+// alias resolves to itself. Targets without an @vault prefix stay in the
+// vault of the alias.
+func (c *Config) ResolveAlias(vault, key string) (string, string, error) {
+	if c == nil || len(c.Aliases) == 0 {
+		return vault, key, nil
+	}
+	seen := make(map[string]bool)
+	for depth := 0; ; depth++ {
+		target, ok := c.Aliases[key]
+		if !ok {
+			return vault, key, nil
+		}
+		visit := vault + "\x00" + key
+		if seen[visit] || depth >= maxAliasDepth {
+			return "", "", fmt.Errorf("%w: '%s' leads back to itself", ErrAliasCycle, key)
+		}
+		seen[visit] = true
+
+		ref, err := ParseAliasTarget(target)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid alias '%s': %w", key, err)
+		}
+		if ref.Vault != "" {
+			vault = ref.Vault
+		}
+		key = ref.Key
+	}
+}
+
+// IsAlias reports whether key is configured as an alias.
+func (c *Config) IsAlias(key string) bool {
+	if c == nil {
+		return false
+	}
+	_, ok := c.Aliases[key]
+	return ok
+}
+
+// aliasTarget returns the vault and key that key refers to. ok is false when
+// key is not an alias, in which case l and key should be used as they are.
+func (l *Locksmith) aliasTarget(key string) (target *Locksmith, resolved string, ok bool, err error) {
+	if !l.Config.IsAlias(key) {
+		return l, key, false, nil
+	}
+	vault, resolved, err := l.Config.ResolveAlias(l.vaultName(), key)
+	if err != nil {
+		return nil, "", false, err
+	}
+	target, err = l.OpenVault(vault)
+	if err != nil {
+		return nil, "", false, fmt.Errorf("alias '%s': %w", key, err)
+	}
+	return target, resolved, true, nil
+}
+
+// FormatAliasTarget returns target in the form stored in the config.
+func FormatAliasTarget(ref SecretRef) string {
+	return strings.TrimPrefix(ref.String(), RefScheme)
+}
@@ -0,0 +1,69 @@
+package locksmith
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestResolveAlias(t *testing.T) {
+	cfg := &Config{Aliases: map[string]string{
+		"github/gh/token": "github/work/pat",
+		"short":           "github/gh/token",
+		"remote":          "locksmith://@work/db/password",
+		"loop/a":          "loop/b",
+		"loop/b":          "loop/a",
+		"bad":             "db#field",
+	}}
+
+	cases := []struct {
+		key, wantVault, wantKey string
+	}{
+		{"short", "default", "github/work/pat"},
+		{"remote", "work", "db/password"},
+		{"plain/key", "default", "plain/key"},
+	}
+	for _, tc := range cases {
+		vault, key, err := cfg.ResolveAlias("default", tc.key)
+		if err != nil || vault != tc.wantVault || key != tc.wantKey {
+			t.Errorf("ResolveAlias(%s) = %s, %s, %v", tc.key, vault, key, err)
+		}
+	}
+	if _, _, err := cfg.ResolveAlias("default", "loop/a"); !errors.Is(err, ErrAliasCycle) {
+		t.Errorf("expected a cycle, got %v", err)
+	}
+	if _, _, err := cfg.ResolveAlias("default", "bad"); err == nil {
+		t.Error("expected an alias to a field to be rejected")
+	}
+	if ref, _ := ParseAliasTarget("locksmith://@work/db"); FormatAliasTarget(ref) != "@work/db" {
+		t.Errorf("FormatAliasTarget = %s", FormatAliasTarget(ref))
+	}
+}
+
+func TestAliasReadsWritesAndHistory(t *testing.T) {
+	l, _ := newHistoryTestLocksmith()
+	l.Config = &Config{Aliases: map[string]string{"alias": "target"}}
+
+	_ = l.PutSecret("target", Secret{Value: []byte("one")}, false)
+	if err := l.PutSecret("alias", Secret{Value: []byte("two")}, false); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := l.Get("target"); err != nil || string(v) != "two" {
+		t.Errorf("target = %q, %v", v, err)
+	}
+	if v, err := l.Get("alias"); err != nil || string(v) != "two" {
+		t.Errorf("alias = %q, %v", v, err)
+	}
+	versions, err := l.History("alias")
+	if err != nil || len(versions) != 2 {
+		t.Fatalf("History through alias = %d versions, %v", len(versions), err)
+	}
+	if _, err := l.Rollback("alias", 0); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := l.Get("target"); string(v) != "one" {
+		t.Errorf("rollback through alias left target at %q", v)
+	}
+	if err := l.Delete("alias"); err == nil {
+		t.Error("expected Delete to refuse an alias")
+	}
+}
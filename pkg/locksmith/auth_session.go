@@ -0,0 +1,79 @@
+package locksmith
+
+// authSession lets a batch of reads (such as rendering a template) prompt
+// for authentication at most once per vault. The backends of the vaults it
+// touches are wrapped so that only reads up to the first successful gated
+// read ask for biometrics; later reads reuse that authentication. Reads
+// served from the cache never count, so the first backend read is always
+// gated as usual.
+//
+// A session mutates the vaults it wraps and is not safe for concurrent use.
+type authSession struct {
+	prompt  string
+	wrapped []*Locksmith
+	saved   []Backend
+}
+
+// newAuthSession starts a session. prompt, when not empty, replaces the
+// per-key prompt of the one gated read, e.g. to say how many secrets are
+// about to be read.
+func newAuthSession(prompt string) *authSession {
+	return &authSession{prompt: prompt}
+}
+
+// join wraps l's backend for the rest of the session.
+func (s *authSession) join(l *Locksmith) {
+	for _, w := range s.wrapped {
+		if w == l {
+			return
+		}
+	}
+	s.wrapped = append(s.wrapped, l)
+	s.saved = append(s.saved, l.Backend)
+	l.Backend = &authOnceBackend{Backend: l.Backend, prompt: s.prompt}
+}
+
+// end restores the original backends.
+func (s *authSession) end() {
+	for i, l := range s.wrapped {
+		l.Backend = s.saved[i]
+	}
+	s.wrapped, s.saved = nil, nil
+}
+
+// authOnceBackend passes the biometric requirement through until one gated
+// read succeeds.
+type authOnceBackend struct {
+	Backend
+	prompt        string
+	authenticated bool
+}
+
+func (b *authOnceBackend) Get(service, account string, useBiometrics bool, prompt string) ([]byte, error) {
+	gated := useBiometrics && !b.authenticated
+	if gated && b.prompt != "" {
+		prompt = b.prompt
+	}
+	data, err := b.Backend.Get(service, account, gated, prompt)
+	if err == nil && gated {
+		b.authenticated = true
+	}
+	return data, err
+}
+
+// SetWithMetadata and ListMetadata keep the wrapped backend's metadata
+// support, e.g. when a read triggers a rotation.
+func (b *authOnceBackend) SetWithMetadata(service, account string, data []byte, meta SecretMetadata, requireBiometrics bool) error {
+	return setWithMetadata(b.Backend, service, account, data, meta, requireBiometrics)
+}
+
+func (b *authOnceBackend) ListMetadata(service string, useBiometrics bool, prompt string) (map[string]SecretMetadata, error) {
+	if mb, ok := b.Backend.(MetadataBackend); ok {
+		return mb.ListMetadata(service, useBiometrics, prompt)
+	}
+	return nil, ErrMetadataUnsupported
+}
+
+func (b *authOnceBackend) partialMetadata() bool {
+	return listsPartialMetadata(b.Backend)
+}
@@ -0,0 +1,204 @@
+package locksmith
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bonjoski/locksmith/v2/pkg/backend/filevault"
+	"github.com/bonjoski/locksmith/v2/pkg/backend/kdbx"
+	"github.com/bonjoski/locksmith/v2/pkg/backend/keyctl"
+	"github.com/bonjoski/locksmith/v2/pkg/backend/vaultkv"
+	"github.com/bonjoski/locksmith/v2/pkg/native"
+	"golang.org/x/term"
+)
+
+const (
+	BackendAuto    = "auto"
+	BackendNative  = "native"
+	BackendFile    = "file"
+	BackendKeyctl  = "keyctl"
+	BackendTiered  = "tiered"
+	BackendKDBX    = "kdbx"
+	BackendVaultKV = "vault-kv"
+
+	// BackendEnv overrides the configured backend name, for callers such as
+	// summon-locksmith that take no flags.
+	BackendEnv = "LOCKSMITH_BACKEND"
+)
+
+// ErrNotFound is returned by Backend.Get, possibly wrapped, for a key the
+// backend does not hold. Backends registered by embedding programs should
+// return it too, as a missing key is told apart from a failed read only
+// with errors.Is.
+var ErrNotFound = native.ErrNotFound
+
+// isNotFound reports whether err is ErrNotFound or the not-found error of
+// one of the built-in backends.
+func isNotFound(err error) bool {
+	for _, target := range []error{ErrNotFound, keyctl.ErrNotFound, filevault.ErrNotFound, kdbx.ErrNotFound, vaultkv.ErrNotFound} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// BackendFactory builds a Backend from the options of a `backend:` config section.
+type BackendFactory func(options map[string]string) (Backend, error)
+
+// BackendRegistry maps backend names to factories.
+type BackendRegistry struct {
+	mu        sync.RWMutex
+	factories map[string]BackendFactory
+}
+
+func NewBackendRegistry() *BackendRegistry {
+	return &BackendRegistry{factories: make(map[string]BackendFactory)}
+}
+
+// Backends is the registry consulted by NewWithOptions. Programs embedding
+// locksmith may register additional backends before constructing it.
+var Backends = NewBackendRegistry()
+
+func init() {
+	registerDefaultBackends(Backends)
+}
+
+func registerDefaultBackends(r *BackendRegistry) {
+	_ = r.Register(BackendNative, func(map[string]string) (Backend, error) { return &DefaultBackend{}, nil })
+	_ = r.Register(BackendFile, newFileBackend)
+	_ = r.Register(BackendKeyctl, newKeyctlBackend)
+	_ = r.Register(BackendKDBX, newKDBXBackend)
+	_ = r.Register(BackendVaultKV, newVaultKVBackend)
+	_ = r.Register(BackendTiered, newTieredBackendFactory(r))
+}
+
+func (r *BackendRegistry) Register(name string, factory BackendFactory) error {
+	if factory == nil {
+		return fmt.Errorf("backend factory cannot be nil")
+	}
+	name = normalizeBackendName(name)
+	if name == "" {
+		return fmt.Errorf("backend name cannot be empty")
+	}
+	if name == BackendAuto {
+		return fmt.Errorf("backend name '%s' is reserved", BackendAuto)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.factories[name] = factory
+	return nil
+}
+
+func (r *BackendRegistry) Resolve(name string) (BackendFactory, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	f, ok := r.factories[normalizeBackendName(name)]
+	return f, ok
+}
+
+// Names returns the registered backend names in sorted order.
+func (r *BackendRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.factories))
+	for name := range r.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open builds the Backend named by cfg. "auto" (the default) uses the
+// native keychain when it is reachable and falls back to the encrypted file
+// vault otherwise (e.g. Linux hosts without D-Bus).
+func (r *BackendRegistry) Open(cfg BackendConfig) (Backend, error) {
+	name := normalizeBackendName(cfg.Name)
+	if name == "" || name == BackendAuto {
+		name = BackendFile
+		if native.Available() {
+			name = BackendNative
+		}
+	}
+
+	factory, ok := r.Resolve(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown backend '%s' (supported: %s)", name, strings.Join(append([]string{BackendAuto}, r.Names()...), ", "))
+	}
+	backend, err := factory(cfg.Options)
+	if err != nil {
+		return nil, fmt.Errorf("backend '%s': %w", name, err)
+	}
+	return backend, nil
+}
+
+func normalizeBackendName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// resolveBackendConfig returns the backend section to use: the vault's
+// (or top-level) one, with its name overridden by LOCKSMITH_BACKEND and then
+// by Options.Backend.
+func resolveBackendConfig(bc BackendConfig, opts Options) BackendConfig {
+	if name := os.Getenv(BackendEnv); name != "" {
+		bc.Name = name
+	}
+	if opts.Backend != "" {
+		bc.Name = opts.Backend
+	}
+	return bc
+}
+
+// backendFromConfig builds the Backend named by cfg from the default registry.
+func backendFromConfig(cfg BackendConfig) (Backend, error) {
+	return Backends.Open(cfg)
+}
+
+func newFileBackend(options map[string]string) (Backend, error) {
+	return filevault.New(filevault.Options{
+		Path:          options["path"],
+		KeyFile:       options["keyfile"],
+		PassphraseEnv: options["passphrase_env"],
+		Prompt:        promptTerminalPassphrase,
+	})
+}
+
+func newKeyctlBackend(options map[string]string) (Backend, error) {
+	k, err := keyctl.New(keyctl.Options{Scope: options["scope"]})
+	if err != nil {
+		return nil, err
+	}
+	return &keyctlBackend{Keyring: k}, nil
+}
+
+// keyctlBackend maps Secret.ExpiresAt onto kernel key timeouts.
+type keyctlBackend struct {
+	*keyctl.Keyring
+}
+
+func (b *keyctlBackend) SetWithMetadata(service, account string, data []byte, meta SecretMetadata, requireBiometrics bool) error {
+	return b.SetWithExpiry(service, account, data, meta.ExpiresAt, requireBiometrics)
+}
+
+func (b *keyctlBackend) ListMetadata(service string, useBiometrics bool, prompt string) (map[string]SecretMetadata, error) {
+	return nil, ErrMetadataUnsupported
+}
+
+// promptTerminalPassphrase reads a passphrase from the controlling terminal.
+// It fails when stdin is not a terminal so non-interactive callers get a
+// clear error instead of hanging.
+func promptTerminalPassphrase(message string) ([]byte, error) {
+	fd := int(os.Stdin.Fd()) // #nosec G115 -- file descriptors fit in int
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("no terminal available to prompt for a passphrase")
+	}
+	fmt.Fprint(os.Stderr, message)
+	pass, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	return pass, err
+}
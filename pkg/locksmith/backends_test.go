@@ -0,0 +1,80 @@
+package locksmith
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBackendRegistry(t *testing.T) {
+	r := NewBackendRegistry()
+
+	if err := r.Register("", func(map[string]string) (Backend, error) { return nil, nil }); err == nil {
+		t.Error("expected error for empty name")
+	}
+	if err := r.Register("x", nil); err == nil {
+		t.Error("expected error for nil factory")
+	}
+	if err := r.Register("Auto", func(map[string]string) (Backend, error) { return nil, nil }); err == nil {
+		t.Error("expected error for reserved name auto")
+	}
+
+	var gotOptions map[string]string
+	custom := &testBackend{}
+	err := r.Register(" Custom ", func(options map[string]string) (Backend, error) {
+		gotOptions = options
+		return custom, nil
+	})
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	_ = r.Register("broken", func(map[string]string) (Backend, error) { return nil, errors.New("boom") })
+
+	if names := r.Names(); !reflect.DeepEqual(names, []string{"broken", "custom"}) {
+		t.Errorf("Names = %v", names)
+	}
+
+	b, err := r.Open(BackendConfig{Name: "CUSTOM", Options: map[string]string{"k": "v"}})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if b != custom || gotOptions["k"] != "v" {
+		t.Errorf("Open returned %v with options %v", b, gotOptions)
+	}
+
+	if _, err := r.Open(BackendConfig{Name: "broken"}); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("expected factory error, got %v", err)
+	}
+	if _, err := r.Open(BackendConfig{Name: "missing"}); err == nil || !strings.Contains(err.Error(), "auto, broken, custom") {
+		t.Errorf("expected unknown backend error listing names, got %v", err)
+	}
+}
+
+func TestDefaultBackendsRegistered(t *testing.T) {
+	for _, name := range []string{BackendNative, BackendFile, BackendKeyctl} {
+		if _, ok := Backends.Resolve(name); !ok {
+			t.Errorf("backend %q not registered", name)
+		}
+	}
+}
+
+func TestResolveBackendConfig(t *testing.T) {
+	cfg := &Config{Backend: BackendConfig{Name: "file", Options: map[string]string{"path": "/tmp/v.json"}}}
+
+	t.Setenv(BackendEnv, "")
+	if bc := resolveBackendConfig(cfg.Backend, Options{}); bc.Name != "file" || bc.Options["path"] != "/tmp/v.json" {
+		t.Errorf("config backend not used: %+v", bc)
+	}
+	if bc := resolveBackendConfig(BackendConfig{}, Options{}); bc.Name != "" {
+		t.Errorf("expected auto selection without config, got %+v", bc)
+	}
+
+	t.Setenv(BackendEnv, "keyctl")
+	if bc := resolveBackendConfig(cfg.Backend, Options{}); bc.Name != "keyctl" || bc.Options["path"] != "/tmp/v.json" {
+		t.Errorf("env override not applied: %+v", bc)
+	}
+	if bc := resolveBackendConfig(cfg.Backend, Options{Backend: "native"}); bc.Name != "native" {
+		t.Errorf("Options.Backend should take precedence, got %+v", bc)
+	}
+}
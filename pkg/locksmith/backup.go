@@ -0,0 +1,429 @@
+package locksmith
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"filippo.io/age"
+)
+
+// BackupFormat identifies a locksmith backup bundle.
+const BackupFormat = "locksmith-backup"
+
+const backupFormatVersion = 1
+
+// ErrBackupCorrupt is returned when a bundle fails integrity verification.
+var ErrBackupCorrupt = errors.New("backup bundle is corrupt or was modified")
+
+// A backup bundle is a JSON envelope holding two sealed parts:
+//
+//   - the manifest, encrypted with age to a passphrase or to age recipients,
+//     lists every key with its metadata and the SHA-256 of its secret, and
+//     carries the random key of the payload;
+//   - the payload, sealed with AES-GCM under that key, holds the secrets
+//     and the SSH key records.
+//
+// The manifest also records the SHA-256 of the sealed payload, so a bundle
+// can be listed and checked against it without decrypting any value.
+type backupEnvelope struct {
+	Format   string `json:"format"`
+	Version  int    `json:"version"`
+	Manifest []byte `json:"manifest"`
+	Payload  []byte `json:"payload"`
+}
+
+// BackupManifest describes the contents of a bundle.
+type BackupManifest struct {
+	CreatedAt time.Time     `json:"created_at"`
+	Vault     string        `json:"vault"`
+	Service   string        `json:"service"`
+	Entries   []BackupEntry `json:"entries"`
+	// SSHKeys is the number of SSH key records in the bundle.
+	SSHKeys int `json:"ssh_keys"`
+
+	PayloadKey    []byte `json:"payload_key"`
+	PayloadSHA256 string `json:"payload_sha256"`
+	SSHKeysSHA256 string `json:"ssh_keys_sha256,omitempty"`
+}
+
+// BackupEntry is one secret of a bundle.
+type BackupEntry struct {
+	Key      string         `json:"key"`
+	Metadata SecretMetadata `json:"metadata"`
+	SHA256   string         `json:"sha256"`
+}
+
+type backupPayload struct {
+	Secrets map[string]json.RawMessage `json:"secrets"`
+	SSHKeys json.RawMessage            `json:"ssh_keys,omitempty"`
+}
+
+// BackupOptions configures CreateBackup.
+type BackupOptions struct {
+	// Recipients the manifest is encrypted to: an age.ScryptRecipient for a
+	// passphrase, or age X25519 recipients.
+	Recipients []age.Recipient
+	// SSHKeys holds the SSH agent's key records (~/.locksmith/ssh_keys.json)
+	// to include in the bundle.
+	SSHKeys json.RawMessage
+}
+
+// CreateBackup writes a bundle of every secret in the vault, with its
+// metadata, to w and returns its manifest. Secrets are read with at most one
+// authentication prompt; history and the cache master key are not included.
+func (l *Locksmith) CreateBackup(w io.Writer, opts BackupOptions) (*BackupManifest, error) {
+	if len(opts.Recipients) == 0 {
+		return nil, fmt.Errorf("a backup needs a passphrase or at least one recipient")
+	}
+	prompt := l.Options.getPrompt("Authentication required to back up secrets", "")
+	keys, _, err := l.backendListMetadata(l.Options.RequireBiometrics, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secrets: %w", err)
+	}
+
+	session := newAuthSession(prompt)
+	defer session.end()
+	session.join(l)
+
+	manifest := &BackupManifest{
+		CreatedAt: time.Now().UTC(),
+		Vault:     l.vaultName(),
+		Service:   l.Service,
+	}
+	payload := backupPayload{Secrets: make(map[string]json.RawMessage, len(keys))}
+	defer func() {
+		for _, data := range payload.Secrets {
+			zeroBytes(data)
+		}
+	}()
+	for _, key := range keys {
+		if isInternalKey(key) {
+			continue
+		}
+		secret, err := l.getSecretNoRotate(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read '%s': %w", key, err)
+		}
+		data, err := json.Marshal(secret)
+		if err != nil {
+			return nil, err
+		}
+		payload.Secrets[key] = data
+		manifest.Entries = append(manifest.Entries, BackupEntry{
+			Key:      key,
+			Metadata: metadataOf(*secret),
+			SHA256:   sha256Hex(data),
+		})
+	}
+	if len(opts.SSHKeys) > 0 {
+		var records []json.RawMessage
+		if err := json.Unmarshal(opts.SSHKeys, &records); err != nil {
+			return nil, fmt.Errorf("invalid SSH key records: %w", err)
+		}
+		payload.SSHKeys = opts.SSHKeys
+		manifest.SSHKeys = len(records)
+		manifest.SSHKeysSHA256 = sha256Hex(opts.SSHKeys)
+	}
+
+	plain, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(plain)
+	manifest.PayloadKey = make([]byte, 32)
+	if _, err := rand.Read(manifest.PayloadKey); err != nil {
+		return nil, err
+	}
+	gcm, err := backupAEAD(manifest.PayloadKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := gcm.Seal(nonce, nonce, plain, backupAD())
+	manifest.PayloadSHA256 = sha256Hex(sealed)
+
+	manifestJSON, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(manifestJSON)
+	var encrypted bytes.Buffer
+	aw, err := age.Encrypt(&encrypted, opts.Recipients...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt the manifest: %w", err)
+	}
+	if _, err := aw.Write(manifestJSON); err != nil {
+		return nil, err
+	}
+	if err := aw.Close(); err != nil {
+		return nil, err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(backupEnvelope{
+		Format:   BackupFormat,
+		Version:  backupFormatVersion,
+		Manifest: encrypted.Bytes(),
+		Payload:  sealed,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+	return manifest, nil
+}
+
+// Backup is an opened bundle. Its manifest is decrypted and the payload
+// checked against it; values are only decrypted by Restore.
+type Backup struct {
+	Manifest BackupManifest
+	payload  []byte
+}
+
+// OpenBackup reads a bundle and decrypts its manifest with identities (an
+// age.ScryptIdentity for a passphrase, or age X25519 identities).
+func OpenBackup(r io.Reader, identities ...age.Identity) (*Backup, error) {
+	var env backupEnvelope
+	if err := json.NewDecoder(r).Decode(&env); err != nil || env.Format != BackupFormat {
+		return nil, fmt.Errorf("not a locksmith backup bundle")
+	}
+	if env.Version != backupFormatVersion {
+		return nil, fmt.Errorf("unsupported backup version %d", env.Version)
+	}
+
+	ar, err := age.Decrypt(bytes.NewReader(env.Manifest), identities...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt the backup: %w", err)
+	}
+	manifestJSON, err := io.ReadAll(ar)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBackupCorrupt, err)
+	}
+	defer zeroBytes(manifestJSON)
+
+	b := &Backup{payload: env.Payload}
+	if err := json.Unmarshal(manifestJSON, &b.Manifest); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBackupCorrupt, err)
+	}
+	if sha256Hex(env.Payload) != b.Manifest.PayloadSHA256 {
+		return nil, fmt.Errorf("%w: payload does not match the manifest", ErrBackupCorrupt)
+	}
+	return b, nil
+}
+
+// Select returns the entries whose key matches one of the globs; no globs
+// select every entry.
+func (b *Backup) Select(patterns []string) ([]BackupEntry, error) {
+	for _, pattern := range patterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+		}
+	}
+	var selected []BackupEntry
+	for _, e := range b.Manifest.Entries {
+		if len(patterns) == 0 || matchesAny(patterns, e.Key) {
+			selected = append(selected, e)
+		}
+	}
+	return selected, nil
+}
+
+func matchesAny(patterns []string, key string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := filepath.Match(pattern, key); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// decrypt opens the payload and verifies every secret and the SSH key
+// records against the manifest.
+func (b *Backup) decrypt() (*backupPayload, error) {
+	gcm, err := backupAEAD(b.Manifest.PayloadKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(b.payload) < gcm.NonceSize() {
+		return nil, ErrBackupCorrupt
+	}
+	plain, err := gcm.Open(nil, b.payload[:gcm.NonceSize()], b.payload[gcm.NonceSize():], backupAD())
+	if err != nil {
+		return nil, ErrBackupCorrupt
+	}
+	defer zeroBytes(plain)
+
+	var payload backupPayload
+	if err := json.Unmarshal(plain, &payload); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBackupCorrupt, err)
+	}
+	if len(payload.Secrets) != len(b.Manifest.Entries) {
+		return nil, fmt.Errorf("%w: %d secrets for %d manifest entries", ErrBackupCorrupt, len(payload.Secrets), len(b.Manifest.Entries))
+	}
+	for _, e := range b.Manifest.Entries {
+		data, ok := payload.Secrets[e.Key]
+		if !ok || sha256Hex(data) != e.SHA256 {
+			return nil, fmt.Errorf("%w: secret '%s' does not match the manifest", ErrBackupCorrupt, e.Key)
+		}
+	}
+	if b.Manifest.SSHKeysSHA256 != "" && sha256Hex(payload.SSHKeys) != b.Manifest.SSHKeysSHA256 {
+		return nil, fmt.Errorf("%w: SSH key records do not match the manifest", ErrBackupCorrupt)
+	}
+	return &payload, nil
+}
+
+// RestoreAction is the outcome of restoring a single key.
+type RestoreAction string
+
+const (
+	RestoreRestored    RestoreAction = "restored"
+	RestoreOverwritten RestoreAction = "overwritten"
+	RestoreRenamed     RestoreAction = "renamed"
+	RestoreSkipped     RestoreAction = "skipped"
+	RestoreFailed      RestoreAction = "failed"
+)
+
+// RestoreOptions configures Restore.
+type RestoreOptions struct {
+	// Patterns select the keys to restore (globs, '*' does not cross '/');
+	// empty restores every key.
+	Patterns []string
+	Conflict ConflictPolicy
+	// DryRun reports what would happen from the manifest alone, without
+	// decrypting any value or writing anything.
+	DryRun            bool
+	RequireBiometrics bool
+	// Progress, when set, is called after each key is processed.
+	Progress func(RestoreResult)
+}
+
+// RestoreResult describes what happened to one key.
+type RestoreResult struct {
+	Key string
+	// TargetKey differs from Key when the conflict policy renamed it.
+	TargetKey string
+	Action    RestoreAction
+	Err       error
+}
+
+// Restore writes the selected secrets of b to the vault through PutSecret,
+// keeping their metadata and creation dates; replaced values stay in
+// history. The whole bundle is verified before anything is written. Keys
+// that exist are handled by opts.Conflict; renamed keys get a ".restored"
+// suffix. The bundle's SSH key records are returned for the caller to merge.
+func (l *Locksmith) Restore(b *Backup, opts RestoreOptions) ([]RestoreResult, json.RawMessage, error) {
+	if opts.Conflict == "" {
+		opts.Conflict = ConflictSkip
+	}
+	selected, err := b.Select(opts.Patterns)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var payload *backupPayload
+	if !opts.DryRun {
+		if payload, err = b.decrypt(); err != nil {
+			return nil, nil, err
+		}
+		defer func() {
+			for _, data := range payload.Secrets {
+				zeroBytes(data)
+			}
+		}()
+	}
+
+	existing, err := l.ListKeyNames()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list existing keys: %w", err)
+	}
+	taken := make(map[string]bool, len(existing))
+	for _, k := range existing {
+		taken[k] = true
+	}
+
+	session := newAuthSession(l.Options.getPrompt(fmt.Sprintf("Authentication required to restore %d secrets", len(selected)), ""))
+	defer session.end()
+	session.join(l)
+
+	sort.Slice(selected, func(i, j int) bool { return selected[i].Key < selected[j].Key })
+	results := make([]RestoreResult, 0, len(selected))
+	for _, e := range selected {
+		res := l.restoreOne(e, payload, taken, opts)
+		if res.Action != RestoreSkipped && res.Action != RestoreFailed {
+			taken[res.TargetKey] = true
+		}
+		results = append(results, res)
+		if opts.Progress != nil {
+			opts.Progress(res)
+		}
+	}
+	if payload == nil {
+		return results, nil, nil
+	}
+	return results, payload.SSHKeys, nil
+}
+
+func (l *Locksmith) restoreOne(e BackupEntry, payload *backupPayload, taken map[string]bool, opts RestoreOptions) RestoreResult {
+	res := RestoreResult{Key: e.Key, TargetKey: e.Key, Action: RestoreRestored}
+	if taken[e.Key] {
+		switch opts.Conflict {
+		case ConflictOverwrite:
+			res.Action = RestoreOverwritten
+		case ConflictRename:
+			res.Action = RestoreRenamed
+			res.TargetKey = renamedKey(e.Key, "restored", taken)
+		default:
+			res.Action = RestoreSkipped
+			return res
+		}
+	}
+	if opts.DryRun {
+		return res
+	}
+
+	var secret Secret
+	if err := json.Unmarshal(payload.Secrets[e.Key], &secret); err != nil {
+		res.Action = RestoreFailed
+		res.Err = fmt.Errorf("invalid secret: %w", err)
+		return res
+	}
+	if err := l.PutSecret(res.TargetKey, secret, opts.RequireBiometrics); err != nil {
+		res.Action = RestoreFailed
+		res.Err = err
+	}
+	return res
+}
+
+func backupAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, ErrBackupCorrupt
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// backupAD binds the payload to its purpose and format version.
+func backupAD() []byte {
+	return []byte("locksmith-backup/v1")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,155 @@
+package locksmith
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+)
+
+func newTestBackup(t *testing.T) (*Locksmith, []byte, *age.X25519Identity) {
+	t.Helper()
+	l, _ := newHistoryTestLocksmith()
+	created := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	for key, value := range map[string]string{"db/prod": "p1", "db/dev": "d1", "github/token": "gh"} {
+		if err := l.PutSecret(key, Secret{Value: []byte(value), CreatedAt: created, SecretType: SecretTypePassword, Tags: []string{"team"}}, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	manifest, err := l.CreateBackup(&buf, BackupOptions{
+		Recipients: []age.Recipient{id.Recipient()},
+		SSHKeys:    json.RawMessage(`[{"name":"work","public_key":"ssh-ed25519 AAAA"}]`),
+	})
+	if err != nil {
+		t.Fatalf("CreateBackup: %v", err)
+	}
+	if len(manifest.Entries) != 3 || manifest.SSHKeys != 1 {
+		t.Fatalf("unexpected manifest %+v", manifest)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("github/token")) || bytes.Contains(buf.Bytes(), []byte("ssh-ed25519")) {
+		t.Fatal("bundle must not contain plaintext keys or records")
+	}
+	return l, buf.Bytes(), id
+}
+
+func TestBackupRestore(t *testing.T) {
+	_, bundle, id := newTestBackup(t)
+
+	if _, err := OpenBackup(bytes.NewReader(bundle)); err == nil {
+		t.Fatal("expected opening without an identity to fail")
+	}
+	b, err := OpenBackup(bytes.NewReader(bundle), id)
+	if err != nil {
+		t.Fatalf("OpenBackup: %v", err)
+	}
+	selected, err := b.Select([]string{"db/*"})
+	if err != nil || len(selected) != 2 || selected[0].Key != "db/dev" {
+		t.Fatalf("Select(db/*) = %+v, %v", selected, err)
+	}
+
+	target, _ := newHistoryTestLocksmith()
+	if err := target.PutSecret("db/prod", Secret{Value: []byte("newer")}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// A dry run lists what would happen without decrypting the payload.
+	b.payload = []byte("not decrypted in a dry run")
+	results, ssh, err := target.Restore(b, RestoreOptions{Patterns: []string{"db/*"}, DryRun: true})
+	if err != nil || ssh != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if len(results) != 2 || results[0].Action != RestoreRestored || results[1].Action != RestoreSkipped {
+		t.Errorf("unexpected dry run results %+v", results)
+	}
+	if _, err := target.Get("db/dev"); err == nil {
+		t.Error("a dry run must not write")
+	}
+
+	b, _ = OpenBackup(bytes.NewReader(bundle), id)
+	results, ssh, err = target.Restore(b, RestoreOptions{Patterns: []string{"db/*"}, Conflict: ConflictRename})
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if results[1].Action != RestoreRenamed || results[1].TargetKey != "db/prod.restored" {
+		t.Errorf("expected db/prod to be renamed, got %+v", results[1])
+	}
+	restored, err := target.GetWithMetadata("db/prod.restored")
+	if err != nil || string(restored.Value) != "p1" || restored.SecretType != SecretTypePassword ||
+		!restored.CreatedAt.Equal(time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)) || len(restored.Tags) != 1 {
+		t.Errorf("metadata not restored: %+v, %v", restored, err)
+	}
+	if v, _ := target.Get("db/prod"); string(v) != "newer" {
+		t.Errorf("rename must keep the existing secret, got %q", v)
+	}
+	if _, err := target.Get("github/token"); err == nil {
+		t.Error("keys outside the patterns must not be restored")
+	}
+	if !strings.Contains(string(ssh), "ssh-ed25519") {
+		t.Errorf("expected the SSH key records, got %s", ssh)
+	}
+}
+
+func TestBackupPassphrase(t *testing.T) {
+	l, _ := newHistoryTestLocksmith()
+	if err := l.PutSecret("a", Secret{Value: []byte("1")}, false); err != nil {
+		t.Fatal(err)
+	}
+	recipient, err := age.NewScryptRecipient("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient.SetWorkFactor(10)
+	var buf bytes.Buffer
+	if _, err := l.CreateBackup(&buf, BackupOptions{Recipients: []age.Recipient{recipient}}); err != nil {
+		t.Fatalf("CreateBackup: %v", err)
+	}
+
+	wrong, _ := age.NewScryptIdentity("wrong")
+	if _, err := OpenBackup(bytes.NewReader(buf.Bytes()), wrong); err == nil {
+		t.Error("expected a wrong passphrase to fail")
+	}
+	right, _ := age.NewScryptIdentity("correct horse")
+	b, err := OpenBackup(bytes.NewReader(buf.Bytes()), right)
+	if err != nil || len(b.Manifest.Entries) != 1 || b.Manifest.Entries[0].Key != "a" {
+		t.Fatalf("OpenBackup = %+v, %v", b, err)
+	}
+}
+
+func TestBackupIntegrity(t *testing.T) {
+	_, bundle, id := newTestBackup(t)
+
+	var env backupEnvelope
+	if err := json.Unmarshal(bundle, &env); err != nil {
+		t.Fatal(err)
+	}
+	env.Payload[len(env.Payload)-1] ^= 1
+	tampered, _ := json.Marshal(env)
+	if _, err := OpenBackup(bytes.NewReader(tampered), id); !errors.Is(err, ErrBackupCorrupt) {
+		t.Errorf("expected a modified payload to be rejected, got %v", err)
+	}
+
+	// A manifest entry that no longer matches its secret fails the restore
+	// before anything is written.
+	b, err := OpenBackup(bytes.NewReader(bundle), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Manifest.Entries[0].SHA256 = sha256Hex([]byte("other"))
+	target, _ := newHistoryTestLocksmith()
+	if _, _, err := target.Restore(b, RestoreOptions{}); !errors.Is(err, ErrBackupCorrupt) {
+		t.Errorf("expected a digest mismatch to be rejected, got %v", err)
+	}
+	if keys, _ := target.ListKeyNames(); len(keys) != 0 {
+		t.Errorf("nothing should be restored from a corrupt bundle, got %v", keys)
+	}
+}
@@ -3,107 +3,441 @@ package locksmith
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/bonjoski/locksmith/v2/pkg/filelock"
 )
 
+// DiskCache stores each cached secret in its own AES-GCM encrypted file.
+// File names are an HMAC of the vault and key, so listing the directory
+// does not reveal which secrets exist; see cacheMagic for the file format.
 type DiskCache struct {
-	Dir       string
+	Dir string
+	// MasterKey is the cache key; the keys that encrypt entries and name
+	// their files are derived from it. When nil, keyFunc supplies it on
+	// first use.
 	MasterKey []byte
+	// Vault is bound into every entry, so entries cannot be moved between
+	// vaults sharing a master key. Empty means DefaultVaultName.
+	Vault string
+	// LockDir holds the per-entry lock files that keep processes from
+	// reading an entry another is writing. Empty disables locking.
+	LockDir string
+
+	keyFunc     func() ([]byte, error)
+	mu          sync.Mutex
+	derived     *diskCacheKeys
+	migrateOnce sync.Once
+}
+
+// diskCacheKeys are derived from the master key: enc encrypts entries and
+// names keys the HMAC of their file names.
+type diskCacheKeys struct {
+	enc   []byte
+	names []byte
 }
 
 func NewDiskCache(masterKey []byte) (*DiskCache, error) {
+	dir, err := VaultCacheDir(DefaultVaultName)
+	if err != nil {
+		return nil, err
+	}
+	return NewDiskCacheAt(masterKey, dir)
+}
+
+// NewDiskCacheAt returns a DiskCache storing its files in dir.
+func NewDiskCacheAt(masterKey []byte, dir string) (*DiskCache, error) {
 	if len(masterKey) != 32 {
 		return nil, fmt.Errorf("invalid master key length: expected 32 bytes, got %d", len(masterKey))
 	}
-	home, err := os.UserHomeDir()
-	if err != nil {
+	if err := os.MkdirAll(dir, 0700); err != nil {
 		return nil, err
 	}
-	dir := filepath.Join(home, ".locksmith", "cache")
+	return &DiskCache{Dir: dir, MasterKey: masterKey}, nil
+}
+
+// newKeyedDiskCache returns a DiskCache for vault storing its files in dir,
+// the master key of which is read with keyFunc when first needed.
+func newKeyedDiskCache(dir, vault string, keyFunc func() ([]byte, error)) (*DiskCache, error) {
 	if err := os.MkdirAll(dir, 0700); err != nil {
 		return nil, err
 	}
-	return &DiskCache{Dir: dir, MasterKey: masterKey}, nil
+	return &DiskCache{Dir: dir, Vault: vault, keyFunc: keyFunc}, nil
 }
 
-func (c *DiskCache) validatePath(key string) (string, error) {
-	path := filepath.Join(c.Dir, filepath.Clean(key))
-	absPath, err := filepath.Abs(path)
+// keys returns the keys derived from the master key.
+func (c *DiskCache) keys() (*diskCacheKeys, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.derived != nil {
+		return c.derived, nil
+	}
+	master := c.MasterKey
+	if master == nil && c.keyFunc != nil {
+		var err error
+		if master, err = c.keyFunc(); err != nil {
+			return nil, fmt.Errorf("cache key unavailable: %w", err)
+		}
+	}
+	if len(master) != 32 {
+		return nil, fmt.Errorf("invalid master key length: expected 32 bytes, got %d", len(master))
+	}
+	enc, err := hkdf.Key(sha256.New, master, nil, "locksmith cache encryption", 32)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	names, err := hkdf.Key(sha256.New, master, nil, "locksmith cache file names", 32)
+	if err != nil {
+		return nil, err
+	}
+	c.derived = &diskCacheKeys{enc: enc, names: names}
+	return c.derived, nil
+}
+
+// validateKey rejects keys that would have escaped the cache directory as a
+// version 1 file path; no key names a path any more, but such keys are not
+// legitimate either.
+func (c *DiskCache) validateKey(key string) error {
+	absPath, err := filepath.Abs(filepath.Join(c.Dir, filepath.Clean(key)))
+	if err != nil {
+		return err
 	}
 	absDir, err := filepath.Abs(c.Dir)
 	if err != nil {
-		return "", err
+		return err
 	}
 	if !strings.HasPrefix(absPath, absDir) {
-		return "", fmt.Errorf("security: path traversal attempt detected")
+		return fmt.Errorf("security: path traversal attempt detected")
 	}
-	return path, nil
+	return nil
+}
+
+// Cache files start with cacheMagic and a format version byte. Version 2
+// follows with two AES-GCM blocks, each a nonce and its ciphertext:
+//
+//	"LSC" | version | uint32 info length | info block | secret block
+//
+// The info block holds the key and when it was cached, with the header, the
+// vault and the file name as associated data; it is all 'cache ls' and
+// expiry checks decrypt. The secret block has the header, the vault and the
+// key as associated data, so it cannot be swapped with another entry's.
+// Version 1 files held a single block without associated data in a file
+// named after the key; they are migrated when the cache is first used.
+const (
+	cacheMagic   = "LSC"
+	cacheVersion = 2
+
+	cacheHeaderLen = len(cacheMagic) + 1
+)
+
+// cacheInfo describes a cached secret; CachedAt+TTL, capped at the secret's
+// ExpiresAt, is its Deadline.
+type cacheInfo struct {
+	Key      string        `json:"key"`
+	CachedAt time.Time     `json:"cached_at"`
+	TTL      time.Duration `json:"ttl"`
+	Deadline time.Time     `json:"deadline"`
+}
+
+// cacheEntry is a cached secret with its info, the JSON of which was the
+// whole of a version 1 file.
+type cacheEntry struct {
+	cacheInfo
+	Secret Secret `json:"secret"`
 }
 
+// Set caches secret for at most ttl, and never past its ExpiresAt. A ttl of
+// zero or less, or a secret that has already expired, removes key from the
+// cache instead.
 func (c *DiskCache) Set(key string, secret Secret, ttl time.Duration) error {
-	path, err := c.validatePath(key)
+	if err := c.validateKey(key); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	entry := cacheEntry{cacheInfo: cacheInfo{Key: key, CachedAt: now, TTL: ttl, Deadline: now.Add(ttl)}, Secret: secret}
+	if !secret.ExpiresAt.IsZero() && secret.ExpiresAt.Before(entry.Deadline) {
+		entry.Deadline = secret.ExpiresAt
+	}
+	if ttl <= 0 || !now.Before(entry.Deadline) {
+		return c.Delete(key)
+	}
+	c.migrate()
+	keys, err := c.keys()
+	if err != nil {
+		return err
+	}
+	return c.writeEntry(keys, &entry)
+}
+
+// Get returns the cached secret, however old; IsExpired says whether it is
+// still fresh.
+func (c *DiskCache) Get(key string) (*Secret, error) {
+	if err := c.validateKey(key); err != nil {
+		return nil, err
+	}
+	c.migrate()
+	keys, err := c.keys()
 	if err != nil {
+		return nil, err
+	}
+	var entry *cacheEntry
+	name := keys.fileName(c.vault(), key)
+	if err := c.withEntryLock(name, func() (err error) {
+		entry, err = c.readEntry(keys, name, key, true)
 		return err
+	}); err != nil || entry == nil {
+		return nil, err
 	}
+	return &entry.Secret, nil
+}
 
-	data, err := json.Marshal(secret)
+func (c *DiskCache) Delete(key string) error {
+	if err := c.validateKey(key); err != nil {
+		return err
+	}
+	c.migrate()
+	keys, err := c.keys()
 	if err != nil {
 		return err
 	}
-	defer func() {
-		for i := range data {
-			data[i] = 0
+	name := keys.fileName(c.vault(), key)
+	return c.withEntryLock(name, func() error {
+		err := os.Remove(filepath.Join(c.Dir, name))
+		if err != nil && !os.IsNotExist(err) {
+			return err
 		}
-	}()
+		return nil
+	})
+}
 
-	encrypted, err := c.encrypt(data)
+// IsExpired reports whether key should no longer be served from the cache:
+// it is missing or unreadable, past the deadline stored with it, or cached
+// longer than ttl ago.
+func (c *DiskCache) IsExpired(key string, ttl time.Duration) bool {
+	if c.validateKey(key) != nil {
+		return true
+	}
+	c.migrate()
+	keys, err := c.keys()
 	if err != nil {
-		return fmt.Errorf("failed to encrypt cache item: %w", err)
+		return true
+	}
+	var entry *cacheEntry
+	name := keys.fileName(c.vault(), key)
+	if err := c.withEntryLock(name, func() (err error) {
+		entry, err = c.readEntry(keys, name, key, false)
+		return err
+	}); err != nil || entry == nil {
+		return true
+	}
+	now := time.Now()
+	return !now.Before(entry.Deadline) || now.Sub(entry.CachedAt) > ttl
+}
+
+func (c *DiskCache) vault() string {
+	if c.Vault == "" {
+		return DefaultVaultName
+	}
+	return c.Vault
+}
+
+// fileName returns the name of the cache file of key in vault.
+func (k *diskCacheKeys) fileName(vault, key string) string {
+	mac := hmac.New(sha256.New, k.names)
+	mac.Write([]byte(vault))
+	mac.Write([]byte{0})
+	mac.Write([]byte(key))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// cacheAAD returns the associated data of a block: the file header, the
+// vault and what the block is bound to.
+func (c *DiskCache) cacheAAD(header []byte, binding string) []byte {
+	aad := make([]byte, 0, len(header)+len(c.vault())+1+len(binding))
+	aad = append(aad, header...)
+	aad = append(aad, c.vault()...)
+	aad = append(aad, 0)
+	return append(aad, binding...)
+}
+
+func (c *DiskCache) writeEntry(keys *diskCacheKeys, entry *cacheEntry) error {
+	info, err := json.Marshal(entry.cacheInfo)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(entry.Secret)
+	if err != nil {
+		return err
 	}
 	defer func() {
-		for i := range encrypted {
-			encrypted[i] = 0
+		for i := range payload {
+			payload[i] = 0
 		}
 	}()
 
-	// Create parent directories in case the key contains slashes
-	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0700); err != nil {
-		return fmt.Errorf("failed to create cache subdirectory: %w", err)
+	name := keys.fileName(c.vault(), entry.Key)
+	header := []byte{cacheMagic[0], cacheMagic[1], cacheMagic[2], cacheVersion}
+	sealedInfo, err := aesGCMSeal(keys.enc, info, c.cacheAAD(header, name))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt cache item: %w", err)
+	}
+	sealedSecret, err := aesGCMSeal(keys.enc, payload, c.cacheAAD(header, entry.Key))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt cache item: %w", err)
 	}
 
-	return os.WriteFile(path, encrypted, 0600)
+	data := make([]byte, 0, cacheHeaderLen+4+len(sealedInfo)+len(sealedSecret))
+	data = append(data, header...)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(sealedInfo))) // #nosec G115 -- a few hundred bytes
+	data = append(data, sealedInfo...)
+	data = append(data, sealedSecret...)
+	return c.withEntryLock(name, func() error {
+		return os.WriteFile(filepath.Join(c.Dir, name), data, 0600)
+	})
 }
 
-func (c *DiskCache) Get(key string) (*Secret, error) {
-	path, err := c.validatePath(key)
+// withEntryLock runs fn holding the cross-process lock of the cache file
+// name, so that no process reads an entry while another is writing it.
+func (c *DiskCache) withEntryLock(name string, fn func() error) error {
+	if c.LockDir == "" {
+		return fn()
+	}
+	lock, err := filelock.Acquire(filepath.Join(c.LockDir, "cache-"+name+".lock"))
 	if err != nil {
-		return nil, err
+		return err
 	}
+	defer func() { _ = lock.Release() }()
+	return fn()
+}
 
-	encrypted, err := os.ReadFile(path) // #nosec G304
+// readEntry reads the cache file name, which must hold key unless key is
+// empty, or returns nil when it does not exist. The secret is only
+// decrypted when withSecret is set.
+func (c *DiskCache) readEntry(keys *diskCacheKeys, name, key string, withSecret bool) (*cacheEntry, error) {
+	data, err := os.ReadFile(filepath.Join(c.Dir, name)) // #nosec G304 -- name is an HMAC or read from Dir
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, nil
 		}
 		return nil, err
 	}
+	defer func() {
+		for i := range data {
+			data[i] = 0
+		}
+	}()
+
+	if len(data) < cacheHeaderLen+4 || string(data[:len(cacheMagic)]) != cacheMagic {
+		return nil, fmt.Errorf("not a cache file")
+	}
+	header := data[:cacheHeaderLen]
+	if v := header[len(cacheMagic)]; v != cacheVersion {
+		return nil, fmt.Errorf("unsupported cache format version %d", v)
+	}
+	rest := data[cacheHeaderLen:]
+	infoLen := binary.BigEndian.Uint32(rest)
+	rest = rest[4:]
+	if uint64(infoLen) > uint64(len(rest)) {
+		return nil, fmt.Errorf("cache file is truncated")
+	}
+
+	info, err := aesGCMOpen(keys.enc, rest[:infoLen], c.cacheAAD(header, name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt cache item: %w", err)
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(info, &entry.cacheInfo); err != nil {
+		return nil, err
+	}
+	if key != "" && entry.Key != key {
+		return nil, fmt.Errorf("cache file does not belong to '%s'", key)
+	}
+	if !withSecret {
+		return &entry, nil
+	}
+
+	payload, err := aesGCMOpen(keys.enc, rest[infoLen:], c.cacheAAD(header, entry.Key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt cache item: %w", err)
+	}
+	defer func() {
+		for i := range payload {
+			payload[i] = 0
+		}
+	}()
+	if err := json.Unmarshal(payload, &entry.Secret); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// migrate rewrites the version 1 files of the cache directory in the
+// current format, once per DiskCache. Files that cannot be read, e.g.
+// because they were written under another master key, are removed, as
+// their names alone reveal a key.
+func (c *DiskCache) migrate() {
+	c.migrateOnce.Do(func() {
+		keys, keysErr := c.keys()
+		_ = filepath.WalkDir(c.Dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(c.Dir, path)
+			if err != nil || isCacheFileName(rel) {
+				return nil
+			}
+			if keysErr == nil {
+				if entry, err := c.readLegacyEntry(path, filepath.ToSlash(rel)); err == nil && time.Now().Before(entry.Deadline) {
+					_ = c.writeEntry(keys, entry)
+					entry.Secret.Zero()
+				}
+			}
+			_ = os.Remove(path)
+			c.removeEmptyDirs(filepath.Dir(path))
+			return nil
+		})
+	})
+}
+
+// isCacheFileName reports whether name is a version 2 file name.
+func isCacheFileName(name string) bool {
+	if len(name) != hex.EncodedLen(sha256.Size) {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil
+}
+
+// readLegacyEntry reads a version 1 file, the path of which is key. Version
+// 1 files were encrypted with the master key itself.
+func (c *DiskCache) readLegacyEntry(path, key string) (*cacheEntry, error) {
+	encrypted, err := os.ReadFile(path) // #nosec G304 -- walked from Dir
+	if err != nil {
+		return nil, err
+	}
 	defer func() {
 		for i := range encrypted {
 			encrypted[i] = 0
 		}
 	}()
 
-	data, err := c.decrypt(encrypted)
+	data, err := aesGCMOpen(c.MasterKey, encrypted, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decrypt cache item: %w", err)
 	}
@@ -113,21 +447,36 @@ func (c *DiskCache) Get(key string) (*Secret, error) {
 		}
 	}()
 
-	_, err = os.Stat(path)
+	info, err := os.Stat(path)
 	if err != nil {
 		return nil, err
 	}
 
-	var secret Secret
-	if err := json.Unmarshal(data, &secret); err != nil {
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
 		return nil, err
 	}
-
-	return &secret, nil
+	if entry.CachedAt.IsZero() {
+		// The first version 1 entries held the bare secret and were cached
+		// for DefaultCacheTTL from their modification time.
+		entry = cacheEntry{cacheInfo: cacheInfo{CachedAt: info.ModTime(), TTL: DefaultCacheTTL, Deadline: info.ModTime().Add(DefaultCacheTTL)}}
+		if err := json.Unmarshal(data, &entry.Secret); err != nil {
+			return nil, err
+		}
+		if !entry.Secret.ExpiresAt.IsZero() && entry.Secret.ExpiresAt.Before(entry.Deadline) {
+			entry.Deadline = entry.Secret.ExpiresAt
+		}
+	}
+	if entry.Key == "" {
+		entry.Key = key
+	}
+	return &entry, nil
 }
 
-func (c *DiskCache) encrypt(data []byte) ([]byte, error) {
-	block, err := aes.NewCipher(c.MasterKey)
+// aesGCMSeal encrypts data under key and returns the nonce followed by the
+// ciphertext.
+func aesGCMSeal(key, data, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
 	}
@@ -142,11 +491,12 @@ func (c *DiskCache) encrypt(data []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	return gcm.Seal(nonce, nonce, data, nil), nil
+	return gcm.Seal(nonce, nonce, data, additionalData), nil
 }
 
-func (c *DiskCache) decrypt(data []byte) ([]byte, error) {
-	block, err := aes.NewCipher(c.MasterKey)
+// aesGCMOpen decrypts what aesGCMSeal returned.
+func aesGCMOpen(key, data, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
 	}
@@ -162,31 +512,142 @@ func (c *DiskCache) decrypt(data []byte) ([]byte, error) {
 	}
 
 	nonce, ciphertext := data[:nonceSize], data[nonceSize:]
-	return gcm.Open(nil, nonce, ciphertext, nil)
+	return gcm.Open(nil, nonce, ciphertext, additionalData)
 }
 
-func (c *DiskCache) Delete(key string) error {
-	path, err := c.validatePath(key)
+// removeEmptyDirs removes dir and its parents up to the cache directory
+// while they are empty.
+func (c *DiskCache) removeEmptyDirs(dir string) {
+	root := filepath.Clean(c.Dir)
+	for dir = filepath.Clean(dir); dir != root && strings.HasPrefix(dir, root+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
+
+// CacheEntryInfo describes a cached secret without its value.
+type CacheEntryInfo struct {
+	Key      string
+	CachedAt time.Time
+	Deadline time.Time
+	// Expired is set by Locksmith.CacheEntries when the entry would no
+	// longer be served.
+	Expired bool
+	// Err is set for entries that cannot be read, e.g. because they were
+	// written under another master key. Key is then the file name.
+	Err error
+
+	file string
+}
+
+// CacheLister is implemented by caches whose entries can be enumerated,
+// such as DiskCache; the cache commands require it.
+type CacheLister interface {
+	Entries() ([]CacheEntryInfo, error)
+	// RemoveEntry removes an entry returned by Entries, even one that
+	// cannot be read.
+	RemoveEntry(e CacheEntryInfo) error
+}
+
+// Entries returns every cached entry, sorted by key. Only the entries'
+// info blocks are decrypted.
+func (c *DiskCache) Entries() ([]CacheEntryInfo, error) {
+	c.migrate()
+	keys, keysErr := c.keys()
+	files, err := os.ReadDir(c.Dir)
 	if err != nil {
-		return err
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
 	}
+	var entries []CacheEntryInfo
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		entry, err := (*cacheEntry)(nil), keysErr
+		if err == nil {
+			entry, err = c.readEntry(keys, f.Name(), "", false)
+		}
+		switch {
+		case err != nil:
+			entries = append(entries, CacheEntryInfo{Key: f.Name(), Err: err, file: f.Name()})
+		case entry != nil:
+			entries = append(entries, CacheEntryInfo{Key: entry.Key, CachedAt: entry.CachedAt, Deadline: entry.Deadline, file: f.Name()})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries, nil
+}
 
-	err = os.Remove(path)
+// RemoveEntry removes the file of an entry returned by Entries.
+func (c *DiskCache) RemoveEntry(e CacheEntryInfo) error {
+	name := e.file
+	if name == "" {
+		keys, err := c.keys()
+		if err != nil {
+			return err
+		}
+		name = keys.fileName(c.vault(), e.Key)
+	}
+	err := os.Remove(filepath.Join(c.Dir, filepath.Base(name)))
 	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
 	return nil
 }
 
-func (c *DiskCache) IsExpired(key string, ttl time.Duration) bool {
-	path, err := c.validatePath(key)
-	if err != nil {
-		return true
+// Rekey re-encrypts the entries that are still fresh under masterKey and
+// removes the others, including every entry when the current master key is
+// unavailable. It returns how many entries were kept and removed.
+func (c *DiskCache) Rekey(masterKey []byte) (kept, removed int, err error) {
+	if len(masterKey) != 32 {
+		return 0, 0, fmt.Errorf("invalid master key length: expected 32 bytes, got %d", len(masterKey))
+	}
+	c.migrate()
+	files, err := os.ReadDir(c.Dir)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, 0, err
 	}
 
-	info, err := os.Stat(path)
+	var entries []*cacheEntry
+	defer func() {
+		for _, e := range entries {
+			e.Secret.Zero()
+		}
+	}()
+	oldKeys, keysErr := c.keys()
+	now := time.Now()
+	total := 0
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		total++
+		if keysErr == nil {
+			if e, err := c.readEntry(oldKeys, f.Name(), "", true); err == nil && e != nil && now.Before(e.Deadline) {
+				entries = append(entries, e)
+			}
+		}
+		if err := os.Remove(filepath.Join(c.Dir, f.Name())); err != nil && !os.IsNotExist(err) {
+			return 0, 0, err
+		}
+	}
+
+	c.mu.Lock()
+	c.MasterKey, c.derived = masterKey, nil
+	c.mu.Unlock()
+	keys, err := c.keys()
 	if err != nil {
-		return true
+		return 0, 0, err
+	}
+	for _, e := range entries {
+		if err := c.writeEntry(keys, e); err != nil {
+			return kept, total - kept, err
+		}
+		kept++
 	}
-	return time.Since(info.ModTime()) > ttl
+	return kept, total - kept, nil
 }
@@ -0,0 +1,177 @@
+package locksmith
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CacheNever as a cache TTL keeps matching keys out of the disk cache.
+const CacheNever = "never"
+
+// CacheConfig controls how long decrypted secrets are kept in the disk
+// cache. Entries are never served past their secret's expiry.
+type CacheConfig struct {
+	TTL      string        `yaml:"ttl,omitempty"`      // keys no policy matches; default 1h
+	Policies []CachePolicy `yaml:"policies,omitempty"` // the first policy whose keys match applies
+	// Passphrase wraps new cache keys with a passphrase (prompted for, or
+	// read from LOCKSMITH_CACHE_PASSPHRASE); 'locksmith cache rekey' applies
+	// a change to the existing key.
+	Passphrase bool `yaml:"passphrase,omitempty"`
+}
+
+// CachePolicy sets the cache TTL of the keys matching one of Keys.
+type CachePolicy struct {
+	Keys []string `yaml:"keys"`          // globs, e.g. "prod/*"
+	TTL  string   `yaml:"ttl,omitempty"` // e.g. "5m", "1d"; "never" or "0" disables caching
+}
+
+// CacheTTL returns how long key may be served from the cache; zero means it
+// is never cached. TTLs that cannot be parsed are treated as "never", so a
+// typo cannot extend how long a secret stays on disk.
+func (c *Config) CacheTTL(key string) time.Duration {
+	if c == nil {
+		return DefaultCacheTTL
+	}
+	for _, p := range c.Cache.Policies {
+		for _, pattern := range p.Keys {
+			if matched, err := filepath.Match(pattern, key); err == nil && matched {
+				return parseCacheTTL(p.TTL)
+			}
+		}
+	}
+	if c.Cache.TTL == "" {
+		return DefaultCacheTTL
+	}
+	return parseCacheTTL(c.Cache.TTL)
+}
+
+// ParseCacheTTL parses a cache TTL: "never", a Go duration or a ParseDuration
+// value such as "1d".
+func ParseCacheTTL(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if strings.EqualFold(s, CacheNever) || s == "0" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		if d, err = ParseDuration(s); err != nil {
+			return 0, fmt.Errorf("invalid cache ttl '%s': use a duration such as 15m or 1d, or 'never'", s)
+		}
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("invalid cache ttl '%s': must not be negative", s)
+	}
+	return d, nil
+}
+
+func parseCacheTTL(s string) time.Duration {
+	d, err := ParseCacheTTL(s)
+	if err != nil {
+		return 0
+	}
+	return d
+}
+
+// cacheTTL returns the cache TTL of key; history items follow the key they
+// belong to.
+func (l *Locksmith) cacheTTL(key string) time.Duration {
+	return l.Config.CacheTTL(strings.TrimPrefix(key, HistoryPrefix))
+}
+
+// cacheSet caches secret under key for its configured TTL, or removes key
+// from the cache when it must not be cached.
+func (l *Locksmith) cacheSet(key string, secret Secret) error {
+	ttl := l.cacheTTL(key)
+	if ttl <= 0 || secret.IsExpired() {
+		return l.Cache.Delete(key)
+	}
+	return l.Cache.Set(key, secret, ttl)
+}
+
+// cachedSecret returns key's cached secret while it is fresh: within its
+// TTL and not past the secret's expiry.
+func (l *Locksmith) cachedSecret(key string) *Secret {
+	if l.Options.BypassCache {
+		return nil
+	}
+	ttl := l.cacheTTL(key)
+	if ttl <= 0 || l.Cache.IsExpired(key, ttl) {
+		return nil
+	}
+	return l.staleCachedSecret(key)
+}
+
+// staleCachedSecret returns key's cached secret however old, as long as the
+// secret itself has not expired.
+func (l *Locksmith) staleCachedSecret(key string) *Secret {
+	secret, err := l.Cache.Get(key)
+	if err != nil || secret == nil || secret.IsExpired() {
+		return nil
+	}
+	return secret
+}
+
+// CacheEntries lists the vault's cache without reading any value from it.
+// Expired is set for entries that would no longer be served.
+func (l *Locksmith) CacheEntries() ([]CacheEntryInfo, error) {
+	lister, ok := l.Cache.(CacheLister)
+	if !ok {
+		return nil, fmt.Errorf("the cache of vault '%s' cannot be listed", l.vaultName())
+	}
+	entries, err := lister.Entries()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for i := range entries {
+		e := &entries[i]
+		ttl := l.cacheTTL(e.Key)
+		e.Expired = e.Err != nil || ttl <= 0 || !now.Before(e.Deadline) || now.Sub(e.CachedAt) > ttl
+	}
+	return entries, nil
+}
+
+// ClearCache removes the cached entries whose key matches pattern (every
+// entry when pattern is empty), with their cached history, and returns how
+// many were removed.
+func (l *Locksmith) ClearCache(pattern string) (int, error) {
+	if pattern != "" {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return 0, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+		}
+	}
+	return l.removeCacheEntries(func(e CacheEntryInfo) bool {
+		if pattern == "" {
+			return true
+		}
+		matched, _ := filepath.Match(pattern, strings.TrimPrefix(e.Key, HistoryPrefix))
+		return matched
+	})
+}
+
+// GCCache removes expired and unreadable cache entries and returns how many
+// were removed.
+func (l *Locksmith) GCCache() (int, error) {
+	return l.removeCacheEntries(func(e CacheEntryInfo) bool { return e.Expired })
+}
+
+func (l *Locksmith) removeCacheEntries(remove func(CacheEntryInfo) bool) (int, error) {
+	entries, err := l.CacheEntries()
+	if err != nil {
+		return 0, err
+	}
+	lister := l.Cache.(CacheLister)
+	removed := 0
+	for _, e := range entries {
+		if !remove(e) {
+			continue
+		}
+		if err := lister.RemoveEntry(e); err != nil {
+			return removed, fmt.Errorf("failed to remove '%s': %w", e.Key, err)
+		}
+		removed++
+	}
+	return removed, nil
+}
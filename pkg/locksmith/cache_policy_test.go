@@ -0,0 +1,135 @@
+package locksmith
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConfigCacheTTL(t *testing.T) {
+	cfg := &Config{Cache: CacheConfig{
+		TTL: "15m",
+		Policies: []CachePolicy{
+			{Keys: []string{"prod/*", "root"}, TTL: "never"},
+			{Keys: []string{"dev/*"}, TTL: "1d"},
+			{Keys: []string{"typo/*"}, TTL: "forever"},
+		},
+	}}
+	tests := map[string]time.Duration{
+		"prod/db":  0,
+		"root":     0,
+		"dev/api":  24 * time.Hour,
+		"typo/x":   0,
+		"other":    15 * time.Minute,
+		"prod/a/b": 15 * time.Minute, // '*' does not cross '/'
+	}
+	for key, want := range tests {
+		if got := cfg.CacheTTL(key); got != want {
+			t.Errorf("CacheTTL(%q) = %v, want %v", key, got, want)
+		}
+	}
+	if got := (*Config)(nil).CacheTTL("x"); got != DefaultCacheTTL {
+		t.Errorf("nil config: got %v", got)
+	}
+	if _, err := ParseCacheTTL("-5m"); err == nil {
+		t.Error("expected a negative ttl to be rejected")
+	}
+}
+
+func TestDiskCacheDeadline(t *testing.T) {
+	cache, err := NewDiskCacheAt(make([]byte, 32), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The stored TTL is honoured, not just the caller's.
+	if err := cache.Set("short", Secret{Value: []byte("v")}, time.Nanosecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	if !cache.IsExpired("short", time.Hour) {
+		t.Error("expected the entry to be past its stored TTL")
+	}
+
+	// A secret expiring before the TTL is only cached until it expires.
+	expiring := Secret{Value: []byte("v"), ExpiresAt: time.Now().Add(50 * time.Millisecond)}
+	if err := cache.Set("expiring", expiring, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if cache.IsExpired("expiring", time.Hour) {
+		t.Fatal("expected the entry to be fresh")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if !cache.IsExpired("expiring", time.Hour) {
+		t.Error("expected the entry to expire with its secret")
+	}
+
+	if err := cache.Set("gone", Secret{Value: []byte("v"), ExpiresAt: time.Now().Add(-time.Minute)}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := cache.Get("gone"); got != nil {
+		t.Error("an expired secret must not be cached")
+	}
+}
+
+func TestCachePolicies(t *testing.T) {
+	l, _ := newHistoryTestLocksmith()
+	dir := t.TempDir()
+	cache, err := NewDiskCacheAt(make([]byte, 32), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Cache = cache
+	l.Config = &Config{Cache: CacheConfig{Policies: []CachePolicy{{Keys: []string{"prod/*"}, TTL: "never"}}}}
+
+	for _, key := range []string{"prod/db", "dev/db", "dev/api"} {
+		if err := l.PutSecret(key, Secret{Value: []byte("v")}, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "prod", "db")); !os.IsNotExist(err) {
+		t.Errorf("a never-cache key must not reach the disk, got %v", err)
+	}
+	if v, err := l.Get("prod/db"); err != nil || string(v) != "v" {
+		t.Errorf("never-cache keys are read from the backend, got %q, %v", v, err)
+	}
+
+	entries, err := l.CacheEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, e := range entries {
+		if e.Expired || e.CachedAt.IsZero() {
+			t.Errorf("unexpected entry %+v", e)
+		}
+		keys = append(keys, e.Key)
+	}
+	if len(keys) != 2 || keys[0] != "dev/api" || keys[1] != "dev/db" {
+		t.Errorf("cached keys = %v", keys)
+	}
+
+	// An entry under another master key is unreadable and collected.
+	other, _ := NewDiskCacheAt(make([]byte, 32), dir)
+	other.MasterKey = []byte("0123456789abcdef0123456789abcdef")
+	if err := other.Set("stray", Secret{Value: []byte("v")}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := l.GCCache(); err != nil || n != 1 {
+		t.Errorf("GCCache = %d, %v; want 1", n, err)
+	}
+
+	if n, err := l.ClearCache("dev/a*"); err != nil || n != 1 {
+		t.Errorf("ClearCache(dev/a*) = %d, %v; want 1", n, err)
+	}
+	if n, err := l.ClearCache(""); err != nil || n != 1 {
+		t.Errorf("ClearCache() = %d, %v; want 1", n, err)
+	}
+	if _, err := l.ClearCache("["); err == nil {
+		t.Error("expected an invalid pattern to fail")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("expected an empty cache directory, got %d entries", len(entries))
+	}
+}
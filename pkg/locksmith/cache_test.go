@@ -4,9 +4,12 @@ import (
 	"bytes"
 	"encoding/json"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/bonjoski/locksmith/v2/pkg/filelock"
 )
 
 func TestDiskCache(t *testing.T) {
@@ -94,7 +97,7 @@ func TestDiskCacheEncryption(t *testing.T) {
 	}
 
 	// Manually read the file
-	data, err := os.ReadFile(cache.Dir + "/" + key)
+	data, err := os.ReadFile(filepath.Join(cache.Dir, cacheFileName(t, cache, key)))
 	if err != nil {
 		t.Fatalf("Failed to read raw cache file: %v", err)
 	}
@@ -118,3 +121,142 @@ func TestDiskCacheEncryption(t *testing.T) {
 		t.Errorf("Expected super-secret, got %s", got.Value)
 	}
 }
+
+func cacheFileName(t *testing.T, c *DiskCache, key string) string {
+	t.Helper()
+	keys, err := c.keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys.fileName(c.vault(), key)
+}
+
+func TestDiskCacheFormat(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewDiskCacheAt(make([]byte, 32), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"github/gh/token", "aws/key"} {
+		if err := cache.Set(key, Secret{Value: []byte(key)}, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, _ := os.ReadDir(dir)
+	if len(files) != 2 {
+		t.Fatalf("expected 2 flat cache files, got %d", len(files))
+	}
+	for _, f := range files {
+		if strings.Contains(f.Name(), "github") || strings.Contains(f.Name(), "aws") || !isCacheFileName(f.Name()) {
+			t.Errorf("file name %q reveals its key", f.Name())
+		}
+	}
+	token := filepath.Join(dir, cacheFileName(t, cache, "github/gh/token"))
+	data, err := os.ReadFile(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data[:4]) != cacheMagic+string(rune(cacheVersion)) {
+		t.Errorf("unexpected header %q", data[:4])
+	}
+
+	// Another vault sharing the directory and master key cannot read it.
+	other := &DiskCache{Dir: dir, MasterKey: make([]byte, 32), Vault: "work"}
+	if got, _ := other.Get("github/gh/token"); got != nil {
+		t.Error("entries must be bound to their vault")
+	}
+
+	// A file swapped in for another key's is rejected.
+	if err := os.WriteFile(filepath.Join(dir, cacheFileName(t, cache, "aws/key")), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := cache.Get("aws/key"); err == nil || got != nil {
+		t.Errorf("expected a swapped file to be rejected, got %v, %v", got, err)
+	}
+
+	data[3] = 9
+	if err := os.WriteFile(token, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.Get("github/gh/token"); err == nil || !strings.Contains(err.Error(), "version 9") {
+		t.Errorf("expected an unsupported version error, got %v", err)
+	}
+}
+
+func TestDiskCacheMigratesV1(t *testing.T) {
+	dir := t.TempDir()
+	key := make([]byte, 32)
+	writeV1 := func(name string, v any) {
+		t.Helper()
+		data, _ := json.Marshal(v)
+		sealed, err := aesGCMSeal(key, data, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, sealed, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	writeV1("github/gh/token", cacheEntry{cacheInfo{Key: "github/gh/token", CachedAt: now, TTL: time.Hour, Deadline: now.Add(time.Hour)}, Secret{Value: []byte("gh")}})
+	writeV1("bare", Secret{Value: []byte("bare")})
+	writeV1("stale", cacheEntry{cacheInfo{Key: "stale", CachedAt: now.Add(-2 * time.Hour), TTL: time.Hour, Deadline: now.Add(-time.Hour)}, Secret{Value: []byte("x")}})
+	if err := os.WriteFile(filepath.Join(dir, "foreign"), []byte("not ours"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cache, err := NewDiskCacheAt(key, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := cache.Get("github/gh/token")
+	if err != nil || got == nil || string(got.Value) != "gh" {
+		t.Fatalf("Get after migration = %v, %v", got, err)
+	}
+	if cache.IsExpired("bare", time.Hour) {
+		t.Error("a bare v1 secret should keep its remaining TTL")
+	}
+	entries, err := cache.Entries()
+	if err != nil || len(entries) != 2 || entries[0].Key != "bare" || entries[1].Key != "github/gh/token" {
+		t.Errorf("Entries = %+v, %v", entries, err)
+	}
+	files, _ := os.ReadDir(dir)
+	for _, f := range files {
+		if !isCacheFileName(f.Name()) {
+			t.Errorf("v1 file %q left behind", f.Name())
+		}
+	}
+}
+
+func TestDiskCacheEntryLock(t *testing.T) {
+	cache, err := NewDiskCacheAt(make([]byte, 32), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.LockDir = t.TempDir()
+
+	// Another process writing the entry holds its lock.
+	lock, err := filelock.Acquire(filepath.Join(cache.LockDir, "cache-"+cacheFileName(t, cache, "api")+".lock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	written := make(chan error)
+	go func() { written <- cache.Set("api", Secret{Value: []byte("v")}, time.Hour) }()
+	select {
+	case <-written:
+		t.Fatal("the entry was written while its lock was held")
+	case <-time.After(100 * time.Millisecond):
+	}
+	_ = lock.Release()
+	if err := <-written; err != nil {
+		t.Fatal(err)
+	}
+	if got, err := cache.Get("api"); err != nil || got == nil || string(got.Value) != "v" {
+		t.Errorf("Get = %v, %v", got, err)
+	}
+}
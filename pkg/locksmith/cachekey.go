@@ -0,0 +1,380 @@
+package locksmith
+
+import (
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/bonjoski/locksmith/v2/pkg/filelock"
+	"golang.org/x/crypto/argon2"
+)
+
+// CacheKeyPassphraseEnv is consulted for the passphrase of a wrapped cache
+// key before prompting.
+const CacheKeyPassphraseEnv = "LOCKSMITH_CACHE_PASSPHRASE" // #nosec G101 -- env var name, not a credential
+
+const (
+	cacheKeyVersion = 1
+	cacheKeyLen     = 32
+	cacheKeyWrapAD  = "locksmith-cache-key/v1"
+
+	// Bounds on the Argon2id parameters of a stored wrapped key, which
+	// argon2.IDKey would otherwise panic on or exhaust memory with.
+	maxCacheKeyKDFTime   = 64
+	maxCacheKeyKDFMemory = 1 << 20 // KiB (1 GiB)
+
+	// Purposes of the keys derived from a vault's cache key.
+	keyPurposeCache = "cache"
+	keyPurposeIndex = "index"
+)
+
+// ErrCacheKeyPassphrase is returned when a wrapped cache key cannot be
+// unwrapped with the passphrase given; 'locksmith cache rekey' replaces the
+// key and discards what was encrypted under it.
+var ErrCacheKeyPassphrase = errors.New("wrong cache key passphrase")
+
+// cacheKeyRecord is stored in the backend under MasterKeyAccount. Key holds
+// the cache key in the clear, unless the record is wrapped, in which case
+// Wrapped holds it sealed under a key derived from a passphrase with KDF.
+type cacheKeyRecord struct {
+	Version int          `json:"version"`
+	Key     []byte       `json:"key,omitempty"`
+	KDF     *cacheKeyKDF `json:"kdf,omitempty"`
+	Wrapped []byte       `json:"wrapped,omitempty"`
+}
+
+type cacheKeyKDF struct {
+	Name    string `json:"name"`
+	Salt    []byte `json:"salt"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+}
+
+// cacheKeyring holds a vault's cache key: 256 random bits stored in the
+// backend, from which the keys of the disk cache and the metadata index are
+// derived with HKDF, separated by vault and purpose. The key is read, or
+// created, on first use, so commands that touch neither never reach the
+// backend for it.
+type cacheKeyring struct {
+	backend Backend
+	service string
+	vault   string
+	// wrap seals new keys under a passphrase.
+	wrap   bool
+	prompt func(message string) ([]byte, error)
+	// lockDir holds the lock taken while creating a key; none is taken
+	// when it is empty.
+	lockDir string
+	// onCreate is called with a key that was just created.
+	onCreate func(key []byte)
+
+	mu  sync.Mutex
+	key []byte
+	err error
+}
+
+// cacheKeyStorer is implemented by backends that keep the cache key in
+// another backend than their secrets: remote backends keep it in the local
+// keychain, so the cache stays readable while they are unreachable, and
+// tiered backends in their primary, as the key belongs to the machine.
+type cacheKeyStorer interface {
+	cacheKeyBackend() Backend
+}
+
+func cacheKeyStore(b Backend) Backend {
+	for {
+		s, ok := b.(cacheKeyStorer)
+		if !ok {
+			return b
+		}
+		b = s.cacheKeyBackend()
+	}
+}
+
+// deriveKey returns the vault's key for purpose.
+func (k *cacheKeyring) deriveKey(purpose string) ([]byte, error) {
+	key, err := k.cacheKey()
+	if err != nil {
+		return nil, err
+	}
+	return deriveCacheKey(key, k.vault, purpose)
+}
+
+func deriveCacheKey(key []byte, vault, purpose string) ([]byte, error) {
+	return hkdf.Key(sha256.New, key, nil, "locksmith/v2\x00"+vault+"\x00"+purpose, cacheKeyLen)
+}
+
+// cacheKey returns the cache key, reading or creating it on first use. A
+// failure is remembered, so a wrong passphrase is asked for only once.
+func (k *cacheKeyring) cacheKey() ([]byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.key == nil && k.err == nil {
+		k.key, k.err = k.load()
+	}
+	return k.key, k.err
+}
+
+func (k *cacheKeyring) load() ([]byte, error) {
+	data, err := cacheKeyStore(k.backend).Get(k.service, MasterKeyAccount, false, "")
+	if isNotFound(err) {
+		return k.create()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the cache key: %w", err)
+	}
+	return k.open(data)
+}
+
+// create stores a new cache key while holding the key's lock, so that
+// processes starting together agree on one key. The key is read again
+// once the lock is held, in case another process created it meanwhile.
+func (k *cacheKeyring) create() ([]byte, error) {
+	var lock *filelock.Lock
+	if k.lockDir != "" {
+		sum := sha256.Sum256([]byte(k.service))
+		var err error
+		if lock, err = filelock.Acquire(filepath.Join(k.lockDir, "cachekey-"+hex.EncodeToString(sum[:])+".lock")); err != nil {
+			return nil, err
+		}
+	}
+	defer func() { _ = lock.Release() }()
+
+	data, err := cacheKeyStore(k.backend).Get(k.service, MasterKeyAccount, false, "")
+	if err == nil {
+		return k.open(data)
+	}
+	if !isNotFound(err) {
+		return nil, fmt.Errorf("failed to read the cache key: %w", err)
+	}
+	key := make([]byte, cacheKeyLen)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	if err := k.store(key); err != nil {
+		return nil, err
+	}
+	if k.onCreate != nil {
+		k.onCreate(key)
+	}
+	return key, nil
+}
+
+// open decodes a cache key record read from the backend, unwrapping the
+// key if needed.
+func (k *cacheKeyring) open(data []byte) ([]byte, error) {
+	defer zeroBytes(data)
+
+	var rec cacheKeyRecord
+	if err := json.Unmarshal(data, &rec); err != nil || rec.Version != cacheKeyVersion {
+		return nil, fmt.Errorf("the cache key in the backend is not readable; run 'locksmith cache rekey'")
+	}
+	if rec.KDF == nil {
+		if len(rec.Key) != cacheKeyLen {
+			return nil, fmt.Errorf("invalid cache key length: expected %d bytes, got %d", cacheKeyLen, len(rec.Key))
+		}
+		return rec.Key, nil
+	}
+
+	wrapKey, err := k.wrapKey(rec.KDF)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(wrapKey)
+	key, err := aesGCMOpen(wrapKey, rec.Wrapped, []byte(cacheKeyWrapAD))
+	if err != nil {
+		return nil, ErrCacheKeyPassphrase
+	}
+	return key, nil
+}
+
+// replace stores key as the cache key, wrapped if the keyring wraps keys.
+func (k *cacheKeyring) replace(key []byte) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.store(key); err != nil {
+		return err
+	}
+	k.key, k.err = key, nil
+	return nil
+}
+
+func (k *cacheKeyring) store(key []byte) error {
+	rec := cacheKeyRecord{Version: cacheKeyVersion, Key: key}
+	if k.wrap {
+		rec.KDF = &cacheKeyKDF{Name: "argon2id", Salt: make([]byte, 16), Time: 3, Memory: 64 * 1024, Threads: 4}
+		if _, err := io.ReadFull(rand.Reader, rec.KDF.Salt); err != nil {
+			return err
+		}
+		wrapKey, err := k.wrapKey(rec.KDF)
+		if err != nil {
+			return err
+		}
+		defer zeroBytes(wrapKey)
+		if rec.Wrapped, err = aesGCMSeal(wrapKey, key, []byte(cacheKeyWrapAD)); err != nil {
+			return err
+		}
+		rec.Key = nil
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	defer zeroBytes(data)
+	if err := cacheKeyStore(k.backend).Set(k.service, MasterKeyAccount, data, false); err != nil {
+		return fmt.Errorf("failed to store the cache key: %w", err)
+	}
+	return nil
+}
+
+// wrapKey derives the key wrapping the cache key from the passphrase.
+func (k *cacheKeyring) wrapKey(p *cacheKeyKDF) ([]byte, error) {
+	if p.Name != "argon2id" {
+		return nil, fmt.Errorf("unsupported cache key KDF '%s'", p.Name)
+	}
+	if p.Time == 0 || p.Time > maxCacheKeyKDFTime || p.Threads == 0 || len(p.Salt) == 0 ||
+		p.Memory < 8*uint32(p.Threads) || p.Memory > maxCacheKeyKDFMemory {
+		return nil, fmt.Errorf("invalid cache key KDF parameters; run 'locksmith cache rekey'")
+	}
+	var passphrase []byte
+	if env := os.Getenv(CacheKeyPassphraseEnv); env != "" {
+		passphrase = []byte(env)
+	} else {
+		if k.prompt == nil {
+			return nil, fmt.Errorf("the cache key is protected by a passphrase; set %s", CacheKeyPassphraseEnv)
+		}
+		var err error
+		if passphrase, err = k.prompt(fmt.Sprintf("Cache key passphrase for vault '%s': ", k.vault)); err != nil {
+			return nil, err
+		}
+	}
+	defer zeroBytes(passphrase)
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("passphrase cannot be empty")
+	}
+	return argon2.IDKey(passphrase, p.Salt, p.Time, p.Memory, p.Threads, cacheKeyLen), nil
+}
+
+// openCache sets up the vault's disk cache and metadata index, encrypted
+// under keys derived from the cache key kept in l.Backend.
+func (l *Locksmith) openCache(vault *VaultInfo) error {
+	keyring := &cacheKeyring{
+		backend:  l.Backend,
+		service:  vault.Service,
+		vault:    vault.Name,
+		wrap:     l.Config != nil && l.Config.Cache.Passphrase,
+		prompt:   promptTerminalPassphrase,
+		lockDir:  vault.LockDir,
+		onCreate: func(key []byte) { migrateLegacyCacheKey(vault, key) },
+	}
+	cache, err := newKeyedDiskCache(vault.CacheDir, vault.Name, func() ([]byte, error) {
+		return keyring.deriveKey(keyPurposeCache)
+	})
+	if err != nil {
+		return err
+	}
+	cache.LockDir = vault.LockDir
+	l.Cache = cache
+	l.lockDir = vault.LockDir
+	l.Index = &MetadataIndex{Path: vault.IndexPath, service: vault.Service, keyFunc: func() ([]byte, error) {
+		return keyring.deriveKey(keyPurposeIndex)
+	}}
+	l.cacheKey = keyring
+	return nil
+}
+
+// migrateLegacyCacheKey moves a vault to its first cache key from the
+// machine-derived master key of earlier versions: the metadata index is
+// re-encrypted, and cache entries, which the new key cannot read, removed.
+func migrateLegacyCacheKey(vault *VaultInfo, key []byte) {
+	if files, err := os.ReadDir(vault.CacheDir); err == nil {
+		for _, f := range files {
+			if !f.IsDir() {
+				_ = os.Remove(filepath.Join(vault.CacheDir, f.Name()))
+			}
+		}
+	}
+
+	legacy, err := legacyMasterKey()
+	if err != nil {
+		return
+	}
+	defer zeroBytes(legacy)
+	entries, err := (&MetadataIndex{Path: vault.IndexPath, service: vault.Service, key: legacy}).read()
+	if err != nil || len(entries) == 0 {
+		return
+	}
+	indexKey, err := deriveCacheKey(key, vault.Name, keyPurposeIndex)
+	if err != nil {
+		return
+	}
+	_ = (&MetadataIndex{Path: vault.IndexPath, service: vault.Service, key: indexKey}).write(entries)
+}
+
+// CacheRekeyResult reports what RekeyCache did with what was encrypted under
+// the previous cache key.
+type CacheRekeyResult struct {
+	Kept      int // cache entries re-encrypted
+	Discarded int // stale or unreadable cache entries removed
+	// IndexRebuilt is set when the metadata index could not be read under
+	// the previous key and was rebuilt from the vault instead.
+	IndexRebuilt bool
+}
+
+// RekeyCache replaces the vault's cache key with a new random key, wrapped
+// with a passphrase when the config's cache.passphrase is set, re-encrypts
+// the fresh cache entries and the metadata index under it and discards the
+// rest. It is also the way out of a forgotten passphrase: what cannot be
+// read under the previous key is discarded, and the index rebuilt.
+func (l *Locksmith) RekeyCache() (*CacheRekeyResult, error) {
+	cache, ok := l.Cache.(*DiskCache)
+	if l.cacheKey == nil || !ok {
+		return nil, fmt.Errorf("the cache of vault '%s' has no cache key in its backend", l.vaultName())
+	}
+
+	// Read the keys derived from the previous cache key, where possible,
+	// before it is replaced.
+	_, _ = cache.keys()
+	_, _ = l.Index.Load()
+
+	key := make([]byte, cacheKeyLen)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	l.cacheKey.wrap = l.Config != nil && l.Config.Cache.Passphrase
+	if err := l.cacheKey.replace(key); err != nil {
+		return nil, err
+	}
+
+	cacheKey, err := deriveCacheKey(key, l.cacheKey.vault, keyPurposeCache)
+	if err != nil {
+		return nil, err
+	}
+	result := &CacheRekeyResult{}
+	if result.Kept, result.Discarded, err = cache.Rekey(cacheKey); err != nil {
+		return result, fmt.Errorf("failed to re-encrypt the cache: %w", err)
+	}
+	if l.Index == nil {
+		return result, nil
+	}
+	indexKey, err := deriveCacheKey(key, l.cacheKey.vault, keyPurposeIndex)
+	if err != nil {
+		return result, err
+	}
+	if err := l.Index.rekey(indexKey); err != nil {
+		result.IndexRebuilt = true
+		if _, err := l.RebuildIndex(); err != nil {
+			return result, fmt.Errorf("failed to rebuild the metadata index: %w", err)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,276 @@
+package locksmith
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bonjoski/locksmith/v2/pkg/filelock"
+)
+
+func openTestCache(t *testing.T, l *Locksmith, dir string) {
+	t.Helper()
+	vault := &VaultInfo{Name: l.vaultName(), Service: l.Service, CacheDir: filepath.Join(dir, "cache"), IndexPath: filepath.Join(dir, IndexFileName)}
+	if err := l.openCache(vault); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCacheKeyring(t *testing.T) {
+	b := newAttrBackend()
+	k := &cacheKeyring{backend: b, service: DefaultService, vault: "default"}
+	key, err := k.cacheKey()
+	if err != nil || len(key) != cacheKeyLen {
+		t.Fatalf("cacheKey = %x, %v", key, err)
+	}
+	stored, err := b.Get(DefaultService, MasterKeyAccount, false, "")
+	if err != nil || bytes.Contains(stored, key) {
+		t.Fatalf("expected the key to be stored base64 encoded, got %s, %v", stored, err)
+	}
+
+	again, _ := (&cacheKeyring{backend: b, service: DefaultService, vault: "default"}).cacheKey()
+	if !bytes.Equal(key, again) {
+		t.Error("expected the stored key to be read back")
+	}
+	cacheKey, _ := deriveCacheKey(key, "default", keyPurposeCache)
+	indexKey, _ := deriveCacheKey(key, "default", keyPurposeIndex)
+	workKey, _ := deriveCacheKey(key, "work", keyPurposeCache)
+	if bytes.Equal(cacheKey, indexKey) || bytes.Equal(cacheKey, workKey) || bytes.Equal(cacheKey, key) {
+		t.Error("derived keys must differ by vault and purpose")
+	}
+
+	tiered := &TieredBackend{Primary: b, Secondary: newAttrBackend()}
+	if cacheKeyStore(tiered) != Backend(b) {
+		t.Error("a tiered backend keeps the cache key in its primary")
+	}
+}
+
+// syncBackend serializes access to a backend shared by several instances,
+// standing in for the processes sharing the OS keychain.
+type syncBackend struct {
+	mu sync.Mutex
+	b  Backend
+}
+
+func (s *syncBackend) Set(service, account string, data []byte, requireBiometrics bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Set(service, account, data, requireBiometrics)
+}
+
+func (s *syncBackend) Get(service, account string, useBiometrics bool, prompt string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Get(service, account, useBiometrics, prompt)
+}
+
+func (s *syncBackend) Delete(service, account string, useBiometrics bool, prompt string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Delete(service, account, useBiometrics, prompt)
+}
+
+func (s *syncBackend) List(service string, useBiometrics bool, prompt string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.List(service, useBiometrics, prompt)
+}
+
+// failingBackend fails every read with err.
+type failingBackend struct {
+	brokenBackend
+	err error
+}
+
+func (f failingBackend) Get(service, account string, useBiometrics bool, prompt string) ([]byte, error) {
+	return nil, f.err
+}
+
+func TestCacheKeyCreation(t *testing.T) {
+	// Only ErrNotFound creates a key; other failures that happen to
+	// mention "not found" must not replace it.
+	created := false
+	broken := &cacheKeyring{backend: failingBackend{err: errors.New("collection not found on the bus")}, service: DefaultService, vault: "default",
+		onCreate: func([]byte) { created = true }}
+	if _, err := broken.cacheKey(); err == nil || created {
+		t.Errorf("expected the read error without a new key, got %v (created %v)", err, created)
+	}
+
+	// Processes racing to create the key agree on one.
+	b := &syncBackend{b: newAttrBackend()}
+	lockDir := t.TempDir()
+	var mu sync.Mutex
+	creations := 0
+	keyring := func() *cacheKeyring {
+		return &cacheKeyring{backend: b, service: DefaultService, vault: "default", lockDir: lockDir, onCreate: func([]byte) {
+			mu.Lock()
+			creations++
+			mu.Unlock()
+		}}
+	}
+	sum := sha256.Sum256([]byte(DefaultService))
+	lock, err := filelock.Acquire(filepath.Join(lockDir, "cachekey-"+hex.EncodeToString(sum[:])+".lock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make([][]byte, 2)
+	var wg sync.WaitGroup
+	for i := range keys {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			keys[i], _ = keyring().cacheKey()
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	_ = lock.Release()
+	wg.Wait()
+	if creations != 1 || keys[0] == nil || !bytes.Equal(keys[0], keys[1]) {
+		t.Errorf("expected one key created and shared, got %d creations, %x and %x", creations, keys[0], keys[1])
+	}
+}
+
+func TestCacheKeyPassphrase(t *testing.T) {
+	b := newAttrBackend()
+	t.Setenv(CacheKeyPassphraseEnv, "correct horse")
+	k := &cacheKeyring{backend: b, service: DefaultService, vault: "default", wrap: true}
+	key, err := k.cacheKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := b.Get(DefaultService, MasterKeyAccount, false, "")
+	if !bytes.Contains(stored, []byte(`"wrapped"`)) || bytes.Contains(stored, []byte(`"key"`)) {
+		t.Errorf("expected a wrapped key record, got %s", stored)
+	}
+
+	again, err := (&cacheKeyring{backend: b, service: DefaultService, vault: "default"}).cacheKey()
+	if err != nil || !bytes.Equal(key, again) {
+		t.Errorf("unwrapping = %v", err)
+	}
+
+	t.Setenv(CacheKeyPassphraseEnv, "wrong")
+	prompts := 0
+	wrong := &cacheKeyring{backend: b, service: DefaultService, vault: "default"}
+	for range 2 {
+		if _, err := wrong.cacheKey(); !errors.Is(err, ErrCacheKeyPassphrase) {
+			t.Errorf("expected ErrCacheKeyPassphrase, got %v", err)
+		}
+	}
+	t.Setenv(CacheKeyPassphraseEnv, "")
+	prompting := &cacheKeyring{backend: b, service: DefaultService, vault: "default", prompt: func(string) ([]byte, error) {
+		prompts++
+		return []byte("wrong"), nil
+	}}
+	_, _ = prompting.cacheKey()
+	_, _ = prompting.cacheKey()
+	if prompts != 1 {
+		t.Errorf("a failed unwrap should be remembered, prompted %d times", prompts)
+	}
+}
+
+func TestCacheKeyRejectsInvalidKDFParams(t *testing.T) {
+	t.Setenv(CacheKeyPassphraseEnv, "correct horse")
+	k := &cacheKeyring{vault: "default"}
+	for name, p := range map[string]cacheKeyKDF{
+		"zero time":    {Name: "argon2id", Salt: make([]byte, 16), Time: 0, Memory: 64 * 1024, Threads: 4},
+		"zero threads": {Name: "argon2id", Salt: make([]byte, 16), Time: 3, Memory: 64 * 1024, Threads: 0},
+		"huge memory":  {Name: "argon2id", Salt: make([]byte, 16), Time: 3, Memory: 1 << 31, Threads: 4},
+	} {
+		if _, err := k.wrapKey(&p); err == nil || !strings.Contains(err.Error(), "invalid cache key KDF") {
+			t.Errorf("%s: expected the parameters to be rejected, got %v", name, err)
+		}
+	}
+}
+
+func TestRekeyCache(t *testing.T) {
+	l, b := newHistoryTestLocksmith()
+	dir := t.TempDir()
+	openTestCache(t, l, dir)
+	for _, key := range []string{"a", "b"} {
+		if err := l.PutSecret(key, Secret{Value: []byte("v-" + key)}, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	oldRecord, _ := b.Get(l.Service, MasterKeyAccount, false, "")
+	oldFiles, _ := os.ReadDir(filepath.Join(dir, "cache"))
+
+	result, err := l.RekeyCache()
+	if err != nil {
+		t.Fatalf("RekeyCache: %v", err)
+	}
+	if result.Kept != len(oldFiles) || result.Discarded != 0 || result.IndexRebuilt {
+		t.Errorf("unexpected result %+v for %d files", result, len(oldFiles))
+	}
+	if newRecord, _ := b.Get(l.Service, MasterKeyAccount, false, ""); bytes.Equal(oldRecord, newRecord) {
+		t.Error("expected a new cache key in the backend")
+	}
+	newFiles, _ := os.ReadDir(filepath.Join(dir, "cache"))
+	if len(newFiles) != len(oldFiles) || newFiles[0].Name() == oldFiles[0].Name() {
+		t.Error("expected the entries to be renamed under the new key")
+	}
+
+	// A fresh instance reads the cache and index under the new key.
+	reopened, _ := newHistoryTestLocksmith()
+	reopened.Backend = b
+	openTestCache(t, reopened, dir)
+	if cached, err := reopened.Cache.Get("a"); err != nil || cached == nil || string(cached.Value) != "v-a" {
+		t.Errorf("cache under the new key = %v, %v", cached, err)
+	}
+	if entries, err := reopened.Index.Load(); err != nil || len(entries) != 2 {
+		t.Errorf("index under the new key = %v, %v", entries, err)
+	}
+
+	// With the previous key lost, everything is discarded and the index
+	// rebuilt from the vault.
+	if err := b.Set(l.Service, MasterKeyAccount, []byte("garbage"), false); err != nil {
+		t.Fatal(err)
+	}
+	lost, _ := newHistoryTestLocksmith()
+	lost.Backend = b
+	openTestCache(t, lost, dir)
+	result, err = lost.RekeyCache()
+	if err != nil {
+		t.Fatalf("RekeyCache: %v", err)
+	}
+	if result.Kept != 0 || result.Discarded != len(oldFiles) || !result.IndexRebuilt {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if entries, err := lost.Index.Load(); err != nil || len(entries) != 2 {
+		t.Errorf("rebuilt index = %v, %v", entries, err)
+	}
+}
+
+func TestLegacyCacheKeyMigration(t *testing.T) {
+	legacy, err := legacyMasterKey()
+	if err != nil {
+		t.Skipf("no machine-derived key on this host: %v", err)
+	}
+	l, _ := newHistoryTestLocksmith()
+	dir := t.TempDir()
+	old := &MetadataIndex{Path: filepath.Join(dir, IndexFileName), service: l.Service, key: legacy}
+	if err := old.Put("db/prod", SecretMetadata{SecretType: SecretTypePassword}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "cache"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cache", "stale"), []byte("old entry"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	openTestCache(t, l, dir)
+	entries, err := l.Index.Load()
+	if err != nil || entries["db/prod"].SecretType != SecretTypePassword {
+		t.Errorf("expected the index to be migrated, got %v, %v", entries, err)
+	}
+	if files, _ := os.ReadDir(filepath.Join(dir, "cache")); len(files) != 0 {
+		t.Errorf("expected legacy cache entries to be removed, got %d", len(files))
+	}
+}
@@ -47,6 +47,31 @@ type AccessControl struct {
 	DenyBinaries  []string `yaml:"deny_binaries"`
 }
 
+// HistoryConfig controls how many previous versions of each secret are kept.
+type HistoryConfig struct {
+	Versions int `yaml:"versions,omitempty"` // previous versions per key; 0 = DefaultHistoryVersions, -1 disables
+}
+
+// BackendConfig selects the storage backend used for secrets.
+type BackendConfig struct {
+	Name    string            `yaml:"name,omitempty"`    // auto (default), native, file
+	Options map[string]string `yaml:"options,omitempty"` // backend-specific, e.g. path, keyfile, passphrase_env
+}
+
+// VaultConfig describes a named vault. Empty fields inherit the top-level
+// settings; Service defaults to "<DefaultService>.<name>".
+type VaultConfig struct {
+	Service string           `yaml:"service,omitempty"`
+	Backend BackendConfig    `yaml:"backend,omitempty"`
+	Auth    *VaultAuthConfig `yaml:"auth,omitempty"`
+}
+
+// VaultAuthConfig overrides AuthConfig for a single vault.
+type VaultAuthConfig struct {
+	RequireBiometrics *bool  `yaml:"require_biometrics,omitempty"`
+	PromptMessage     string `yaml:"prompt_message,omitempty"`
+}
+
 // Config represents the locksmith configuration
 type ShellConfig struct {
 	Env map[string]string `yaml:"env,omitempty"`
@@ -59,6 +84,14 @@ type Config struct {
 	Integrations  map[string]IntegrationConfig `yaml:"integrations,omitempty"`
 	AccessControl AccessControl                `yaml:"access_control"`
 	Shell         ShellConfig                  `yaml:"shell,omitempty"`
+	Backend       BackendConfig                `yaml:"backend,omitempty"`
+	DefaultVault  string                       `yaml:"default_vault,omitempty"`
+	Vaults        map[string]VaultConfig       `yaml:"vaults,omitempty"`
+	History       HistoryConfig                `yaml:"history,omitempty"`
+	Generate      map[string]GeneratePolicy    `yaml:"generate,omitempty"` // named generator policies
+	Aliases       map[string]string            `yaml:"aliases,omitempty"`  // alias -> key, or @vault/key
+	Cache         CacheConfig                  `yaml:"cache,omitempty"`
+	Daemon        DaemonConfig                 `yaml:"daemon,omitempty"`
 }
 
 // LoadConfig loads configuration from ~/.locksmith/config.yml
@@ -78,13 +111,12 @@ func LoadConfig() (*Config, error) {
 	}
 
 	// Try to load from ~/.locksmith/config.yml
-	home, err := os.UserHomeDir()
+	configPath, err := ConfigPath()
 	if err != nil {
 		return cfg, nil // Return defaults
 	}
 
-	configPath := filepath.Clean(filepath.Join(home, ".locksmith", "config.yml"))
-	data, err := os.ReadFile(configPath)
+	data, err := os.ReadFile(filepath.Clean(configPath))
 	if err != nil {
 		return cfg, nil // Return defaults if file doesn't exist
 	}
@@ -0,0 +1,181 @@
+package locksmith
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bonjoski/locksmith/v2/pkg/filelock"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigPath returns the location of the configuration file.
+func ConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".locksmith", "config.yml"), nil
+}
+
+// SetConfigValue sets the value at path (e.g. ["vaults", "work"]) in
+// config.yml, creating intermediate mappings as needed. The rest of the
+// file, including comments, is preserved.
+func SetConfigValue(path []string, value any) error {
+	if len(path) == 0 {
+		return fmt.Errorf("config path cannot be empty")
+	}
+	var node yaml.Node
+	if err := node.Encode(value); err != nil {
+		return fmt.Errorf("failed to encode config value: %w", err)
+	}
+	return editConfig(func(root *yaml.Node) (bool, error) {
+		m := root
+		for _, key := range path[:len(path)-1] {
+			child := mappingValue(m, key)
+			if child == nil {
+				child = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+				m.Content = append(m.Content, scalarNode(key), child)
+			}
+			if child.Kind != yaml.MappingNode {
+				return false, fmt.Errorf("config key '%s' is not a mapping", key)
+			}
+			m = child
+		}
+
+		last := path[len(path)-1]
+		for i := 0; i+1 < len(m.Content); i += 2 {
+			if m.Content[i].Value == last {
+				m.Content[i+1] = &node
+				return true, nil
+			}
+		}
+		m.Content = append(m.Content, scalarNode(last), &node)
+		return true, nil
+	})
+}
+
+// DeleteConfigValue removes the value at path from config.yml and reports
+// whether it existed.
+func DeleteConfigValue(path []string) (bool, error) {
+	if len(path) == 0 {
+		return false, fmt.Errorf("config path cannot be empty")
+	}
+	var removed bool
+	err := editConfig(func(root *yaml.Node) (bool, error) {
+		m := root
+		for _, key := range path[:len(path)-1] {
+			m = mappingValue(m, key)
+			if m == nil || m.Kind != yaml.MappingNode {
+				return false, nil
+			}
+		}
+		last := path[len(path)-1]
+		for i := 0; i+1 < len(m.Content); i += 2 {
+			if m.Content[i].Value == last {
+				m.Content = append(m.Content[:i], m.Content[i+2:]...)
+				removed = true
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	return removed, err
+}
+
+// editConfig applies fn to the top-level mapping of config.yml under a file
+// lock and writes the result back atomically when fn reports a change. The
+// edited document must still parse as a Config.
+func editConfig(fn func(root *yaml.Node) (bool, error)) error {
+	path, err := ConfigPath()
+	if err != nil {
+		return err
+	}
+	lock, err := filelock.Acquire(path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = lock.Release() }()
+
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to parse config: %w", err)
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("config file %s is not a YAML mapping", path)
+	}
+
+	changed, err := fn(doc.Content[0])
+	if err != nil || !changed {
+		return err
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(buf.Bytes(), &Config{}); err != nil {
+		return fmt.Errorf("edited config is invalid: %w", err)
+	}
+
+	return writeFileAtomic(path, buf.Bytes(), 0600)
+}
+
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func scalarNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it into place.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer func() { _ = os.Remove(tmpName) }()
+
+	if err := tmp.Chmod(perm); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, path)
+}
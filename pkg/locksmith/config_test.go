@@ -5,6 +5,8 @@ import (
 	"path/filepath"
 	"testing"
 	"time"
+
+	"github.com/bonjoski/locksmith/v2/pkg/backend/filevault"
 )
 
 // TestLoadConfigDefaults tests loading config with defaults
@@ -114,3 +116,34 @@ func TestParseDuration(t *testing.T) {
 		})
 	}
 }
+
+func TestBackendFromConfig(t *testing.T) {
+	b, err := backendFromConfig(BackendConfig{Name: "native"})
+	if err != nil {
+		t.Fatalf("native backend: %v", err)
+	}
+	if _, ok := b.(*DefaultBackend); !ok {
+		t.Errorf("expected DefaultBackend, got %T", b)
+	}
+
+	b, err = backendFromConfig(BackendConfig{Name: "File", Options: map[string]string{"path": filepath.Join(t.TempDir(), "v.json")}})
+	if err != nil {
+		t.Fatalf("file backend: %v", err)
+	}
+	if _, ok := b.(*filevault.Vault); !ok {
+		t.Errorf("expected filevault.Vault, got %T", b)
+	}
+
+	if _, err := backendFromConfig(BackendConfig{Name: "keyctl", Options: map[string]string{"scope": "thread"}}); err == nil {
+		t.Error("expected error for unknown keyring scope")
+	}
+	if b, err := backendFromConfig(BackendConfig{Name: "keyctl"}); err == nil {
+		if _, ok := b.(MetadataBackend); !ok {
+			t.Errorf("expected keyctl backend to map expiry via MetadataBackend, got %T", b)
+		}
+	}
+
+	if _, err := backendFromConfig(BackendConfig{Name: "bogus"}); err == nil {
+		t.Error("expected error for unknown backend")
+	}
+}
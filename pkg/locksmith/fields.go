@@ -0,0 +1,156 @@
+package locksmith
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SecretKind distinguishes single-value secrets from structured ones.
+type SecretKind string
+
+const (
+	// SecretKindValue is a plain secret: Value is the secret itself.
+	SecretKindValue SecretKind = ""
+	// SecretKindFields is a structured secret: Value holds the JSON encoding
+	// of its named fields (see Secret.Fields).
+	SecretKindFields SecretKind = "fields"
+	// SecretKindFile is a file stored with 'locksmith add --file': Value is
+	// the file's contents (see FileRefScheme).
+	SecretKindFile SecretKind = "file"
+)
+
+// Field is one named value of a structured secret. Sensitive fields are
+// masked when the whole secret is displayed and are only printed when
+// asked for by name.
+type Field struct {
+	Name      string `json:"name"`
+	Value     string `json:"value"`
+	Sensitive bool   `json:"sensitive,omitempty"`
+}
+
+// ErrFieldNotFound is returned when a structured secret has no field with
+// the requested name.
+var ErrFieldNotFound = errors.New("field not found")
+
+// ValidateFieldName checks that name can be used in a locksmith://key#field
+// reference.
+func ValidateFieldName(name string) error {
+	if name == "" {
+		return fmt.Errorf("field name cannot be empty")
+	}
+	if strings.ContainsAny(name, "#?=,/ \t\n") {
+		return fmt.Errorf("invalid field name '%s': names cannot contain whitespace or any of # ? = , /", name)
+	}
+	return nil
+}
+
+// NewFieldSecret returns a structured secret holding fields, in order.
+// Field names must be valid and unique.
+func NewFieldSecret(fields []Field) (Secret, error) {
+	if len(fields) == 0 {
+		return Secret{}, fmt.Errorf("a structured secret needs at least one field")
+	}
+	seen := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		if err := ValidateFieldName(f.Name); err != nil {
+			return Secret{}, err
+		}
+		if seen[f.Name] {
+			return Secret{}, fmt.Errorf("duplicate field '%s'", f.Name)
+		}
+		seen[f.Name] = true
+	}
+	value, err := json.Marshal(fields)
+	if err != nil {
+		return Secret{}, err
+	}
+	return Secret{Value: value, Kind: SecretKindFields}, nil
+}
+
+// IsStructured reports whether the secret holds named fields.
+func (s *Secret) IsStructured() bool {
+	return s.Kind == SecretKindFields
+}
+
+// Fields decodes the fields of a structured secret.
+func (s *Secret) Fields() ([]Field, error) {
+	if !s.IsStructured() {
+		return nil, fmt.Errorf("secret has no fields")
+	}
+	var fields []Field
+	if err := json.Unmarshal(s.Value, &fields); err != nil {
+		return nil, fmt.Errorf("corrupt structured secret: %w", err)
+	}
+	return fields, nil
+}
+
+// Field returns the value of the named field.
+func (s *Secret) Field(name string) ([]byte, error) {
+	fields, err := s.Fields()
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range fields {
+		if f.Name == name {
+			return []byte(f.Value), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: '%s'", ErrFieldNotFound, name)
+}
+
+// GetField retrieves a single field of a structured secret. With an empty
+// field it behaves like Get, except that structured secrets are rejected.
+func (l *Locksmith) GetField(key, field string) ([]byte, error) {
+	return l.getRef(SecretRef{Key: key, Field: field})
+}
+
+// getRef reads the value a reference resolves to in this vault.
+func (l *Locksmith) getRef(ref SecretRef) ([]byte, error) {
+	secret, err := l.getSecret(ref.Key)
+	if err != nil {
+		return nil, err
+	}
+	return refValue(ref, secret)
+}
+
+// refValue returns the value ref resolves to given the secret it names: the
+// value, one of its fields, or the current TOTP code of either. Plain
+// references to structured secrets are rejected rather than returning the
+// encoded fields.
+func refValue(ref SecretRef, secret *Secret) ([]byte, error) {
+	if secret == nil {
+		return nil, ErrNotFound
+	}
+	var value []byte
+	switch {
+	case ref.Field != "":
+		if !secret.IsStructured() {
+			return nil, fmt.Errorf("'%s' is not a structured secret and has no field '%s'", ref.Key, ref.Field)
+		}
+		v, err := secret.Field(ref.Field)
+		if err != nil {
+			return nil, fmt.Errorf("'%s': %w", ref.Key, err)
+		}
+		value = v
+	case secret.IsStructured():
+		return nil, fmt.Errorf("'%s' is a structured secret; reference one of its fields as %s%s#<field>", ref.Key, RefScheme, ref.Key)
+	default:
+		value = make([]byte, len(secret.Value))
+		copy(value, secret.Value)
+	}
+	if !ref.OTP {
+		return value, nil
+	}
+
+	defer zeroBytes(value)
+	otp, err := ParseTOTP(string(value))
+	if err != nil {
+		return nil, fmt.Errorf("'%s' is not a TOTP secret: %w", ref.Key, err)
+	}
+	defer zeroBytes(otp.Secret)
+	code, _ := otp.Code(time.Now())
+	return []byte(code), nil
+}
@@ -0,0 +1,137 @@
+package locksmith
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewFieldSecret(t *testing.T) {
+	secret, err := NewFieldSecret([]Field{
+		{Name: "host", Value: "db.internal"},
+		{Name: "password", Value: "s3cret", Sensitive: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !secret.IsStructured() {
+		t.Fatal("expected a structured secret")
+	}
+	if v, err := secret.Field("password"); err != nil || string(v) != "s3cret" {
+		t.Errorf("Field(password) = %q, %v", v, err)
+	}
+	if _, err := secret.Field("port"); !errors.Is(err, ErrFieldNotFound) {
+		t.Errorf("expected ErrFieldNotFound, got %v", err)
+	}
+
+	for _, fields := range [][]Field{
+		nil,
+		{{Name: "a"}, {Name: "a"}},
+		{{Name: "with space"}},
+		{{Name: "a#b"}},
+	} {
+		if _, err := NewFieldSecret(fields); err == nil {
+			t.Errorf("NewFieldSecret(%v) should fail", fields)
+		}
+	}
+}
+
+func TestResolveFieldRefs(t *testing.T) {
+	l, b := newHistoryTestLocksmith()
+	db, _ := NewFieldSecret([]Field{
+		{Name: "user", Value: "app"},
+		{Name: "password", Value: "pw", Sensitive: true},
+	})
+	db.ExpiresAt = time.Now().Add(time.Hour)
+	if err := l.PutSecret("db", db, false); err != nil {
+		t.Fatal(err)
+	}
+	_ = l.PutSecret("plain", Secret{Value: []byte("v")}, false)
+
+	if b.attrs["db"][attrKind] != string(SecretKindFields) {
+		t.Errorf("kind attribute not stored: %v", b.attrs["db"])
+	}
+
+	env, err := l.ResolveEnvironment(nil, map[string]string{
+		"DB_USER": "locksmith://db#user",
+		"DB_PASS": "locksmith://db#password",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	joined := strings.Join(env, "\n")
+	if !strings.Contains(joined, "DB_USER=app") || !strings.Contains(joined, "DB_PASS=pw") {
+		t.Errorf("unexpected environment %v", env)
+	}
+
+	shell, err := l.ResolveShellEnv(map[string]string{"PGPASSWORD": "db#password"})
+	if err != nil || shell["PGPASSWORD"] != "pw" {
+		t.Errorf("ResolveShellEnv = %v, %v", shell, err)
+	}
+
+	for ref, want := range map[string]string{
+		"locksmith://db":          "structured secret",
+		"locksmith://db#port":     "field not found",
+		"locksmith://plain#value": "not a structured secret",
+	} {
+		if _, err := l.ResolveRef(ref); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ResolveRef(%s): expected %q error, got %v", ref, want, err)
+		}
+	}
+}
+
+// Keys containing '#' or '?' predate field and ?otp references and must
+// stay readable through references.
+func TestResolveRefsToKeysWithFieldSyntax(t *testing.T) {
+	l, _ := newHistoryTestLocksmith()
+	for key, value := range map[string]string{
+		"wiki#staging": "s3cret",
+		"acct?raw":     "raw",
+		"gh?otp":       "not a seed",
+	} {
+		if err := l.PutSecret(key, Secret{Value: []byte(value)}, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db, _ := NewFieldSecret([]Field{{Name: "user", Value: "app"}})
+	if err := l.PutSecret("db", db, false); err != nil {
+		t.Fatal(err)
+	}
+
+	for ref, want := range map[string]string{
+		"locksmith://wiki#staging": "s3cret",
+		"wiki#staging":             "s3cret",
+		"locksmith://acct?raw":     "raw",
+		"locksmith://gh?otp":       "not a seed",
+		"locksmith://db#user":      "app",
+	} {
+		if v, err := l.ResolveRef(ref); err != nil || string(v) != want {
+			t.Errorf("ResolveRef(%s) = %q, %v; want %q", ref, v, err, want)
+		}
+	}
+
+	env, err := l.ResolveEnvironment(nil, map[string]string{"WIKI": "locksmith://wiki#staging"})
+	if err != nil || len(env) != 1 || env[0] != "WIKI=s3cret" {
+		t.Errorf("ResolveEnvironment = %v, %v", env, err)
+	}
+	out, err := l.RenderTemplate("t", `{{ secret "locksmith://wiki#staging" }}`)
+	if err != nil || string(out) != "s3cret" {
+		t.Errorf("RenderTemplate = %q, %v", out, err)
+	}
+	if _, err := l.ResolveRef("locksmith://wiki#other"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected a missing key, got %v", err)
+	}
+
+	// Looking for a whole key costs no extra prompt.
+	counter := &gateCounter{Backend: l.Backend}
+	l.Backend = counter
+	l.Options.RequireBiometrics = true
+	l.Options.BypassCache = true
+	for _, ref := range []string{"locksmith://db#user", "locksmith://wiki#staging"} {
+		counter.gated = nil
+		if _, err := l.ResolveRef(ref); err != nil || len(counter.gated) != 1 {
+			t.Errorf("ResolveRef(%s): expected one gated read, got %v, %v", ref, counter.gated, err)
+		}
+	}
+}
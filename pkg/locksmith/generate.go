@@ -0,0 +1,283 @@
+package locksmith
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	_ "embed"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Generator formats.
+const (
+	GenerateFormatChars    = "chars"    // random characters from the policy's classes
+	GenerateFormatDiceware = "diceware" // words from the EFF large wordlist
+	GenerateFormatHex      = "hex"      // random bytes, hex encoded
+	GenerateFormatBase64   = "base64"   // random bytes, base64 encoded
+)
+
+// Character classes for the chars format.
+const (
+	ClassLower   = "lower"
+	ClassUpper   = "upper"
+	ClassDigits  = "digits"
+	ClassSymbols = "symbols"
+)
+
+// DefaultSymbols is the symbol class unless a policy sets its own. Quotes,
+// backslashes, backticks and spaces are left out so generated values can be
+// pasted into shells and config files.
+const DefaultSymbols = "!#$%&()*+,-./:;<=>?@[]^_{|}~"
+
+// ambiguousChars are dropped by exclude_ambiguous.
+const ambiguousChars = "0O1lI|"
+
+// DefaultGeneratePolicyName selects the configured policy used when no other
+// policy matches; without one, the built-in default (32 characters of every
+// class) is used.
+const DefaultGeneratePolicyName = "default"
+
+// GeneratePolicy describes how a secret is generated. A named policy in the
+// config's generate section applies to new secrets whose key matches one of
+// Keys, or whose type is SecretType; see Config.GeneratePolicyFor.
+type GeneratePolicy struct {
+	SecretType       SecretType `yaml:"secret_type,omitempty"`       // selects the policy for secrets of this type
+	Keys             []string   `yaml:"keys,omitempty"`              // selects the policy for keys matching these globs
+	Format           string     `yaml:"format,omitempty"`            // chars (default), diceware, hex or base64
+	Length           int        `yaml:"length,omitempty"`            // characters, words (diceware) or raw bytes (hex, base64)
+	Classes          []string   `yaml:"classes,omitempty"`           // chars: lower, upper, digits, symbols (default: all)
+	Symbols          string     `yaml:"symbols,omitempty"`           // chars: symbol class, default DefaultSymbols
+	ExcludeAmbiguous bool       `yaml:"exclude_ambiguous,omitempty"` // chars: drop 0 O 1 l I |
+	Separator        string     `yaml:"separator,omitempty"`         // diceware: between words, default "-"
+}
+
+// defaultLength returns the length used when the policy does not set one.
+func (p GeneratePolicy) defaultLength() int {
+	switch p.Format {
+	case GenerateFormatDiceware:
+		return 6
+	default:
+		return 32
+	}
+}
+
+// GeneratePolicy returns the named policy from the config.
+func (c *Config) GeneratePolicy(name string) (GeneratePolicy, error) {
+	if c != nil {
+		if p, ok := c.Generate[name]; ok {
+			return p, nil
+		}
+	}
+	if name == DefaultGeneratePolicyName {
+		return GeneratePolicy{}, nil
+	}
+	return GeneratePolicy{}, fmt.Errorf("no generate policy named '%s'", name)
+}
+
+// GeneratePolicyFor returns the name and policy to use for a new secret: the
+// first policy (by name) with a key glob matching key, else the first whose
+// secret_type equals secretType, else the default policy.
+func (c *Config) GeneratePolicyFor(key string, secretType SecretType) (string, GeneratePolicy) {
+	if c == nil {
+		return DefaultGeneratePolicyName, GeneratePolicy{}
+	}
+	names := make([]string, 0, len(c.Generate))
+	for name := range c.Generate {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, pattern := range c.Generate[name].Keys {
+			if matched, err := filepath.Match(pattern, key); err == nil && matched {
+				return name, c.Generate[name]
+			}
+		}
+	}
+	if secretType = NormalizeSecretType(secretType); secretType != SecretTypeUnspecified {
+		for _, name := range names {
+			if NormalizeSecretType(c.Generate[name].SecretType) == secretType {
+				return name, c.Generate[name]
+			}
+		}
+	}
+	p, _ := c.GeneratePolicy(DefaultGeneratePolicyName)
+	return DefaultGeneratePolicyName, p
+}
+
+// GenerateValue returns a new random secret following policy p. With the
+// chars format, every class appears at least once.
+func GenerateValue(p GeneratePolicy) ([]byte, error) {
+	length := p.Length
+	if length == 0 {
+		length = p.defaultLength()
+	}
+	if length < 0 || length > 4096 {
+		return nil, fmt.Errorf("invalid length %d", length)
+	}
+
+	switch strings.ToLower(p.Format) {
+	case "", GenerateFormatChars:
+		return generateChars(p, length)
+	case GenerateFormatDiceware:
+		return generateDiceware(p, length)
+	case GenerateFormatHex, GenerateFormatBase64:
+		raw := make([]byte, length)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, fmt.Errorf("failed to read random bytes: %w", err)
+		}
+		defer zeroBytes(raw)
+		if strings.EqualFold(p.Format, GenerateFormatHex) {
+			out := make([]byte, hex.EncodedLen(len(raw)))
+			hex.Encode(out, raw)
+			return out, nil
+		}
+		out := make([]byte, base64.StdEncoding.EncodedLen(len(raw)))
+		base64.StdEncoding.Encode(out, raw)
+		return out, nil
+	}
+	return nil, fmt.Errorf("unknown format '%s': expected chars, diceware, hex or base64", p.Format)
+}
+
+func generateChars(p GeneratePolicy, length int) ([]byte, error) {
+	classNames := p.Classes
+	if len(classNames) == 0 {
+		classNames = []string{ClassLower, ClassUpper, ClassDigits, ClassSymbols}
+	}
+
+	var classes []string
+	for _, name := range classNames {
+		var set string
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case ClassLower:
+			set = "abcdefghijklmnopqrstuvwxyz"
+		case ClassUpper:
+			set = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+		case ClassDigits:
+			set = "0123456789"
+		case ClassSymbols:
+			set = DefaultSymbols
+			if p.Symbols != "" {
+				set = p.Symbols
+			}
+		default:
+			return nil, fmt.Errorf("unknown character class '%s': expected lower, upper, digits or symbols", name)
+		}
+		if p.ExcludeAmbiguous {
+			set = strings.Map(func(r rune) rune {
+				if strings.ContainsRune(ambiguousChars, r) {
+					return -1
+				}
+				return r
+			}, set)
+		}
+		if set != "" {
+			classes = append(classes, set)
+		}
+	}
+	if len(classes) == 0 {
+		return nil, fmt.Errorf("no characters to generate from")
+	}
+	if length < len(classes) {
+		return nil, fmt.Errorf("length %d is too short to include all %d character classes", length, len(classes))
+	}
+	alphabet := []rune(strings.Join(classes, ""))
+
+	// Draw uniformly from the whole alphabet and retry until every class is
+	// present; for realistic lengths a retry is rare.
+	for attempt := 0; attempt < 1000; attempt++ {
+		out := make([]rune, length)
+		for i := range out {
+			n, err := randomIndex(len(alphabet))
+			if err != nil {
+				return nil, err
+			}
+			out[i] = alphabet[n]
+		}
+		if containsEveryClass(out, classes) {
+			value := []byte(string(out))
+			for i := range out {
+				out[i] = 0
+			}
+			return value, nil
+		}
+		for i := range out {
+			out[i] = 0
+		}
+	}
+	return nil, fmt.Errorf("failed to generate a value with every character class; increase the length")
+}
+
+func containsEveryClass(value []rune, classes []string) bool {
+	for _, class := range classes {
+		found := false
+		for _, r := range value {
+			if strings.ContainsRune(class, r) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func generateDiceware(p GeneratePolicy, words int) ([]byte, error) {
+	if words == 0 {
+		return nil, fmt.Errorf("a passphrase needs at least one word")
+	}
+	list := effWordlist()
+	sep := p.Separator
+	if sep == "" {
+		sep = "-"
+	}
+	var buf bytes.Buffer
+	for i := 0; i < words; i++ {
+		n, err := randomIndex(len(list))
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			buf.WriteString(sep)
+		}
+		buf.WriteString(list[n])
+	}
+	return buf.Bytes(), nil
+}
+
+func randomIndex(n int) (int, error) {
+	v, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read random bytes: %w", err)
+	}
+	return int(v.Int64()), nil
+}
+
+// effLargeWordlist is the EFF large wordlist
+// (https://www.eff.org/deeplinks/2016/07/new-wordlists-random-passphrases):
+// 7776 words, 12.9 bits of entropy each. It is © the Electronic Frontier
+// Foundation under CC BY 3.0 US; see eff_large_wordlist.LICENSE.
+//
+//go:embed eff_large_wordlist.txt
+var effLargeWordlist string
+
+var effWordlist = sync.OnceValue(func() []string {
+	words := make([]string, 0, 7776)
+	scanner := bufio.NewScanner(strings.NewReader(effLargeWordlist))
+	for scanner.Scan() {
+		// Lines are "<dice rolls>\t<word>".
+		if _, word, ok := strings.Cut(scanner.Text(), "\t"); ok {
+			words = append(words, word)
+		}
+	}
+	return words
+})
@@ -0,0 +1,117 @@
+package locksmith
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestGenerateValueChars(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		value, err := GenerateValue(GeneratePolicy{Length: 8, Classes: []string{ClassLower, ClassDigits}, ExcludeAmbiguous: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := string(value)
+		if len(s) != 8 || !strings.ContainsAny(s, "abcdefghijklmnopqrstuvwxyz") || !strings.ContainsAny(s, "23456789") {
+			t.Fatalf("unexpected value %q", s)
+		}
+		if strings.ContainsAny(s, ambiguousChars+"ABCDEFGHIJKLMNOPQRSTUVWXYZ"+DefaultSymbols) {
+			t.Fatalf("value %q has characters outside the policy", s)
+		}
+	}
+
+	value, err := GenerateValue(GeneratePolicy{})
+	if err != nil || len(value) != 32 || !strings.ContainsAny(string(value), DefaultSymbols) {
+		t.Errorf("default policy gave %q, %v", value, err)
+	}
+	if value, err := GenerateValue(GeneratePolicy{Classes: []string{ClassSymbols}, Symbols: "#", Length: 3}); err != nil || string(value) != "###" {
+		t.Errorf("custom symbols gave %q, %v", value, err)
+	}
+
+	for _, bad := range []GeneratePolicy{
+		{Length: 3},
+		{Classes: []string{"emoji"}},
+		{Format: "uuid"},
+		{Length: -1},
+	} {
+		if _, err := GenerateValue(bad); err == nil {
+			t.Errorf("expected %+v to be rejected", bad)
+		}
+	}
+}
+
+func TestGenerateValueEncodings(t *testing.T) {
+	value, err := GenerateValue(GeneratePolicy{Format: GenerateFormatHex, Length: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw, err := hex.DecodeString(string(value)); err != nil || len(raw) != 16 {
+		t.Errorf("hex value %q decodes to %d bytes, %v", value, len(raw), err)
+	}
+
+	value, err = GenerateValue(GeneratePolicy{Format: GenerateFormatBase64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw, err := base64.StdEncoding.DecodeString(string(value)); err != nil || len(raw) != 32 {
+		t.Errorf("base64 value %q decodes to %d bytes, %v", value, len(raw), err)
+	}
+
+	value, err = GenerateValue(GeneratePolicy{Format: GenerateFormatDiceware, Length: 5, Separator: " "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	words := strings.Split(string(value), " ")
+	if len(words) != 5 {
+		t.Fatalf("expected 5 words, got %q", value)
+	}
+	known := make(map[string]bool)
+	for _, w := range effWordlist() {
+		known[w] = true
+	}
+	if len(known) != 7776 {
+		t.Errorf("expected 7776 distinct words in the wordlist, got %d", len(known))
+	}
+	for _, w := range words {
+		if !known[w] {
+			t.Errorf("'%s' is not in the wordlist", w)
+		}
+	}
+}
+
+func TestGeneratePolicySelection(t *testing.T) {
+	cfg := &Config{Generate: map[string]GeneratePolicy{
+		"db":         {Keys: []string{"db/*"}, Length: 40},
+		"passphrase": {SecretType: SecretTypePassword, Format: GenerateFormatDiceware},
+		"default":    {Length: 24},
+	}}
+
+	cases := []struct {
+		key        string
+		secretType SecretType
+		want       string
+	}{
+		{"db/prod", SecretTypePassword, "db"}, // key globs win over types
+		{"wifi/home", "Password", "passphrase"},
+		{"api/key", SecretTypeAPIKey, "default"},
+	}
+	for _, tc := range cases {
+		if name, _ := cfg.GeneratePolicyFor(tc.key, tc.secretType); name != tc.want {
+			t.Errorf("GeneratePolicyFor(%s, %s) = %s, want %s", tc.key, tc.secretType, name, tc.want)
+		}
+	}
+
+	if p, err := cfg.GeneratePolicy("db"); err != nil || p.Length != 40 {
+		t.Errorf("GeneratePolicy(db) = %+v, %v", p, err)
+	}
+	if _, err := cfg.GeneratePolicy("missing"); err == nil {
+		t.Error("expected an unknown policy to be rejected")
+	}
+
+	var empty *Config
+	if name, p := empty.GeneratePolicyFor("db/prod", SecretTypePassword); name != DefaultGeneratePolicyName || p.Length != 0 {
+		t.Errorf("nil config gave %s, %+v", name, p)
+	}
+}
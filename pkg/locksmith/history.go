@@ -0,0 +1,267 @@
+package locksmith
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/user"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultHistoryVersions is the number of previous versions kept per key
+	// when history.versions is not configured.
+	DefaultHistoryVersions = 10
+
+	// HistoryPrefix namespaces the backend items that hold previous
+	// versions. Keys below it are hidden from listings and cannot be
+	// written directly.
+	HistoryPrefix = ".history/"
+)
+
+// ErrVersionNotFound is returned when a requested version is not in a
+// key's history.
+var ErrVersionNotFound = errors.New("version not found")
+
+// PutSecret writes secret as the new version of key. The version it
+// replaces is kept in the key's history, Version is set to one past the
+// previous version, CreatedAt defaults to now and WrittenBy to
+// Options.Writer. Writes to an alias go to the key it refers to.
+//
+// The whole write asks for authentication once: the previous version and
+// the history are read without a prompt, as they never leave this process
+// unless the write is authenticated, and only the first of the history and
+// key writes is gated.
+func (l *Locksmith) PutSecret(key string, secret Secret, requireBiometrics bool) error {
+	if target, resolved, ok, err := l.aliasTarget(key); err != nil {
+		return err
+	} else if ok {
+		return target.PutSecret(resolved, secret, requireBiometrics)
+	}
+	if isInternalKey(key) {
+		return fmt.Errorf("key '%s' is reserved for internal use", key)
+	}
+	if secret.CreatedAt.IsZero() {
+		secret.CreatedAt = time.Now()
+	}
+	if secret.WrittenBy == "" {
+		secret.WrittenBy = l.writer()
+	}
+	secret.SecretType = NormalizeSecretType(secret.SecretType)
+	if secret.SecretType == SecretTypeTOTP && !secret.IsStructured() {
+		if _, err := ParseTOTP(string(secret.Value)); err != nil {
+			return err
+		}
+	}
+	secret.Version = 0
+	tags, err := NormalizeTags(secret.Tags)
+	if err != nil {
+		return err
+	}
+	secret.Tags = tags
+
+	if l.historyLimit() > 0 {
+		prev, err := l.getSecretGated(key, false)
+		switch {
+		case err == nil && prev != nil:
+			if prev.Version == 0 {
+				prev.Version = 1
+			}
+			secret.Version = prev.Version + 1
+			if err := l.recordVersion(key, *prev, requireBiometrics); err != nil {
+				return fmt.Errorf("failed to save the previous version of '%s': %w", key, err)
+			}
+			requireBiometrics = false
+		case err == nil || isNotFound(err):
+			secret.Version = 1
+		default:
+			return fmt.Errorf("failed to read the current version of '%s': %w", key, err)
+		}
+	}
+
+	data, err := json.Marshal(secret)
+	if err != nil {
+		return err
+	}
+	defer zeroBytes(data)
+	if err := l.backendSet(key, data, secret, requireBiometrics); err != nil {
+		return err
+	}
+	l.indexPut(key, secret)
+	return l.cacheSet(key, secret)
+}
+
+// History returns every known version of key, newest (the current value)
+// first.
+func (l *Locksmith) History(key string) ([]Secret, error) {
+	if target, resolved, ok, err := l.aliasTarget(key); err != nil {
+		return nil, err
+	} else if ok {
+		return target.History(resolved)
+	}
+	current, err := l.getSecretNoRotate(key)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := l.loadHistory(key, l.Options.RequireBiometrics)
+	if err != nil {
+		return nil, err
+	}
+
+	cur := *current
+	if cur.Version == 0 {
+		cur.Version = 1
+	}
+	result := []Secret{cur}
+	for i := len(versions) - 1; i >= 0; i-- {
+		result = append(result, versions[i])
+	}
+	return result, nil
+}
+
+// GetVersion returns version n of key, which may be the current version.
+func (l *Locksmith) GetVersion(key string, n int) (*Secret, error) {
+	versions, err := l.History(key)
+	if err != nil {
+		return nil, err
+	}
+	for i := range versions {
+		if versions[i].Version == n {
+			return &versions[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: '%s' has no version %d", ErrVersionNotFound, key, n)
+}
+
+// Rollback restores version n of key (the previous version when n is 0)
+// by writing it as a new version, so the value being replaced stays in the
+// history. It returns the restored secret.
+func (l *Locksmith) Rollback(key string, n int) (*Secret, error) {
+	if target, resolved, ok, err := l.aliasTarget(key); err != nil {
+		return nil, err
+	} else if ok {
+		return target.Rollback(resolved, n)
+	}
+	versions, err := l.History(key)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		if len(versions) < 2 {
+			return nil, fmt.Errorf("%w: '%s' has no previous version", ErrVersionNotFound, key)
+		}
+		n = versions[1].Version
+	}
+	if n == versions[0].Version {
+		return nil, fmt.Errorf("'%s' is already at version %d", key, n)
+	}
+
+	var target *Secret
+	for i := range versions[1:] {
+		if versions[i+1].Version == n {
+			target = &versions[i+1]
+			break
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("%w: '%s' has no version %d", ErrVersionNotFound, key, n)
+	}
+
+	restored := *target
+	restored.WrittenBy = fmt.Sprintf("%s (rollback to v%d)", l.writer(), n)
+	if err := l.PutSecret(key, restored, l.Options.RequireBiometrics); err != nil {
+		return nil, err
+	}
+	restored.Version = versions[0].Version + 1
+	return &restored, nil
+}
+
+// recordVersion appends prev to key's history, dropping the oldest versions
+// beyond the configured limit. The history is read without a prompt; the
+// write is gated when requireBiometrics is set.
+func (l *Locksmith) recordVersion(key string, prev Secret, requireBiometrics bool) error {
+	versions, err := l.loadHistory(key, false)
+	if err != nil {
+		return err
+	}
+	versions = append(versions, prev)
+	if limit := l.historyLimit(); len(versions) > limit {
+		versions = versions[len(versions)-limit:]
+	}
+
+	value, err := json.Marshal(versions)
+	if err != nil {
+		return err
+	}
+	item := Secret{Value: value, CreatedAt: time.Now()}
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	defer zeroBytes(data)
+	if err := l.backendSet(historyKey(key), data, item, requireBiometrics); err != nil {
+		return err
+	}
+	return l.cacheSet(historyKey(key), item)
+}
+
+// loadHistory returns the previous versions of key, oldest first.
+func (l *Locksmith) loadHistory(key string, useBiometrics bool) ([]Secret, error) {
+	item, err := l.getSecretGated(historyKey(key), useBiometrics)
+	if isNotFound(err) || (err == nil && (item == nil || len(item.Value) == 0)) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var versions []Secret
+	if err := json.Unmarshal(item.Value, &versions); err != nil {
+		return nil, fmt.Errorf("corrupt version history for '%s': %w", key, err)
+	}
+	return versions, nil
+}
+
+// deleteHistory removes key's history after the key itself was deleted.
+// That deletion was the authenticated step, so the history item, if there
+// is one, is removed without another prompt.
+func (l *Locksmith) deleteHistory(key string) {
+	_ = l.Cache.Delete(historyKey(key))
+	l.sessionForget(historyKey(key))
+	data, err := l.Backend.Get(l.Service, historyKey(key), false, "")
+	zeroBytes(data)
+	if err != nil {
+		return
+	}
+	_ = l.Backend.Delete(l.Service, historyKey(key), false, "")
+}
+
+func (l *Locksmith) historyLimit() int {
+	if l.Config == nil || l.Config.History.Versions == 0 {
+		return DefaultHistoryVersions
+	}
+	if l.Config.History.Versions < 0 {
+		return 0
+	}
+	return l.Config.History.Versions
+}
+
+func (l *Locksmith) writer() string {
+	if l.Options.Writer != "" {
+		return l.Options.Writer
+	}
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return "user:" + u.Username
+	}
+	return "user"
+}
+
+func historyKey(key string) string {
+	return HistoryPrefix + key
+}
+
+// isInternalKey reports whether key is a locksmith bookkeeping item rather
+// than a user secret.
+func isInternalKey(key string) bool {
+	return key == MasterKeyAccount || strings.HasPrefix(key, HistoryPrefix)
+}
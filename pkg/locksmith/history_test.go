@@ -0,0 +1,231 @@
+package locksmith
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func newHistoryTestLocksmith() (*Locksmith, *attrBackend) {
+	b := newAttrBackend()
+	l := &Locksmith{
+		Service: DefaultService,
+		Backend: b,
+		Cache:   &MockCache{secrets: map[string]Secret{}},
+		Options: Options{Writer: "test"},
+	}
+	return l, b
+}
+
+func TestPutSecretRecordsHistory(t *testing.T) {
+	l, b := newHistoryTestLocksmith()
+
+	for _, v := range []string{"one", "two", "three"} {
+		if err := l.PutSecret("api", Secret{Value: []byte(v)}, false); err != nil {
+			t.Fatalf("PutSecret(%s): %v", v, err)
+		}
+	}
+	if err := l.PutSecret("api", Secret{Value: []byte("four"), WrittenBy: "rotator:test"}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := l.History("api")
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	want := []string{"four", "three", "two", "one"}
+	if len(versions) != len(want) {
+		t.Fatalf("got %d versions, want %d", len(versions), len(want))
+	}
+	for i, v := range versions {
+		if string(v.Value) != want[i] || v.Version != len(want)-i {
+			t.Errorf("version %d: got %q v%d", i, v.Value, v.Version)
+		}
+	}
+	if versions[0].WrittenBy != "rotator:test" || versions[1].WrittenBy != "test" {
+		t.Errorf("writers not recorded: %q, %q", versions[0].WrittenBy, versions[1].WrittenBy)
+	}
+
+	// Version and writer are kept as item attributes too.
+	if b.attrs["api"][attrVersion] != "4" || b.attrs["api"][attrWrittenBy] != "rotator:test" {
+		t.Errorf("unexpected attributes %v", b.attrs["api"])
+	}
+
+	// The history item is an internal key.
+	meta, err := l.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := meta[historyKey("api")]; ok || len(meta) != 1 {
+		t.Errorf("history item should be hidden from listings, got %v", meta)
+	}
+	if err := l.PutSecret(historyKey("api"), Secret{Value: []byte("x")}, false); err == nil {
+		t.Error("expected writes to the history namespace to be rejected")
+	}
+}
+
+// gateProbe records every backend call made with biometrics required.
+type gateProbe struct {
+	*attrBackend
+	gated   []string
+	deleted []string
+}
+
+func (b *gateProbe) record(op, account string, gated bool) {
+	if gated {
+		b.gated = append(b.gated, op+" "+account)
+	}
+}
+
+func (b *gateProbe) Get(service, account string, useBiometrics bool, prompt string) ([]byte, error) {
+	b.record("get", account, useBiometrics)
+	return b.attrBackend.Get(service, account, useBiometrics, prompt)
+}
+
+func (b *gateProbe) Set(service, account string, data []byte, requireBiometrics bool) error {
+	b.record("set", account, requireBiometrics)
+	return b.attrBackend.Set(service, account, data, requireBiometrics)
+}
+
+func (b *gateProbe) SetWithMetadata(service, account string, data []byte, meta SecretMetadata, requireBiometrics bool) error {
+	b.record("set", account, requireBiometrics)
+	return b.attrBackend.SetWithMetadata(service, account, data, meta, requireBiometrics)
+}
+
+func (b *gateProbe) Delete(service, account string, useBiometrics bool, prompt string) error {
+	b.record("delete", account, useBiometrics)
+	b.deleted = append(b.deleted, account)
+	return b.attrBackend.Delete(service, account, useBiometrics, prompt)
+}
+
+func TestHistoryAuthenticatesOnce(t *testing.T) {
+	l, b := newHistoryTestLocksmith()
+	probe := &gateProbe{attrBackend: b}
+	l.Backend = probe
+	l.Options.RequireBiometrics = true
+	l.Options.BypassCache = true
+
+	step := func(name string, fn func() error) {
+		t.Helper()
+		probe.gated, probe.deleted = nil, nil
+		if err := fn(); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(probe.gated) != 1 {
+			t.Errorf("%s: expected one gated call, got %v", name, probe.gated)
+		}
+	}
+	step("add", func() error { return l.PutSecret("api", Secret{Value: []byte("one")}, true) })
+	step("overwrite", func() error { return l.PutSecret("api", Secret{Value: []byte("two")}, true) })
+	step("overwrite again", func() error { return l.PutSecret("api", Secret{Value: []byte("three")}, true) })
+
+	versions, err := l.History("api")
+	if err != nil || len(versions) != 3 || string(versions[2].Value) != "one" {
+		t.Fatalf("History = %v, %v", versions, err)
+	}
+
+	step("delete", func() error { return l.Delete("api") })
+	if _, ok := b.data[historyKey("api")]; ok {
+		t.Error("expected the history to be deleted with the key")
+	}
+
+	if err := l.PutSecret("single", Secret{Value: []byte("v")}, true); err != nil {
+		t.Fatal(err)
+	}
+	step("delete without history", func() error { return l.Delete("single") })
+	if len(probe.deleted) != 1 {
+		t.Errorf("expected no history delete for a key without history, got %v", probe.deleted)
+	}
+}
+
+func TestPutSecretHistoryLimit(t *testing.T) {
+	l, _ := newHistoryTestLocksmith()
+	l.Config = &Config{History: HistoryConfig{Versions: 2}}
+
+	for _, v := range []string{"a", "b", "c", "d"} {
+		if err := l.PutSecret("k", Secret{Value: []byte(v)}, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	versions, err := l.History("k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 3 || string(versions[2].Value) != "b" || versions[2].Version != 2 {
+		t.Errorf("expected current plus two previous versions, got %+v", versions)
+	}
+
+	l.Config.History.Versions = -1
+	l2, b := newHistoryTestLocksmith()
+	l2.Config = l.Config
+	_ = l2.PutSecret("k", Secret{Value: []byte("a")}, false)
+	_ = l2.PutSecret("k", Secret{Value: []byte("b")}, false)
+	if _, ok := b.data[historyKey("k")]; ok {
+		t.Error("history should not be written when disabled")
+	}
+}
+
+func TestGetVersionAndRollback(t *testing.T) {
+	l, _ := newHistoryTestLocksmith()
+
+	expires := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	_ = l.PutSecret("db", Secret{Value: []byte("good"), ExpiresAt: expires, SecretType: SecretTypePassword}, false)
+	_ = l.PutSecret("db", Secret{Value: []byte("broken"), WrittenBy: "rotator:db"}, false)
+
+	v1, err := l.GetVersion("db", 1)
+	if err != nil {
+		t.Fatalf("GetVersion: %v", err)
+	}
+	if string(v1.Value) != "good" {
+		t.Errorf("version 1 = %q", v1.Value)
+	}
+	if _, err := l.GetVersion("db", 7); !errors.Is(err, ErrVersionNotFound) {
+		t.Errorf("expected ErrVersionNotFound, got %v", err)
+	}
+
+	restored, err := l.Rollback("db", 0)
+	if err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+	if restored.Version != 3 {
+		t.Errorf("restored version = %d, want 3", restored.Version)
+	}
+
+	current, err := l.Get("db")
+	if err != nil || string(current) != "good" {
+		t.Fatalf("after rollback got %q, %v", current, err)
+	}
+	secret, _ := l.GetWithMetadata("db")
+	if !secret.ExpiresAt.Equal(expires) || secret.SecretType != SecretTypePassword {
+		t.Errorf("rollback should restore metadata, got %+v", secret)
+	}
+
+	// The broken value is kept and can be restored in turn.
+	v2, err := l.GetVersion("db", 2)
+	if err != nil || string(v2.Value) != "broken" {
+		t.Errorf("version 2 = %v, %v", v2, err)
+	}
+	if _, err := l.Rollback("db", 3); err == nil {
+		t.Error("expected an error rolling back to the current version")
+	}
+	if _, err := l.Rollback("db", 9); !errors.Is(err, ErrVersionNotFound) {
+		t.Errorf("expected ErrVersionNotFound, got %v", err)
+	}
+}
+
+func TestHistoryOfLegacySecret(t *testing.T) {
+	l, b := newHistoryTestLocksmith()
+	// Written before version history existed: no version number.
+	_ = setWithMetadata(b, DefaultService, "old", []byte(`{"value":"bGVnYWN5"}`), SecretMetadata{}, false)
+
+	if err := l.PutSecret("old", Secret{Value: []byte("new")}, false); err != nil {
+		t.Fatal(err)
+	}
+	versions, err := l.History("old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || versions[0].Version != 2 || versions[1].Version != 1 || string(versions[1].Value) != "legacy" {
+		t.Errorf("unexpected history %+v", versions)
+	}
+}
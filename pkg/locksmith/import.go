@@ -0,0 +1,590 @@
+package locksmith
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// ImportFormat names a file format read by ParseImport.
+type ImportFormat string
+
+const (
+	ImportFormatEnv       ImportFormat = "env"       // KEY=value lines
+	ImportFormatBitwarden ImportFormat = "bitwarden" // unencrypted Bitwarden JSON export
+	ImportFormatCSV       ImportFormat = "csv"       // KeePassXC, 1Password, Bitwarden or generic CSV with a header row
+	ImportFormatNative    ImportFormat = "locksmith" // locksmith JSON, see ImportFile
+)
+
+// ParseImportFormat parses a --format value; empty means detect it.
+// keepassxc and 1password are accepted as names for csv.
+func ParseImportFormat(s string) (ImportFormat, error) {
+	switch f := ImportFormat(strings.ToLower(strings.TrimSpace(s))); f {
+	case "", ImportFormatEnv, ImportFormatBitwarden, ImportFormatCSV, ImportFormatNative:
+		return f, nil
+	case "keepassxc", "1password":
+		return ImportFormatCSV, nil
+	case "json":
+		return ImportFormatNative, nil
+	default:
+		return "", fmt.Errorf("unknown import format '%s' (supported: env, bitwarden, csv, keepassxc, 1password, locksmith)", s)
+	}
+}
+
+// DetectImportFormat guesses the format of data read from the file name.
+func DetectImportFormat(name string, data []byte) (ImportFormat, error) {
+	base := strings.ToLower(filepath.Base(name))
+	switch {
+	case base == ".env" || strings.HasPrefix(base, ".env.") || strings.HasSuffix(base, ".env"):
+		return ImportFormatEnv, nil
+	case strings.HasSuffix(base, ".csv"):
+		return ImportFormatCSV, nil
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		return ImportFormatNative, nil
+	}
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		var probe map[string]json.RawMessage
+		if err := json.Unmarshal(trimmed, &probe); err == nil {
+			if _, ok := probe["items"]; ok {
+				return ImportFormatBitwarden, nil
+			}
+			if _, ok := probe["secrets"]; ok {
+				return ImportFormatNative, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("cannot detect the format of '%s'; set it with --format", name)
+}
+
+// ImportEntry is one secret read from an import file. Name, Folder and
+// Username are also available to key templates.
+type ImportEntry struct {
+	// Key is where the entry is stored unless a key template is given: the
+	// variable name for .env files, the key for locksmith JSON and
+	// folder/title for password-manager exports.
+	Key string
+	// Name is the variable name or entry title.
+	Name string
+	// Folder is the folder or group of a password-manager entry; it is
+	// also added as a tag.
+	Folder   string
+	Username string
+	Value    []byte
+
+	SecretType       SecretType
+	OwnerApplication string
+	SourceURL        string
+	Tags             []string
+	Description      string
+	ExpiresAt        time.Time
+	Metadata         map[string]string
+}
+
+// ImportFile is the locksmith JSON import format. A bare array of secrets
+// is accepted too.
+//
+//	{"version": 1, "secrets": [{"key": "db/prod/password", "value": "...",
+//	  "secret_type": "password", "tags": ["prod"], "expires_at": "2026-01-01T00:00:00Z"}]}
+type ImportFile struct {
+	Version int            `json:"version"`
+	Secrets []ImportSecret `json:"secrets"`
+}
+
+// ImportSecret is one secret of an ImportFile.
+type ImportSecret struct {
+	Key              string            `json:"key"`
+	Value            string            `json:"value"`
+	SecretType       SecretType        `json:"secret_type,omitempty"`
+	OwnerApplication string            `json:"owner_application,omitempty"`
+	SourceURL        string            `json:"source_url,omitempty"`
+	Tags             []string          `json:"tags,omitempty"`
+	Description      string            `json:"description,omitempty"`
+	ExpiresAt        time.Time         `json:"expires_at,omitzero"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
+}
+
+const importFormatVersion = 1
+
+// ParseImport reads the entries of an import file.
+func ParseImport(r io.Reader, format ImportFormat) ([]ImportEntry, error) {
+	switch format {
+	case ImportFormatEnv:
+		return parseEnvImport(r)
+	case ImportFormatBitwarden:
+		return parseBitwardenImport(r)
+	case ImportFormatCSV:
+		return parseCSVImport(r)
+	case ImportFormatNative:
+		return parseNativeImport(r)
+	default:
+		return nil, fmt.Errorf("unknown import format '%s'", format)
+	}
+}
+
+func parseEnvImport(r io.Reader) ([]ImportEntry, error) {
+	env, err := parseEnv(r)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	entries := make([]ImportEntry, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, ImportEntry{Key: name, Name: name, Value: []byte(env[name])})
+	}
+	return entries, nil
+}
+
+type bitwardenExport struct {
+	Encrypted bool `json:"encrypted"`
+	Folders   []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"folders"`
+	Items []struct {
+		Type     int    `json:"type"`
+		Name     string `json:"name"`
+		FolderID string `json:"folderId"`
+		Notes    string `json:"notes"`
+		Login    *struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			URIs     []struct {
+				URI string `json:"uri"`
+			} `json:"uris"`
+		} `json:"login"`
+	} `json:"items"`
+}
+
+// Bitwarden item types.
+const (
+	bitwardenLogin      = 1
+	bitwardenSecureNote = 2
+)
+
+// parseBitwardenImport reads logins (the password) and secure notes (the
+// notes) from an unencrypted Bitwarden JSON export. Cards and identities
+// have no value and are reported as skipped.
+func parseBitwardenImport(r io.Reader) ([]ImportEntry, error) {
+	var export bitwardenExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, fmt.Errorf("invalid Bitwarden export: %w", err)
+	}
+	if export.Encrypted {
+		return nil, fmt.Errorf("encrypted Bitwarden exports are not supported; export as unencrypted JSON")
+	}
+	folders := make(map[string]string, len(export.Folders))
+	for _, f := range export.Folders {
+		folders[f.ID] = f.Name
+	}
+
+	entries := make([]ImportEntry, 0, len(export.Items))
+	for _, item := range export.Items {
+		e := ImportEntry{Name: item.Name, Folder: folders[item.FolderID]}
+		switch item.Type {
+		case bitwardenLogin:
+			if item.Login != nil {
+				e.Username = item.Login.Username
+				e.Value = []byte(item.Login.Password)
+				e.SecretType = SecretTypePassword
+				if len(item.Login.URIs) > 0 {
+					e.SourceURL = item.Login.URIs[0].URI
+				}
+			}
+		case bitwardenSecureNote:
+			e.Value = []byte(item.Notes)
+		}
+		e.Key = entryKey(e.Folder, e.Name)
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// csvColumns maps the header names used by KeePassXC, 1Password, Bitwarden
+// and the generic CSV format to entry fields.
+var csvColumns = map[string]string{
+	"key":               "key",
+	"title":             "name",
+	"name":              "name",
+	"group":             "folder",
+	"folder":            "folder",
+	"username":          "username",
+	"login_username":    "username",
+	"password":          "password",
+	"login_password":    "password",
+	"value":             "value",
+	"url":               "url",
+	"login_uri":         "url",
+	"source_url":        "url",
+	"notes":             "notes",
+	"tags":              "tags",
+	"secret_type":       "secret_type",
+	"owner_application": "owner_application",
+	"owner_app":         "owner_application",
+	"description":       "description",
+	"expires_at":        "expires_at",
+}
+
+// parseCSVImport reads a CSV file whose first row names the columns. The
+// password (or value) column is the secret; rows without one use their
+// notes, as exported for secure notes.
+func parseCSVImport(r io.Reader) ([]ImportEntry, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	cols := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if field, ok := csvColumns[name]; ok {
+			if _, dup := cols[field]; !dup {
+				cols[field] = i
+			}
+		}
+	}
+	if _, ok := cols["password"]; !ok {
+		if _, ok := cols["value"]; !ok {
+			return nil, fmt.Errorf("CSV header has no password or value column")
+		}
+	}
+
+	var entries []ImportEntry
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		get := func(field string) string {
+			if i, ok := cols[field]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+
+		e := ImportEntry{
+			Key:              get("key"),
+			Name:             get("name"),
+			Folder:           keepassGroup(get("folder")),
+			Username:         get("username"),
+			SecretType:       ParseSecretType(get("secret_type")),
+			OwnerApplication: get("owner_application"),
+			SourceURL:        get("url"),
+			Description:      get("description"),
+		}
+		if i, ok := cols["password"]; ok && i < len(row) && row[i] != "" {
+			e.Value = []byte(row[i])
+			if e.SecretType == SecretTypeUnspecified {
+				e.SecretType = SecretTypePassword
+			}
+		} else if i, ok := cols["value"]; ok && i < len(row) && row[i] != "" {
+			e.Value = []byte(row[i])
+		} else {
+			e.Value = []byte(get("notes"))
+		}
+		if tags := get("tags"); tags != "" {
+			e.Tags = strings.FieldsFunc(tags, func(r rune) bool { return r == ',' || r == ';' })
+		}
+		if v := get("expires_at"); v != "" {
+			if e.ExpiresAt, err = parseImportTime(v); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+		if e.Key == "" {
+			e.Key = entryKey(e.Folder, e.Name)
+		}
+		if e.Name == "" {
+			e.Name = e.Key
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// keepassGroup drops the "Root" group KeePassXC puts at the top of every
+// group path.
+func keepassGroup(group string) string {
+	if group == "Root" {
+		return ""
+	}
+	return strings.TrimPrefix(group, "Root/")
+}
+
+func parseImportTime(v string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid expiry '%s': use RFC 3339 or YYYY-MM-DD", v)
+}
+
+func parseNativeImport(r io.Reader) ([]ImportEntry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var file ImportFile
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(trimmed, &file.Secrets)
+	} else {
+		err = json.Unmarshal(trimmed, &file)
+	}
+	zeroBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid locksmith import file: %w", err)
+	}
+	if file.Version > importFormatVersion {
+		return nil, fmt.Errorf("unsupported locksmith import file version %d", file.Version)
+	}
+
+	entries := make([]ImportEntry, 0, len(file.Secrets))
+	for _, s := range file.Secrets {
+		entries = append(entries, ImportEntry{
+			Key:              s.Key,
+			Name:             s.Key,
+			Value:            []byte(s.Value),
+			SecretType:       s.SecretType,
+			OwnerApplication: s.OwnerApplication,
+			SourceURL:        s.SourceURL,
+			Tags:             s.Tags,
+			Description:      s.Description,
+			ExpiresAt:        s.ExpiresAt,
+			Metadata:         s.Metadata,
+		})
+	}
+	return entries, nil
+}
+
+var slugInvalid = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// slugKey lowercases s and replaces everything but letters, digits, '.',
+// '_' and '-' with '-' in each '/'-separated segment; empty segments are
+// dropped.
+func slugKey(s string) string {
+	var segments []string
+	for _, segment := range strings.Split(strings.ToLower(s), "/") {
+		segment = strings.Trim(slugInvalid.ReplaceAllString(segment, "-"), "-")
+		if segment != "" && segment != "." && segment != ".." {
+			segments = append(segments, segment)
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func entryKey(parts ...string) string {
+	return slugKey(strings.Join(parts, "/"))
+}
+
+// ImportAction is the outcome of importing a single entry.
+type ImportAction string
+
+const (
+	ImportCreated     ImportAction = "imported"
+	ImportOverwritten ImportAction = "overwritten"
+	ImportRenamed     ImportAction = "renamed"
+	ImportSkipped     ImportAction = "skipped"
+	ImportFailed      ImportAction = "failed"
+)
+
+// ImportOptions configures Import.
+type ImportOptions struct {
+	// KeyTemplate, when set, is a text/template producing each entry's key
+	// from its fields ({{.Key}}, {{.Name}}, {{.Folder}}, {{.Username}},
+	// {{.SecretType}}); slug, lower and upper are available as functions.
+	KeyTemplate string
+	Conflict    ConflictPolicy
+	// DryRun reports what would happen without writing anything.
+	DryRun bool
+	// Tags are added to every imported secret.
+	Tags []string
+	// SecretType and OwnerApplication apply to entries that do not set
+	// their own.
+	SecretType       SecretType
+	OwnerApplication string
+	// TTL sets the expiry of entries without one; zero means they never
+	// expire.
+	TTL               time.Duration
+	RequireBiometrics bool
+	// Progress, when set, is called after each entry is processed.
+	Progress func(ImportResult)
+}
+
+// ImportResult describes what happened to one entry.
+type ImportResult struct {
+	Name string
+	// Key is where the entry was (or, in a dry run, would be) stored.
+	Key    string
+	Action ImportAction
+	// Err says why the entry failed or was skipped for a reason other than
+	// a conflict.
+	Err error
+}
+
+// Import writes entries to the vault through PutSecret. Existing keys and
+// aliases, and keys imported earlier in the same run, are handled by
+// opts.Conflict; renamed keys get an ".imported" suffix.
+func (l *Locksmith) Import(entries []ImportEntry, opts ImportOptions) ([]ImportResult, error) {
+	if opts.Conflict == "" {
+		opts.Conflict = ConflictSkip
+	}
+	extraTags, err := NormalizeTags(opts.Tags)
+	if err != nil {
+		return nil, err
+	}
+	var keyTemplate *template.Template
+	if opts.KeyTemplate != "" {
+		keyTemplate, err = template.New("key").Funcs(template.FuncMap{
+			"slug":  slugKey,
+			"lower": strings.ToLower,
+			"upper": strings.ToUpper,
+		}).Option("missingkey=error").Parse(opts.KeyTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key template: %w", err)
+		}
+	}
+
+	existing, err := l.ListKeyNames()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list existing keys: %w", err)
+	}
+	taken := make(map[string]bool, len(existing))
+	for _, k := range existing {
+		taken[k] = true
+	}
+	if l.Config != nil {
+		for alias := range l.Config.Aliases {
+			taken[alias] = true
+		}
+	}
+
+	session := newAuthSession(l.Options.getPrompt(fmt.Sprintf("Authentication required to import %d secrets", len(entries)), ""))
+	defer session.end()
+	session.join(l)
+
+	results := make([]ImportResult, 0, len(entries))
+	for _, entry := range entries {
+		res := l.importOne(entry, keyTemplate, extraTags, taken, opts)
+		if res.Action != ImportSkipped && res.Action != ImportFailed {
+			taken[res.Key] = true
+		}
+		results = append(results, res)
+		if opts.Progress != nil {
+			opts.Progress(res)
+		}
+	}
+	return results, nil
+}
+
+func (l *Locksmith) importOne(entry ImportEntry, keyTemplate *template.Template, extraTags []string, taken map[string]bool, opts ImportOptions) ImportResult {
+	res := ImportResult{Name: entry.Name, Key: entry.Key, Action: ImportCreated}
+	if res.Name == "" {
+		res.Name = entry.Key
+	}
+	fail := func(err error) ImportResult {
+		res.Action = ImportFailed
+		res.Err = err
+		return res
+	}
+
+	if keyTemplate != nil {
+		var buf strings.Builder
+		if err := keyTemplate.Execute(&buf, entry); err != nil {
+			return fail(fmt.Errorf("key template: %w", err))
+		}
+		res.Key = strings.Trim(strings.TrimSpace(buf.String()), "/")
+	}
+	if res.Key == "" {
+		return fail(fmt.Errorf("entry has no key"))
+	}
+	if ref, err := ParseRef(res.Key); err != nil || ref.Key != res.Key || isInternalKey(res.Key) {
+		return fail(fmt.Errorf("invalid key '%s'", res.Key))
+	}
+	if len(entry.Value) == 0 {
+		res.Action = ImportSkipped
+		res.Err = fmt.Errorf("entry has no value")
+		return res
+	}
+
+	if taken[res.Key] {
+		switch opts.Conflict {
+		case ConflictOverwrite:
+			res.Action = ImportOverwritten
+		case ConflictRename:
+			res.Action = ImportRenamed
+			res.Key = renamedKey(res.Key, "imported", taken)
+		default:
+			res.Action = ImportSkipped
+			return res
+		}
+	}
+
+	secret := Secret{
+		Value:            append([]byte(nil), entry.Value...),
+		ExpiresAt:        entry.ExpiresAt,
+		SecretType:       entry.SecretType,
+		OwnerApplication: entry.OwnerApplication,
+		SourceURL:        entry.SourceURL,
+		Description:      entry.Description,
+		Metadata:         entry.Metadata,
+	}
+	if secret.SecretType == SecretTypeUnspecified {
+		secret.SecretType = opts.SecretType
+	}
+	if secret.OwnerApplication == "" {
+		secret.OwnerApplication = opts.OwnerApplication
+	}
+	if secret.ExpiresAt.IsZero() && opts.TTL > 0 {
+		secret.ExpiresAt = time.Now().Add(opts.TTL)
+	}
+	if entry.Username != "" {
+		secret.Metadata = make(map[string]string, len(entry.Metadata)+1)
+		for k, v := range entry.Metadata {
+			secret.Metadata[k] = v
+		}
+		secret.Metadata["username"] = entry.Username
+	}
+	tags := append([]string(nil), extraTags...)
+	for _, tag := range entry.Tags {
+		if tag = slugKey(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	if folder := slugKey(entry.Folder); folder != "" {
+		tags = append(tags, folder)
+	}
+	secret.Tags = tags
+	if secret.SecretType == SecretTypeTOTP {
+		if _, err := ParseTOTP(string(secret.Value)); err != nil {
+			return fail(err)
+		}
+	}
+
+	if opts.DryRun {
+		return res
+	}
+	if err := l.PutSecret(res.Key, secret, opts.RequireBiometrics); err != nil {
+		return fail(err)
+	}
+	return res
+}
@@ -0,0 +1,204 @@
+package locksmith
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseEnvExportPrefix(t *testing.T) {
+	env, err := parseEnv(strings.NewReader("export A=1\nB=\"\nC='x=y'\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"A": "1", "B": "\"", "C": "x=y"}
+	if !reflect.DeepEqual(env, want) {
+		t.Errorf("parseEnv = %v, want %v", env, want)
+	}
+}
+
+func TestDetectImportFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want ImportFormat
+	}{
+		{".env", "", ImportFormatEnv},
+		{"config/.env.local", "", ImportFormatEnv},
+		{"prod.env", "", ImportFormatEnv},
+		{"export.CSV", "", ImportFormatCSV},
+		{"bw.json", `{"encrypted": false, "items": []}`, ImportFormatBitwarden},
+		{"secrets.json", `{"version": 1, "secrets": []}`, ImportFormatNative},
+		{"secrets.json", `[]`, ImportFormatNative},
+	}
+	for _, tt := range tests {
+		got, err := DetectImportFormat(tt.name, []byte(tt.data))
+		if err != nil || got != tt.want {
+			t.Errorf("DetectImportFormat(%q) = %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+	if _, err := DetectImportFormat("notes.txt", []byte("hello")); err == nil {
+		t.Error("expected an undetectable file to fail")
+	}
+	if f, err := ParseImportFormat("KeePassXC"); err != nil || f != ImportFormatCSV {
+		t.Errorf("ParseImportFormat(KeePassXC) = %q, %v", f, err)
+	}
+}
+
+func TestParseBitwardenImport(t *testing.T) {
+	export := `{
+	  "encrypted": false,
+	  "folders": [{"id": "f1", "name": "Work Accounts"}],
+	  "items": [
+	    {"type": 1, "name": "GitHub", "folderId": "f1",
+	     "login": {"username": "alice", "password": "pw", "uris": [{"uri": "https://github.com"}]}},
+	    {"type": 2, "name": "Recovery codes", "notes": "1234 5678"},
+	    {"type": 3, "name": "Visa"}
+	  ]
+	}`
+	entries, err := ParseImport(strings.NewReader(export), ImportFormatBitwarden)
+	if err != nil {
+		t.Fatalf("ParseImport: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	login := entries[0]
+	if login.Key != "work-accounts/github" || string(login.Value) != "pw" || login.Username != "alice" ||
+		login.SourceURL != "https://github.com" || login.SecretType != SecretTypePassword {
+		t.Errorf("unexpected login entry %+v", login)
+	}
+	if entries[1].Key != "recovery-codes" || string(entries[1].Value) != "1234 5678" {
+		t.Errorf("unexpected note entry %+v", entries[1])
+	}
+	if len(entries[2].Value) != 0 {
+		t.Errorf("a card should have no value, got %q", entries[2].Value)
+	}
+
+	if _, err := ParseImport(strings.NewReader(`{"encrypted": true, "items": []}`), ImportFormatBitwarden); err == nil {
+		t.Error("expected an encrypted export to be rejected")
+	}
+}
+
+func TestParseCSVImport(t *testing.T) {
+	keepass := "\"Group\",\"Title\",\"Username\",\"Password\",\"URL\",\"Notes\"\n" +
+		"\"Root/Cloud\",\"AWS Console\",\"admin\",\"s3cret\",\"https://aws.amazon.com\",\"\"\n" +
+		"\"Root\",\"Wifi\",\"\",\"\",\"\",\"only notes\"\n"
+	entries, err := ParseImport(strings.NewReader(keepass), ImportFormatCSV)
+	if err != nil {
+		t.Fatalf("ParseImport: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Key != "cloud/aws-console" || entries[0].Folder != "Cloud" ||
+		string(entries[0].Value) != "s3cret" || entries[0].SecretType != SecretTypePassword {
+		t.Fatalf("unexpected KeePassXC entries %+v", entries)
+	}
+	if entries[1].Key != "wifi" || string(entries[1].Value) != "only notes" {
+		t.Errorf("unexpected notes entry %+v", entries[1])
+	}
+
+	onePassword := "Title,Url,Username,Password,OTPAuth,Favorite,Archived,Tags,Notes\n" +
+		"Stripe,https://stripe.com,ops,sk_live,,false,false,billing;prod,\n"
+	entries, err = ParseImport(strings.NewReader(onePassword), ImportFormatCSV)
+	if err != nil {
+		t.Fatalf("ParseImport: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Key != "stripe" || !reflect.DeepEqual(entries[0].Tags, []string{"billing", "prod"}) {
+		t.Errorf("unexpected 1Password entries %+v", entries)
+	}
+
+	generic := "key,value,secret_type,owner_application,expires_at\n" +
+		"ci/token,abc,token,github,2030-01-02\n"
+	entries, err = ParseImport(strings.NewReader(generic), ImportFormatCSV)
+	if err != nil {
+		t.Fatalf("ParseImport: %v", err)
+	}
+	want := time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC)
+	if len(entries) != 1 || entries[0].Key != "ci/token" || entries[0].SecretType != SecretTypeToken ||
+		entries[0].OwnerApplication != "github" || !entries[0].ExpiresAt.Equal(want) {
+		t.Errorf("unexpected generic entries %+v", entries)
+	}
+
+	if _, err := ParseImport(strings.NewReader("title,url\nx,y\n"), ImportFormatCSV); err == nil {
+		t.Error("expected a CSV without a password column to be rejected")
+	}
+}
+
+func TestImport(t *testing.T) {
+	l, _ := newHistoryTestLocksmith()
+	if err := l.PutSecret("myapp/db_url", Secret{Value: []byte("old")}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	native := `{"version": 1, "secrets": [
+	  {"key": "DB_URL", "value": "postgres://", "secret_type": "password", "tags": ["Team A"]},
+	  {"key": "API_KEY", "value": "k", "expires_at": "2031-01-01T00:00:00Z", "source_url": "https://api.example.com"},
+	  {"key": "EMPTY", "value": ""}
+	]}`
+	entries, err := ParseImport(strings.NewReader(native), ImportFormatNative)
+	if err != nil {
+		t.Fatalf("ParseImport: %v", err)
+	}
+	opts := ImportOptions{
+		KeyTemplate: "myapp/{{.Key | lower}}",
+		Tags:        []string{"imported"},
+		TTL:         time.Hour,
+		DryRun:      true,
+	}
+
+	results, err := l.Import(entries, opts)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	var actions []ImportAction
+	for _, r := range results {
+		actions = append(actions, r.Action)
+	}
+	if want := []ImportAction{ImportSkipped, ImportCreated, ImportSkipped}; !reflect.DeepEqual(actions, want) {
+		t.Errorf("dry run actions = %v, want %v", actions, want)
+	}
+	if _, err := l.GetWithMetadata("myapp/api_key"); err == nil {
+		t.Error("a dry run must not write")
+	}
+
+	opts.DryRun = false
+	opts.Conflict = ConflictRename
+	results, err = l.Import(entries, opts)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if results[0].Action != ImportRenamed || results[0].Key != "myapp/db_url.imported" {
+		t.Errorf("expected a rename, got %+v", results[0])
+	}
+	renamed, err := l.GetWithMetadata("myapp/db_url.imported")
+	if err != nil || string(renamed.Value) != "postgres://" || renamed.SecretType != SecretTypePassword ||
+		!reflect.DeepEqual(renamed.Tags, []string{"imported", "team-a"}) {
+		t.Errorf("unexpected renamed secret %+v, %v", renamed, err)
+	}
+	if old, _ := l.Get("myapp/db_url"); string(old) != "old" {
+		t.Errorf("rename must keep the existing secret, got %q", old)
+	}
+	apiKey, err := l.GetWithMetadata("myapp/api_key")
+	if err != nil || !apiKey.ExpiresAt.Equal(time.Date(2031, 1, 1, 0, 0, 0, 0, time.UTC)) ||
+		apiKey.SourceURL != "https://api.example.com" {
+		t.Errorf("expected the entry's own expiry and source URL, got %+v, %v", apiKey, err)
+	}
+
+	opts.Conflict = ConflictOverwrite
+	opts.KeyTemplate = "{{.Missing}}"
+	results, err = l.Import(entries[:1], opts)
+	if err != nil || results[0].Action != ImportFailed {
+		t.Errorf("expected a template error to fail the entry, got %+v, %v", results, err)
+	}
+	opts.KeyTemplate = "myapp/{{.Key | lower}}"
+	results, err = l.Import(entries[:1], opts)
+	if err != nil || results[0].Action != ImportOverwritten {
+		t.Fatalf("expected an overwrite, got %+v, %v", results, err)
+	}
+	if value, _ := l.Get("myapp/db_url"); string(value) != "postgres://" {
+		t.Errorf("overwrite stored %q", value)
+	}
+	if history, err := l.History("myapp/db_url"); err != nil || len(history) != 2 {
+		t.Errorf("overwrite should keep the old value in history, got %d versions, %v", len(history), err)
+	}
+}
@@ -0,0 +1,323 @@
+package locksmith
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+
+	"github.com/bonjoski/locksmith/v2/pkg/filelock"
+)
+
+// IndexFileName is the name of a vault's metadata index, stored next to its
+// cache directory.
+const IndexFileName = "metadata.index"
+
+const indexFormatVersion = 1
+
+// ErrIndexCorrupt is returned when the metadata index cannot be decrypted or
+// authenticated; 'locksmith index rebuild' replaces it.
+var ErrIndexCorrupt = errors.New("metadata index is corrupt or was modified")
+
+// MetadataIndex is an encrypted index of the metadata (never the values) of
+// every secret in a vault. It keeps listings, expiry status and rotation
+// scans accurate without reading, and authenticating for, each secret. The
+// file is sealed with AES-GCM under the master key and bound to the vault's
+// service, so it cannot be read, modified or swapped between vaults
+// undetected. Updates are serialized across processes with a lock file.
+//
+// A nil *MetadataIndex is valid and disables indexing.
+type MetadataIndex struct {
+	Path    string
+	service string
+	key     []byte
+	// keyFunc supplies key on first use when it is nil.
+	keyFunc func() ([]byte, error)
+	mu      sync.Mutex
+}
+
+type indexFile struct {
+	Version int                       `json:"version"`
+	Entries map[string]SecretMetadata `json:"entries"`
+}
+
+// NewMetadataIndex returns the index stored at path for the vault whose
+// backend service is service.
+func NewMetadataIndex(masterKey []byte, path, service string) (*MetadataIndex, error) {
+	if len(masterKey) != 32 {
+		return nil, fmt.Errorf("invalid master key length: expected 32 bytes, got %d", len(masterKey))
+	}
+	return &MetadataIndex{Path: path, service: service, key: masterKey}, nil
+}
+
+// VaultIndexPath returns the path of a vault's metadata index.
+func VaultIndexPath(name string) (string, error) {
+	cacheDir, err := VaultCacheDir(name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(cacheDir), IndexFileName), nil
+}
+
+// Load returns every indexed entry. A missing index is empty.
+func (x *MetadataIndex) Load() (map[string]SecretMetadata, error) {
+	if x == nil {
+		return nil, nil
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.read()
+}
+
+// Put records the metadata of key.
+func (x *MetadataIndex) Put(key string, meta SecretMetadata) error {
+	return x.update(func(entries map[string]SecretMetadata) bool {
+		if old, ok := entries[key]; ok && reflect.DeepEqual(old, meta) {
+			return false
+		}
+		entries[key] = meta
+		return true
+	})
+}
+
+// Remove drops key from the index.
+func (x *MetadataIndex) Remove(key string) error {
+	return x.update(func(entries map[string]SecretMetadata) bool {
+		if _, ok := entries[key]; !ok {
+			return false
+		}
+		delete(entries, key)
+		return true
+	})
+}
+
+// Replace overwrites the whole index with entries.
+func (x *MetadataIndex) Replace(entries map[string]SecretMetadata) error {
+	if x == nil {
+		return nil
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	lock, err := filelock.Acquire(x.Path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = lock.Release() }()
+	return x.write(entries)
+}
+
+// update applies fn to the current entries under the lock and writes them
+// back when fn reports a change. A corrupt index is left alone: it is only
+// replaced by Replace.
+func (x *MetadataIndex) update(fn func(map[string]SecretMetadata) bool) error {
+	if x == nil {
+		return nil
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	lock, err := filelock.Acquire(x.Path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = lock.Release() }()
+
+	entries, err := x.read()
+	if err != nil {
+		return err
+	}
+	if !fn(entries) {
+		return nil
+	}
+	return x.write(entries)
+}
+
+func (x *MetadataIndex) read() (map[string]SecretMetadata, error) {
+	if _, err := os.Stat(x.Path); os.IsNotExist(err) {
+		return make(map[string]SecretMetadata), nil
+	}
+	// Resolve the key before reading: creating the first cache key
+	// re-encrypts an index written under the legacy master key.
+	gcm, err := x.aead()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Clean(x.Path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return make(map[string]SecretMetadata), nil
+		}
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, ErrIndexCorrupt
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], x.ad())
+	if err != nil {
+		return nil, ErrIndexCorrupt
+	}
+	defer zeroBytes(plain)
+
+	var f indexFile
+	if err := json.Unmarshal(plain, &f); err != nil || f.Version != indexFormatVersion {
+		return nil, ErrIndexCorrupt
+	}
+	if f.Entries == nil {
+		f.Entries = make(map[string]SecretMetadata)
+	}
+	return f.Entries, nil
+}
+
+// write seals entries and replaces the index file atomically.
+func (x *MetadataIndex) write(entries map[string]SecretMetadata) error {
+	plain, err := json.Marshal(indexFile{Version: indexFormatVersion, Entries: entries})
+	if err != nil {
+		return err
+	}
+	defer zeroBytes(plain)
+
+	gcm, err := x.aead()
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	sealed := gcm.Seal(nonce, nonce, plain, x.ad())
+
+	dir := filepath.Dir(x.Path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create index directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, ".index-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary index file: %w", err)
+	}
+	tmpName := tmp.Name()
+	defer func() { _ = os.Remove(tmpName) }()
+
+	if err := tmp.Chmod(0600); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(sealed); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, x.Path)
+}
+
+func (x *MetadataIndex) aead() (cipher.AEAD, error) {
+	if x.key == nil && x.keyFunc != nil {
+		key, err := x.keyFunc()
+		if err != nil {
+			return nil, fmt.Errorf("index key unavailable: %w", err)
+		}
+		x.key = key
+	}
+	block, err := aes.NewCipher(x.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// rekey re-encrypts the index under key. An index that cannot be read
+// under the current key is left for RebuildIndex to replace, and
+// ErrIndexCorrupt returned.
+func (x *MetadataIndex) rekey(key []byte) error {
+	if x == nil {
+		return nil
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	lock, err := filelock.Acquire(x.Path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = lock.Release() }()
+
+	entries, readErr := x.read()
+	x.key, x.keyFunc = key, nil
+	if readErr != nil {
+		return readErr
+	}
+	return x.write(entries)
+}
+
+// ad binds the ciphertext to its purpose and vault.
+func (x *MetadataIndex) ad() []byte {
+	return []byte("locksmith-index/v1\x00" + x.service)
+}
+
+// indexPut records secret's metadata. Index failures never fail the write
+// they follow; they are reported and repaired by 'locksmith index rebuild'.
+func (l *Locksmith) indexPut(key string, secret Secret) {
+	if err := l.Index.Put(key, metadataOf(secret)); err != nil {
+		warnIndex(err)
+	}
+}
+
+func (l *Locksmith) indexRemove(key string) {
+	if err := l.Index.Remove(key); err != nil {
+		warnIndex(err)
+	}
+}
+
+func warnIndex(err error) {
+	if os.Getenv("LOCKSMITH_SILENT") == "true" {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Warning: metadata index not updated: %v (run 'locksmith index rebuild')\n", err)
+}
+
+// RebuildIndex replaces the metadata index with the metadata of every key
+// in the vault and returns the number of entries. Complete metadata the
+// backend can list is used as is; other keys are read, with at most one
+// authentication prompt.
+func (l *Locksmith) RebuildIndex() (int, error) {
+	if l.Index == nil {
+		return 0, fmt.Errorf("vault '%s' has no metadata index", l.vaultName())
+	}
+	prompt := l.Options.getPrompt("Authentication required to rebuild the metadata index", "")
+	keys, backendMeta, err := l.backendListMetadata(l.Options.RequireBiometrics, prompt)
+	if err != nil {
+		return 0, err
+	}
+
+	partial := listsPartialMetadata(l.Backend)
+
+	session := newAuthSession(prompt)
+	defer session.end()
+	session.join(l)
+
+	entries := make(map[string]SecretMetadata, len(keys))
+	for _, key := range keys {
+		if isInternalKey(key) {
+			continue
+		}
+		if meta, ok := backendMeta[key]; ok && !partial {
+			entries[key] = meta
+			continue
+		}
+		secret, err := l.getSecretNoRotate(key)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read '%s': %w", key, err)
+		}
+		entries[key] = metadataOf(*secret)
+	}
+	if err := l.Index.Replace(entries); err != nil {
+		return 0, err
+	}
+	return len(entries), nil
+}
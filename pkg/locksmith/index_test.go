@@ -0,0 +1,145 @@
+package locksmith
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestIndex(t *testing.T, service string) *MetadataIndex {
+	t.Helper()
+	x, err := NewMetadataIndex(bytes.Repeat([]byte{7}, 32), filepath.Join(t.TempDir(), IndexFileName), service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return x
+}
+
+func TestMetadataIndex(t *testing.T) {
+	x := newTestIndex(t, "svc")
+	expires := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := x.Put("a", SecretMetadata{ExpiresAt: expires, Tags: []string{"prod"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := x.Put("b", SecretMetadata{Description: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := x.Remove("b"); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, _ := NewMetadataIndex(bytes.Repeat([]byte{7}, 32), x.Path, "svc")
+	entries, err := reopened.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || !entries["a"].ExpiresAt.Equal(expires) || entries["a"].Tags[0] != "prod" {
+		t.Errorf("unexpected entries %+v", entries)
+	}
+	if info, err := os.Stat(x.Path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("index mode = %v, %v", info.Mode(), err)
+	}
+
+	// Another vault's index, or a modified file, is rejected.
+	other, _ := NewMetadataIndex(bytes.Repeat([]byte{7}, 32), x.Path, "other-svc")
+	if _, err := other.Load(); !errors.Is(err, ErrIndexCorrupt) {
+		t.Errorf("expected ErrIndexCorrupt for another vault, got %v", err)
+	}
+	data, _ := os.ReadFile(x.Path)
+	data[len(data)-1] ^= 1
+	_ = os.WriteFile(x.Path, data, 0600)
+	if _, err := x.Load(); !errors.Is(err, ErrIndexCorrupt) {
+		t.Errorf("expected ErrIndexCorrupt after tampering, got %v", err)
+	}
+	if err := x.Put("c", SecretMetadata{}); !errors.Is(err, ErrIndexCorrupt) {
+		t.Errorf("expected writes to leave a corrupt index alone, got %v", err)
+	}
+
+	var disabled *MetadataIndex
+	if entries, err := disabled.Load(); err != nil || entries != nil || disabled.Put("a", SecretMetadata{}) != nil {
+		t.Error("a nil index should be a no-op")
+	}
+}
+
+func TestIndexSkipsInternalKeys(t *testing.T) {
+	l, _ := newHistoryTestLocksmith()
+	l.Index = newTestIndex(t, l.Service)
+
+	// PutSecret and GetVersion read the history item of the key.
+	for _, v := range []string{"one", "two", "three"} {
+		if err := l.PutSecret("api", Secret{Value: []byte(v)}, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l.Cache = &MockCache{secrets: map[string]Secret{}}
+	if _, err := l.GetVersion("api", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := l.Index.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries["api"].Version != 3 {
+		t.Errorf("expected only api in the index, got %+v", entries)
+	}
+}
+
+// valueOnlyBackend hides any metadata support of the wrapped backend.
+type valueOnlyBackend struct {
+	Backend
+}
+
+func TestListWithMetadataUsesIndex(t *testing.T) {
+	l, b := newHistoryTestLocksmith()
+	l.Index = newTestIndex(t, l.Service)
+	counter := &gateCounter{Backend: valueOnlyBackend{b}}
+	l.Backend = counter
+
+	expires := time.Now().Add(48 * time.Hour)
+	_ = l.PutSecret("api/key", Secret{Value: []byte("v1"), ExpiresAt: expires, SecretType: SecretTypeAPIKey}, false)
+	_ = l.PutSecret("db/password", Secret{Value: []byte("v2")}, false)
+	if err := l.Delete("db/password"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing is cached and the backend cannot list metadata.
+	l.Cache = &MockCache{secrets: make(map[string]Secret)}
+	l.Options.RequireBiometrics = true
+	items, err := l.ListWithMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || !items["api/key"].ExpiresAt.Equal(expires) || items["api/key"].SecretType != SecretTypeAPIKey {
+		t.Errorf("unexpected listing %+v", items)
+	}
+	if len(counter.gated) != 0 {
+		t.Errorf("listing read secrets: %v", counter.gated)
+	}
+
+	// Rebuild recreates the index, reading the keys it has no metadata for
+	// behind a single prompt.
+	_ = l.PutSecret("db/password", Secret{Value: []byte("v3")}, false)
+	_ = os.Remove(l.Index.Path)
+	counter.gated = nil
+	l.Options.BypassCache = true
+	n, err := l.RebuildIndex()
+	if err != nil || n != 2 {
+		t.Fatalf("RebuildIndex = %d, %v", n, err)
+	}
+	if len(counter.gated) != 1 {
+		t.Errorf("expected one gated read, got %v", counter.gated)
+	}
+	entries, _ := l.Index.Load()
+	if len(entries) != 2 || entries["db/password"].WrittenBy != "test" {
+		t.Errorf("unexpected rebuilt index %+v", entries)
+	}
+
+	l.Index = nil
+	if _, err := l.RebuildIndex(); err == nil {
+		t.Error("expected an error without an index")
+	}
+}
@@ -680,7 +680,7 @@ func valueLooksPlaintextSecret(v any) bool {
 	if trimmed == "" {
 		return false
 	}
-	if strings.HasPrefix(trimmed, "locksmith://") {
+	if strings.HasPrefix(trimmed, "locksmith://") || IsFileRef(trimmed) {
 		return false
 	}
 	return true
@@ -800,7 +800,7 @@ func stringLooksPlaintextSecret(value string) bool {
 	if trimmed == "" {
 		return false
 	}
-	if strings.HasPrefix(trimmed, "locksmith://") {
+	if strings.HasPrefix(trimmed, "locksmith://") || IsFileRef(trimmed) {
 		return false
 	}
 	return true
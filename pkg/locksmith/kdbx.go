@@ -0,0 +1,88 @@
+package locksmith
+
+import (
+	"encoding/json"
+
+	"github.com/bonjoski/locksmith/v2/pkg/backend/kdbx"
+)
+
+func newKDBXBackend(options map[string]string) (Backend, error) {
+	s, err := kdbx.New(kdbx.Options{
+		Path:          options["path"],
+		KeyFile:       options["keyfile"],
+		PassphraseEnv: options["passphrase_env"],
+		Group:         options["group"],
+		KDF:           options["kdf"],
+		Cipher:        options["cipher"],
+		Prompt:        promptTerminalPassphrase,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &kdbxBackend{Store: s}, nil
+}
+
+// kdbxBackend stores the secret value as the entry's Password and its
+// metadata as locksmith.* string fields, so entries stay usable from
+// KeePass clients. Entries created elsewhere are read with their KeePass
+// creation and expiry times and URL.
+type kdbxBackend struct {
+	*kdbx.Store
+}
+
+func (b *kdbxBackend) Set(service, account string, data []byte, requireBiometrics bool) error {
+	return setDecoded(b, service, account, data, requireBiometrics)
+}
+
+func (b *kdbxBackend) SetWithMetadata(service, account string, data []byte, meta SecretMetadata, requireBiometrics bool) error {
+	var secret Secret
+	if err := json.Unmarshal(data, &secret); err != nil {
+		secret.Value = data
+	} else {
+		defer zeroBytes(secret.Value)
+	}
+	return b.SetEntry(service, account, kdbx.Entry{
+		Password: secret.Value,
+		Fields:   metadataToAttributes(meta),
+		Expires:  meta.ExpiresAt,
+	})
+}
+
+func (b *kdbxBackend) Get(service, account string, useBiometrics bool, prompt string) ([]byte, error) {
+	e, err := b.GetEntry(service, account)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(e.Password)
+
+	meta := kdbxMetadata(e)
+	return json.Marshal(secretFromMetadata(e.Password, meta))
+}
+
+func (b *kdbxBackend) ListMetadata(service string, useBiometrics bool, prompt string) (map[string]SecretMetadata, error) {
+	entries, err := b.ListEntries(service)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]SecretMetadata, len(entries))
+	for account, e := range entries {
+		result[account] = kdbxMetadata(&e)
+	}
+	return result, nil
+}
+
+// kdbxMetadata reads locksmith's fields, falling back to the entry's own
+// KeePass properties for entries locksmith did not write.
+func kdbxMetadata(e *kdbx.Entry) SecretMetadata {
+	meta := attributesToMetadata(e.Fields)
+	if meta.CreatedAt.IsZero() {
+		meta.CreatedAt = e.Created
+	}
+	if meta.ExpiresAt.IsZero() {
+		meta.ExpiresAt = e.Expires
+	}
+	if meta.SourceURL == "" {
+		meta.SourceURL = e.Fields["URL"]
+	}
+	return meta
+}
@@ -0,0 +1,61 @@
+package locksmith
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestKDBXBackendRoundTrip(t *testing.T) {
+	t.Setenv("LOCKSMITH_TEST_KDBX", "pw")
+	b, err := Backends.Open(BackendConfig{Name: BackendKDBX, Options: map[string]string{
+		"path":           filepath.Join(t.TempDir(), "team.kdbx"),
+		"passphrase_env": "LOCKSMITH_TEST_KDBX",
+		"kdf":            "aes-kdf",
+	}})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	created := time.Now().Add(-time.Hour).Truncate(time.Second)
+	secret := Secret{
+		Value:            []byte("hunter2"),
+		CreatedAt:        created,
+		ExpiresAt:        created.Add(24 * time.Hour),
+		SecretType:       SecretTypePassword,
+		OwnerApplication: "postgres",
+		Metadata:         map[string]string{"env": "prod"},
+	}
+	data, _ := json.Marshal(secret)
+	if err := b.Set(DefaultService, "db/password", data, false); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	raw, err := b.Get(DefaultService, "db/password", false, "")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	var got Secret
+	if err := json.Unmarshal(raw, &got); err != nil {
+		t.Fatalf("Get returned invalid JSON: %v", err)
+	}
+	if string(got.Value) != "hunter2" || !got.CreatedAt.Equal(created) || !got.ExpiresAt.Equal(secret.ExpiresAt) {
+		t.Errorf("unexpected secret %+v", got)
+	}
+	if got.SecretType != SecretTypePassword || got.OwnerApplication != "postgres" || got.Metadata["env"] != "prod" {
+		t.Errorf("metadata not preserved: %+v", got)
+	}
+
+	mb, ok := b.(MetadataBackend)
+	if !ok {
+		t.Fatal("kdbx backend should implement MetadataBackend")
+	}
+	meta, err := mb.ListMetadata(DefaultService, false, "")
+	if err != nil {
+		t.Fatalf("ListMetadata: %v", err)
+	}
+	if m, ok := meta["db/password"]; !ok || m.OwnerApplication != "postgres" {
+		t.Errorf("unexpected metadata listing %+v", meta)
+	}
+}
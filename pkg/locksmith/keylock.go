@@ -0,0 +1,62 @@
+package locksmith
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+
+	"github.com/bonjoski/locksmith/v2/pkg/filelock"
+)
+
+// lockDirName is the directory, next to a vault's cache, holding the lock
+// files of its keys and cache entries.
+const lockDirName = "locks"
+
+// lockKey takes the cross-process lock of key, held while it is rotated so
+// that concurrent readers of an expired token wait for one rotation rather
+// than each consuming the refresh token. Lock files are named by a hash of
+// the key and never removed, as removing a lock file others may be waiting
+// on would break the lock. Without a lock directory no lock is taken; the
+// nil lock returned may be released all the same.
+func (l *Locksmith) lockKey(key string) (*filelock.Lock, error) {
+	if l.lockDir == "" {
+		return nil, nil
+	}
+	sum := sha256.Sum256([]byte(key))
+	return filelock.Acquire(filepath.Join(l.lockDir, "key-"+hex.EncodeToString(sum[:])+".lock"))
+}
+
+// indexEntry returns key's metadata index entry, if the index holds one.
+func (l *Locksmith) indexEntry(key string) (SecretMetadata, bool) {
+	entries, err := l.Index.Load()
+	if err != nil {
+		return SecretMetadata{}, false
+	}
+	meta, ok := entries[key]
+	return meta, ok
+}
+
+// rotatedElsewhere reports whether another process rotated key, read as
+// expired, while this one waited for the key's lock, and returns the fresh
+// secret if so. The metadata index, which every write updates, is compared
+// with before, key's entry taken before waiting, which avoids another
+// authentication prompt when nobody else rotated it. Without an entry to
+// compare, the secret itself is read again.
+func (l *Locksmith) rotatedElsewhere(key string, expired *Secret, before SecretMetadata, indexed bool) (*Secret, bool, error) {
+	if after, ok := l.indexEntry(key); indexed && ok {
+		if after.CreatedAt.Equal(before.CreatedAt) && after.Version == before.Version {
+			return nil, false, nil
+		}
+		secret, err := l.getSecretNoRotate(key)
+		return secret, err == nil, err
+	}
+
+	secret, err := l.getSecretNoRotate(key)
+	if err != nil {
+		return nil, false, err
+	}
+	if secret.CreatedAt.Equal(expired.CreatedAt) && secret.Version == expired.Version {
+		return nil, false, nil
+	}
+	return secret, true, nil
+}
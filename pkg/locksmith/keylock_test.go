@@ -0,0 +1,131 @@
+//go:build locksmith_admin
+
+package locksmith
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bonjoski/locksmith/v2/pkg/rotator"
+)
+
+// countingRotator hands out a new refresh token on every rotation, as an
+// OAuth provider consuming the previous one would.
+type countingRotator struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (r *countingRotator) ID() string { return "counting" }
+
+func (r *countingRotator) Supports(_ rotator.RotationSelector) bool { return true }
+
+func (r *countingRotator) Rotate(_ context.Context, _ rotator.RotationInput) (rotator.RotationOutput, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.n++
+	return rotator.RotationOutput{NewValue: fmt.Appendf(nil, "token-%d", r.n), TTL: time.Hour}, nil
+}
+
+func TestConcurrentReadsRotateOnce(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		indexed bool
+		// elsewhere replaces the expired token while the reader waits.
+		elsewhere func(l *Locksmith) error
+		want      string
+		rotations int
+	}{
+		{"rotated", true, func(l *Locksmith) error { return l.rotateSecret("gitlab/glab/token") }, "token-1", 1},
+		{"rotated without index", false, func(l *Locksmith) error { return l.rotateSecret("gitlab/glab/token") }, "token-1", 1},
+		{"replaced without expiry", true, func(l *Locksmith) error {
+			return l.PutSecret("gitlab/glab/token", Secret{
+				Value: []byte("pasted"), SecretType: SecretTypeOAuthToken, OwnerApplication: "gitlab",
+			}, false)
+		}, "pasted", 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			testConcurrentReadsRotateOnce(t, tc.indexed, tc.elsewhere, tc.want, tc.rotations)
+		})
+	}
+}
+
+func testConcurrentReadsRotateOnce(t *testing.T, indexed bool, elsewhere func(l *Locksmith) error, want string, rotations int) {
+	backend := &syncBackend{b: newAttrBackend()}
+	shared := newTestIndex(t, DefaultService)
+	lockDir := t.TempDir()
+	rot := &countingRotator{}
+	instance := func() *Locksmith {
+		l := &Locksmith{
+			Service:  DefaultService,
+			Backend:  backend,
+			Cache:    &MockCache{secrets: map[string]Secret{}},
+			Rotators: rotator.NewHandlerRegistry(),
+			Options:  Options{Writer: "test"},
+			Config: &Config{Rotation: []RotationRule{{
+				Secret: "gitlab/glab/token", Rotator: "counting", SecretType: SecretTypeOAuthToken, OwnerApplication: "gitlab",
+			}}},
+			lockDir: lockDir,
+		}
+		if indexed {
+			l.Index = &MetadataIndex{Path: shared.Path, service: DefaultService, key: shared.key}
+		}
+		if err := l.Rotators.Register(rot); err != nil {
+			t.Fatal(err)
+		}
+		return l
+	}
+
+	first, second := instance(), instance()
+	expired := time.Now().Add(-time.Hour)
+	if err := first.PutSecret("gitlab/glab/token", Secret{
+		Value: []byte("token-0"), CreatedAt: expired.Add(-time.Hour), ExpiresAt: expired,
+		SecretType: SecretTypeOAuthToken, OwnerApplication: "gitlab",
+	}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second reader finds the token expired and waits for the key's
+	// lock while the first replaces it.
+	lock, err := first.lockKey("gitlab/glab/token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	type result struct {
+		value []byte
+		err   error
+	}
+	done := make(chan result)
+	go func() {
+		v, err := second.Get("gitlab/glab/token")
+		done <- result{v, err}
+	}()
+	time.Sleep(100 * time.Millisecond)
+	if err := elsewhere(first); err != nil {
+		t.Fatal(err)
+	}
+	_ = lock.Release()
+
+	res := <-done
+	if res.err != nil || string(res.value) != want {
+		t.Errorf("expected the waiting reader to get %q, got %q, %v", want, res.value, res.err)
+	}
+	if rot.n != rotations {
+		t.Errorf("expected %d rotations, got %d", rotations, rot.n)
+	}
+
+	// An expired token nobody else rotated is rotated by its reader.
+	second.Cache = &MockCache{secrets: map[string]Secret{}}
+	if err := first.PutSecret("gitlab/glab/token", Secret{
+		Value: []byte("stale"), CreatedAt: expired.Add(-time.Hour), ExpiresAt: expired,
+		SecretType: SecretTypeOAuthToken, OwnerApplication: "gitlab",
+	}, false); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := second.Get("gitlab/glab/token"); err != nil || string(v) != fmt.Sprintf("token-%d", rotations+1) {
+		t.Errorf("expected a rotation, got %q, %v", v, err)
+	}
+}
@@ -2,14 +2,17 @@ package locksmith
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/bonjoski/locksmith/v2/pkg/native"
 	"github.com/bonjoski/locksmith/v2/pkg/rotator"
+	"github.com/bonjoski/locksmith/v2/pkg/session"
 )
 
 const (
@@ -19,12 +22,24 @@ const (
 )
 
 type Options struct {
+	// RequireBiometrics gates reads and writes behind an authentication
+	// prompt. NewWithOptions also sets it when the vault's
+	// auth.require_biometrics is true.
 	RequireBiometrics bool
 	PromptMessage     string
 	BypassCache       bool
 	// Binary access control
 	AllowBinaries []string
 	DenyBinaries  []string
+	// Backend names a registered backend and overrides LOCKSMITH_BACKEND
+	// and the `backend:` config section. Options from the config still apply.
+	Backend string
+	// Vault selects a named vault and overrides LOCKSMITH_VAULT and
+	// default_vault. Empty means the default vault.
+	Vault string
+	// Writer is recorded as the author of secrets written through this
+	// instance (see Secret.WrittenBy). Defaults to "user:<login name>".
+	Writer string
 }
 
 func (o *Options) getPrompt(defaultPrompt, key string) string {
@@ -59,62 +74,105 @@ type Backend interface {
 type DefaultBackend struct{}
 
 func (b *DefaultBackend) Set(service, account string, data []byte, requireBiometrics bool) error {
-	return native.Set(service, account, data, requireBiometrics)
+	return nativeError(native.Set(service, account, data, requireBiometrics))
 }
 
 func (b *DefaultBackend) Get(service, account string, useBiometrics bool, prompt string) ([]byte, error) {
-	return native.Get(service, account, useBiometrics, prompt)
+	data, err := native.Get(service, account, useBiometrics, prompt)
+	return data, nativeError(err)
 }
 
 func (b *DefaultBackend) Delete(service, account string, useBiometrics bool, prompt string) error {
-	return native.Delete(service, account, useBiometrics, prompt)
+	return nativeError(native.Delete(service, account, useBiometrics, prompt))
 }
 
 func (b *DefaultBackend) List(service string, useBiometrics bool, prompt string) ([]string, error) {
-	return native.List(service, useBiometrics, prompt)
+	keys, err := native.List(service, useBiometrics, prompt)
+	return keys, nativeError(err)
+}
+
+// nativeError maps an unreachable credential store onto
+// ErrBackendUnavailable.
+func nativeError(err error) error {
+	if errors.Is(err, native.ErrUnavailable) {
+		return fmt.Errorf("%w: %w", ErrBackendUnavailable, err)
+	}
+	return err
 }
 
 type Locksmith struct {
 	Service  string
+	Vault    string // Name of the vault Service belongs to
 	Cache    Cache
+	Index    *MetadataIndex // encrypted metadata of every key; nil disables it
+	Session  SessionStore   // the user's session daemon, when it is running
 	Backend  Backend
 	Options  Options
 	Config   *Config // Loaded system configuration
 	Rotators *rotator.HandlerRegistry
+
+	cacheKey *cacheKeyring // nil unless the cache key is kept in the backend
+	lockDir  string        // per-key lock files; empty disables locking
+	vaultsMu sync.Mutex
+	vaults   map[string]*Locksmith // other vaults opened for cross-vault references
 }
 
 func New() (*Locksmith, error) {
-	// Default to NOT requiring biometrics when invoked without options
+	// Biometrics are required only if the vault's auth config says so
 	return NewWithOptions(Options{RequireBiometrics: false})
 }
 
 func NewWithOptions(opts Options) (*Locksmith, error) {
-	// 1. Derive Master Key from platform-specific logic
-	masterKey, err := deriveMasterKey()
-	if err != nil {
-		return nil, fmt.Errorf("failed to derive master key: %w", err)
+	// Load configuration and resolve the selected vault
+	cfg, cfgErr := LoadConfig()
+	if cfgErr != nil {
+		cfg = nil
 	}
-
-	cache, err := NewDiskCache(masterKey)
+	vault, err := ResolveVault(cfg, opts.Vault)
 	if err != nil {
 		return nil, err
 	}
-	ls := NewWithCache(cache)
+
+	ls := NewWithCache(nil)
 	ls.Options = opts
+	ls.Service = vault.Service
+	ls.Vault = vault.Name
+	if ls.Options.PromptMessage == "" {
+		ls.Options.PromptMessage = vault.Auth.PromptMessage
+	}
+	// The vault can require biometrics but not waive a caller's request.
+	ls.Options.RequireBiometrics = opts.RequireBiometrics || vault.Auth.RequireBiometrics
 
-	// Load configuration and populate AccessControl
-	cfg, cfgErr := LoadConfig()
-	if cfgErr == nil && cfg != nil {
+	// Populate AccessControl
+	if cfg != nil {
 		ls.Config = cfg
 		ls.Options.AllowBinaries = cfg.AccessControl.AllowBinaries
 		ls.Options.DenyBinaries = cfg.AccessControl.DenyBinaries
 	}
+
+	backend, err := backendFromConfig(resolveBackendConfig(vault.Backend, opts))
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize backend: %w", err)
+	}
+	ls.Backend = backend
+
+	// The cache and the index are encrypted under keys derived from the
+	// vault's cache key, which is read from the backend when first needed.
+	if err := ls.openCache(vault); err != nil {
+		return nil, err
+	}
+
+	// Share what is read with the other processes of an unlocked session.
+	if client := session.Lookup(); client != nil {
+		ls.Session = client
+	}
 	return ls, nil
 }
 
 func NewWithCache(cache Cache) *Locksmith {
 	ls := &Locksmith{
 		Service:  DefaultService,
+		Vault:    DefaultVaultName,
 		Cache:    cache,
 		Backend:  &DefaultBackend{},
 		Options:  Options{RequireBiometrics: false}, // Default to read-only friendly behavior
@@ -138,6 +196,12 @@ func (l *Locksmith) Get(key string) ([]byte, error) {
 }
 
 func (l *Locksmith) getSecret(key string) (*Secret, error) {
+	if target, resolved, ok, err := l.aliasTarget(key); err != nil {
+		return nil, err
+	} else if ok {
+		return target.getSecret(resolved)
+	}
+
 	secret, err := l.getSecretNoRotate(key)
 	if err != nil {
 		return nil, err
@@ -159,7 +223,20 @@ func (l *Locksmith) getSecret(key string) (*Secret, error) {
 		return secret, nil
 	}
 
-	if err := l.RotateSecret(key); err != nil {
+	// Rotate under the key's lock. A caller that waited while another
+	// process rotated finds the fresh value and does not rotate again,
+	// which would consume the refresh token twice.
+	before, indexed := l.indexEntry(key)
+	lock, err := l.lockKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock '%s' for rotation: %w", key, err)
+	}
+	defer func() { _ = lock.Release() }()
+	if fresh, ok, err := l.rotatedElsewhere(key, secret, before, indexed); err != nil || ok {
+		return fresh, err
+	}
+
+	if err := l.rotateSecret(key); err != nil {
 		errMsg := strings.ToLower(strings.TrimSpace(err.Error()))
 		if strings.Contains(errMsg, "rotation unavailable in this compile profile") {
 			return secret, nil
@@ -191,12 +268,21 @@ func (l *Locksmith) hasRotationRuleForKey(key string) bool {
 }
 
 func (l *Locksmith) getSecretNoRotate(key string) (*Secret, error) {
-	// 1. Check Cache (skip if BypassCache is true)
-	if !l.Options.BypassCache && !l.Cache.IsExpired(key, DefaultCacheTTL) {
-		secret, err := l.Cache.Get(key)
-		if err == nil && secret != nil {
-			return secret, nil
-		}
+	return l.getSecretGated(key, l.Options.RequireBiometrics)
+}
+
+// getSecretGated reads key like getSecretNoRotate, asking the backend for
+// authentication only when useBiometrics is set.
+func (l *Locksmith) getSecretGated(key string, useBiometrics bool) (*Secret, error) {
+	if target, resolved, ok, err := l.aliasTarget(key); err != nil {
+		return nil, err
+	} else if ok {
+		return target.getSecretGated(resolved, useBiometrics)
+	}
+
+	// 1. Check Cache (skip if BypassCache is true or the key is not cached)
+	if secret := l.cachedSecret(key); secret != nil {
+		return secret, nil
 	}
 
 	// 1b. Binary whitelisting enforcement (moved to helper)
@@ -204,11 +290,28 @@ func (l *Locksmith) getSecretNoRotate(key string) (*Secret, error) {
 		return nil, err
 	}
 
-	// 2. Fallback to Keychain (triggers biometric prompt if required)
-	prompt := l.Options.getPrompt("Authentication required to access '%s'", key)
-	data, err := l.Backend.Get(l.Service, key, l.Options.RequireBiometrics, prompt)
-	if err != nil {
-		return nil, err
+	// 1c. An unlocked session daemon holds what was read since unlocking
+	data, held := l.sessionGet(key)
+	if !held {
+		// 2. Fallback to Keychain (triggers biometric prompt if required)
+		prompt := l.Options.getPrompt("Authentication required to access '%s'", key)
+		var err error
+		data, err = l.Backend.Get(l.Service, key, useBiometrics, prompt)
+		if err != nil {
+			// 2b. Serve the last cached copy, however old but not past its
+			// expiry, while a remote backend is unreachable.
+			if errors.Is(err, ErrBackendUnavailable) && !l.Options.BypassCache {
+				if secret := l.staleCachedSecret(key); secret != nil {
+					warnOffline(key, err)
+					return secret, nil
+				}
+			}
+			return nil, err
+		}
+		l.sessionPut(key, data)
+	}
+	if len(data) == 0 {
+		return nil, ErrNotFound
 	}
 	defer func() {
 		for i := range data {
@@ -223,12 +326,26 @@ func (l *Locksmith) getSecretNoRotate(key string) (*Secret, error) {
 
 	// 3. Update Cache for subsequent calls (skip if BypassCache is true)
 	if !l.Options.BypassCache {
-		_ = l.Cache.Set(key, secret, DefaultCacheTTL)
+		_ = l.cacheSet(key, secret)
+	}
+	// Index keys written before the index existed, or by other tools.
+	// History versions and the master key are not listed, so stay out.
+	if !isInternalKey(key) {
+		_ = l.Index.Put(key, metadataOf(secret))
 	}
 
 	return &secret, nil
 }
 
+// warnOffline reports a cached read served while the backend is unreachable,
+// unless LOCKSMITH_SILENT is set.
+func warnOffline(key string, err error) {
+	if os.Getenv("LOCKSMITH_SILENT") == "true" {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Warning: using cached copy of '%s': %v\n", key, err)
+}
+
 func (l *Locksmith) List() (map[string]SecretMetadata, error) {
 	// ... existing List implementation ...
 	// Binary whitelisting enforcement before listing
@@ -257,21 +374,21 @@ func (l *Locksmith) List() (map[string]SecretMetadata, error) {
 	}
 
 	prompt := l.Options.getPrompt("Authentication required to list secrets", "")
-	keys, err := l.Backend.List(l.Service, l.Options.RequireBiometrics, prompt)
+	keys, backendMeta, err := l.backendListMetadata(l.Options.RequireBiometrics, prompt)
 	if err != nil {
 		return nil, err
 	}
 
 	result := make(map[string]SecretMetadata)
 	for _, key := range keys {
-		// Filter out the internal master key
-		if key == MasterKeyAccount {
+		// Filter out the internal master key and version history
+		if isInternalKey(key) {
 			continue
 		}
 
-		// To list metadata, we technically need to READ the item, which requires biometrics…
-		// For now, let's just return what we have (the keys).
-		result[key] = SecretMetadata{}
+		// Reading full metadata would require reading the item (and biometrics);
+		// return whatever the backend stored as item attributes.
+		result[key] = backendMeta[key]
 	}
 	return result, nil
 }
@@ -295,7 +412,7 @@ func (l *Locksmith) ListKeyNames() ([]string, error) {
 
 	result := make([]string, 0, len(keys))
 	for _, key := range keys {
-		if key == MasterKeyAccount {
+		if isInternalKey(key) {
 			continue
 		}
 		result = append(result, key)
@@ -313,15 +430,21 @@ func (l *Locksmith) GetWithMetadata(key string) (*Secret, error) {
 // ListWithMetadata returns all secrets with their metadata
 func (l *Locksmith) ListWithMetadata() (map[string]*SecretMetadata, error) {
 	prompt := l.Options.getPrompt("Authentication required to list secrets", "")
-	keys, err := l.Backend.List(l.Service, l.Options.RequireBiometrics, prompt)
+	keys, backendMeta, err := l.backendListMetadata(l.Options.RequireBiometrics, prompt)
 	if err != nil {
 		return nil, err
 	}
 
+	// A corrupt or unreadable index only costs accuracy.
+	indexed, err := l.Index.Load()
+	if err != nil {
+		warnIndex(err)
+	}
+
 	result := make(map[string]*SecretMetadata)
 	for _, key := range keys {
-		// Filter out the internal master key
-		if key == MasterKeyAccount {
+		// Filter out the internal master key and version history
+		if isInternalKey(key) {
 			continue
 		}
 
@@ -331,17 +454,16 @@ func (l *Locksmith) ListWithMetadata() (map[string]*SecretMetadata, error) {
 			cached, _ = l.Cache.Get(key)
 		}
 		if cached != nil {
-			result[key] = &SecretMetadata{
-				CreatedAt:        cached.CreatedAt,
-				ExpiresAt:        cached.ExpiresAt,
-				SecretType:       cached.SecretType,
-				OwnerApplication: cached.OwnerApplication,
-				SourceURL:        cached.SourceURL,
-				Metadata:         cached.Metadata,
-			}
+			meta := metadataOf(*cached)
+			result[key] = &meta
+		} else if meta, ok := indexed[key]; ok {
+			result[key] = &meta
+		} else if meta, ok := backendMeta[key]; ok {
+			// Metadata stored as item attributes by the backend
+			result[key] = &meta
 		} else {
-			// If not in cache, we'd need to read from keychain
-			// For now, return empty metadata
+			// Reading the item itself would require authentication,
+			// so return empty metadata
 			result[key] = &SecretMetadata{}
 		}
 	}
@@ -10,7 +10,10 @@ import (
 	"strings"
 )
 
-func deriveMasterKey() ([]byte, error) {
+// legacyMasterKey returns the machine-derived key earlier versions encrypted
+// the cache and the metadata index with; it is only read to migrate them to
+// a cache key (see migrateLegacyCacheKey).
+func legacyMasterKey() ([]byte, error) {
 	// Get Hardware UUID via ioreg
 	// ioreg -d2 -c IOPlatformExpertDevice | awk -F\" '/IOPlatformUUID/ {print $(NF-1)}'
 	cmd := exec.Command("ioreg", "-d2", "-c", "IOPlatformExpertDevice")
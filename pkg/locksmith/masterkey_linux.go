@@ -10,7 +10,10 @@ import (
 	"strings"
 )
 
-func deriveMasterKey() ([]byte, error) {
+// legacyMasterKey returns the machine-derived key earlier versions encrypted
+// the cache and the metadata index with; it is only read to migrate them to
+// a cache key (see migrateLegacyCacheKey).
+func legacyMasterKey() ([]byte, error) {
 	// Try standard systemd machine-id paths
 	paths := []string{
 		"/etc/machine-id",
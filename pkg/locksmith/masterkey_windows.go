@@ -10,7 +10,10 @@ import (
 	"golang.org/x/sys/windows/registry"
 )
 
-func deriveMasterKey() ([]byte, error) {
+// legacyMasterKey returns the machine-derived key earlier versions encrypted
+// the cache and the metadata index with; it is only read to migrate them to
+// a cache key (see migrateLegacyCacheKey).
+func legacyMasterKey() ([]byte, error) {
 	// Read MachineGuid from HKLM\SOFTWARE\Microsoft\Cryptography
 	k, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Cryptography`, registry.QUERY_VALUE)
 	if err != nil {
@@ -0,0 +1,247 @@
+package locksmith
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bonjoski/locksmith/v2/pkg/native"
+)
+
+// MetadataBackend is implemented by backends that can store SecretMetadata
+// next to each item in a form that can be listed without reading (and
+// therefore without authenticating for) the secret values themselves.
+type MetadataBackend interface {
+	Backend
+	SetWithMetadata(service, account string, data []byte, meta SecretMetadata, requireBiometrics bool) error
+	// ListMetadata returns account -> metadata for every item under service.
+	// Backends that cannot honour the request return ErrMetadataUnsupported.
+	ListMetadata(service string, useBiometrics bool, prompt string) (map[string]SecretMetadata, error)
+}
+
+// ErrMetadataUnsupported is returned by MetadataBackend.ListMetadata when
+// the underlying store cannot list item metadata.
+var ErrMetadataUnsupported = errors.New("backend does not support listing metadata")
+
+// Item attribute names used to persist SecretMetadata alongside native items.
+const (
+	attrCreatedAt        = "locksmith.created_at"
+	attrExpiresAt        = "locksmith.expires_at"
+	attrSecretType       = "locksmith.secret_type"
+	attrOwnerApplication = "locksmith.owner_application"
+	attrSourceURL        = "locksmith.source_url"
+	attrVersion          = "locksmith.version"
+	attrWrittenBy        = "locksmith.written_by"
+	attrTags             = "locksmith.tags"
+	attrDescription      = "locksmith.description"
+	attrKind             = "locksmith.kind"
+	attrMetadataPrefix   = "locksmith.meta."
+)
+
+func (b *DefaultBackend) SetWithMetadata(service, account string, data []byte, meta SecretMetadata, requireBiometrics bool) error {
+	return nativeError(native.SetWithAttributes(service, account, data, keychainAttributes(meta), requireBiometrics))
+}
+
+// partialMetadata reports that ListMetadata returns only the fields kept by
+// keychainAttributes.
+func (b *DefaultBackend) partialMetadata() bool {
+	return true
+}
+
+func (b *DefaultBackend) ListMetadata(service string, useBiometrics bool, prompt string) (map[string]SecretMetadata, error) {
+	items, err := native.ListAttributes(service, useBiometrics, prompt)
+	if err != nil {
+		if errors.Is(err, native.ErrAttributesUnsupported) {
+			return nil, ErrMetadataUnsupported
+		}
+		return nil, nativeError(err)
+	}
+	result := make(map[string]SecretMetadata, len(items))
+	for account, attrs := range items {
+		result[account] = attributesToMetadata(attrs)
+	}
+	return result, nil
+}
+
+// partialMetadataBackend is implemented by metadata backends whose
+// ListMetadata leaves out fields that only the secret itself (or the
+// metadata index) holds.
+type partialMetadataBackend interface {
+	partialMetadata() bool
+}
+
+// listsPartialMetadata reports whether b lists incomplete metadata.
+func listsPartialMetadata(b Backend) bool {
+	p, ok := b.(partialMetadataBackend)
+	return ok && p.partialMetadata()
+}
+
+// keychainAttributes returns the attributes stored on native keychain
+// items: creation, expiry, type and owner. Secret Service attributes can be
+// read by any D-Bus client without unlocking the collection, so the other
+// fields stay inside the encrypted item and the metadata index.
+func keychainAttributes(meta SecretMetadata) map[string]string {
+	attrs := metadataToAttributes(meta)
+	for k := range attrs {
+		switch k {
+		case attrCreatedAt, attrExpiresAt, attrSecretType, attrOwnerApplication:
+		default:
+			delete(attrs, k)
+		}
+	}
+	return attrs
+}
+
+// metadataToAttributes flattens meta into string attributes, for backends
+// that keep them as private as the value. Zero values are omitted.
+func metadataToAttributes(meta SecretMetadata) map[string]string {
+	attrs := make(map[string]string)
+	if !meta.CreatedAt.IsZero() {
+		attrs[attrCreatedAt] = meta.CreatedAt.UTC().Format(time.RFC3339)
+	}
+	if !meta.ExpiresAt.IsZero() {
+		attrs[attrExpiresAt] = meta.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	if meta.SecretType != "" {
+		attrs[attrSecretType] = string(meta.SecretType)
+	}
+	if meta.OwnerApplication != "" {
+		attrs[attrOwnerApplication] = meta.OwnerApplication
+	}
+	if meta.SourceURL != "" {
+		attrs[attrSourceURL] = meta.SourceURL
+	}
+	if meta.Version > 0 {
+		attrs[attrVersion] = strconv.Itoa(meta.Version)
+	}
+	if meta.WrittenBy != "" {
+		attrs[attrWrittenBy] = meta.WrittenBy
+	}
+	if len(meta.Tags) > 0 {
+		attrs[attrTags] = strings.Join(meta.Tags, ",")
+	}
+	if meta.Description != "" {
+		attrs[attrDescription] = meta.Description
+	}
+	if meta.Kind != "" {
+		attrs[attrKind] = string(meta.Kind)
+	}
+	for k, v := range meta.Metadata {
+		attrs[attrMetadataPrefix+k] = v
+	}
+	return attrs
+}
+
+// attributesToMetadata is the inverse of metadataToAttributes. Attributes
+// not written by locksmith are ignored.
+func attributesToMetadata(attrs map[string]string) SecretMetadata {
+	var meta SecretMetadata
+	if t, err := time.Parse(time.RFC3339, attrs[attrCreatedAt]); err == nil {
+		meta.CreatedAt = t
+	}
+	if t, err := time.Parse(time.RFC3339, attrs[attrExpiresAt]); err == nil {
+		meta.ExpiresAt = t
+	}
+	if v := attrs[attrSecretType]; v != "" {
+		meta.SecretType = NormalizeSecretType(SecretType(v))
+	}
+	meta.OwnerApplication = attrs[attrOwnerApplication]
+	meta.SourceURL = attrs[attrSourceURL]
+	if v, err := strconv.Atoi(attrs[attrVersion]); err == nil && v > 0 {
+		meta.Version = v
+	}
+	meta.WrittenBy = attrs[attrWrittenBy]
+	if v := attrs[attrTags]; v != "" {
+		meta.Tags = strings.Split(v, ",")
+	}
+	meta.Description = attrs[attrDescription]
+	meta.Kind = SecretKind(attrs[attrKind])
+	for k, v := range attrs {
+		if strings.HasPrefix(k, attrMetadataPrefix) {
+			if meta.Metadata == nil {
+				meta.Metadata = make(map[string]string)
+			}
+			meta.Metadata[strings.TrimPrefix(k, attrMetadataPrefix)] = v
+		}
+	}
+	return meta
+}
+
+// metadataOf returns the listable metadata of secret.
+func metadataOf(secret Secret) SecretMetadata {
+	return SecretMetadata{
+		CreatedAt:        secret.CreatedAt,
+		ExpiresAt:        secret.ExpiresAt,
+		SecretType:       secret.SecretType,
+		OwnerApplication: secret.OwnerApplication,
+		SourceURL:        secret.SourceURL,
+		Metadata:         secret.Metadata,
+		Version:          secret.Version,
+		WrittenBy:        secret.WrittenBy,
+		Tags:             secret.Tags,
+		Description:      secret.Description,
+		Kind:             secret.Kind,
+	}
+}
+
+// secretFromMetadata is the inverse of metadataOf, for backends that store
+// the value and its metadata separately.
+func secretFromMetadata(value []byte, meta SecretMetadata) Secret {
+	return Secret{
+		Value:            value,
+		CreatedAt:        meta.CreatedAt,
+		ExpiresAt:        meta.ExpiresAt,
+		SecretType:       meta.SecretType,
+		OwnerApplication: meta.OwnerApplication,
+		SourceURL:        meta.SourceURL,
+		Metadata:         meta.Metadata,
+		Version:          meta.Version,
+		WrittenBy:        meta.WrittenBy,
+		Tags:             meta.Tags,
+		Description:      meta.Description,
+		Kind:             meta.Kind,
+	}
+}
+
+// backendSet writes the marshalled secret to the backend, recording its
+// metadata as item attributes when the backend supports it, and drops the
+// previous value from the session daemon.
+func (l *Locksmith) backendSet(key string, data []byte, secret Secret, requireBiometrics bool) error {
+	if err := setWithMetadata(l.Backend, l.Service, key, data, metadataOf(secret), requireBiometrics); err != nil {
+		return err
+	}
+	l.sessionForget(key)
+	return nil
+}
+
+// setWithMetadata writes through SetWithMetadata when b supports it.
+func setWithMetadata(b Backend, service, account string, data []byte, meta SecretMetadata, requireBiometrics bool) error {
+	if mb, ok := b.(MetadataBackend); ok {
+		return mb.SetWithMetadata(service, account, data, meta, requireBiometrics)
+	}
+	return b.Set(service, account, data, requireBiometrics)
+}
+
+// backendListMetadata lists keys together with whatever metadata the
+// backend can provide without reading secret values. The metadata map is
+// nil when the backend cannot list metadata.
+func (l *Locksmith) backendListMetadata(useBiometrics bool, prompt string) ([]string, map[string]SecretMetadata, error) {
+	if mb, ok := l.Backend.(MetadataBackend); ok {
+		meta, err := mb.ListMetadata(l.Service, useBiometrics, prompt)
+		if err == nil {
+			keys := make([]string, 0, len(meta))
+			for k := range meta {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			return keys, meta, nil
+		}
+		if !errors.Is(err, ErrMetadataUnsupported) {
+			return nil, nil, err
+		}
+	}
+	keys, err := l.Backend.List(l.Service, useBiometrics, prompt)
+	return keys, nil, err
+}
@@ -0,0 +1,141 @@
+package locksmith
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// attrBackend is an in-memory MetadataBackend that keeps metadata as
+// string attributes, the way the Secret Service bridge does.
+type attrBackend struct {
+	data  map[string][]byte
+	attrs map[string]map[string]string
+}
+
+func newAttrBackend() *attrBackend {
+	return &attrBackend{data: map[string][]byte{}, attrs: map[string]map[string]string{}}
+}
+
+func (b *attrBackend) Set(service, account string, data []byte, requireBiometrics bool) error {
+	return b.SetWithMetadata(service, account, data, SecretMetadata{}, requireBiometrics)
+}
+
+func (b *attrBackend) SetWithMetadata(service, account string, data []byte, meta SecretMetadata, requireBiometrics bool) error {
+	b.data[account] = append([]byte(nil), data...)
+	b.attrs[account] = metadataToAttributes(meta)
+	return nil
+}
+
+func (b *attrBackend) Get(service, account string, useBiometrics bool, prompt string) ([]byte, error) {
+	data, ok := b.data[account]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (b *attrBackend) Delete(service, account string, useBiometrics bool, prompt string) error {
+	delete(b.data, account)
+	delete(b.attrs, account)
+	return nil
+}
+
+func (b *attrBackend) List(service string, useBiometrics bool, prompt string) ([]string, error) {
+	keys := make([]string, 0, len(b.data))
+	for k := range b.data {
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+func (b *attrBackend) ListMetadata(service string, useBiometrics bool, prompt string) (map[string]SecretMetadata, error) {
+	out := make(map[string]SecretMetadata, len(b.attrs))
+	for k, a := range b.attrs {
+		out[k] = attributesToMetadata(a)
+	}
+	return out, nil
+}
+
+func TestMetadataAttributesRoundTrip(t *testing.T) {
+	meta := SecretMetadata{
+		CreatedAt:        time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		ExpiresAt:        time.Date(2027, 1, 2, 3, 4, 5, 0, time.UTC),
+		SecretType:       SecretTypeAPIKey,
+		OwnerApplication: "ci",
+		SourceURL:        "https://example.com/tokens",
+		Metadata:         map[string]string{"team": "infra"},
+	}
+
+	attrs := metadataToAttributes(meta)
+	if attrs[attrExpiresAt] != "2027-01-02T03:04:05Z" {
+		t.Fatalf("unexpected expires_at attribute %q", attrs[attrExpiresAt])
+	}
+	if got := attributesToMetadata(attrs); !reflect.DeepEqual(got, meta) {
+		t.Fatalf("round trip mismatch:\n got %+v\nwant %+v", got, meta)
+	}
+
+	if attrs := metadataToAttributes(SecretMetadata{}); len(attrs) != 0 {
+		t.Fatalf("zero metadata should produce no attributes, got %v", attrs)
+	}
+}
+
+func TestKeychainAttributesOmitPrivateFields(t *testing.T) {
+	meta := SecretMetadata{
+		CreatedAt:        time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		ExpiresAt:        time.Date(2027, 1, 2, 3, 4, 5, 0, time.UTC),
+		SecretType:       SecretTypeAPIKey,
+		OwnerApplication: "ci",
+		SourceURL:        "https://example.com/tokens",
+		Description:      "deploy key",
+		Tags:             []string{"prod"},
+		WrittenBy:        "cli",
+		Kind:             SecretKindFields,
+		Metadata:         map[string]string{"team": "infra"},
+	}
+	want := SecretMetadata{
+		CreatedAt:        meta.CreatedAt,
+		ExpiresAt:        meta.ExpiresAt,
+		SecretType:       meta.SecretType,
+		OwnerApplication: meta.OwnerApplication,
+	}
+	attrs := keychainAttributes(meta)
+	if len(attrs) != 4 {
+		t.Errorf("expected only the four listable attributes, got %v", attrs)
+	}
+	if got := attributesToMetadata(attrs); !reflect.DeepEqual(got, want) {
+		t.Errorf("keychain attributes = %+v, want %+v", got, want)
+	}
+}
+
+func TestListWithMetadataFromBackendAttributes(t *testing.T) {
+	backend := newAttrBackend()
+	ls := &Locksmith{Service: DefaultService, Cache: &MockCache{secrets: map[string]Secret{}}, Backend: backend}
+
+	expires := time.Now().Add(48 * time.Hour).UTC().Truncate(time.Second)
+	if err := ls.SetWithContext("api", []byte("value"), expires, false, SecretTypeAPIKey, "ci", "", nil); err != nil {
+		t.Fatalf("SetWithContext: %v", err)
+	}
+	if backend.attrs["api"][attrSecretType] != string(SecretTypeAPIKey) {
+		t.Fatalf("backend attributes not written: %v", backend.attrs["api"])
+	}
+
+	// Without a cache entry the metadata must come from the attributes.
+	_ = ls.Cache.Delete("api")
+	listed, err := ls.ListWithMetadata()
+	if err != nil {
+		t.Fatalf("ListWithMetadata: %v", err)
+	}
+	meta := listed["api"]
+	if meta == nil || !meta.ExpiresAt.Equal(expires) || meta.OwnerApplication != "ci" {
+		t.Fatalf("unexpected metadata %+v", meta)
+	}
+
+	plain, err := ls.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if plain["api"].SecretType != SecretTypeAPIKey {
+		t.Fatalf("List metadata = %+v", plain["api"])
+	}
+}
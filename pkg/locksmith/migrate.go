@@ -0,0 +1,208 @@
+package locksmith
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ConflictPolicy decides what MigrateSecrets does when a key already exists
+// in the target backend.
+type ConflictPolicy string
+
+const (
+	ConflictSkip      ConflictPolicy = "skip"
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	ConflictRename    ConflictPolicy = "rename"
+)
+
+// ParseConflictPolicy parses a --conflict value; empty means skip.
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch p := ConflictPolicy(strings.ToLower(strings.TrimSpace(s))); p {
+	case "":
+		return ConflictSkip, nil
+	case ConflictSkip, ConflictOverwrite, ConflictRename:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown conflict policy '%s' (supported: skip, overwrite, rename)", s)
+	}
+}
+
+// MigrateAction is the outcome of migrating a single key.
+type MigrateAction string
+
+const (
+	MigrateCopied      MigrateAction = "copied"
+	MigrateOverwritten MigrateAction = "overwritten"
+	MigrateRenamed     MigrateAction = "renamed"
+	MigrateSkipped     MigrateAction = "skipped"
+	MigrateFailed      MigrateAction = "failed"
+)
+
+// MigrateOptions configures MigrateSecrets.
+type MigrateOptions struct {
+	Service  string
+	Conflict ConflictPolicy
+	// DryRun reports what would happen without writing or deleting anything.
+	DryRun bool
+	// DeleteSource removes each key from the source once its copy has been
+	// read back from the target and verified.
+	DeleteSource  bool
+	UseBiometrics bool
+	Prompt        string
+	// Progress, when set, is called after each key is processed.
+	Progress func(MigrateResult)
+}
+
+// MigrateResult describes what happened to one key.
+type MigrateResult struct {
+	Key string
+	// TargetKey differs from Key when the conflict policy renamed it.
+	TargetKey     string
+	Action        MigrateAction
+	SourceDeleted bool
+	Err           error
+}
+
+// MigrateSecrets copies every secret of opts.Service from one backend to
+// another. Items are copied verbatim, so CreatedAt, ExpiresAt, SecretType,
+// OwnerApplication, SourceURL and Metadata are preserved; each copy is read
+// back and compared before the source is (optionally) deleted. The cache
+// master key is never migrated.
+func MigrateSecrets(from, to Backend, opts MigrateOptions) ([]MigrateResult, error) {
+	if opts.Service == "" {
+		opts.Service = DefaultService
+	}
+	if opts.Conflict == "" {
+		opts.Conflict = ConflictSkip
+	}
+
+	keys, err := from.List(opts.Service, opts.UseBiometrics, opts.Prompt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list source backend: %w", err)
+	}
+	keys = withoutKey(keys, MasterKeyAccount)
+	sort.Strings(keys)
+
+	existing, err := to.List(opts.Service, opts.UseBiometrics, opts.Prompt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list target backend: %w", err)
+	}
+	taken := make(map[string]bool, len(existing))
+	for _, k := range existing {
+		taken[k] = true
+	}
+
+	results := make([]MigrateResult, 0, len(keys))
+	for _, key := range keys {
+		res := migrateOne(from, to, key, taken, opts)
+		if res.Action != MigrateSkipped && res.Action != MigrateFailed {
+			taken[res.TargetKey] = true
+		}
+		results = append(results, res)
+		if opts.Progress != nil {
+			opts.Progress(res)
+		}
+	}
+	return results, nil
+}
+
+func migrateOne(from, to Backend, key string, taken map[string]bool, opts MigrateOptions) MigrateResult {
+	res := MigrateResult{Key: key, TargetKey: key, Action: MigrateCopied}
+	if taken[key] {
+		switch opts.Conflict {
+		case ConflictOverwrite:
+			res.Action = MigrateOverwritten
+		case ConflictRename:
+			res.Action = MigrateRenamed
+			res.TargetKey = renamedKey(key, "migrated", taken)
+		default:
+			res.Action = MigrateSkipped
+			return res
+		}
+	}
+	if opts.DryRun {
+		res.SourceDeleted = opts.DeleteSource
+		return res
+	}
+
+	fail := func(err error) MigrateResult {
+		res.Action = MigrateFailed
+		res.Err = err
+		return res
+	}
+
+	data, err := from.Get(opts.Service, key, opts.UseBiometrics, opts.Prompt)
+	if err != nil {
+		return fail(fmt.Errorf("read from source: %w", err))
+	}
+	defer zeroBytes(data)
+
+	if err := setDecoded(to, opts.Service, res.TargetKey, data, opts.UseBiometrics); err != nil {
+		return fail(fmt.Errorf("write to target: %w", err))
+	}
+
+	written, err := to.Get(opts.Service, res.TargetKey, opts.UseBiometrics, opts.Prompt)
+	if err != nil {
+		return fail(fmt.Errorf("verify: %w", err))
+	}
+	defer zeroBytes(written)
+	if !sameSecret(data, written) {
+		return fail(fmt.Errorf("verify: target content does not match source"))
+	}
+
+	if opts.DeleteSource {
+		if err := from.Delete(opts.Service, key, opts.UseBiometrics, opts.Prompt); err != nil {
+			res.Err = fmt.Errorf("copied, but failed to delete from source: %w", err)
+			return res
+		}
+		res.SourceDeleted = true
+	}
+	return res
+}
+
+// sameSecret reports whether two serialized secrets hold the same value and
+// metadata. Backends that rebuild secrets from item attributes do not
+// reproduce the serialized form byte for byte (RFC 3339 timestamps drop
+// the nanoseconds), so both sides are decoded and compared with times
+// truncated to seconds. Data that does not decode as a secret is compared
+// as is.
+func sameSecret(a, b []byte) bool {
+	var sa, sb Secret
+	if json.Unmarshal(a, &sa) != nil || json.Unmarshal(b, &sb) != nil {
+		return bytes.Equal(a, b)
+	}
+	defer zeroBytes(sa.Value)
+	defer zeroBytes(sb.Value)
+	return bytes.Equal(sa.Value, sb.Value) && reflect.DeepEqual(comparableMetadata(sa), comparableMetadata(sb))
+}
+
+// comparableMetadata returns the metadata of s in the precision every
+// backend preserves.
+func comparableMetadata(s Secret) SecretMetadata {
+	meta := metadataOf(s)
+	meta.CreatedAt = meta.CreatedAt.Truncate(time.Second).UTC()
+	meta.ExpiresAt = meta.ExpiresAt.Truncate(time.Second).UTC()
+	meta.SecretType = NormalizeSecretType(meta.SecretType)
+	if len(meta.Metadata) == 0 {
+		meta.Metadata = nil
+	}
+	if len(meta.Tags) == 0 {
+		meta.Tags = nil
+	}
+	return meta
+}
+
+// renamedKey returns key with the first free "."+suffix suffix, e.g.
+// key.migrated, key.migrated-2.
+func renamedKey(key, suffix string, taken map[string]bool) string {
+	candidate := key + "." + suffix
+	for i := 2; taken[candidate]; i++ {
+		candidate = fmt.Sprintf("%s.%s-%d", key, suffix, i)
+	}
+	return candidate
+}
@@ -0,0 +1,208 @@
+package locksmith
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// corruptingBackend stores something other than what it was given.
+type corruptingBackend struct{ *attrBackend }
+
+func (c corruptingBackend) Set(service, account string, data []byte, requireBiometrics bool) error {
+	return c.attrBackend.Set(service, account, []byte("garbage"), requireBiometrics)
+}
+
+func (c corruptingBackend) SetWithMetadata(service, account string, data []byte, meta SecretMetadata, requireBiometrics bool) error {
+	return c.Set(service, account, data, requireBiometrics)
+}
+
+// rebuildingBackend keeps the value and the metadata attributes apart and
+// rebuilds the secret on reads, as the Vault KV backend does.
+type rebuildingBackend struct{ *attrBackend }
+
+func (r rebuildingBackend) Set(service, account string, data []byte, requireBiometrics bool) error {
+	return setDecoded(r, service, account, data, requireBiometrics)
+}
+
+func (r rebuildingBackend) SetWithMetadata(service, account string, data []byte, meta SecretMetadata, requireBiometrics bool) error {
+	var secret Secret
+	if err := json.Unmarshal(data, &secret); err != nil {
+		return err
+	}
+	return r.attrBackend.SetWithMetadata(service, account, secret.Value, meta, requireBiometrics)
+}
+
+func (r rebuildingBackend) Get(service, account string, useBiometrics bool, prompt string) ([]byte, error) {
+	value, err := r.attrBackend.Get(service, account, useBiometrics, prompt)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(secretFromMetadata(value, attributesToMetadata(r.attrs[account])))
+}
+
+func seedMigrationSource(t *testing.T) (*attrBackend, []byte) {
+	t.Helper()
+	src := newAttrBackend()
+	secret := Secret{
+		Value:            []byte("token"),
+		CreatedAt:        time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC),
+		ExpiresAt:        time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC),
+		SecretType:       SecretTypeToken,
+		OwnerApplication: "github",
+		SourceURL:        "https://example.com",
+		Metadata:         map[string]string{"env": "prod"},
+	}
+	data, err := json.Marshal(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = src.Set("svc", "a", data, false)
+	_ = src.Set("svc", "b", data, false)
+	_ = src.Set("svc", MasterKeyAccount, []byte("mk"), false)
+	return src, data
+}
+
+func TestMigrateSecretsCopiesVerbatim(t *testing.T) {
+	src, data := seedMigrationSource(t)
+	dst := newAttrBackend()
+
+	var progress []string
+	results, err := MigrateSecrets(src, dst, MigrateOptions{
+		Service:  "svc",
+		Progress: func(r MigrateResult) { progress = append(progress, r.Key) },
+	})
+	if err != nil {
+		t.Fatalf("MigrateSecrets: %v", err)
+	}
+	if !reflect.DeepEqual(progress, []string{"a", "b"}) {
+		t.Errorf("progress = %v (master key must not be migrated)", progress)
+	}
+	for _, r := range results {
+		if r.Action != MigrateCopied || r.Err != nil || r.SourceDeleted {
+			t.Errorf("unexpected result %+v", r)
+		}
+	}
+	if string(dst.data["a"]) != string(data) {
+		t.Error("secret not copied verbatim")
+	}
+	if got := attributesToMetadata(dst.attrs["a"]); got.OwnerApplication != "github" || got.Metadata["env"] != "prod" {
+		t.Errorf("metadata not carried to target attributes: %+v", got)
+	}
+	if _, ok := src.data["a"]; !ok {
+		t.Error("source should be kept without DeleteSource")
+	}
+}
+
+func TestMigrateSecretsConflictPolicies(t *testing.T) {
+	for _, tc := range []struct {
+		policy ConflictPolicy
+		action MigrateAction
+		target string
+		dstA   string
+	}{
+		{ConflictSkip, MigrateSkipped, "a", "existing"},
+		{ConflictOverwrite, MigrateOverwritten, "a", "source"},
+		{ConflictRename, MigrateRenamed, "a.migrated-2", "existing"},
+	} {
+		t.Run(string(tc.policy), func(t *testing.T) {
+			src, dst := newAttrBackend(), newAttrBackend()
+			_ = src.Set("svc", "a", []byte("source"), false)
+			_ = dst.Set("svc", "a", []byte("existing"), false)
+			_ = dst.Set("svc", "a.migrated", []byte("earlier"), false)
+
+			results, err := MigrateSecrets(src, dst, MigrateOptions{Service: "svc", Conflict: tc.policy})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != 1 || results[0].Action != tc.action || results[0].TargetKey != tc.target {
+				t.Fatalf("results = %+v", results)
+			}
+			if string(dst.data["a"]) != tc.dstA {
+				t.Errorf("target a = %q, want %q", dst.data["a"], tc.dstA)
+			}
+			if tc.policy == ConflictRename && string(dst.data[tc.target]) != "source" {
+				t.Errorf("renamed copy missing")
+			}
+		})
+	}
+}
+
+func TestMigrateSecretsDryRunAndDeleteSource(t *testing.T) {
+	src, _ := seedMigrationSource(t)
+	dst := newAttrBackend()
+
+	results, err := MigrateSecrets(src, dst, MigrateOptions{Service: "svc", DryRun: true, DeleteSource: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || len(dst.data) != 0 || len(src.data) != 3 {
+		t.Fatalf("dry run changed state: results=%+v dst=%v", results, dst.data)
+	}
+
+	if _, err := MigrateSecrets(src, dst, MigrateOptions{Service: "svc", DeleteSource: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := src.data["a"]; ok {
+		t.Error("source key should be deleted after verified copy")
+	}
+	if _, ok := src.data[MasterKeyAccount]; !ok {
+		t.Error("master key must stay in the source")
+	}
+}
+
+func TestMigrateSecretsVerifyFailureKeepsSource(t *testing.T) {
+	src, _ := seedMigrationSource(t)
+	dst := corruptingBackend{newAttrBackend()}
+
+	results, err := MigrateSecrets(src, dst, MigrateOptions{Service: "svc", DeleteSource: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if r.Action != MigrateFailed || r.Err == nil || r.SourceDeleted {
+			t.Errorf("expected verify failure, got %+v", r)
+		}
+	}
+	if _, ok := src.data["a"]; !ok {
+		t.Error("source must be kept when verification fails")
+	}
+}
+
+func TestMigrateSecretsToRebuildingBackend(t *testing.T) {
+	src := newAttrBackend()
+	data, _ := json.Marshal(Secret{
+		Value:            []byte("token"),
+		CreatedAt:        time.Date(2025, 5, 1, 0, 0, 0, 123456789, time.UTC),
+		ExpiresAt:        time.Date(2026, 5, 1, 0, 0, 0, 987654321, time.UTC),
+		OwnerApplication: "github",
+		Tags:             []string{},
+	})
+	_ = src.Set("svc", "a", data, false)
+
+	results, err := MigrateSecrets(src, rebuildingBackend{newAttrBackend()}, MigrateOptions{Service: "svc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Action != MigrateCopied || results[0].Err != nil {
+		t.Errorf("expected sub-second timestamps not to fail verification, got %+v", results)
+	}
+
+	changed, _ := json.Marshal(Secret{Value: []byte("token"), CreatedAt: time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC), OwnerApplication: "gitlab"})
+	if sameSecret(data, changed) {
+		t.Error("secrets with different metadata must not compare equal")
+	}
+}
+
+func TestParseConflictPolicy(t *testing.T) {
+	if p, err := ParseConflictPolicy(""); err != nil || p != ConflictSkip {
+		t.Errorf("default = %q, %v", p, err)
+	}
+	if p, err := ParseConflictPolicy("Rename"); err != nil || p != ConflictRename {
+		t.Errorf("Rename = %q, %v", p, err)
+	}
+	if _, err := ParseConflictPolicy("merge"); err == nil {
+		t.Error("expected error for unknown policy")
+	}
+}
@@ -3,7 +3,6 @@
 package locksmith
 
 import (
-	"errors"
 	"sync"
 )
 
@@ -34,7 +33,7 @@ func (m *MockBackend) Get(service, account string, useBiometrics bool, prompt st
 	defer m.mu.RUnlock()
 	data, ok := m.store[key]
 	if !ok {
-		return nil, errors.New("key not found")
+		return nil, ErrNotFound
 	}
 	copyData := make([]byte, len(data))
 	copy(copyData, data)
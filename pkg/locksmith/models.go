@@ -1,6 +1,8 @@
 package locksmith
 
 import (
+	"fmt"
+	"sort"
 	"strings"
 	"time"
 )
@@ -43,6 +45,18 @@ type Secret struct {
 	OwnerApplication string            `json:"owner_application,omitempty"`
 	SourceURL        string            `json:"source_url,omitempty"`
 	Metadata         map[string]string `json:"metadata,omitempty"`
+	// Version counts writes to the key, starting at 1. Zero means the secret
+	// predates version history.
+	Version int `json:"version,omitempty"`
+	// WrittenBy records who or what wrote this version, e.g. "user:alice"
+	// or "rotator:gitlab-oauth-refresh".
+	WrittenBy string `json:"written_by,omitempty"`
+	// Tags are short labels used by search, e.g. "prod".
+	Tags        []string `json:"tags,omitempty"`
+	Description string   `json:"description,omitempty"`
+	// Kind is SecretKindFields for structured secrets, whose Value holds
+	// named fields.
+	Kind SecretKind `json:"kind,omitempty"`
 }
 
 // Zero clears the secret value from memory
@@ -94,6 +108,11 @@ type SecretMetadata struct {
 	OwnerApplication string            `json:"owner_application,omitempty"`
 	SourceURL        string            `json:"source_url,omitempty"`
 	Metadata         map[string]string `json:"metadata,omitempty"`
+	Version          int               `json:"version,omitempty"`
+	WrittenBy        string            `json:"written_by,omitempty"`
+	Tags             []string          `json:"tags,omitempty"`
+	Description      string            `json:"description,omitempty"`
+	Kind             SecretKind        `json:"kind,omitempty"`
 }
 
 // GetExpirationStatus returns the current status based on metadata
@@ -101,3 +120,29 @@ func (sm *SecretMetadata) GetExpirationStatus(threshold time.Duration) Expiratio
 	secret := &Secret{ExpiresAt: sm.ExpiresAt}
 	return secret.GetExpirationStatus(threshold)
 }
+
+// NormalizeTags trims, lower-cases, de-duplicates and sorts tags. Tags may
+// not contain whitespace or commas.
+func NormalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	var out []string
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || seen[t] {
+			continue
+		}
+		if strings.ContainsAny(t, ", \t\n") {
+			return nil, fmt.Errorf("invalid tag '%s': tags cannot contain spaces or commas", t)
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
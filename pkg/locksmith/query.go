@@ -0,0 +1,274 @@
+package locksmith
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Query is a parsed search expression. See ParseQuery for the syntax.
+type Query struct {
+	terms []queryTerm
+}
+
+type queryTerm struct {
+	field  string
+	op     string
+	value  string
+	age    time.Duration
+	negate bool
+}
+
+// queryFields lists the supported field names and their aliases.
+var queryFields = map[string]string{
+	"tag":         "tag",
+	"owner":       "owner",
+	"type":        "type",
+	"key":         "key",
+	"source":      "source",
+	"url":         "source",
+	"desc":        "desc",
+	"description": "desc",
+	"writer":      "writer",
+	"written_by":  "writer",
+	"expires":     "expires",
+	"created":     "created",
+}
+
+// ParseQuery parses a search expression made of whitespace-separated terms,
+// all of which must match:
+//
+//	tag:prod            a tag (glob, case-insensitive)
+//	owner:github        owner application (glob, case-insensitive)
+//	type:oauth_token    secret type (glob, case-insensitive)
+//	key:aws/*           key name (glob, as in rotation rules)
+//	writer:rotator:*    who wrote the current version (glob)
+//	meta.env:prod       a metadata value (glob, case-insensitive)
+//	source:gitlab.com   source URL contains the text
+//	desc:"deploy key"   description contains the text
+//	expires<14d         expires within 14 days (or already expired); also >, <=, >=
+//	created>90d         created more than 90 days ago
+//	aws                 key or description contains the text
+//
+// A leading '-' negates a term. Durations accept Go syntax and the d, w,
+// mo and y suffixes; "expires:<14d" is accepted to avoid shell quoting.
+func ParseQuery(s string) (Query, error) {
+	tokens, err := splitQuery(s)
+	if err != nil {
+		return Query{}, err
+	}
+	var q Query
+	for _, tok := range tokens {
+		t, err := parseQueryTerm(tok)
+		if err != nil {
+			return Query{}, err
+		}
+		q.terms = append(q.terms, t)
+	}
+	return q, nil
+}
+
+// Empty reports whether the query has no terms and so matches everything.
+func (q Query) Empty() bool {
+	return len(q.terms) == 0
+}
+
+// Match reports whether the secret stored under key with meta satisfies
+// every term of the query.
+func (q Query) Match(key string, meta SecretMetadata) bool {
+	now := time.Now()
+	for _, t := range q.terms {
+		if t.match(key, meta, now) == t.negate {
+			return false
+		}
+	}
+	return true
+}
+
+// Filter returns the entries of items that match q.
+func (q Query) Filter(items map[string]*SecretMetadata) map[string]*SecretMetadata {
+	out := make(map[string]*SecretMetadata)
+	for key, meta := range items {
+		var m SecretMetadata
+		if meta != nil {
+			m = *meta
+		}
+		if q.Match(key, m) {
+			out[key] = meta
+		}
+	}
+	return out
+}
+
+// Search lists secrets whose metadata matches query.
+func (l *Locksmith) Search(query string) (map[string]*SecretMetadata, error) {
+	q, err := ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	items, err := l.ListWithMetadata()
+	if err != nil {
+		return nil, err
+	}
+	return q.Filter(items), nil
+}
+
+func parseQueryTerm(tok string) (queryTerm, error) {
+	var t queryTerm
+	if strings.HasPrefix(tok, "-") && len(tok) > 1 {
+		t.negate = true
+		tok = tok[1:]
+	}
+
+	i := strings.IndexAny(tok, ":<>")
+	if i < 0 {
+		t.field, t.op, t.value = "text", ":", strings.ToLower(tok)
+		return t, nil
+	}
+	name, rest := strings.ToLower(tok[:i]), tok[i:]
+
+	switch {
+	case strings.HasPrefix(rest, "<="), strings.HasPrefix(rest, ">="):
+		t.op, t.value = rest[:2], rest[2:]
+	case strings.HasPrefix(rest, ":<="), strings.HasPrefix(rest, ":>="):
+		t.op, t.value = rest[1:3], rest[3:]
+	case strings.HasPrefix(rest, ":<"), strings.HasPrefix(rest, ":>"):
+		t.op, t.value = rest[1:2], rest[2:]
+	default:
+		t.op, t.value = rest[:1], rest[1:]
+	}
+
+	if metaKey, ok := strings.CutPrefix(name, "meta."); ok && metaKey != "" {
+		t.field = "meta." + metaKey
+	} else if f, ok := queryFields[name]; ok {
+		t.field = f
+	} else {
+		return t, fmt.Errorf("unknown search field '%s'", name)
+	}
+
+	switch t.field {
+	case "expires", "created":
+		if t.op == ":" {
+			return t, fmt.Errorf("'%s' needs a comparison, e.g. %s<14d", name, name)
+		}
+		d, err := time.ParseDuration(t.value)
+		if err != nil {
+			d, err = ParseDuration(t.value)
+		}
+		if err != nil {
+			return t, fmt.Errorf("invalid duration in '%s': %w", tok, err)
+		}
+		t.age = d
+	default:
+		if t.op != ":" {
+			return t, fmt.Errorf("'%s' only supports ':' (got '%s')", name, t.op)
+		}
+		if t.value == "" {
+			return t, fmt.Errorf("empty value for '%s'", name)
+		}
+	}
+	return t, nil
+}
+
+func (t queryTerm) match(key string, meta SecretMetadata, now time.Time) bool {
+	switch t.field {
+	case "text":
+		return strings.Contains(strings.ToLower(key), t.value) ||
+			strings.Contains(strings.ToLower(meta.Description), t.value)
+	case "tag":
+		for _, tag := range meta.Tags {
+			if globFold(t.value, tag) {
+				return true
+			}
+		}
+		return false
+	case "owner":
+		return globFold(t.value, meta.OwnerApplication)
+	case "type":
+		return globFold(t.value, string(meta.SecretType))
+	case "writer":
+		return globFold(t.value, meta.WrittenBy)
+	case "key":
+		ok, err := filepath.Match(t.value, key)
+		return err == nil && ok
+	case "source":
+		return strings.Contains(strings.ToLower(meta.SourceURL), strings.ToLower(t.value))
+	case "desc":
+		return strings.Contains(strings.ToLower(meta.Description), strings.ToLower(t.value))
+	case "expires":
+		if meta.ExpiresAt.IsZero() {
+			// Never expires: later than any bound.
+			return t.op[0] == '>'
+		}
+		return compareDuration(meta.ExpiresAt.Sub(now), t.op, t.age)
+	case "created":
+		if meta.CreatedAt.IsZero() {
+			return false
+		}
+		return compareDuration(now.Sub(meta.CreatedAt), t.op, t.age)
+	}
+	if name, ok := strings.CutPrefix(t.field, "meta."); ok {
+		for k, v := range meta.Metadata {
+			if strings.EqualFold(k, name) && globFold(t.value, v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func compareDuration(d time.Duration, op string, bound time.Duration) bool {
+	switch op {
+	case "<":
+		return d < bound
+	case "<=":
+		return d <= bound
+	case ">":
+		return d > bound
+	default:
+		return d >= bound
+	}
+}
+
+// globFold matches s against a case-insensitive glob, falling back to
+// equality for malformed patterns.
+func globFold(pattern, s string) bool {
+	pattern, s = strings.ToLower(pattern), strings.ToLower(s)
+	ok, err := filepath.Match(pattern, s)
+	if err != nil {
+		return pattern == s
+	}
+	return ok
+}
+
+// splitQuery splits on whitespace, keeping double-quoted runs together
+// (the quotes themselves are dropped).
+func splitQuery(s string) ([]string, error) {
+	var tokens []string
+	var cur strings.Builder
+	inQuote, started := false, false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+			started = true
+		case !inQuote && (r == ' ' || r == '\t' || r == '\n'):
+			if started {
+				tokens = append(tokens, cur.String())
+				cur.Reset()
+				started = false
+			}
+		default:
+			cur.WriteRune(r)
+			started = true
+		}
+	}
+	if inQuote {
+		return nil, fmt.Errorf("unterminated quote in query")
+	}
+	if started {
+		tokens = append(tokens, cur.String())
+	}
+	return tokens, nil
+}
@@ -0,0 +1,118 @@
+package locksmith
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQueryMatch(t *testing.T) {
+	now := time.Now()
+	meta := SecretMetadata{
+		CreatedAt:        now.Add(-100 * 24 * time.Hour),
+		ExpiresAt:        now.Add(10 * 24 * time.Hour),
+		SecretType:       SecretTypeOAuthToken,
+		OwnerApplication: "GitHub",
+		SourceURL:        "https://api.github.com/app/installations/1/access_tokens",
+		Metadata:         map[string]string{"env": "prod"},
+		WrittenBy:        "rotator:github-app-installation-token",
+		Tags:             []string{"ci", "prod"},
+		Description:      "Deploy key for the release pipeline",
+	}
+
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"", true},
+		{"tag:prod", true},
+		{"tag:PROD", true},
+		{"tag:dev", false},
+		{"-tag:dev", true},
+		{"-tag:prod", false},
+		{"tag:p*", true},
+		{"owner:github", true},
+		{"type:oauth_token", true},
+		{"type:password", false},
+		{"key:github/*", true},
+		{"key:github", false},
+		{"key:aws/*", false},
+		{"writer:rotator:*", true},
+		{"meta.env:prod", true},
+		{"meta.env:dev", false},
+		{"meta.missing:x", false},
+		{"source:api.github.com", true},
+		{`desc:"release pipeline"`, true},
+		{"desc:staging", false},
+		{"expires<14d", true},
+		{"expires:<14d", true},
+		{"expires<1w", false},
+		{"expires>=1w", true},
+		{"created>90d", true},
+		{"created<30d", false},
+		{"deploy", true},
+		{"ci-token", true},
+		{"tag:prod owner:github expires<14d type:oauth_token key:github/*", true},
+		{"tag:prod owner:gitlab", false},
+	}
+	for _, tt := range tests {
+		q, err := ParseQuery(tt.query)
+		if err != nil {
+			t.Errorf("ParseQuery(%q): %v", tt.query, err)
+			continue
+		}
+		if got := q.Match("github/ci-token", meta); got != tt.want {
+			t.Errorf("%q matched = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestQueryNoExpiry(t *testing.T) {
+	for query, want := range map[string]bool{"expires<14d": false, "expires>14d": true, "created>1d": false} {
+		q, err := ParseQuery(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := q.Match("k", SecretMetadata{}); got != want {
+			t.Errorf("%q on a secret without dates = %v, want %v", query, got, want)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, query := range []string{
+		"color:red",
+		"expires:14d",
+		"expires<soon",
+		"tag<3",
+		"tag:",
+		`desc:"unterminated`,
+	} {
+		if _, err := ParseQuery(query); err == nil {
+			t.Errorf("ParseQuery(%q) should fail", query)
+		}
+	}
+}
+
+func TestSearchUsesStoredTags(t *testing.T) {
+	l, b := newHistoryTestLocksmith()
+	_ = l.PutSecret("aws/prod", Secret{Value: []byte("a"), Tags: []string{"Prod", "aws", "prod"}, Description: "prod keys"}, false)
+	_ = l.PutSecret("aws/dev", Secret{Value: []byte("b"), Tags: []string{"dev"}}, false)
+
+	if got := b.attrs["aws/prod"][attrTags]; got != "aws,prod" {
+		t.Errorf("tags attribute = %q, want normalized aws,prod", got)
+	}
+
+	// List from item attributes only, as after a cache wipe.
+	l.Cache = &MockCache{secrets: map[string]Secret{}}
+	items, err := l.Search("tag:prod key:aws/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items["aws/prod"] == nil || items["aws/prod"].Description != "prod keys" {
+		t.Errorf("unexpected search result %v", items)
+	}
+
+	if err := l.PutSecret("bad", Secret{Value: []byte("x"), Tags: []string{"two words"}}, false); err == nil {
+		t.Error("expected tags with spaces to be rejected")
+	}
+}
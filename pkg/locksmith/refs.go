@@ -0,0 +1,167 @@
+package locksmith
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RefScheme prefixes secret references in environment files, integration
+// profiles and rotation metadata.
+const RefScheme = "locksmith://"
+
+// SecretRef identifies a secret, optionally in another vault:
+//
+//	locksmith://db/password         key in the current vault
+//	locksmith://@work/db/password   key in the "work" vault
+//	locksmith://db#password         the "password" field of a structured secret
+//	locksmith://github/2fa?otp      the current code of a TOTP secret
+//
+// The scheme is optional, so bare keys are references too.
+type SecretRef struct {
+	Vault string
+	Key   string
+	Field string
+	// OTP resolves a TOTP seed to its current code.
+	OTP bool
+}
+
+// IsRef reports whether s uses the locksmith:// scheme.
+func IsRef(s string) bool {
+	return strings.HasPrefix(strings.TrimSpace(s), RefScheme)
+}
+
+// ParseRef parses a secret reference. It does not consult any vault, so
+// keys containing '#' or '?' parse as a field or ?otp reference; the methods
+// resolving references read such keys whole when they exist.
+func ParseRef(s string) (SecretRef, error) {
+	raw := strings.TrimSpace(s)
+	rest := strings.TrimPrefix(raw, RefScheme)
+
+	var ref SecretRef
+	if strings.HasPrefix(rest, "@") {
+		vault, key, ok := strings.Cut(rest[1:], "/")
+		if !ok {
+			return SecretRef{}, fmt.Errorf("invalid secret reference '%s': expected @vault/key", raw)
+		}
+		if err := ValidateVaultName(vault); err != nil {
+			return SecretRef{}, fmt.Errorf("invalid secret reference '%s': %w", raw, err)
+		}
+		ref.Vault = vault
+		rest = key
+	}
+
+	if i := strings.LastIndex(rest, "?"); i >= 0 {
+		if query := rest[i+1:]; query != "otp" {
+			return SecretRef{}, fmt.Errorf("invalid secret reference '%s': unsupported option '?%s' (only ?otp)", raw, query)
+		}
+		ref.OTP = true
+		rest = rest[:i]
+	}
+
+	if i := strings.LastIndex(rest, "#"); i >= 0 {
+		ref.Field = strings.TrimSpace(rest[i+1:])
+		rest = rest[:i]
+		if err := ValidateFieldName(ref.Field); err != nil {
+			return SecretRef{}, fmt.Errorf("invalid secret reference '%s': %w", raw, err)
+		}
+	}
+
+	ref.Key = strings.TrimSpace(rest)
+	if ref.Key == "" {
+		return SecretRef{}, fmt.Errorf("invalid secret reference '%s': empty key", raw)
+	}
+	return ref, nil
+}
+
+// String formats the reference with the locksmith:// scheme.
+func (r SecretRef) String() string {
+	s := RefScheme
+	if r.Vault != "" {
+		s += "@" + r.Vault + "/"
+	}
+	s += r.Key
+	if r.Field != "" {
+		s += "#" + r.Field
+	}
+	if r.OTP {
+		s += "?otp"
+	}
+	return s
+}
+
+// ResolveRef reads the secret (or secret field) a reference points to,
+// opening the referenced vault when it is not the current one.
+func (l *Locksmith) ResolveRef(ref string) ([]byte, error) {
+	parsed, secret, err := l.readRef(ref, readSecret)
+	if err != nil {
+		return nil, err
+	}
+	return refValue(parsed, secret)
+}
+
+// readRef parses ref, opens the vault it names and reads its secret with
+// get. Keys could contain '#' and '?' before field and ?otp references
+// existed, so a reference whose key, taken whole, names an existing secret
+// reads that secret rather than a field or code of a shorter key. Whether
+// it exists is looked up from the key names, which costs no prompt.
+func (l *Locksmith) readRef(ref string, get func(target *Locksmith, ref SecretRef) (*Secret, error)) (SecretRef, *Secret, error) {
+	if whole, ok := wholeKeyRef(ref); ok {
+		target, err := l.OpenVault(whole.Vault)
+		if err != nil {
+			return SecretRef{}, nil, err
+		}
+		names, err := target.ListKeyNames()
+		if err != nil {
+			return SecretRef{}, nil, err
+		}
+		for _, name := range names {
+			if name != whole.Key {
+				continue
+			}
+			secret, err := get(target, whole)
+			if err != nil {
+				return SecretRef{}, nil, err
+			}
+			return whole, secret, nil
+		}
+	}
+
+	parsed, err := ParseRef(ref)
+	if err != nil {
+		return SecretRef{}, nil, err
+	}
+	target, err := l.OpenVault(parsed.Vault)
+	if err != nil {
+		return SecretRef{}, nil, err
+	}
+	secret, err := get(target, parsed)
+	if err != nil {
+		return SecretRef{}, nil, err
+	}
+	return parsed, secret, nil
+}
+
+// wholeKeyRef returns the reference s makes when everything after its vault
+// is taken as the key, if that key contains '#' or '?'.
+func wholeKeyRef(s string) (SecretRef, bool) {
+	rest := strings.TrimPrefix(strings.TrimSpace(s), RefScheme)
+	var ref SecretRef
+	if strings.HasPrefix(rest, "@") {
+		vault, key, ok := strings.Cut(rest[1:], "/")
+		if !ok || ValidateVaultName(vault) != nil {
+			return SecretRef{}, false
+		}
+		ref.Vault = vault
+		rest = key
+	}
+	if !strings.ContainsAny(rest, "#?") {
+		return SecretRef{}, false
+	}
+	ref.Key = strings.TrimSpace(rest)
+	return ref, true
+}
+
+// readSecret reads the key of ref from target.
+func readSecret(target *Locksmith, ref SecretRef) (*Secret, error) {
+	return target.getSecret(ref.Key)
+}
@@ -18,6 +18,23 @@ const defaultRotationOperationTimeout = 30 * time.Second
 
 // RotateSecret executes the configured in-process Go rotator for the given key and updates the vault.
 func (l *Locksmith) RotateSecret(key string) error {
+	if target, resolved, ok, err := l.aliasTarget(key); err != nil {
+		return err
+	} else if ok {
+		return target.RotateSecret(resolved)
+	}
+
+	lock, err := l.lockKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to lock '%s' for rotation: %w", key, err)
+	}
+	defer func() { _ = lock.Release() }()
+	return l.rotateSecret(key)
+}
+
+// rotateSecret rotates key, which is not an alias; the caller holds the
+// key's lock.
+func (l *Locksmith) rotateSecret(key string) error {
 	currentSecret, err := l.getSecretNoRotate(key)
 	if err != nil {
 		return fmt.Errorf("failed to load secret '%s' before rotation: %w", key, err)
@@ -82,16 +99,19 @@ func (l *Locksmith) RotateSecret(key string) error {
 
 	valCopy := make([]byte, len(result.NewValue))
 	copy(valCopy, result.NewValue)
-	err = l.SetWithContext(
-		key,
-		valCopy,
-		expiresAt,
-		l.Options.RequireBiometrics,
-		ParseSecretType(selector.SecretType),
-		selector.OwnerApplication,
-		selector.SourceURL,
-		selector.Metadata,
-	)
+	// PutSecret keeps the current value in the key's history, so a broken
+	// token from the provider can be rolled back.
+	err = l.PutSecret(key, Secret{
+		Value:            valCopy,
+		ExpiresAt:        expiresAt,
+		SecretType:       ParseSecretType(selector.SecretType),
+		OwnerApplication: selector.OwnerApplication,
+		SourceURL:        selector.SourceURL,
+		Metadata:         selector.Metadata,
+		WrittenBy:        "rotator:" + handler.ID(),
+		Tags:             currentSecret.Tags,
+		Description:      currentSecret.Description,
+	}, l.Options.RequireBiometrics)
 	if err != nil {
 		return fmt.Errorf("failed to write rotated secret back to vault: %w", err)
 	}
@@ -172,18 +192,25 @@ func (l *Locksmith) resolveMetadataValue(v string) (string, error) {
 		return v, nil
 	}
 
-	secretKey := strings.TrimPrefix(s, "locksmith://")
-	secretKey = strings.TrimSpace(secretKey)
-	if secretKey == "" {
+	if strings.TrimSpace(strings.TrimPrefix(s, RefScheme)) == "" {
 		return "", fmt.Errorf("empty locksmith metadata reference")
 	}
-
-	sec, err := l.getSecretNoRotate(secretKey)
+	ref, sec, err := l.readRef(s, func(target *Locksmith, ref SecretRef) (*Secret, error) {
+		sec, err := target.getSecretNoRotate(ref.Key)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load referenced secret '%s': %w", ref.Key, err)
+		}
+		return sec, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	value, err := refValue(ref, sec)
 	if err != nil {
-		return "", fmt.Errorf("unable to load referenced secret '%s': %w", secretKey, err)
+		return "", err
 	}
 
-	return string(sec.Value), nil
+	return string(value), nil
 }
 
 func ruleSupportsSelector(rule *RotationRule, selector rotator.RotationSelector) bool {
@@ -314,13 +341,20 @@ func (l *Locksmith) RotateExpiringSecrets() (rotated []string, skipped []string,
 
 	failed = make(map[string]error)
 
-	for key := range keys {
-		secret, err := l.getSecretNoRotate(key)
-		if err != nil {
-			continue // skip secrets we can't retrieve (e.g. access denied)
+	for key, meta := range keys {
+		// Listed metadata (cache, backend attributes or the metadata index)
+		// decides without reading the secret; every write sets CreatedAt, so
+		// a zero value means nothing is known about the key.
+		var status ExpirationStatus
+		if meta != nil && !meta.CreatedAt.IsZero() {
+			status = meta.GetExpirationStatus(threshold)
+		} else {
+			secret, err := l.getSecretNoRotate(key)
+			if err != nil {
+				continue // skip secrets we can't retrieve (e.g. access denied)
+			}
+			status = secret.GetExpirationStatus(threshold)
 		}
-
-		status := secret.GetExpirationStatus(threshold)
 		if status == StatusValid {
 			skipped = append(skipped, key)
 			continue
@@ -343,14 +377,34 @@ func (l *Locksmith) RotateExpiringSecrets() (rotated []string, skipped []string,
 			continue
 		}
 
-		// Rotate
-		err = l.RotateSecret(key)
-		if err != nil {
+		// Rotate, unless another process did while this one waited for
+		// the key's lock
+		done, err := l.rotateExpiring(key, threshold)
+		switch {
+		case err != nil:
 			failed[key] = err
-		} else {
+		case done:
 			rotated = append(rotated, key)
+		default:
+			skipped = append(skipped, key)
 		}
 	}
 
 	return rotated, skipped, failed, nil
 }
+
+// rotateExpiring rotates key under its lock, unless by the time the lock is
+// held the metadata index shows another process has rotated it already.
+func (l *Locksmith) rotateExpiring(key string, threshold time.Duration) (bool, error) {
+	lock, err := l.lockKey(key)
+	if err != nil {
+		return false, fmt.Errorf("failed to lock '%s' for rotation: %w", key, err)
+	}
+	defer func() { _ = lock.Release() }()
+	if entries, err := l.Index.Load(); err == nil {
+		if meta, ok := entries[key]; ok && meta.GetExpirationStatus(threshold) == StatusValid {
+			return false, nil
+		}
+	}
+	return true, l.rotateSecret(key)
+}
@@ -17,6 +17,14 @@ import (
 
 const defaultURLRotatorID = "url-json"
 
+// LocalGenerateRotatorID is the rotator that replaces a secret with a newly
+// generated value, for secrets that only exist in locksmith.
+const LocalGenerateRotatorID = "local-generate"
+
+// GeneratePolicyMetadataKey names the generate policy used by the
+// local-generate rotator, in a rotation rule's or a secret's metadata.
+const GeneratePolicyMetadataKey = "generate_policy"
+
 func registerDefaultRotationHandlers(l *Locksmith) {
 	if l == nil || l.Rotators == nil {
 		return
@@ -27,6 +35,7 @@ func registerDefaultRotationHandlers(l *Locksmith) {
 	_ = l.Rotators.Register(gitlabrotator.NewOAuthRefreshRotator())
 	_ = l.Rotators.Register(gitlabrotator.NewPATSelfRotateRotator())
 	_ = l.Rotators.Register(&urlJSONRotator{})
+	_ = l.Rotators.Register(&localGenerateRotator{config: func() *Config { return l.Config }})
 }
 
 type urlJSONRotator struct{}
@@ -103,6 +112,54 @@ func (h *urlJSONRotator) Rotate(ctx context.Context, input rotator.RotationInput
 	return rotator.RotationOutput{NewValue: []byte(respData.Value), TTL: ttl}, nil
 }
 
+// localGenerateRotator regenerates secrets locally with a generate policy:
+// the one named by the generate_policy metadata, or the policy the key and
+// type select. It is picked automatically only for secrets without an owner
+// application or source URL, so provider-issued credentials are never
+// replaced by random values; other handlers may claim untyped secrets
+// first, so rules for those should name it with 'rotator: local-generate'.
+type localGenerateRotator struct {
+	config func() *Config
+}
+
+func (h *localGenerateRotator) ID() string {
+	return LocalGenerateRotatorID
+}
+
+func (h *localGenerateRotator) Supports(selector rotator.RotationSelector) bool {
+	if selector.Metadata[GeneratePolicyMetadataKey] != "" {
+		return true
+	}
+	if selector.SourceURL != "" || selector.OwnerApplication != "" {
+		return false
+	}
+	switch ParseSecretType(selector.SecretType) {
+	case SecretTypeOAuthToken, SecretTypeTOTP:
+		return false
+	}
+	return true
+}
+
+func (h *localGenerateRotator) Rotate(ctx context.Context, input rotator.RotationInput) (rotator.RotationOutput, error) {
+	cfg := h.config()
+	var policy GeneratePolicy
+	if name := input.Selector.Metadata[GeneratePolicyMetadataKey]; name != "" {
+		p, err := cfg.GeneratePolicy(name)
+		if err != nil {
+			return rotator.RotationOutput{}, err
+		}
+		policy = p
+	} else {
+		_, policy = cfg.GeneratePolicyFor(input.Key, ParseSecretType(input.Selector.SecretType))
+	}
+
+	value, err := GenerateValue(policy)
+	if err != nil {
+		return rotator.RotationOutput{}, fmt.Errorf("failed to generate a value for '%s': %w", input.Key, err)
+	}
+	return rotator.RotationOutput{NewValue: value}, nil
+}
+
 func parseDurationForRotator(s string) (time.Duration, error) {
 	if d, err := time.ParseDuration(s); err == nil {
 		return d, nil
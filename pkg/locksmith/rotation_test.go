@@ -27,9 +27,10 @@ func (t *testRotationBackend) Set(service, account string, data []byte, requireB
 func (t *testRotationBackend) Get(service, account string, useBiometrics bool, prompt string) ([]byte, error) {
 	d, ok := t.secrets[account]
 	if !ok {
-		return nil, fmt.Errorf("secret %s not found", account)
+		return nil, fmt.Errorf("secret %s: %w", account, ErrNotFound)
 	}
-	return d, nil
+	// Callers zero what they read, as with the native backends.
+	return append([]byte(nil), d...), nil
 }
 
 func (t *testRotationBackend) Delete(service, account string, useBiometrics bool, prompt string) error {
@@ -83,8 +84,10 @@ func TestRotateSecretURLRotator(t *testing.T) {
 	oldSecret.SecretType = "password"
 	oldSecret.OwnerApplication = "db"
 	oldSecret.SourceURL = server.URL
+	oldSecret.Tags = []string{"prod"}
 	secretData, _ = json.Marshal(oldSecret)
 	mb.secrets["db/password"] = secretData
+	_ = mc.Set("db/password", oldSecret, time.Hour)
 
 	err := ls.RotateSecret("db/password")
 	if err != nil {
@@ -109,6 +112,21 @@ func TestRotateSecretURLRotator(t *testing.T) {
 	if timeRemaining < 45*time.Minute || timeRemaining > 65*time.Minute {
 		t.Errorf("Expected renewed expiration to be ~1 hour, got TTL duration: %v", timeRemaining)
 	}
+	if len(meta.Tags) != 1 || meta.Tags[0] != "prod" {
+		t.Errorf("Expected tags to survive rotation, got %v", meta.Tags)
+	}
+
+	// The pre-rotation value is kept so a broken token can be rolled back.
+	versions, err := ls.History("db/password")
+	if err != nil {
+		t.Fatalf("Failed to read history: %v", err)
+	}
+	if len(versions) != 2 || string(versions[1].Value) != "old-pass" {
+		t.Fatalf("Expected the previous value in history, got %+v", versions)
+	}
+	if !strings.HasPrefix(versions[0].WrittenBy, "rotator:") || versions[0].Version != 2 {
+		t.Errorf("Expected rotated version 2 written by a rotator, got v%d by %q", versions[0].Version, versions[0].WrittenBy)
+	}
 }
 
 func TestRotateSecretWithExplicitRotatorID(t *testing.T) {
@@ -216,11 +234,12 @@ func TestGetDoesNotAutoRotateOnGet(t *testing.T) {
 		t.Errorf("Expected secret to remain unchanged on get, got '%s'", val)
 	}
 
+	// Expired secrets are dropped from the cache rather than rotated into it.
 	cached, err := ls.Cache.Get("service/token")
-	if err != nil || cached == nil {
-		t.Fatalf("Failed to retrieve from cache: %v", err)
+	if err != nil {
+		t.Fatalf("Failed to read the cache: %v", err)
 	}
-	if string(cached.Value) != "expired-val" {
+	if cached != nil && string(cached.Value) != "expired-val" {
 		t.Errorf("Expected cache to remain unchanged on get, got '%s'", cached.Value)
 	}
 }
@@ -652,3 +671,118 @@ func TestRotateSecretResolvesMetadataSecretRefs(t *testing.T) {
 		t.Fatalf("expected github_app_private_key to resolve from locksmith")
 	}
 }
+
+func TestResolveMetadataValueField(t *testing.T) {
+	l, _ := newHistoryTestLocksmith()
+	app, _ := NewFieldSecret([]Field{
+		{Name: "id", Value: "12345"},
+		{Name: "private-key", Value: "pem", Sensitive: true},
+	})
+	if err := l.PutSecret("github/app", app, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := l.resolveMetadataValue("locksmith://github/app#id"); err != nil || v != "12345" {
+		t.Errorf("resolveMetadataValue = %q, %v", v, err)
+	}
+	if _, err := l.resolveMetadataValue("locksmith://github/app"); err == nil {
+		t.Error("expected an error resolving a structured secret without a field")
+	}
+}
+
+func TestRotateSecretLocalGenerate(t *testing.T) {
+	mc := &MockCache{secrets: make(map[string]Secret)}
+	mb := &testRotationBackend{secrets: make(map[string][]byte)}
+	ls := NewWithCache(mc)
+	ls.Backend = mb
+	ls.Config = &Config{
+		Rotation: []RotationRule{
+			{Secret: "app/*", Rotator: LocalGenerateRotatorID, Metadata: map[string]string{GeneratePolicyMetadataKey: "signing"}},
+			{Secret: "local/*"}, // selected automatically for local passwords
+		},
+		Generate: map[string]GeneratePolicy{
+			"signing": {Format: GenerateFormatHex, Length: 16},
+		},
+	}
+
+	for _, key := range []string{"app/signing-key", "local/password"} {
+		old := Secret{Value: []byte("old"), Description: "kept"}
+		if key == "local/password" {
+			old.SecretType = SecretTypePassword
+		}
+		if err := ls.PutSecret(key, old, false); err != nil {
+			t.Fatal(err)
+		}
+		if err := ls.RotateSecret(key); err != nil {
+			t.Fatalf("RotateSecret(%s) failed: %v", key, err)
+		}
+		secret, err := ls.GetWithMetadata(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(secret.Value) == "old" || secret.WrittenBy != "rotator:"+LocalGenerateRotatorID || secret.Description != "kept" {
+			t.Errorf("%s not regenerated: %+v", key, secret)
+		}
+		if key == "app/signing-key" && len(secret.Value) != 32 {
+			t.Errorf("expected 16 hex-encoded bytes, got %q", secret.Value)
+		}
+	}
+
+	h := &localGenerateRotator{config: func() *Config { return nil }}
+	if h.Supports(rotator.RotationSelector{Key: "x", SourceURL: "https://example.com"}) ||
+		h.Supports(rotator.RotationSelector{Key: "x", OwnerApplication: "github"}) ||
+		h.Supports(rotator.RotationSelector{Key: "x", SecretType: "oauth_token"}) {
+		t.Error("local-generate should not be selected for provider-issued secrets")
+	}
+}
+
+func TestRotateExpiringSecretsUsesIndex(t *testing.T) {
+	l, b := newHistoryTestLocksmith()
+	l.Index = newTestIndex(t, l.Service)
+	l.Rotators = rotator.NewHandlerRegistry()
+	registerDefaultRotationHandlers(l)
+	counter := &gateCounter{Backend: valueOnlyBackend{b}}
+	l.Backend = counter
+	l.Config = &Config{
+		Notifications: NotificationConfig{ExpiringThreshold: "1d"},
+		Rotation:      []RotationRule{{Secret: "local/*", Rotator: LocalGenerateRotatorID}},
+	}
+
+	_ = l.PutSecret("local/valid", Secret{Value: []byte("a"), ExpiresAt: time.Now().Add(30 * 24 * time.Hour)}, false)
+	_ = l.PutSecret("local/expired", Secret{Value: []byte("b"), ExpiresAt: time.Now().Add(-time.Hour)}, false)
+	l.Cache = &MockCache{secrets: make(map[string]Secret)}
+	l.Options.RequireBiometrics = true
+
+	rotated, skipped, failed, err := l.RotateExpiringSecrets()
+	if err != nil || len(failed) != 0 {
+		t.Fatalf("RotateExpiringSecrets: %v, %v", err, failed)
+	}
+	if len(rotated) != 1 || rotated[0] != "local/expired" || len(skipped) != 1 {
+		t.Errorf("rotated %v, skipped %v", rotated, skipped)
+	}
+	for _, key := range counter.gated {
+		if key == "local/valid" {
+			t.Error("a valid secret was read to learn its expiry")
+		}
+	}
+}
+
+func TestRotateSecretThroughAlias(t *testing.T) {
+	l, _ := newHistoryTestLocksmith()
+	l.Rotators = rotator.NewHandlerRegistry()
+	registerDefaultRotationHandlers(l)
+	l.Config = &Config{
+		Aliases:  map[string]string{"app/key": "local/key"},
+		Rotation: []RotationRule{{Secret: "local/*", Rotator: LocalGenerateRotatorID}},
+	}
+	_ = l.PutSecret("local/key", Secret{Value: []byte("old")}, false)
+
+	if err := l.RotateSecret("app/key"); err != nil {
+		t.Fatalf("RotateSecret through alias: %v", err)
+	}
+	target, _ := l.Get("local/key")
+	viaAlias, _ := l.Get("app/key")
+	if string(target) == "old" || string(viaAlias) != string(target) {
+		t.Errorf("rotation not visible through the alias: target %q, alias %q", target, viaAlias)
+	}
+}
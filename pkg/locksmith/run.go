@@ -3,10 +3,13 @@ package locksmith
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
 )
 
 type integrationSpec struct {
@@ -50,12 +53,7 @@ func (l *Locksmith) Run(args []string, envFile string) (int, error) {
 		}
 	}
 
-	env, err := l.ResolveEnvironment(os.Environ(), envFileVars)
-	if err != nil {
-		return 1, err
-	}
-
-	return runCommandWithEnv(args[0], args[1:], env)
+	return l.runWithFiles(args[0], args[1:], envFileVars)
 }
 
 // RunIntegration executes a configured integration command with locksmith-backed env vars.
@@ -65,12 +63,24 @@ func (l *Locksmith) RunIntegration(name string, args []string) (int, error) {
 		return 1, err
 	}
 
-	env, err := l.ResolveEnvironment(os.Environ(), profile.env)
+	return l.runWithFiles(profile.command, args, profile.env)
+}
+
+// runWithFiles resolves vars, writing locksmith-file:// references to
+// secret files, and runs command with the result. Signals are handled from
+// before the first reference is resolved, so the files are removed however
+// the run ends.
+func (l *Locksmith) runWithFiles(command string, args []string, vars map[string]string) (int, error) {
+	files := &SecretFiles{}
+	defer func() { _ = files.Cleanup() }()
+	signals := handleRunSignals(files)
+	defer signals.stop()
+
+	env, err := l.resolveEnvironment(os.Environ(), vars, files)
 	if err != nil {
 		return 1, err
 	}
-
-	return runCommandWithEnv(profile.command, args, env)
+	return runCommandWithEnv(command, args, env, signals)
 }
 
 // ResolveIntegrationEnvironment returns the environment used for a named integration.
@@ -123,7 +133,7 @@ func normalizeIntegrationEnv(env map[string]string) map[string]string {
 		if envName == "" || secretRef == "" {
 			continue
 		}
-		if strings.HasPrefix(secretRef, "locksmith://") {
+		if strings.HasPrefix(secretRef, "locksmith://") || IsFileRef(secretRef) {
 			out[envName] = secretRef
 			continue
 		}
@@ -140,26 +150,72 @@ func copyStringMap(in map[string]string) map[string]string {
 	return out
 }
 
-func runCommandWithEnv(command string, args []string, env []string) (int, error) {
+// runSignals handles forwardedSignals for the whole of a run. Until the
+// child has started, a signal removes the secret files written so far and
+// exits: resolving references may be waiting on an authentication prompt
+// that cannot be cancelled. Once the child has started, signals are
+// forwarded to it rather than terminating us, so the files are removed
+// however it exits.
+type runSignals struct {
+	files *SecretFiles
+	ch    chan os.Signal
+
+	mu    sync.Mutex
+	child *os.Process
+}
+
+func handleRunSignals(files *SecretFiles) *runSignals {
+	s := &runSignals{files: files, ch: make(chan os.Signal, 1)}
+	signal.Notify(s.ch, forwardedSignals...)
+	go s.loop()
+	return s
+}
+
+func (s *runSignals) loop() {
+	for sig := range s.ch {
+		s.mu.Lock()
+		child := s.child
+		if child == nil {
+			s.files.abort()
+			os.Exit(signalExitCode(sig))
+		}
+		s.mu.Unlock()
+		_ = child.Signal(sig)
+	}
+}
+
+// start starts cmd, after which signals are forwarded to it.
+func (s *runSignals) start(cmd *exec.Cmd) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	s.child = cmd.Process
+	return nil
+}
+
+func (s *runSignals) stop() {
+	signal.Stop(s.ch)
+	close(s.ch)
+}
+
+// signalExitCode is the shell's exit status for a process killed by sig.
+func signalExitCode(sig os.Signal) int {
+	if n, ok := sig.(syscall.Signal); ok {
+		return 128 + int(n)
+	}
+	return 1
+}
+
+func runCommandWithEnv(command string, args []string, env []string, signals *runSignals) (int, error) {
 	cmd := exec.Command(command, args...) // #nosec G204 // nosem
 	cmd.Env = env
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
-	// Forward signals to child process
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, forwardedSignals...)
-	go func() {
-		for sig := range sigChan {
-			if cmd.Process != nil {
-				_ = cmd.Process.Signal(sig)
-			}
-		}
-	}()
-	defer signal.Stop(sigChan)
-
-	if err := cmd.Start(); err != nil {
+	if err := signals.start(cmd); err != nil {
 		return 1, fmt.Errorf("failed to start command: %w", err)
 	}
 
@@ -173,8 +229,27 @@ func runCommandWithEnv(command string, args []string, env []string) (int, error)
 	return 0, nil
 }
 
-// ResolveEnvironment resolves secrets defined in the environment or envFileVars
+// ResolveEnvironment resolves secrets defined in the environment or envFileVars.
+// locksmith-file:// references are rejected; use ResolveEnvironmentWithFiles.
 func (l *Locksmith) ResolveEnvironment(hostEnv []string, envFileVars map[string]string) ([]string, error) {
+	return l.resolveEnvironment(hostEnv, envFileVars, nil)
+}
+
+// ResolveEnvironmentWithFiles is ResolveEnvironment with support for
+// locksmith-file:// references, which are written to private files whose
+// paths become the variables' values. The caller must call Cleanup on the
+// returned SecretFiles once the environment is no longer in use.
+func (l *Locksmith) ResolveEnvironmentWithFiles(hostEnv []string, envFileVars map[string]string) ([]string, *SecretFiles, error) {
+	files := &SecretFiles{}
+	env, err := l.resolveEnvironment(hostEnv, envFileVars, files)
+	if err != nil {
+		_ = files.Cleanup()
+		return nil, nil, err
+	}
+	return env, files, nil
+}
+
+func (l *Locksmith) resolveEnvironment(hostEnv []string, envFileVars map[string]string, files *SecretFiles) ([]string, error) {
 	resolved := make(map[string]string)
 
 	// 1. Load host environment
@@ -198,9 +273,8 @@ func (l *Locksmith) ResolveEnvironment(hostEnv []string, envFileVars map[string]
 		if strings.HasPrefix(k, "LOCKSMITH_SECRET_") {
 			newKey := strings.TrimPrefix(k, "LOCKSMITH_SECRET_")
 			secretVars[newKey] = v
-		} else if strings.HasPrefix(v, "locksmith://") {
-			secretKey := strings.TrimPrefix(v, "locksmith://")
-			secretVars[k] = secretKey
+		} else if strings.HasPrefix(v, RefScheme) || strings.HasPrefix(v, FileRefScheme) {
+			secretVars[k] = v
 		} else {
 			regularVars[k] = v
 		}
@@ -222,10 +296,21 @@ func (l *Locksmith) ResolveEnvironment(hostEnv []string, envFileVars map[string]
 		}
 	}()
 
-	for k, secretKey := range secretVars {
-		valBytes, err := l.Get(secretKey)
+	for k, ref := range secretVars {
+		if IsFileRef(ref) {
+			if files == nil {
+				return nil, fmt.Errorf("'%s' uses %s, which is only supported when running a command", k, FileRefScheme)
+			}
+			path, err := l.materializeFileRef(files, k, ref)
+			if err != nil {
+				return nil, fmt.Errorf("failed to write secret file '%s': %w", strings.TrimPrefix(ref, FileRefScheme), err)
+			}
+			finalEnvMap[k] = path
+			continue
+		}
+		valBytes, err := l.ResolveRef(ref)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get secret '%s': %w", secretKey, err)
+			return nil, fmt.Errorf("failed to get secret '%s': %w", strings.TrimPrefix(ref, RefScheme), err)
 		}
 		secretsToZero = append(secretsToZero, valBytes)
 		finalEnvMap[k] = string(valBytes)
@@ -250,14 +335,21 @@ func parseEnvFile(filepath string) (map[string]string, error) {
 		return nil, err
 	}
 	defer file.Close()
+	return parseEnv(file)
+}
 
+// parseEnv reads KEY=value lines. Blank lines, comments and lines without
+// '=' are skipped; an "export " prefix and matching surrounding quotes are
+// removed.
+func parseEnv(r io.Reader) (map[string]string, error) {
 	env := make(map[string]string)
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
 		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
 		parts := strings.SplitN(line, "=", 2)
 		if len(parts) != 2 {
 			continue
@@ -266,8 +358,8 @@ func parseEnvFile(filepath string) (map[string]string, error) {
 		val := strings.TrimSpace(parts[1])
 
 		// Strip quotes if present
-		if (strings.HasPrefix(val, "\"") && strings.HasSuffix(val, "\"")) ||
-			(strings.HasPrefix(val, "'") && strings.HasSuffix(val, "'")) {
+		if len(val) >= 2 && ((strings.HasPrefix(val, "\"") && strings.HasSuffix(val, "\"")) ||
+			(strings.HasPrefix(val, "'") && strings.HasSuffix(val, "'"))) {
 			val = val[1 : len(val)-1]
 		}
 		env[key] = val
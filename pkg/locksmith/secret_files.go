@@ -0,0 +1,191 @@
+package locksmith
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// FileRefScheme prefixes references to secrets that are written to a
+// private temporary file for the lifetime of a child process. The variable
+// is set to the file's path:
+//
+//	KUBECONFIG=locksmith-file://k8s/prod
+//
+// The rest of the reference follows the locksmith:// syntax, so vaults and
+// fields (locksmith-file://@work/gcp#service-account) work too.
+const FileRefScheme = "locksmith-file://"
+
+// FileNameMetadataKey is the Secret.Metadata entry recording the original
+// name of a file stored with 'locksmith add --file'.
+const FileNameMetadataKey = "filename"
+
+// IsFileRef reports whether s uses the locksmith-file:// scheme.
+func IsFileRef(s string) bool {
+	return strings.HasPrefix(strings.TrimSpace(s), FileRefScheme)
+}
+
+// SecretFiles is a private directory of secrets materialized as files. The
+// directory is created on first use with mode 0700 and every file with mode
+// 0600. Callers must call Cleanup once the files are no longer needed.
+type SecretFiles struct {
+	mu    sync.Mutex
+	dir   string
+	paths []string
+	// aborted is set once the files have been removed on a signal; no
+	// more are written after that.
+	aborted bool
+}
+
+// NewFileSecret returns a secret holding the contents of a file named name.
+func NewFileSecret(name string, data []byte) Secret {
+	return Secret{
+		Value:    data,
+		Kind:     SecretKindFile,
+		Metadata: map[string]string{FileNameMetadataKey: filepath.Base(name)},
+	}
+}
+
+// Dir returns the directory holding the files, or "" before the first write.
+func (f *SecretFiles) Dir() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.dir
+}
+
+// write stores data in a new file named name and returns its path.
+func (f *SecretFiles) write(name string, data []byte) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.aborted {
+		return "", fmt.Errorf("interrupted")
+	}
+	if f.dir == "" {
+		dir, err := os.MkdirTemp(secretFilesBaseDir(), "locksmith-files-")
+		if err != nil {
+			return "", fmt.Errorf("failed to create secret file directory: %w", err)
+		}
+		if err := os.Chmod(dir, 0700); err != nil {
+			_ = os.RemoveAll(dir)
+			return "", err
+		}
+		f.dir = dir
+	}
+
+	path := filepath.Join(f.dir, name)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600) // #nosec G304 -- name is derived from an env var name inside our private directory
+	if err != nil {
+		return "", fmt.Errorf("failed to create secret file: %w", err)
+	}
+	f.paths = append(f.paths, path)
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		return "", fmt.Errorf("failed to write secret file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("failed to write secret file: %w", err)
+	}
+	return path, nil
+}
+
+// Cleanup overwrites every file with zeros, removes it and removes the
+// directory. It is safe to call more than once.
+func (f *SecretFiles) Cleanup() error {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.cleanupLocked()
+}
+
+// abort removes the files for a process exiting on a signal, while
+// another goroutine may still be resolving references into f.
+func (f *SecretFiles) abort() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.aborted = true
+	_ = f.cleanupLocked()
+}
+
+func (f *SecretFiles) cleanupLocked() error {
+	if f.dir == "" {
+		return nil
+	}
+	var errs []error
+	for _, path := range f.paths {
+		if err := shredFile(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	if err := os.RemoveAll(f.dir); err != nil {
+		errs = append(errs, err)
+	}
+	f.dir, f.paths = "", nil
+	return errors.Join(errs...)
+}
+
+// shredFile overwrites path with zeros before removing it. The child may
+// have replaced the file, so the current size is used.
+func shredFile(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode().IsRegular() {
+		if file, err := os.OpenFile(path, os.O_WRONLY, 0); err == nil { // #nosec G304 -- path was created by SecretFiles.write
+			_, _ = file.Write(make([]byte, info.Size()))
+			_ = file.Sync()
+			_ = file.Close()
+		}
+	}
+	return os.Remove(path)
+}
+
+// secretFilesBaseDir prefers memory-backed locations so secret files never
+// reach a disk: $XDG_RUNTIME_DIR, then /dev/shm on Linux, then the
+// system temporary directory.
+func secretFilesBaseDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+	}
+	if runtime.GOOS == "linux" {
+		if info, err := os.Stat("/dev/shm"); err == nil && info.IsDir() {
+			return "/dev/shm"
+		}
+	}
+	return os.TempDir()
+}
+
+// materializeFileRef writes the secret referenced by ref to a file named
+// after envName and returns its path. The extension of the stored file name
+// (or of the key) is kept, since some tools look at it.
+func (l *Locksmith) materializeFileRef(files *SecretFiles, envName, ref string) (string, error) {
+	parsed, secret, err := l.readRef(strings.TrimPrefix(strings.TrimSpace(ref), FileRefScheme), readSecret)
+	if err != nil {
+		return "", err
+	}
+	data, err := refValue(parsed, secret)
+	if err != nil {
+		return "", err
+	}
+	defer zeroBytes(data)
+
+	ext := filepath.Ext(parsed.Key)
+	if name := secret.Metadata[FileNameMetadataKey]; name != "" && parsed.Field == "" {
+		ext = filepath.Ext(name)
+	}
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == os.PathSeparator {
+			return '_'
+		}
+		return r
+	}, envName)
+	return files.write(name+ext, data)
+}
@@ -0,0 +1,151 @@
+package locksmith
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolveEnvironmentWithFiles(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	l, _ := newHistoryTestLocksmith()
+	if err := l.PutSecret("k8s/prod", NewFileSecret("/home/me/.kube/config.yaml", []byte("apiVersion: v1\n")), false); err != nil {
+		t.Fatal(err)
+	}
+
+	env, files, err := l.ResolveEnvironmentWithFiles(nil, map[string]string{
+		"KUBECONFIG":   "locksmith-file://k8s/prod",
+		"PLAIN_CONFIG": "locksmith://k8s/prod",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := make(map[string]string)
+	for _, kv := range env {
+		k, v, _ := strings.Cut(kv, "=")
+		vars[k] = v
+	}
+
+	path := vars["KUBECONFIG"]
+	if filepath.Dir(filepath.Dir(path)) != os.Getenv("XDG_RUNTIME_DIR") || filepath.Base(path) != "KUBECONFIG.yaml" {
+		t.Errorf("unexpected file path %q", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "apiVersion: v1\n" {
+		t.Fatalf("file contents = %q, %v", data, err)
+	}
+	if vars["PLAIN_CONFIG"] != "apiVersion: v1\n" {
+		t.Errorf("locksmith:// should still inline the contents, got %q", vars["PLAIN_CONFIG"])
+	}
+	if runtime.GOOS != "windows" {
+		info, _ := os.Stat(path)
+		dirInfo, _ := os.Stat(files.Dir())
+		if info.Mode().Perm() != 0600 || dirInfo.Mode().Perm() != 0700 {
+			t.Errorf("unexpected permissions: file %v, dir %v", info.Mode().Perm(), dirInfo.Mode().Perm())
+		}
+	}
+
+	if err := files.Cleanup(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Dir(path)); !os.IsNotExist(err) {
+		t.Errorf("secret file directory should be removed, got %v", err)
+	}
+
+	if _, err := l.ResolveEnvironment(nil, map[string]string{"KUBECONFIG": "locksmith-file://k8s/prod"}); err == nil {
+		t.Error("ResolveEnvironment should reject file references")
+	}
+	if _, _, err := l.ResolveEnvironmentWithFiles(nil, map[string]string{"KUBECONFIG": "locksmith-file://missing"}); err == nil {
+		t.Error("expected an error for a missing secret")
+	}
+}
+
+func TestRunRemovesSecretFiles(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	runtimeDir := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", runtimeDir)
+	l, _ := newHistoryTestLocksmith()
+	_ = l.PutSecret("gcp/sa", Secret{Value: []byte(`{"type":"service_account"}`)}, false)
+
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("GOOGLE_APPLICATION_CREDENTIALS=locksmith-file://gcp/sa\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	code, err := l.Run([]string{"sh", "-c", `grep -q service_account "$GOOGLE_APPLICATION_CREDENTIALS"`}, envFile)
+	if err != nil || code != 0 {
+		t.Fatalf("child could not read the secret file: exit %d, %v", code, err)
+	}
+	entries, _ := os.ReadDir(runtimeDir)
+	if len(entries) != 0 {
+		t.Errorf("secret files left behind: %v", entries)
+	}
+}
+
+// blockingBackend serves one read and then blocks, like a biometric prompt
+// left unanswered.
+type blockingBackend struct {
+	*attrBackend
+	reads int
+}
+
+func (b *blockingBackend) Get(service, account string, useBiometrics bool, prompt string) ([]byte, error) {
+	if b.reads++; b.reads > 1 {
+		select {}
+	}
+	return b.attrBackend.Get(service, account, useBiometrics, prompt)
+}
+
+func TestRunRemovesSecretFilesOnSignal(t *testing.T) {
+	if os.Getenv("LOCKSMITH_TEST_RUN_SIGNAL") == "1" {
+		l, b := newHistoryTestLocksmith()
+		_ = l.PutSecret("gcp/sa", Secret{Value: []byte(`{"type":"service_account"}`)}, false)
+		l.Backend = &blockingBackend{attrBackend: b}
+		l.Options.BypassCache = true
+		l.Config = &Config{Integrations: map[string]IntegrationConfig{"gcloud": {Command: "true", Env: map[string]string{
+			"GOOGLE_APPLICATION_CREDENTIALS": "locksmith-file://gcp/sa",
+			"CLOUDSDK_AUTH_CREDENTIAL_FILE":  "locksmith-file://gcp/sa",
+		}}}}
+		_, _ = l.RunIntegration("gcloud", nil)
+		return
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("cannot interrupt a child process on Windows")
+	}
+
+	// The helper writes one secret file, then waits on the second read
+	// until interrupted.
+	runtimeDir := t.TempDir()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestRunRemovesSecretFilesOnSignal$")
+	cmd.Env = append(os.Environ(), "LOCKSMITH_TEST_RUN_SIGNAL=1", "XDG_RUNTIME_DIR="+runtimeDir)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	written := false
+	for deadline := time.Now().Add(10 * time.Second); !written && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		dirs, _ := os.ReadDir(runtimeDir)
+		for _, d := range dirs {
+			files, _ := os.ReadDir(filepath.Join(runtimeDir, d.Name()))
+			written = written || len(files) > 0
+		}
+	}
+	if !written {
+		_ = cmd.Process.Kill()
+		t.Fatal("no secret file was written")
+	}
+	_ = cmd.Process.Signal(os.Interrupt)
+	err := cmd.Wait()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 130 {
+		t.Errorf("expected exit status 130, got %v", err)
+	}
+	if entries, _ := os.ReadDir(runtimeDir); len(entries) != 0 {
+		t.Errorf("secret files left behind: %v", entries)
+	}
+}
@@ -0,0 +1,139 @@
+package locksmith
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bonjoski/locksmith/v2/pkg/session"
+)
+
+// SessionStore is the session daemon as Locksmith uses it (see pkg/session):
+// backend items read by one process are held for the others of the same
+// work session, so they need not authenticate again. Failed lookups are
+// misses.
+type SessionStore interface {
+	Get(service, account string) ([]byte, bool)
+	Put(service, account string, data []byte)
+	Forget(service, account string)
+}
+
+// DaemonConfig configures 'locksmith daemon'.
+type DaemonConfig struct {
+	IdleTimeout     string `yaml:"idle_timeout,omitempty"`     // lock after this long unused; default 15m
+	AbsoluteTimeout string `yaml:"absolute_timeout,omitempty"` // lock this long after unlocking; default 8h
+}
+
+// DaemonTimeouts returns the session daemon's idle and absolute timeouts.
+// "0" or "never" disables a timeout.
+func (c *Config) DaemonTimeouts() (idle, absolute time.Duration, err error) {
+	idle, absolute = session.DefaultIdleTimeout, session.DefaultAbsoluteTimeout
+	if c == nil {
+		return idle, absolute, nil
+	}
+	if c.Daemon.IdleTimeout != "" {
+		if idle, err = ParseDaemonTimeout(c.Daemon.IdleTimeout); err != nil {
+			return 0, 0, err
+		}
+	}
+	if c.Daemon.AbsoluteTimeout != "" {
+		if absolute, err = ParseDaemonTimeout(c.Daemon.AbsoluteTimeout); err != nil {
+			return 0, 0, err
+		}
+	}
+	return idle, absolute, nil
+}
+
+// ParseDaemonTimeout parses a daemon timeout such as "15m" or "1d"; "0" or
+// "never" disables it.
+func ParseDaemonTimeout(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if strings.EqualFold(s, CacheNever) || s == "0" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		if d, err = ParseDuration(s); err != nil {
+			return 0, fmt.Errorf("invalid daemon timeout '%s': use a duration such as 15m or 8h, or 'never'", s)
+		}
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("invalid daemon timeout '%s': must not be negative", s)
+	}
+	return d, nil
+}
+
+// sessionGet returns key's item from the session daemon. Like the disk
+// cache, it is skipped with BypassCache.
+func (l *Locksmith) sessionGet(key string) ([]byte, bool) {
+	if l.Session == nil || l.Options.BypassCache {
+		return nil, false
+	}
+	return l.Session.Get(l.Service, key)
+}
+
+// sessionPut offers an item just read from the backend to the session
+// daemon, which keeps it while the session is unlocked.
+func (l *Locksmith) sessionPut(key string, data []byte) {
+	if l.Session == nil || l.Options.BypassCache || len(data) == 0 {
+		return
+	}
+	l.Session.Put(l.Service, key, data)
+}
+
+// sessionForget drops key from the session daemon after it was written or
+// deleted.
+func (l *Locksmith) sessionForget(key string) {
+	if l.Session != nil {
+		l.Session.Forget(l.Service, key)
+	}
+}
+
+// SessionItems reads the keys matching one of patterns, or every key when
+// none are given, behind a single prompt, as the items 'locksmith unlock'
+// starts a session with. The daemon serves a session's keys without asking
+// again, so that prompt is shown even when RequireBiometrics is off, and a
+// selection matching no key is an error rather than a session opened
+// without authentication.
+func (l *Locksmith) SessionItems(patterns []string) ([]session.Item, error) {
+	for _, pattern := range patterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+		}
+	}
+	keys, err := l.ListKeyNames()
+	if err != nil {
+		return nil, err
+	}
+	var selected []string
+	for _, key := range keys {
+		if len(patterns) == 0 || matchesAny(patterns, key) {
+			selected = append(selected, key)
+		}
+	}
+	if len(selected) == 0 {
+		if len(patterns) == 0 {
+			return nil, fmt.Errorf("vault '%s' has no secrets to unlock", l.vaultName())
+		}
+		return nil, fmt.Errorf("no secrets match %s", strings.Join(patterns, ", "))
+	}
+
+	prompt := l.Options.getPrompt(fmt.Sprintf("Authentication required to unlock %d secrets", len(selected)), "")
+	auth := newAuthSession(prompt)
+	defer auth.end()
+	auth.join(l)
+
+	items := make([]session.Item, 0, len(selected))
+	for _, key := range selected {
+		data, err := l.Backend.Get(l.Service, key, true, prompt)
+		if err != nil {
+			for _, item := range items {
+				zeroBytes(item.Data)
+			}
+			return nil, fmt.Errorf("failed to read '%s': %w", key, err)
+		}
+		items = append(items, session.Item{Service: l.Service, Account: key, Data: data})
+	}
+	return items, nil
+}
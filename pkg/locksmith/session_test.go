@@ -0,0 +1,119 @@
+package locksmith
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeSession is an always unlocked session daemon.
+type fakeSession struct {
+	items map[string][]byte
+}
+
+func (f *fakeSession) Get(service, account string) ([]byte, bool) {
+	data, ok := f.items[service+"/"+account]
+	return append([]byte(nil), data...), ok
+}
+
+func (f *fakeSession) Put(service, account string, data []byte) {
+	f.items[service+"/"+account] = append([]byte(nil), data...)
+}
+
+func (f *fakeSession) Forget(service, account string) {
+	delete(f.items, service+"/"+account)
+}
+
+func TestSessionStore(t *testing.T) {
+	l, b := newHistoryTestLocksmith()
+	l.Config = &Config{Cache: CacheConfig{TTL: "never"}}
+	if err := l.PutSecret("db", Secret{Value: []byte("one")}, false); err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSession{items: map[string][]byte{}}
+	l.Session = s
+
+	if v, err := l.Get("db"); err != nil || string(v) != "one" {
+		t.Fatalf("Get = %q, %v", v, err)
+	}
+	if _, ok := s.items[l.Service+"/db"]; !ok {
+		t.Fatal("expected the item read from the backend to be offered to the session")
+	}
+
+	// Reads are served by the session without reaching the backend.
+	delete(b.data, "db")
+	if v, err := l.Get("db"); err != nil || string(v) != "one" {
+		t.Errorf("expected the session to serve the read, got %q, %v", v, err)
+	}
+	l.Options.BypassCache = true
+	if _, err := l.Get("db"); err == nil {
+		t.Error("BypassCache must skip the session")
+	}
+	l.Options.BypassCache = false
+
+	// Writes drop the held value.
+	if err := l.PutSecret("db", Secret{Value: []byte("two")}, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.items[l.Service+"/db"]; ok {
+		t.Error("expected a write to drop the held value")
+	}
+	if v, _ := l.Get("db"); string(v) != "two" {
+		t.Errorf("Get after write = %q", v)
+	}
+}
+
+func TestSessionItems(t *testing.T) {
+	l, _ := newHistoryTestLocksmith()
+	for _, key := range []string{"prod/db", "prod/api", "dev/db"} {
+		if err := l.PutSecret(key, Secret{Value: []byte("v")}, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	items, err := l.SessionItems([]string{"prod/*"})
+	if err != nil || len(items) != 2 {
+		t.Fatalf("SessionItems = %v, %v", items, err)
+	}
+	for _, item := range items {
+		if item.Service != l.Service || len(item.Data) == 0 {
+			t.Errorf("unexpected item %+v", item)
+		}
+	}
+	if all, err := l.SessionItems(nil); err != nil || len(all) != 3 {
+		t.Errorf("expected every key without patterns, got %d, %v", len(all), err)
+	}
+	if _, err := l.SessionItems([]string{"["}); err == nil {
+		t.Error("expected an invalid pattern to fail")
+	}
+
+	// Unlocking authenticates once even without RequireBiometrics, and
+	// never without reading anything.
+	counter := &gateCounter{Backend: l.Backend}
+	l.Backend = counter
+	l.Cache = &MockCache{secrets: map[string]Secret{}}
+	if _, err := l.SessionItems([]string{"prod/*"}); err != nil || len(counter.gated) != 1 {
+		t.Errorf("expected one gated read, got %v, %v", counter.gated, err)
+	}
+	if items, err := l.SessionItems([]string{"nomatch/*"}); err == nil || items != nil {
+		t.Errorf("expected an empty selection to fail, got %v, %v", items, err)
+	}
+	empty, _ := newHistoryTestLocksmith()
+	if _, err := empty.SessionItems(nil); err == nil {
+		t.Error("expected an empty vault to fail")
+	}
+}
+
+func TestDaemonTimeouts(t *testing.T) {
+	idle, absolute, err := (&Config{Daemon: DaemonConfig{IdleTimeout: "5m", AbsoluteTimeout: "1d"}}).DaemonTimeouts()
+	if err != nil || idle != 5*time.Minute || absolute != 24*time.Hour {
+		t.Errorf("DaemonTimeouts = %v, %v, %v", idle, absolute, err)
+	}
+	if idle, _, _ := (*Config)(nil).DaemonTimeouts(); idle != 15*time.Minute {
+		t.Errorf("default idle timeout = %v", idle)
+	}
+	if d, err := ParseDaemonTimeout("never"); err != nil || d != 0 {
+		t.Errorf("never = %v, %v", d, err)
+	}
+	if _, err := ParseDaemonTimeout("soon"); err == nil {
+		t.Error("expected an invalid timeout to fail")
+	}
+}
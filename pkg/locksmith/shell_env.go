@@ -2,16 +2,19 @@ package locksmith
 
 import "fmt"
 
-// ResolveShellEnv resolves a map of ENV_NAME -> locksmith://key (or bare key)
+// ResolveShellEnv resolves a map of ENV_NAME -> locksmith://key (or bare key,
+// or locksmith://@vault/key for another vault)
 // into a map of ENV_NAME -> plaintext value. Intended for shell export use cases.
 func (l *Locksmith) ResolveShellEnv(envMap map[string]string) (map[string]string, error) {
 	normalized := normalizeIntegrationEnv(envMap)
 	out := make(map[string]string, len(normalized))
 	for envName, ref := range normalized {
-		key := ref[len("locksmith://"):]
-		val, err := l.Get(key)
+		if IsFileRef(ref) {
+			return nil, fmt.Errorf("%s (%s): %s references cannot be exported to a shell; use 'locksmith run'", envName, ref, FileRefScheme)
+		}
+		val, err := l.ResolveRef(ref)
 		if err != nil {
-			return nil, fmt.Errorf("failed to resolve %s (locksmith://%s): %w", envName, key, err)
+			return nil, fmt.Errorf("failed to resolve %s (%s): %w", envName, ref, err)
 		}
 		out[envName] = string(val)
 	}
@@ -0,0 +1,177 @@
+package locksmith
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// RenderTemplate renders a Go text/template with access to secrets:
+//
+//	{{ secret "db/password" }}             a secret's value (any reference form)
+//	{{ secret "db" "user" }}               a field of a structured secret
+//	{{ meta "db/password" "expires_at" }}  a metadata value
+//	{{ secret "api/key" | base64 }}        base64, base64decode, json, shell, trim
+//
+// Every secret is read once, and at most one authentication prompt is shown
+// per vault. Nothing is returned unless the whole template renders; the
+// caller should zero the result once written.
+func (l *Locksmith) RenderTemplate(name, text string) ([]byte, error) {
+	r := &templateRenderer{l: l, secrets: make(map[SecretRef]*Secret)}
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(r.funcs()).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	r.session = newAuthSession(l.Options.getPrompt("Authentication required to render '%s'", name))
+	defer r.session.end()
+	defer r.zero()
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, nil); err != nil {
+		zeroBytes(buf.Bytes())
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type templateRenderer struct {
+	l       *Locksmith
+	session *authSession
+	secrets map[SecretRef]*Secret
+}
+
+func (r *templateRenderer) funcs() template.FuncMap {
+	return template.FuncMap{
+		"secret":       r.secret,
+		"meta":         r.meta,
+		"base64":       func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+		"base64decode": base64Decode,
+		"json":         jsonQuote,
+		"shell":        shellQuote,
+		"trim":         strings.TrimSpace,
+	}
+}
+
+// load reads the secret ref points to, once per render.
+func (r *templateRenderer) load(ref string) (SecretRef, *Secret, error) {
+	return r.l.readRef(ref, func(target *Locksmith, parsed SecretRef) (*Secret, error) {
+		key := SecretRef{Vault: parsed.Vault, Key: parsed.Key}
+		if secret, ok := r.secrets[key]; ok {
+			return secret, nil
+		}
+		r.session.join(target)
+		secret, err := target.getSecret(parsed.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read '%s': %w", parsed.Key, err)
+		}
+		if secret == nil {
+			return nil, fmt.Errorf("failed to read '%s': %w", parsed.Key, ErrNotFound)
+		}
+		// Keep a private copy so zeroing it cannot touch a cached value.
+		own := *secret
+		own.Value = append([]byte(nil), secret.Value...)
+		r.secrets[key] = &own
+		return &own, nil
+	})
+}
+
+func (r *templateRenderer) secret(ref string, field ...string) (string, error) {
+	parsed, secret, err := r.load(ref)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case len(field) > 1:
+		return "", fmt.Errorf("secret takes a reference and at most one field name")
+	case len(field) == 1:
+		if parsed.Field != "" {
+			return "", fmt.Errorf("'%s' already names a field", ref)
+		}
+		parsed.Field = field[0]
+	}
+	value, err := refValue(parsed, secret)
+	if err != nil {
+		return "", err
+	}
+	defer zeroBytes(value)
+	return string(value), nil
+}
+
+func (r *templateRenderer) meta(ref, name string) (string, error) {
+	_, secret, err := r.load(ref)
+	if err != nil {
+		return "", err
+	}
+	return metadataValue(secret, name)
+}
+
+func (r *templateRenderer) zero() {
+	for _, secret := range r.secrets {
+		secret.Zero()
+	}
+}
+
+// metadataValue returns a secret's metadata by the name used in JSON
+// output, or a custom metadata entry.
+func metadataValue(secret *Secret, name string) (string, error) {
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+	switch name {
+	case "created_at":
+		return formatTime(secret.CreatedAt), nil
+	case "expires_at":
+		return formatTime(secret.ExpiresAt), nil
+	case "secret_type", "type":
+		return string(secret.SecretType), nil
+	case "owner_application", "owner":
+		return secret.OwnerApplication, nil
+	case "source_url":
+		return secret.SourceURL, nil
+	case "version":
+		return strconv.Itoa(secret.Version), nil
+	case "written_by":
+		return secret.WrittenBy, nil
+	case "description":
+		return secret.Description, nil
+	case "tags":
+		return strings.Join(secret.Tags, ","), nil
+	case "kind":
+		return string(secret.Kind), nil
+	}
+	if v, ok := secret.Metadata[strings.TrimPrefix(name, "metadata.")]; ok {
+		return v, nil
+	}
+	return "", fmt.Errorf("unknown metadata '%s'", name)
+}
+
+func base64Decode(s string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// jsonQuote encodes v as JSON; strings come out quoted and escaped.
+func jsonQuote(v any) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// shellQuote wraps s in single quotes for POSIX shells.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
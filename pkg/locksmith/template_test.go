@@ -0,0 +1,100 @@
+package locksmith
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// gateCounter records which reads asked for biometrics.
+type gateCounter struct {
+	Backend
+	gated   []string
+	prompts []string
+}
+
+func (b *gateCounter) Get(service, account string, useBiometrics bool, prompt string) ([]byte, error) {
+	if useBiometrics {
+		b.gated = append(b.gated, account)
+		b.prompts = append(b.prompts, prompt)
+	}
+	return b.Backend.Get(service, account, useBiometrics, prompt)
+}
+
+func TestRenderTemplate(t *testing.T) {
+	l, b := newHistoryTestLocksmith()
+	expires := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	_ = l.PutSecret("db/password", Secret{Value: []byte("p'w\"1"), ExpiresAt: expires, Metadata: map[string]string{"env": "prod"}}, false)
+	db, _ := NewFieldSecret([]Field{{Name: "user", Value: "app"}, {Name: "password", Value: "pw", Sensitive: true}})
+	_ = l.PutSecret("db/prod", db, false)
+
+	counter := &gateCounter{Backend: b}
+	l.Backend = counter
+	l.Options.RequireBiometrics = true
+	l.Options.BypassCache = true
+
+	tmpl := `user={{ secret "db/prod" "user" }}
+pass={{ secret "locksmith://db/prod#password" }}
+quoted={{ secret "db/password" | shell }}
+json={{ secret "db/password" | json }}
+b64={{ secret "db/prod" "user" | base64 }}
+back={{ "YXBw" | base64decode }}
+expires={{ meta "db/password" "expires_at" }}
+env={{ meta "db/password" "env" }}
+`
+	out, err := l.RenderTemplate("app.tmpl", tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `user=app
+pass=pw
+quoted='p'\''w"1'
+json="p'w\"1"
+b64=YXBw
+back=app
+expires=2030-01-02T03:04:05Z
+env=prod
+`
+	if string(out) != want {
+		t.Errorf("rendered:\n%s\nwant:\n%s", out, want)
+	}
+
+	// Two secrets were read, each once, behind a single prompt.
+	if len(counter.gated) != 1 || !strings.Contains(counter.prompts[0], "app.tmpl") {
+		t.Errorf("expected one gated read for the template, got %v %v", counter.gated, counter.prompts)
+	}
+	if l.Backend != counter {
+		t.Error("the original backend should be restored after rendering")
+	}
+
+	// A second render authenticates again.
+	if _, err := l.RenderTemplate("again", `{{ secret "db/password" }}`); err != nil {
+		t.Fatal(err)
+	}
+	if len(counter.gated) != 2 {
+		t.Errorf("expected a new prompt for a new render, got %v", counter.gated)
+	}
+}
+
+func TestRenderTemplateErrors(t *testing.T) {
+	l, _ := newHistoryTestLocksmith()
+	db, _ := NewFieldSecret([]Field{{Name: "user", Value: "app"}})
+	_ = l.PutSecret("db/prod", db, false)
+
+	for tmpl, want := range map[string]string{
+		`{{ secret "missing" }}`:             "not found",
+		`{{ secret "db/prod" }}`:             "structured secret",
+		`{{ secret "db/prod" "port" }}`:      "field not found",
+		`{{ meta "db/prod" "colour" }}`:      "unknown metadata",
+		`{{ secret "db/prod#user" "user" }}`: "already names a field",
+		`{{ secret "db/prod" `:               "unclosed action",
+	} {
+		out, err := l.RenderTemplate("t", "before "+tmpl)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected %q error, got %v", tmpl, want, err)
+		}
+		if out != nil {
+			t.Errorf("%s: partial output returned: %q", tmpl, out)
+		}
+	}
+}
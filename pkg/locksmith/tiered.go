@@ -0,0 +1,393 @@
+package locksmith
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// TieredBackend writes to a primary backend and mirrors every change to a
+// secondary one (typically an encrypted file backup of the OS keychain).
+// Reads are served by the primary and fall back to the secondary when the
+// primary lacks the key or is unavailable, so secrets survive a keychain
+// reset; Verify and Repair bring the tiers back in sync.
+type TieredBackend struct {
+	Primary   Backend
+	Secondary Backend
+	// OnDivergence is called whenever an operation finds the tiers out of
+	// sync (e.g. a key missing from the primary or a failed mirror write).
+	// It may be nil.
+	OnDivergence func(account string, err error)
+}
+
+// TierReport describes how the key sets and contents of two tiers differ.
+type TierReport struct {
+	InSync        []string
+	OnlyPrimary   []string
+	OnlySecondary []string
+	// Mismatched keys exist in both tiers with different content.
+	Mismatched []string
+	// Unreadable maps keys that could not be read from either tier to the error.
+	Unreadable map[string]error
+}
+
+// Diverged reports whether the tiers differ in any way.
+func (r *TierReport) Diverged() bool {
+	return len(r.OnlyPrimary) > 0 || len(r.OnlySecondary) > 0 || len(r.Mismatched) > 0 || len(r.Unreadable) > 0
+}
+
+func (t *TieredBackend) diverged(account string, err error) {
+	if t.OnDivergence != nil {
+		t.OnDivergence(account, err)
+	}
+}
+
+// cacheKeyBackend keeps the cache key in the primary only.
+func (t *TieredBackend) cacheKeyBackend() Backend {
+	return t.Primary
+}
+
+func (t *TieredBackend) Set(service, account string, data []byte, requireBiometrics bool) error {
+	if err := t.Primary.Set(service, account, data, requireBiometrics); err != nil {
+		return err
+	}
+	if err := t.Secondary.Set(service, account, data, requireBiometrics); err != nil {
+		t.diverged(account, fmt.Errorf("mirror write failed: %w", err))
+	}
+	return nil
+}
+
+func (t *TieredBackend) SetWithMetadata(service, account string, data []byte, meta SecretMetadata, requireBiometrics bool) error {
+	if err := setWithMetadata(t.Primary, service, account, data, meta, requireBiometrics); err != nil {
+		return err
+	}
+	if err := setWithMetadata(t.Secondary, service, account, data, meta, requireBiometrics); err != nil {
+		t.diverged(account, fmt.Errorf("mirror write failed: %w", err))
+	}
+	return nil
+}
+
+func (t *TieredBackend) Get(service, account string, useBiometrics bool, prompt string) ([]byte, error) {
+	data, err := t.Primary.Get(service, account, useBiometrics, prompt)
+	if err == nil {
+		return data, nil
+	}
+	// A denied or cancelled prompt must not be answered by a secondary that
+	// does not prompt, which would defeat RequireBiometrics.
+	if !isNotFound(err) && !errors.Is(err, ErrBackendUnavailable) {
+		return nil, err
+	}
+
+	fallback, fbErr := t.Secondary.Get(service, account, useBiometrics, prompt)
+	if fbErr != nil {
+		return nil, err
+	}
+	t.diverged(account, fmt.Errorf("served from secondary backend: %w", err))
+	return fallback, nil
+}
+
+func (t *TieredBackend) Delete(service, account string, useBiometrics bool, prompt string) error {
+	if err := t.Primary.Delete(service, account, useBiometrics, prompt); err != nil {
+		return err
+	}
+	if err := t.Secondary.Delete(service, account, useBiometrics, prompt); err != nil {
+		t.diverged(account, fmt.Errorf("mirror delete failed: %w", err))
+	}
+	return nil
+}
+
+// List returns the union of both tiers' keys, so secrets that only survive
+// in the secondary remain visible (and readable through Get).
+func (t *TieredBackend) List(service string, useBiometrics bool, prompt string) ([]string, error) {
+	primary, err := t.Primary.List(service, useBiometrics, prompt)
+	secondary, secErr := t.Secondary.List(service, useBiometrics, prompt)
+	if err != nil && secErr != nil {
+		return nil, err
+	}
+	if err != nil {
+		t.diverged("", fmt.Errorf("listing from secondary backend: %w", err))
+	}
+
+	seen := make(map[string]bool, len(primary)+len(secondary))
+	keys := make([]string, 0, len(primary)+len(secondary))
+	for _, k := range append(primary, secondary...) {
+		if !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// ListMetadata merges both tiers like List, preferring the primary's
+// metadata. Keys only the secondary holds keep the secondary's metadata, or
+// none when it cannot list metadata.
+func (t *TieredBackend) ListMetadata(service string, useBiometrics bool, prompt string) (map[string]SecretMetadata, error) {
+	mb, ok := t.Primary.(MetadataBackend)
+	if !ok {
+		return nil, ErrMetadataUnsupported
+	}
+	primary, err := mb.ListMetadata(service, useBiometrics, prompt)
+	if errors.Is(err, ErrMetadataUnsupported) {
+		return nil, err
+	}
+	secondary, secErr := listTierMetadata(t.Secondary, service, useBiometrics, prompt)
+	if err != nil && secErr != nil {
+		return nil, err
+	}
+	if err != nil {
+		t.diverged("", fmt.Errorf("listing from secondary backend: %w", err))
+	}
+
+	result := make(map[string]SecretMetadata, len(primary)+len(secondary))
+	for k, meta := range secondary {
+		result[k] = meta
+	}
+	for k, meta := range primary {
+		result[k] = meta
+	}
+	return result, nil
+}
+
+// listTierMetadata lists b's metadata, or only its keys when b cannot list
+// metadata.
+func listTierMetadata(b Backend, service string, useBiometrics bool, prompt string) (map[string]SecretMetadata, error) {
+	if mb, ok := b.(MetadataBackend); ok {
+		meta, err := mb.ListMetadata(service, useBiometrics, prompt)
+		if !errors.Is(err, ErrMetadataUnsupported) {
+			return meta, err
+		}
+	}
+	keys, err := b.List(service, useBiometrics, prompt)
+	if err != nil {
+		return nil, err
+	}
+	meta := make(map[string]SecretMetadata, len(keys))
+	for _, k := range keys {
+		meta[k] = SecretMetadata{}
+	}
+	return meta, nil
+}
+
+// partialMetadata also reports a secondary that cannot list metadata, whose
+// keys ListMetadata returns without any.
+func (t *TieredBackend) partialMetadata() bool {
+	if _, ok := t.Secondary.(MetadataBackend); !ok {
+		return true
+	}
+	return listsPartialMetadata(t.Primary) || listsPartialMetadata(t.Secondary)
+}
+
+// Verify compares the key sets of both tiers and the value and metadata of
+// every item present in both. Reading items may trigger authentication prompts.
+func (t *TieredBackend) Verify(service string, useBiometrics bool, prompt string) (*TierReport, error) {
+	primary, err := t.Primary.List(service, useBiometrics, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list primary backend: %w", err)
+	}
+	secondary, err := t.Secondary.List(service, useBiometrics, prompt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secondary backend: %w", err)
+	}
+
+	// The cache master key is per-machine and deliberately not mirrored.
+	primary = withoutKey(primary, MasterKeyAccount)
+	secondary = withoutKey(secondary, MasterKeyAccount)
+
+	report := &TierReport{Unreadable: make(map[string]error)}
+	inSecondary := make(map[string]bool, len(secondary))
+	for _, k := range secondary {
+		inSecondary[k] = true
+	}
+	inPrimary := make(map[string]bool, len(primary))
+	for _, k := range primary {
+		inPrimary[k] = true
+		if !inSecondary[k] {
+			report.OnlyPrimary = append(report.OnlyPrimary, k)
+		}
+	}
+	for _, k := range secondary {
+		if !inPrimary[k] {
+			report.OnlySecondary = append(report.OnlySecondary, k)
+		}
+	}
+
+	for _, k := range primary {
+		if !inSecondary[k] {
+			continue
+		}
+		p, err := t.Primary.Get(service, k, useBiometrics, prompt)
+		if err != nil {
+			report.Unreadable[k] = fmt.Errorf("primary: %w", err)
+			continue
+		}
+		s, err := t.Secondary.Get(service, k, useBiometrics, prompt)
+		if err != nil {
+			zeroBytes(p)
+			report.Unreadable[k] = fmt.Errorf("secondary: %w", err)
+			continue
+		}
+		same := sameSecret(p, s)
+		zeroBytes(p)
+		zeroBytes(s)
+		if same {
+			report.InSync = append(report.InSync, k)
+		} else {
+			report.Mismatched = append(report.Mismatched, k)
+		}
+	}
+
+	sort.Strings(report.InSync)
+	sort.Strings(report.OnlyPrimary)
+	sort.Strings(report.OnlySecondary)
+	sort.Strings(report.Mismatched)
+	return report, nil
+}
+
+// Repair copies missing items to the tier that lacks them and resolves
+// mismatches in favour of the most recently created secret (the primary
+// wins ties or undecodable items). It returns the keys it rewrote.
+func (t *TieredBackend) Repair(service string, report *TierReport, useBiometrics bool, prompt string) ([]string, error) {
+	var repaired []string
+	var errs []error
+
+	copyItem := func(from, to Backend, key string) {
+		data, err := from.Get(service, key, useBiometrics, prompt)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			return
+		}
+		defer zeroBytes(data)
+		if err := setDecoded(to, service, key, data, useBiometrics); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			return
+		}
+		repaired = append(repaired, key)
+	}
+
+	for _, k := range report.OnlyPrimary {
+		copyItem(t.Primary, t.Secondary, k)
+	}
+	for _, k := range report.OnlySecondary {
+		copyItem(t.Secondary, t.Primary, k)
+	}
+	for _, k := range report.Mismatched {
+		newer, err := t.newerTier(service, k, useBiometrics, prompt)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", k, err))
+			continue
+		}
+		if newer == t.Primary {
+			copyItem(t.Primary, t.Secondary, k)
+		} else {
+			copyItem(t.Secondary, t.Primary, k)
+		}
+	}
+
+	sort.Strings(repaired)
+	return repaired, errors.Join(errs...)
+}
+
+func (t *TieredBackend) newerTier(service, key string, useBiometrics bool, prompt string) (Backend, error) {
+	p, err := t.Primary.Get(service, key, useBiometrics, prompt)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(p)
+	s, err := t.Secondary.Get(service, key, useBiometrics, prompt)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(s)
+
+	var ps, ss Secret
+	if json.Unmarshal(p, &ps) != nil || json.Unmarshal(s, &ss) != nil {
+		return t.Primary, nil
+	}
+	defer zeroBytes(ps.Value)
+	defer zeroBytes(ss.Value)
+	if ss.CreatedAt.After(ps.CreatedAt) {
+		return t.Secondary, nil
+	}
+	return t.Primary, nil
+}
+
+// setDecoded writes data to b, carrying over the secret's metadata when
+// data is a marshalled Secret.
+func setDecoded(b Backend, service, key string, data []byte, requireBiometrics bool) error {
+	var secret Secret
+	if err := json.Unmarshal(data, &secret); err != nil {
+		return b.Set(service, key, data, requireBiometrics)
+	}
+	defer zeroBytes(secret.Value)
+	return setWithMetadata(b, service, key, data, metadataOf(secret), requireBiometrics)
+}
+
+func withoutKey(keys []string, drop string) []string {
+	out := keys[:0:0]
+	for _, k := range keys {
+		if k != drop {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+// newTieredBackendFactory builds tiered backends from r. Options:
+//
+//	primary:   backend name (default native)
+//	secondary: backend name (default file)
+//	primary.<opt>, secondary.<opt>: options passed to the respective tier
+func newTieredBackendFactory(r *BackendRegistry) BackendFactory {
+	return func(options map[string]string) (Backend, error) {
+		primaryName := options["primary"]
+		if primaryName == "" {
+			primaryName = BackendNative
+		}
+		secondaryName := options["secondary"]
+		if secondaryName == "" {
+			secondaryName = BackendFile
+		}
+		for _, name := range []string{primaryName, secondaryName} {
+			if n := normalizeBackendName(name); n == BackendTiered || n == BackendAuto {
+				return nil, fmt.Errorf("'%s' cannot be used as a tier", n)
+			}
+		}
+
+		primary, err := r.Open(BackendConfig{Name: primaryName, Options: tierOptions(options, "primary.")})
+		if err != nil {
+			return nil, fmt.Errorf("primary tier: %w", err)
+		}
+		secondary, err := r.Open(BackendConfig{Name: secondaryName, Options: tierOptions(options, "secondary.")})
+		if err != nil {
+			return nil, fmt.Errorf("secondary tier: %w", err)
+		}
+		return &TieredBackend{Primary: primary, Secondary: secondary, OnDivergence: warnDivergence}, nil
+	}
+}
+
+func tierOptions(options map[string]string, prefix string) map[string]string {
+	out := make(map[string]string)
+	for k, v := range options {
+		if strings.HasPrefix(k, prefix) {
+			out[strings.TrimPrefix(k, prefix)] = v
+		}
+	}
+	return out
+}
+
+// warnDivergence reports tier divergence on stderr unless LOCKSMITH_SILENT is set.
+func warnDivergence(account string, err error) {
+	if os.Getenv("LOCKSMITH_SILENT") == "true" {
+		return
+	}
+	if account == "" {
+		fmt.Fprintf(os.Stderr, "Warning: backend tiers diverged: %v\n", err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Warning: backend tiers diverged for '%s': %v (run 'locksmith backend verify')\n", account, err)
+}
@@ -0,0 +1,298 @@
+package locksmith
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// brokenBackend fails every operation, like a reset or locked keychain.
+type brokenBackend struct{}
+
+var errBroken = fmt.Errorf("keychain reset: %w", ErrBackendUnavailable)
+
+func (brokenBackend) Set(service, account string, data []byte, requireBiometrics bool) error {
+	return errBroken
+}
+func (brokenBackend) Get(service, account string, useBiometrics bool, prompt string) ([]byte, error) {
+	return nil, errBroken
+}
+func (brokenBackend) Delete(service, account string, useBiometrics bool, prompt string) error {
+	return errBroken
+}
+func (brokenBackend) List(service string, useBiometrics bool, prompt string) ([]string, error) {
+	return nil, errBroken
+}
+
+func newTestTiered(primary, secondary Backend) (*TieredBackend, *[]string) {
+	var diverged []string
+	return &TieredBackend{
+		Primary:   primary,
+		Secondary: secondary,
+		OnDivergence: func(account string, err error) {
+			diverged = append(diverged, account)
+		},
+	}, &diverged
+}
+
+func TestTieredMirrorsWritesAndDeletes(t *testing.T) {
+	primary, secondary := newAttrBackend(), newAttrBackend()
+	tb, diverged := newTestTiered(primary, secondary)
+
+	meta := SecretMetadata{SecretType: SecretTypeToken}
+	if err := tb.SetWithMetadata("svc", "k", []byte("v"), meta, false); err != nil {
+		t.Fatalf("SetWithMetadata: %v", err)
+	}
+	if string(primary.data["k"]) != "v" || string(secondary.data["k"]) != "v" {
+		t.Fatal("write not mirrored to both tiers")
+	}
+	if secondary.attrs["k"][attrSecretType] != string(SecretTypeToken) {
+		t.Errorf("metadata not mirrored: %v", secondary.attrs["k"])
+	}
+
+	if err := tb.Delete("svc", "k", false, ""); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, ok := secondary.data["k"]; ok {
+		t.Error("delete not mirrored")
+	}
+	if len(*diverged) != 0 {
+		t.Errorf("unexpected divergence reports: %v", *diverged)
+	}
+}
+
+func TestTieredMirrorFailureIsReported(t *testing.T) {
+	primary := newAttrBackend()
+	tb, diverged := newTestTiered(primary, brokenBackend{})
+
+	if err := tb.Set("svc", "k", []byte("v"), false); err != nil {
+		t.Fatalf("Set should succeed when only the mirror fails: %v", err)
+	}
+	if !reflect.DeepEqual(*diverged, []string{"k"}) {
+		t.Errorf("divergence reports = %v", *diverged)
+	}
+
+	tb, _ = newTestTiered(brokenBackend{}, primary)
+	if err := tb.Set("svc", "k", []byte("v"), false); !errors.Is(err, errBroken) {
+		t.Errorf("primary failure should be returned, got %v", err)
+	}
+}
+
+func TestTieredReadFallback(t *testing.T) {
+	secondary := newAttrBackend()
+	_ = secondary.Set("svc", "k", []byte("backup"), false)
+	tb, diverged := newTestTiered(brokenBackend{}, secondary)
+
+	got, err := tb.Get("svc", "k", false, "")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if string(got) != "backup" {
+		t.Errorf("Get = %q, want backup", got)
+	}
+	if !reflect.DeepEqual(*diverged, []string{"k"}) {
+		t.Errorf("divergence reports = %v", *diverged)
+	}
+
+	keys, err := tb.List("svc", false, "")
+	if err != nil || !reflect.DeepEqual(keys, []string{"k"}) {
+		t.Errorf("List = %v, %v", keys, err)
+	}
+
+	if _, err := tb.Get("svc", "missing", false, ""); !errors.Is(err, errBroken) {
+		t.Errorf("expected primary error when both tiers miss, got %v", err)
+	}
+}
+
+func TestTieredListsSecondaryOnlyKeys(t *testing.T) {
+	primary, secondary := newAttrBackend(), newAttrBackend()
+	tb, diverged := newTestTiered(primary, secondary)
+	_ = primary.SetWithMetadata("svc", "both", []byte("p"), SecretMetadata{SecretType: SecretTypeToken}, false)
+	_ = secondary.SetWithMetadata("svc", "both", []byte("s"), SecretMetadata{SecretType: SecretTypePassword}, false)
+	_ = secondary.SetWithMetadata("svc", "only-secondary", []byte("s"), SecretMetadata{SecretType: SecretTypeAPIKey}, false)
+
+	meta, err := tb.ListMetadata("svc", false, "")
+	if err != nil || len(meta) != 2 {
+		t.Fatalf("ListMetadata = %v, %v", meta, err)
+	}
+	if meta["both"].SecretType != SecretTypeToken || meta["only-secondary"].SecretType != SecretTypeAPIKey {
+		t.Errorf("expected the primary's metadata to win and the secondary's to fill in, got %v", meta)
+	}
+	if tb.partialMetadata() {
+		t.Error("two complete tiers list complete metadata")
+	}
+
+	l := &Locksmith{Service: "svc", Backend: tb, Cache: &MockCache{secrets: map[string]Secret{}}}
+	listed, err := l.List()
+	if _, ok := listed["only-secondary"]; err != nil || !ok {
+		t.Errorf("List = %v, %v", listed, err)
+	}
+	names, err := l.ListKeyNames()
+	if err != nil || !reflect.DeepEqual(names, []string{"both", "only-secondary"}) {
+		t.Errorf("ListKeyNames = %v, %v", names, err)
+	}
+	withMeta, err := l.ListWithMetadata()
+	if m, ok := withMeta["only-secondary"]; err != nil || !ok || m.SecretType != SecretTypeAPIKey {
+		t.Errorf("ListWithMetadata = %v, %v", withMeta, err)
+	}
+
+	// A broken primary lists the secondary alone.
+	tb, diverged = newTestTiered(&brokenMetadataBackend{}, secondary)
+	if meta, err := tb.ListMetadata("svc", false, ""); err != nil || len(meta) != 2 {
+		t.Errorf("expected the secondary's keys, got %v, %v", meta, err)
+	}
+	if len(*diverged) != 1 {
+		t.Errorf("divergence reports = %v", *diverged)
+	}
+
+	// Keys of a secondary that cannot list metadata are listed without any.
+	plain := newAttrBackend()
+	_ = plain.Set("svc", "plain", []byte("v"), false)
+	tb, _ = newTestTiered(primary, struct{ Backend }{plain})
+	if meta, err := tb.ListMetadata("svc", false, ""); err != nil || len(meta) != 2 || !reflect.DeepEqual(meta["plain"], SecretMetadata{}) {
+		t.Errorf("ListMetadata with a plain secondary = %v, %v", meta, err)
+	}
+	if !tb.partialMetadata() {
+		t.Error("a secondary without metadata lists partial metadata")
+	}
+}
+
+// brokenMetadataBackend fails to list metadata like a reset keychain.
+type brokenMetadataBackend struct{ brokenBackend }
+
+func (brokenMetadataBackend) SetWithMetadata(service, account string, data []byte, meta SecretMetadata, requireBiometrics bool) error {
+	return errBroken
+}
+func (brokenMetadataBackend) ListMetadata(service string, useBiometrics bool, prompt string) (map[string]SecretMetadata, error) {
+	return nil, errBroken
+}
+
+// deniedBackend fails reads the way a refused biometric prompt does.
+type deniedBackend struct{ brokenBackend }
+
+var errDenied = errors.New("authentication failed: user cancelled")
+
+func (deniedBackend) Get(service, account string, useBiometrics bool, prompt string) ([]byte, error) {
+	return nil, errDenied
+}
+
+func TestTieredReadDoesNotBypassAuthentication(t *testing.T) {
+	secondary := newAttrBackend()
+	_ = secondary.Set("svc", "k", []byte("backup"), false)
+	tb, diverged := newTestTiered(deniedBackend{}, secondary)
+
+	if got, err := tb.Get("svc", "k", true, ""); !errors.Is(err, errDenied) || got != nil {
+		t.Errorf("expected the denied prompt without fallback, got %q, %v", got, err)
+	}
+	if len(*diverged) != 0 {
+		t.Errorf("unexpected divergence reports: %v", *diverged)
+	}
+
+	// A key missing from the primary is still served by the secondary.
+	tb, _ = newTestTiered(newAttrBackend(), secondary)
+	if got, err := tb.Get("svc", "k", false, ""); err != nil || string(got) != "backup" {
+		t.Errorf("expected fallback on a missing key, got %q, %v", got, err)
+	}
+}
+
+func TestTieredVerifyAndRepair(t *testing.T) {
+	primary, secondary := newAttrBackend(), newAttrBackend()
+	tb, _ := newTestTiered(primary, secondary)
+
+	older, _ := json.Marshal(Secret{Value: []byte("old"), CreatedAt: time.Now().Add(-time.Hour)})
+	newer, _ := json.Marshal(Secret{Value: []byte("new"), CreatedAt: time.Now()})
+
+	_ = primary.Set("svc", "same", []byte("x"), false)
+	_ = secondary.Set("svc", "same", []byte("x"), false)
+	_ = primary.Set("svc", "only-primary", []byte("p"), false)
+	_ = secondary.Set("svc", "only-secondary", []byte("s"), false)
+	_ = primary.Set("svc", "differs", older, false)
+	_ = secondary.Set("svc", "differs", newer, false)
+	_ = primary.Set("svc", MasterKeyAccount, []byte("mk"), false)
+
+	report, err := tb.Verify("svc", false, "")
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	want := &TierReport{
+		InSync:        []string{"same"},
+		OnlyPrimary:   []string{"only-primary"},
+		OnlySecondary: []string{"only-secondary"},
+		Mismatched:    []string{"differs"},
+		Unreadable:    map[string]error{},
+	}
+	if !reflect.DeepEqual(report, want) {
+		t.Fatalf("report = %+v, want %+v", report, want)
+	}
+	if !report.Diverged() {
+		t.Error("expected Diverged")
+	}
+
+	repaired, err := tb.Repair("svc", report, false, "")
+	if err != nil {
+		t.Fatalf("Repair: %v", err)
+	}
+	if !reflect.DeepEqual(repaired, []string{"differs", "only-primary", "only-secondary"}) {
+		t.Errorf("repaired = %v", repaired)
+	}
+	if string(primary.data["differs"]) != string(newer) {
+		t.Error("newer secondary item should win the mismatch")
+	}
+
+	report, err = tb.Verify("svc", false, "")
+	if err != nil {
+		t.Fatalf("Verify after repair: %v", err)
+	}
+	if report.Diverged() {
+		t.Errorf("tiers still diverged after repair: %+v", report)
+	}
+}
+
+func TestTieredVerifyRebuiltSecrets(t *testing.T) {
+	primary, secondary := newAttrBackend(), rebuildingBackend{newAttrBackend()}
+	tb, _ := newTestTiered(primary, secondary)
+	data, _ := json.Marshal(Secret{Value: []byte("v"), CreatedAt: time.Now(), SecretType: SecretTypeToken})
+	if err := tb.Set("svc", "k", data, false); err != nil {
+		t.Fatal(err)
+	}
+	report, err := tb.Verify("svc", false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Diverged() || !reflect.DeepEqual(report.InSync, []string{"k"}) {
+		t.Errorf("expected a rebuilt secret to verify in sync, got %+v", report)
+	}
+}
+
+func TestTieredBackendFromConfig(t *testing.T) {
+	r := NewBackendRegistry()
+	registerDefaultBackends(r)
+	mem := newAttrBackend()
+	_ = r.Register("mem", func(options map[string]string) (Backend, error) {
+		if options["flavour"] != "x" {
+			t.Errorf("tier options not forwarded: %v", options)
+		}
+		return mem, nil
+	})
+
+	b, err := r.Open(BackendConfig{Name: "tiered", Options: map[string]string{
+		"primary":           "mem",
+		"primary.flavour":   "x",
+		"secondary":         "mem",
+		"secondary.flavour": "x",
+	}})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	tb, ok := b.(*TieredBackend)
+	if !ok || tb.Primary != mem || tb.Secondary != mem {
+		t.Fatalf("unexpected backend %#v", b)
+	}
+
+	if _, err := r.Open(BackendConfig{Name: "tiered", Options: map[string]string{"primary": "tiered"}}); err == nil {
+		t.Error("expected error for nested tiered backend")
+	}
+}
@@ -0,0 +1,105 @@
+package locksmith
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	seed := func(s string) string { return base32.StdEncoding.EncodeToString([]byte(s)) }
+	sha1Seed := seed("12345678901234567890")
+	sha256Seed := seed("12345678901234567890123456789012")
+	sha512Seed := seed("1234567890123456789012345678901234567890123456789012345678901234")
+
+	cases := []struct {
+		uri  string
+		unix int64
+		want string
+	}{
+		{"otpauth://totp/x?digits=8&secret=" + sha1Seed, 59, "94287082"},
+		{"otpauth://totp/x?digits=8&secret=" + sha1Seed, 1111111109, "07081804"},
+		{"otpauth://totp/x?digits=8&algorithm=SHA256&secret=" + sha256Seed, 59, "46119246"},
+		{"otpauth://totp/x?digits=8&algorithm=sha512&secret=" + sha512Seed, 20000000000, "47863826"},
+		{sha1Seed, 59, "287082"},
+	}
+	for _, tc := range cases {
+		otp, err := ParseTOTP(tc.uri)
+		if err != nil {
+			t.Fatalf("ParseTOTP(%s): %v", tc.uri, err)
+		}
+		code, remaining := otp.Code(time.Unix(tc.unix, 0))
+		if code != tc.want {
+			t.Errorf("%s at %d = %s, want %s", tc.uri, tc.unix, code, tc.want)
+		}
+		if remaining <= 0 || remaining > 30*time.Second {
+			t.Errorf("unexpected remaining validity %v", remaining)
+		}
+	}
+}
+
+func TestParseTOTP(t *testing.T) {
+	otp, err := ParseTOTP("otpauth://totp/ACME%20Co:alice@example.com?secret=JBSW Y3DP EHPK 3PXP&issuer=ACME&period=60")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if otp.Issuer != "ACME" || otp.Account != "alice@example.com" || otp.Period != time.Minute || otp.Digits != 6 {
+		t.Errorf("unexpected parameters %+v", otp)
+	}
+	if _, err := ParseTOTP("jbsw-y3dp-ehpk-3pxp"); err != nil {
+		t.Errorf("lower-case dashed seed should parse: %v", err)
+	}
+
+	for _, bad := range []string{
+		"not base32!",
+		"",
+		"otpauth://hotp/x?secret=JBSWY3DPEHPK3PXP",
+		"otpauth://totp/x",
+		"otpauth://totp/x?secret=JBSWY3DPEHPK3PXP&algorithm=MD5",
+		"otpauth://totp/x?secret=JBSWY3DPEHPK3PXP&digits=4",
+	} {
+		if _, err := ParseTOTP(bad); err == nil {
+			t.Errorf("ParseTOTP(%q) should fail", bad)
+		}
+	}
+}
+
+func TestOTPReferences(t *testing.T) {
+	l, _ := newHistoryTestLocksmith()
+	if err := l.PutSecret("github/2fa", Secret{Value: []byte("JBSWY3DPEHPK3PXP"), SecretType: SecretTypeTOTP}, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.PutSecret("bad/2fa", Secret{Value: []byte("not-a-seed!"), SecretType: SecretTypeTOTP}, false); err == nil {
+		t.Error("expected an invalid TOTP seed to be rejected")
+	}
+
+	otp, _ := ParseTOTP("JBSWY3DPEHPK3PXP")
+	code, remaining, err := l.OTP("github/2fa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := otp.Code(time.Now()); code != want && remaining > time.Second {
+		t.Errorf("OTP = %s, want %s", code, want)
+	}
+
+	env, err := l.ResolveEnvironment(nil, map[string]string{"GH_OTP": "locksmith://github/2fa?otp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(env) != 1 || !strings.HasPrefix(env[0], "GH_OTP=") || len(env[0]) != len("GH_OTP=")+6 {
+		t.Errorf("expected a six digit code, got %v", env)
+	}
+
+	ref, err := ParseRef("locksmith://@work/acct#totp?otp")
+	if err != nil || ref != (SecretRef{Vault: "work", Key: "acct", Field: "totp", OTP: true}) || ref.String() != "locksmith://@work/acct#totp?otp" {
+		t.Errorf("ParseRef = %+v, %v", ref, err)
+	}
+	if _, err := ParseRef("locksmith://acct?raw"); err == nil {
+		t.Error("expected unknown reference options to be rejected")
+	}
+	_ = l.PutSecret("plain", Secret{Value: []byte("x")}, false)
+	if _, err := l.ResolveRef("plain?otp"); err == nil || !strings.Contains(err.Error(), "not a TOTP secret") {
+		t.Errorf("expected a TOTP error, got %v", err)
+	}
+}
@@ -0,0 +1,177 @@
+package locksmith
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// DefaultVaultName is the vault used when none is selected. It maps to
+	// DefaultService and the top-level backend and auth settings.
+	DefaultVaultName = "default"
+
+	// VaultEnv selects the vault when no --vault flag or Options.Vault is given.
+	VaultEnv = "LOCKSMITH_VAULT"
+)
+
+var vaultNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// VaultInfo is a vault with all inherited settings resolved.
+type VaultInfo struct {
+	Name      string
+	Service   string
+	CacheDir  string
+	IndexPath string
+	LockDir   string // per-key lock files serializing rotations and cache writes
+	Backend   BackendConfig
+	Auth      AuthConfig
+}
+
+// ValidateVaultName checks that name can be used as a vault name.
+func ValidateVaultName(name string) error {
+	if !vaultNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid vault name '%s': use letters, digits, '.', '_' or '-' (max 64 characters)", name)
+	}
+	return nil
+}
+
+// SelectVaultName returns the vault to use: name if set, otherwise
+// LOCKSMITH_VAULT, otherwise the configured default_vault, otherwise
+// DefaultVaultName.
+func SelectVaultName(cfg *Config, name string) string {
+	if n := strings.TrimSpace(name); n != "" {
+		return n
+	}
+	if n := strings.TrimSpace(os.Getenv(VaultEnv)); n != "" {
+		return n
+	}
+	if cfg != nil && strings.TrimSpace(cfg.DefaultVault) != "" {
+		return strings.TrimSpace(cfg.DefaultVault)
+	}
+	return DefaultVaultName
+}
+
+// ResolveVault selects a vault (see SelectVaultName) and resolves its
+// service, cache directory, backend and auth policy. Vaults other than
+// DefaultVaultName must be declared under `vaults:` in the config.
+func ResolveVault(cfg *Config, name string) (*VaultInfo, error) {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	name = SelectVaultName(cfg, name)
+
+	cacheDir, err := VaultCacheDir(name)
+	if err != nil {
+		return nil, err
+	}
+	info := &VaultInfo{
+		Name:      name,
+		Service:   DefaultService,
+		CacheDir:  cacheDir,
+		IndexPath: filepath.Join(filepath.Dir(cacheDir), IndexFileName),
+		LockDir:   filepath.Join(filepath.Dir(cacheDir), lockDirName),
+		Backend:   cfg.Backend,
+		Auth:      cfg.Auth,
+	}
+	if name == DefaultVaultName {
+		return info, nil
+	}
+
+	if err := ValidateVaultName(name); err != nil {
+		return nil, err
+	}
+	vc, ok := cfg.Vaults[name]
+	if !ok {
+		return nil, fmt.Errorf("vault '%s' does not exist (create it with 'locksmith vault create %s')", name, name)
+	}
+
+	info.Service = vaultService(name, vc)
+	if strings.TrimSpace(vc.Backend.Name) != "" {
+		info.Backend = vc.Backend
+	}
+	if vc.Auth != nil {
+		if vc.Auth.RequireBiometrics != nil {
+			info.Auth.RequireBiometrics = *vc.Auth.RequireBiometrics
+		}
+		if vc.Auth.PromptMessage != "" {
+			info.Auth.PromptMessage = vc.Auth.PromptMessage
+		}
+	}
+	return info, nil
+}
+
+// VaultNames returns DefaultVaultName followed by the configured vaults in
+// sorted order.
+func VaultNames(cfg *Config) []string {
+	names := []string{DefaultVaultName}
+	if cfg == nil {
+		return names
+	}
+	extra := make([]string, 0, len(cfg.Vaults))
+	for name := range cfg.Vaults {
+		if name != DefaultVaultName {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+	return append(names, extra...)
+}
+
+// VaultCacheDir returns the cache directory of a vault. The default vault
+// keeps the historical ~/.locksmith/cache location.
+func VaultCacheDir(name string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	if name == "" || name == DefaultVaultName {
+		return filepath.Join(home, ".locksmith", "cache"), nil
+	}
+	return filepath.Join(home, ".locksmith", "vaults", name, "cache"), nil
+}
+
+func vaultService(name string, vc VaultConfig) string {
+	if s := strings.TrimSpace(vc.Service); s != "" {
+		return s
+	}
+	return DefaultService + "." + name
+}
+
+// OpenVault returns a Locksmith bound to the named vault, sharing this
+// instance's options. The current vault (or an empty name) returns l itself;
+// other vaults are opened once and reused.
+func (l *Locksmith) OpenVault(name string) (*Locksmith, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || name == l.vaultName() {
+		return l, nil
+	}
+
+	l.vaultsMu.Lock()
+	defer l.vaultsMu.Unlock()
+	if other, ok := l.vaults[name]; ok {
+		return other, nil
+	}
+
+	opts := l.Options
+	opts.Vault = name
+	other, err := NewWithOptions(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open vault '%s': %w", name, err)
+	}
+	if l.vaults == nil {
+		l.vaults = make(map[string]*Locksmith)
+	}
+	l.vaults[name] = other
+	return other, nil
+}
+
+func (l *Locksmith) vaultName() string {
+	if l.Vault == "" {
+		return DefaultVaultName
+	}
+	return l.Vault
+}
@@ -0,0 +1,254 @@
+package locksmith
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSelectVaultNamePrecedence(t *testing.T) {
+	cfg := &Config{DefaultVault: "work"}
+
+	t.Setenv(VaultEnv, "")
+	if got := SelectVaultName(nil, ""); got != DefaultVaultName {
+		t.Errorf("expected %q, got %q", DefaultVaultName, got)
+	}
+	if got := SelectVaultName(cfg, ""); got != "work" {
+		t.Errorf("expected config default_vault, got %q", got)
+	}
+
+	t.Setenv(VaultEnv, "personal")
+	if got := SelectVaultName(cfg, ""); got != "personal" {
+		t.Errorf("expected %s to win over default_vault, got %q", VaultEnv, got)
+	}
+	if got := SelectVaultName(cfg, "client"); got != "client" {
+		t.Errorf("expected explicit name to win, got %q", got)
+	}
+}
+
+func TestResolveVault(t *testing.T) {
+	t.Setenv(VaultEnv, "")
+	t.Setenv("HOME", t.TempDir())
+
+	off := false
+	cfg := &Config{
+		Backend: BackendConfig{Name: "file"},
+		Auth:    AuthConfig{RequireBiometrics: true, PromptMessage: "top-level"},
+		Vaults: map[string]VaultConfig{
+			"work":   {},
+			"client": {Service: "com.example.client", Backend: BackendConfig{Name: "keyctl"}, Auth: &VaultAuthConfig{RequireBiometrics: &off, PromptMessage: "client"}},
+		},
+	}
+
+	def, err := ResolveVault(cfg, "")
+	if err != nil {
+		t.Fatalf("ResolveVault(default) failed: %v", err)
+	}
+	if def.Name != DefaultVaultName || def.Service != DefaultService {
+		t.Errorf("unexpected default vault: %+v", def)
+	}
+	if !strings.HasSuffix(def.CacheDir, filepath.Join(".locksmith", "cache")) {
+		t.Errorf("default vault should keep the legacy cache dir, got %s", def.CacheDir)
+	}
+
+	work, err := ResolveVault(cfg, "work")
+	if err != nil {
+		t.Fatalf("ResolveVault(work) failed: %v", err)
+	}
+	if work.Service != DefaultService+".work" {
+		t.Errorf("expected derived service, got %s", work.Service)
+	}
+	if work.Backend.Name != "file" || !work.Auth.RequireBiometrics || work.Auth.PromptMessage != "top-level" {
+		t.Errorf("work vault should inherit top-level settings: %+v", work)
+	}
+	if !strings.HasSuffix(work.CacheDir, filepath.Join(".locksmith", "vaults", "work", "cache")) {
+		t.Errorf("unexpected cache dir %s", work.CacheDir)
+	}
+
+	client, err := ResolveVault(cfg, "client")
+	if err != nil {
+		t.Fatalf("ResolveVault(client) failed: %v", err)
+	}
+	if client.Service != "com.example.client" || client.Backend.Name != "keyctl" {
+		t.Errorf("client vault overrides not applied: %+v", client)
+	}
+	if client.Auth.RequireBiometrics || client.Auth.PromptMessage != "client" {
+		t.Errorf("client auth overrides not applied: %+v", client.Auth)
+	}
+
+	if _, err := ResolveVault(cfg, "missing"); err == nil {
+		t.Error("expected error for undeclared vault")
+	}
+	if _, err := ResolveVault(cfg, "../escape"); err == nil {
+		t.Error("expected error for invalid vault name")
+	}
+}
+
+func TestVaultNames(t *testing.T) {
+	cfg := &Config{Vaults: map[string]VaultConfig{"work": {}, "client": {}}}
+	got := strings.Join(VaultNames(cfg), ",")
+	if got != "default,client,work" {
+		t.Errorf("unexpected vault names %s", got)
+	}
+}
+
+func TestParseRef(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    SecretRef
+		wantErr bool
+	}{
+		{in: "locksmith://db/password", want: SecretRef{Key: "db/password"}},
+		{in: "db/password", want: SecretRef{Key: "db/password"}},
+		{in: "locksmith://@work/db/password", want: SecretRef{Vault: "work", Key: "db/password"}},
+		{in: "locksmith://@work", wantErr: true},
+		{in: "locksmith://@work/", wantErr: true},
+		{in: "locksmith://@bad name/key", wantErr: true},
+		{in: "locksmith://", wantErr: true},
+		{in: "locksmith://db#password", want: SecretRef{Key: "db", Field: "password"}},
+		{in: "locksmith://@work/db/prod#user", want: SecretRef{Vault: "work", Key: "db/prod", Field: "user"}},
+		{in: "locksmith://db#", wantErr: true},
+		{in: "locksmith://#password", wantErr: true},
+	}
+	for _, tc := range cases {
+		got, err := ParseRef(tc.in)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("ParseRef(%q): expected error, got %+v", tc.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseRef(%q) failed: %v", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("ParseRef(%q) = %+v, want %+v", tc.in, got, tc.want)
+		}
+		if tc.want.Vault != "" && got.String() != tc.in {
+			t.Errorf("String() = %q, want %q", got.String(), tc.in)
+		}
+	}
+}
+
+func TestResolveRefCrossVault(t *testing.T) {
+	now := time.Now()
+	l := NewWithCache(&MockCache{secrets: map[string]Secret{
+		"api-key": {Value: []byte("default-value"), CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+	}})
+	work := NewWithCache(&MockCache{secrets: map[string]Secret{
+		"api-key": {Value: []byte("work-value"), CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+	}})
+	work.Vault = "work"
+	l.vaults = map[string]*Locksmith{"work": work}
+
+	got, err := l.ResolveRef("locksmith://api-key")
+	if err != nil || string(got) != "default-value" {
+		t.Fatalf("expected default-value, got %q (%v)", got, err)
+	}
+	got, err = l.ResolveRef("locksmith://@work/api-key")
+	if err != nil || string(got) != "work-value" {
+		t.Fatalf("expected work-value, got %q (%v)", got, err)
+	}
+	got, err = l.ResolveRef("locksmith://@default/api-key")
+	if err != nil || string(got) != "default-value" {
+		t.Fatalf("@default should resolve to the current vault, got %q (%v)", got, err)
+	}
+}
+
+func TestNewWithOptionsAppliesVaultAuth(t *testing.T) {
+	home := t.TempDir()
+	setTestHome(t, home)
+	path, err := ConfigPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	config := `auth:
+  require_biometrics: false
+vaults:
+  work:
+    auth:
+      require_biometrics: true
+      prompt_message: "Unlock work secret '%s'"
+  personal: {}
+`
+	if err := writeTestConfigFile(path, config); err != nil {
+		t.Fatal(err)
+	}
+	_ = Backends.Register("vault-auth-test", func(map[string]string) (Backend, error) { return newAttrBackend(), nil })
+
+	for _, tc := range []struct {
+		vault     string
+		requested bool
+		want      bool
+	}{
+		{vault: "work", want: true},
+		{vault: "personal", want: false},
+		{vault: "personal", requested: true, want: true},
+	} {
+		l, err := NewWithOptions(Options{Backend: "vault-auth-test", Vault: tc.vault, RequireBiometrics: tc.requested})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if l.Options.RequireBiometrics != tc.want {
+			t.Errorf("%s (requested %v): RequireBiometrics = %v, want %v", tc.vault, tc.requested, l.Options.RequireBiometrics, tc.want)
+		}
+		if tc.vault == "work" && l.Options.PromptMessage != "Unlock work secret '%s'" {
+			t.Errorf("unexpected prompt message %q", l.Options.PromptMessage)
+		}
+	}
+}
+
+func TestConfigEditPreservesComments(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	path, err := ConfigPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	original := "# my settings\nnotifications:\n  method: stderr # keep quiet\n"
+	if err := os.WriteFile(path, []byte(original), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetConfigValue([]string{"vaults", "work"}, VaultConfig{Service: "com.example.work"}); err != nil {
+		t.Fatalf("SetConfigValue failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"# my settings", "# keep quiet", "service: com.example.work"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("expected %q in edited config:\n%s", want, data)
+		}
+	}
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Vaults["work"].Service != "com.example.work" {
+		t.Errorf("vault not persisted: %+v", cfg.Vaults)
+	}
+
+	removed, err := DeleteConfigValue([]string{"vaults", "work"})
+	if err != nil || !removed {
+		t.Fatalf("DeleteConfigValue = %v, %v", removed, err)
+	}
+	removed, err = DeleteConfigValue([]string{"vaults", "work"})
+	if err != nil || removed {
+		t.Errorf("second DeleteConfigValue = %v, %v", removed, err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("config should stay 0600: %v %v", info, err)
+	}
+}
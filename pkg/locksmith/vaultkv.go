@@ -0,0 +1,148 @@
+package locksmith
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bonjoski/locksmith/v2/pkg/backend/vaultkv"
+)
+
+// DefaultVaultTokenKey is the native keychain key holding the Vault token
+// used by the vault-kv backend.
+const DefaultVaultTokenKey = "vault-kv/token"
+
+// ErrBackendUnavailable is returned by remote backends that cannot be
+// reached. Reads fall back to the local cache when it is returned.
+var ErrBackendUnavailable = errors.New("backend unavailable")
+
+func newVaultKVBackend(options map[string]string) (Backend, error) {
+	b := &vaultKVBackend{
+		tokens:       &DefaultBackend{},
+		tokenService: options["token_service"],
+		tokenKey:     options["token_key"],
+	}
+	if b.tokenService == "" {
+		b.tokenService = DefaultService
+	}
+	if b.tokenKey == "" {
+		b.tokenKey = DefaultVaultTokenKey
+	}
+	c, err := vaultkv.New(vaultkv.Options{
+		Address:   options["address"],
+		Mount:     options["mount"],
+		Prefix:    options["prefix"],
+		Namespace: options["namespace"],
+		Token:     b.token,
+	})
+	if err != nil {
+		return nil, err
+	}
+	b.client = c
+	return b, nil
+}
+
+// vaultKVBackend fronts a HashiCorp Vault KV v2 mount. The secret value is
+// stored as the version's data and locksmith's metadata as the secret's
+// custom_metadata. The Vault token is read from the native keychain at the
+// start of every operation, so Options.RequireBiometrics gates each remote
+// read exactly as it gates a local one.
+type vaultKVBackend struct {
+	client       *vaultkv.Client
+	tokens       Backend
+	tokenService string
+	tokenKey     string
+}
+
+// cacheKeyBackend keeps the cache key in the native keychain with the Vault
+// token, so cached reads keep working while Vault is unreachable.
+func (b *vaultKVBackend) cacheKeyBackend() Backend {
+	return b.tokens
+}
+
+// token reads the Vault token from the keychain, falling back to
+// $VAULT_TOKEN only when no token has been stored there.
+func (b *vaultKVBackend) token(useBiometrics bool, prompt string) (string, error) {
+	data, err := b.tokens.Get(b.tokenService, b.tokenKey, useBiometrics, prompt)
+	if err != nil {
+		if isNotFound(err) {
+			if env := os.Getenv("VAULT_TOKEN"); env != "" {
+				return env, nil
+			}
+			return "", fmt.Errorf("no vault token in the keychain (store one with 'LOCKSMITH_BACKEND=native locksmith add %s <token> --vault default') and VAULT_TOKEN is not set", b.tokenKey)
+		}
+		return "", err
+	}
+	defer zeroBytes(data)
+
+	var secret Secret
+	if err := json.Unmarshal(data, &secret); err != nil {
+		return strings.TrimSpace(string(data)), nil
+	}
+	defer zeroBytes(secret.Value)
+	return strings.TrimSpace(string(secret.Value)), nil
+}
+
+func (b *vaultKVBackend) Set(service, account string, data []byte, requireBiometrics bool) error {
+	return setDecoded(b, service, account, data, requireBiometrics)
+}
+
+func (b *vaultKVBackend) SetWithMetadata(service, account string, data []byte, meta SecretMetadata, requireBiometrics bool) error {
+	var secret Secret
+	if err := json.Unmarshal(data, &secret); err != nil {
+		secret.Value = data
+	} else {
+		defer zeroBytes(secret.Value)
+	}
+	return vaultKVError(b.client.Put(service, account, secret.Value, metadataToAttributes(meta)))
+}
+
+func (b *vaultKVBackend) Get(service, account string, useBiometrics bool, prompt string) ([]byte, error) {
+	item, err := b.client.Read(service, account, useBiometrics, prompt)
+	if err != nil {
+		return nil, vaultKVError(err)
+	}
+	defer zeroBytes(item.Value)
+
+	meta := attributesToMetadata(item.Custom)
+	if meta.CreatedAt.IsZero() {
+		meta.CreatedAt = item.Created
+	}
+	return json.Marshal(secretFromMetadata(item.Value, meta))
+}
+
+func (b *vaultKVBackend) Delete(service, account string, useBiometrics bool, prompt string) error {
+	return vaultKVError(b.client.Delete(service, account, useBiometrics, prompt))
+}
+
+func (b *vaultKVBackend) List(service string, useBiometrics bool, prompt string) ([]string, error) {
+	keys, err := b.client.List(service, useBiometrics, prompt)
+	return keys, vaultKVError(err)
+}
+
+func (b *vaultKVBackend) ListMetadata(service string, useBiometrics bool, prompt string) (map[string]SecretMetadata, error) {
+	items, err := b.client.ListMetadata(service, useBiometrics, prompt)
+	if err != nil {
+		return nil, vaultKVError(err)
+	}
+	result := make(map[string]SecretMetadata, len(items))
+	for account, m := range items {
+		meta := attributesToMetadata(m.Custom)
+		if meta.CreatedAt.IsZero() {
+			meta.CreatedAt = m.Created
+		}
+		result[account] = meta
+	}
+	return result, nil
+}
+
+// vaultKVError maps the client's connectivity errors onto
+// ErrBackendUnavailable.
+func vaultKVError(err error) error {
+	if errors.Is(err, vaultkv.ErrUnavailable) {
+		return fmt.Errorf("%w: %w", ErrBackendUnavailable, err)
+	}
+	return err
+}
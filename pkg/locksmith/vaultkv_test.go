@@ -0,0 +1,232 @@
+package locksmith
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bonjoski/locksmith/v2/pkg/backend/vaultkv"
+)
+
+// fakeKV is a minimal KV v2 stand-in: one version per secret, enough to
+// exercise the adapter.
+type fakeKV struct {
+	mu     sync.Mutex
+	data   map[string]map[string]string
+	custom map[string]map[string]string
+	down   bool
+}
+
+func (f *fakeKV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.down {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	if r.Header.Get("X-Vault-Token") != "tok" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	rest := strings.TrimPrefix(r.URL.Path, "/v1/secret/")
+	kind, p, _ := strings.Cut(rest, "/")
+	var body map[string]map[string]string
+	_ = json.NewDecoder(r.Body).Decode(&body)
+
+	reply := func(v any) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(v)
+	}
+	switch {
+	case kind == "data" && r.Method == http.MethodPost:
+		f.data[p] = body["data"]
+	case kind == "metadata" && r.Method == http.MethodPost:
+		f.custom[p] = body["custom_metadata"]
+	case kind == "data" && r.Method == http.MethodGet && f.data[p] != nil:
+		reply(map[string]any{"data": map[string]any{"data": f.data[p], "metadata": map[string]any{"version": 1}}})
+	case kind == "metadata" && r.Method == http.MethodGet && f.data[p] != nil:
+		reply(map[string]any{"data": map[string]any{"created_time": time.Now().UTC(), "custom_metadata": f.custom[p]}})
+	case kind == "metadata" && r.Method == http.MethodDelete && f.data[p] != nil:
+		delete(f.data, p)
+		delete(f.custom, p)
+	case kind == "metadata" && r.Method == "LIST":
+		seen := map[string]bool{}
+		var keys []string
+		for k := range f.data {
+			rel, ok := strings.CutPrefix(k, p+"/")
+			if i := strings.Index(rel, "/"); i >= 0 {
+				rel = rel[:i+1]
+			}
+			if ok && !seen[rel] {
+				seen[rel] = true
+				keys = append(keys, rel)
+			}
+		}
+		if len(keys) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		reply(map[string]any{"data": map[string]any{"keys": keys}})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// tokenStore stands in for the native keychain and records whether each
+// token read asked for biometrics.
+type tokenStore struct {
+	token []byte
+	gated []bool
+}
+
+func (s *tokenStore) Set(service, account string, data []byte, requireBiometrics bool) error {
+	return nil
+}
+
+func (s *tokenStore) Get(service, account string, useBiometrics bool, prompt string) ([]byte, error) {
+	s.gated = append(s.gated, useBiometrics)
+	if s.token == nil {
+		return nil, ErrNotFound
+	}
+	return json.Marshal(Secret{Value: s.token})
+}
+
+func (s *tokenStore) Delete(service, account string, useBiometrics bool, prompt string) error {
+	return nil
+}
+
+func (s *tokenStore) List(service string, useBiometrics bool, prompt string) ([]string, error) {
+	return nil, nil
+}
+
+func newTestVaultKV(t *testing.T) (*fakeKV, *vaultKVBackend, *tokenStore) {
+	t.Helper()
+	kv := &fakeKV{data: map[string]map[string]string{}, custom: map[string]map[string]string{}}
+	srv := httptest.NewServer(kv)
+	t.Cleanup(srv.Close)
+
+	b, err := newVaultKVBackend(map[string]string{"address": srv.URL})
+	if err != nil {
+		t.Fatalf("newVaultKVBackend: %v", err)
+	}
+	vb := b.(*vaultKVBackend)
+	tokens := &tokenStore{token: []byte("tok")}
+	vb.tokens = tokens
+	return kv, vb, tokens
+}
+
+func TestVaultKVBackendRoundTrip(t *testing.T) {
+	kv, b, tokens := newTestVaultKV(t)
+
+	created := time.Now().Add(-time.Hour).Truncate(time.Second)
+	data, _ := json.Marshal(Secret{
+		Value:      []byte("hunter2"),
+		CreatedAt:  created,
+		SecretType: SecretTypePassword,
+		Metadata:   map[string]string{"team": "db"},
+	})
+	if err := b.Set(DefaultService, "db/password", data, false); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if kv.data["locksmith/"+DefaultService+"/db/password"]["value"] != "hunter2" {
+		t.Fatalf("value not stored as the version's data: %v", kv.data)
+	}
+
+	tokens.gated = nil
+	raw, err := b.Get(DefaultService, "db/password", true, "unlock")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if len(tokens.gated) != 1 || !tokens.gated[0] {
+		t.Errorf("remote read should fetch the token once behind the biometric gate, got %v", tokens.gated)
+	}
+	var got Secret
+	if err := json.Unmarshal(raw, &got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got.Value) != "hunter2" || !got.CreatedAt.Equal(created) || got.SecretType != SecretTypePassword || got.Metadata["team"] != "db" {
+		t.Errorf("unexpected secret %+v", got)
+	}
+
+	_ = b.Set(DefaultService, "api", []byte(`{"value":"YQ=="}`), false)
+	meta, err := b.ListMetadata(DefaultService, false, "")
+	if err != nil {
+		t.Fatalf("ListMetadata: %v", err)
+	}
+	if len(meta) != 2 || meta["db/password"].Metadata["team"] != "db" || meta["api"].CreatedAt.IsZero() {
+		t.Errorf("unexpected metadata listing %+v", meta)
+	}
+
+	if err := b.Delete(DefaultService, "db/password", false, ""); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if keys, _ := b.List(DefaultService, false, ""); len(keys) != 1 || keys[0] != "api" {
+		t.Errorf("List after delete = %v", keys)
+	}
+}
+
+func TestVaultKVTokenFallback(t *testing.T) {
+	_, b, tokens := newTestVaultKV(t)
+	tokens.token = nil
+
+	t.Setenv("VAULT_TOKEN", "")
+	if _, err := b.Get(DefaultService, "k", false, ""); err == nil || !strings.Contains(err.Error(), "no vault token") {
+		t.Errorf("expected a missing-token error, got %v", err)
+	}
+
+	t.Setenv("VAULT_TOKEN", "tok")
+	if _, err := b.Get(DefaultService, "k", false, ""); !errors.Is(err, vaultkv.ErrNotFound) {
+		t.Errorf("expected VAULT_TOKEN to be used, got %v", err)
+	}
+}
+
+func TestVaultKVOfflineReadsFromCache(t *testing.T) {
+	t.Setenv("LOCKSMITH_SILENT", "true")
+	kv, b, _ := newTestVaultKV(t)
+	cache := &expiredCache{MockCache{secrets: map[string]Secret{}}}
+	l := &Locksmith{Service: DefaultService, Backend: b, Cache: cache}
+
+	data, _ := json.Marshal(Secret{Value: []byte("v1"), ExpiresAt: time.Now().Add(time.Hour)})
+	if err := b.Set(DefaultService, "shared", data, false); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if _, err := l.Get("shared"); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+
+	kv.mu.Lock()
+	kv.down = true
+	kv.mu.Unlock()
+
+	got, err := l.Get("shared")
+	if err != nil {
+		t.Fatalf("offline Get should be served from the cache: %v", err)
+	}
+	if string(got) != "v1" {
+		t.Errorf("got %q, want v1", got)
+	}
+
+	if _, err := l.Get("never-cached"); !errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("expected ErrBackendUnavailable for an uncached key, got %v", err)
+	}
+
+	l.Options.BypassCache = true
+	if _, err := l.Get("shared"); !errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("BypassCache should not fall back to the cache, got %v", err)
+	}
+}
+
+// expiredCache reports every entry as expired so reads always go to the
+// backend first.
+type expiredCache struct {
+	MockCache
+}
+
+func (c *expiredCache) IsExpired(key string, ttl time.Duration) bool {
+	return true
+}
@@ -11,9 +11,30 @@ package native
 import "C"
 import (
 	"fmt"
+	"strings"
 	"unsafe"
 )
 
+// keychainError converts an error message from keychain_darwin.m, mapping
+// the messages for a missing item or an unusable keychain to ErrNotFound
+// and ErrUnavailable.
+func keychainError(cMsg *C.char) error {
+	msg := C.GoString(cMsg)
+	switch {
+	case msg == ErrNotFound.Error():
+		return ErrNotFound
+	case strings.HasPrefix(msg, "Keychain unavailable"):
+		return fmt.Errorf("%w: %s", ErrUnavailable, msg)
+	}
+	return fmt.Errorf("%s", msg)
+}
+
+// Available reports whether the native keychain can be used. The macOS
+// keychain is always present.
+func Available() bool {
+	return true
+}
+
 func Set(service, account string, data []byte, requireBiometrics bool) error {
 	cService := C.CString(service)
 	cAccount := C.CString(account)
@@ -26,11 +47,22 @@ func Set(service, account string, data []byte, requireBiometrics bool) error {
 	defer C.free_keychain_result(res)
 
 	if res.error != nil {
-		return fmt.Errorf("%s", C.GoString(res.error))
+		return keychainError(res.error)
 	}
 	return nil
 }
 
+// SetWithAttributes stores data like Set. The keychain has no searchable
+// per-item attributes, so attrs are ignored.
+func SetWithAttributes(service, account string, data []byte, attrs map[string]string, requireBiometrics bool) error {
+	return Set(service, account, data, requireBiometrics)
+}
+
+// ListAttributes is not supported on this platform.
+func ListAttributes(service string, useBiometrics bool, prompt string) (map[string]map[string]string, error) {
+	return nil, ErrAttributesUnsupported
+}
+
 func Get(service, account string, useBiometrics bool, prompt string) ([]byte, error) {
 	cService := C.CString(service)
 	cAccount := C.CString(account)
@@ -43,7 +75,7 @@ func Get(service, account string, useBiometrics bool, prompt string) ([]byte, er
 	defer C.free_keychain_result(res)
 
 	if res.error != nil {
-		return nil, fmt.Errorf("%s", C.GoString(res.error))
+		return nil, keychainError(res.error)
 	}
 
 	return C.GoBytes(unsafe.Pointer(res.data), C.int(res.length)), nil
@@ -61,7 +93,7 @@ func Delete(service, account string, useBiometrics bool, prompt string) error {
 	defer C.free_keychain_result(res)
 
 	if res.error != nil {
-		return fmt.Errorf("%s", C.GoString(res.error))
+		return keychainError(res.error)
 	}
 	return nil
 }
@@ -76,7 +108,7 @@ func List(service string, useBiometrics bool, prompt string) ([]string, error) {
 	defer C.free_keychain_list_result(res)
 
 	if res.error != nil {
-		return nil, fmt.Errorf("%s", C.GoString(res.error))
+		return nil, keychainError(res.error)
 	}
 
 	count := int(res.count)
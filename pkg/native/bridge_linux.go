@@ -5,9 +5,10 @@ package native
 
 import (
 	"fmt"
+	"os"
 	"os/exec"
 
-	"github.com/zalando/go-keyring"
+	dbus "github.com/godbus/dbus/v5"
 )
 
 // performAuthPrompt uses pkexec to force an interactive authentication prompt
@@ -28,14 +29,98 @@ func performAuthPrompt(prompt string) error {
 	return nil
 }
 
+// Available reports whether a Secret Service provider is reachable on the
+// D-Bus session bus. CI runners and containers typically have none.
+func Available() bool {
+	if os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+		if _, err := os.Stat(fmt.Sprintf("/run/user/%d/bus", os.Getuid())); err != nil {
+			return false
+		}
+	}
+
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return false
+	}
+	defer func() { _ = conn.Close() }()
+
+	bus := conn.BusObject()
+	var owned bool
+	if err := bus.Call("org.freedesktop.DBus.NameHasOwner", 0, ssBusName).Store(&owned); err == nil && owned {
+		return true
+	}
+	var activatable []string
+	if err := bus.Call("org.freedesktop.DBus.ListActivatableNames", 0).Store(&activatable); err != nil {
+		return false
+	}
+	for _, name := range activatable {
+		if name == ssBusName {
+			return true
+		}
+	}
+	return false
+}
+
 func Set(service, account string, data []byte, requireBiometrics bool) error {
+	return SetWithAttributes(service, account, data, nil, requireBiometrics)
+}
+
+// SetWithAttributes stores data like Set and records attrs as searchable
+// Secret Service item attributes. The service and username attributes are
+// reserved and always reflect service and account.
+func SetWithAttributes(service, account string, data []byte, attrs map[string]string, requireBiometrics bool) error {
 	if requireBiometrics {
 		if err := performAuthPrompt("Authentication required to save secret"); err != nil {
 			return err
 		}
 	}
 
-	return keyring.Set(service, account, string(data))
+	ss, err := connectSecretService()
+	if err != nil {
+		return err
+	}
+	defer ss.Close()
+
+	session, err := ss.openSession()
+	if err != nil {
+		return err
+	}
+	defer ss.closeSession(session)
+
+	collection := ss.collection()
+	if err := ss.unlock(collection); err != nil {
+		return err
+	}
+
+	itemAttrs := make(map[string]string, len(attrs)+2)
+	for k, v := range attrs {
+		itemAttrs[k] = v
+	}
+	itemAttrs[attrService] = service
+	itemAttrs[attrAccount] = account
+
+	// CreateItem only replaces items whose attributes match exactly, so an
+	// update that changes metadata would otherwise leave the old item behind.
+	existing, err := ss.search(collection, map[string]string{attrService: service, attrAccount: account})
+	if err != nil {
+		return err
+	}
+
+	secret := ssSecret{Session: session, Value: data, ContentType: "text/plain"}
+	item, err := ss.createItem(collection, fmt.Sprintf("Password for '%s' on '%s'", account, service), itemAttrs, secret)
+	if err != nil {
+		return err
+	}
+
+	for _, old := range existing {
+		if old == item {
+			continue
+		}
+		if err := ss.deleteItem(old); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func Get(service, account string, useBiometrics bool, prompt string) ([]byte, error) {
@@ -45,14 +130,31 @@ func Get(service, account string, useBiometrics bool, prompt string) ([]byte, er
 		}
 	}
 
-	val, err := keyring.Get(service, account)
+	ss, err := connectSecretService()
+	if err != nil {
+		return nil, err
+	}
+	defer ss.Close()
+
+	items, err := ss.search(ss.collection(), map[string]string{attrService: service, attrAccount: account})
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, ErrNotFound
+	}
+
+	if err := ss.unlock(items[0]); err != nil {
+		return nil, err
+	}
+
+	session, err := ss.openSession()
 	if err != nil {
-		if err == keyring.ErrNotFound {
-			return nil, fmt.Errorf("Secret not found") // match windows bridge error convention
-		}
 		return nil, err
 	}
-	return []byte(val), nil
+	defer ss.closeSession(session)
+
+	return ss.getSecret(items[0], session)
 }
 
 func Delete(service, account string, useBiometrics bool, prompt string) error {
@@ -62,13 +164,33 @@ func Delete(service, account string, useBiometrics bool, prompt string) error {
 		}
 	}
 
-	err := keyring.Delete(service, account)
-	if err != nil && err != keyring.ErrNotFound {
+	ss, err := connectSecretService()
+	if err != nil {
+		return err
+	}
+	defer ss.Close()
+
+	collection := ss.collection()
+	items, err := ss.search(collection, map[string]string{attrService: service, attrAccount: account})
+	if err != nil {
 		return err
 	}
+	if len(items) == 0 {
+		return nil
+	}
+	if err := ss.unlock(collection); err != nil {
+		return err
+	}
+	for _, item := range items {
+		if err := ss.deleteItem(item); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// List returns the sorted account names stored under service. Only item
+// attributes are read, so the collection does not need to be unlocked.
 func List(service string, useBiometrics bool, prompt string) ([]string, error) {
 	if useBiometrics {
 		if err := performAuthPrompt(prompt); err != nil {
@@ -76,9 +198,33 @@ func List(service string, useBiometrics bool, prompt string) ([]string, error) {
 		}
 	}
 
-	// zalando/go-keyring does not currently have a "List()" function
-	// that returns all keys for a service natively.
-	// This means we cannot list the keys in the Linux keychain natively through that library yet.
-	// For now, we will return an error stating that listing is not supported on Linux yet.
-	return nil, fmt.Errorf("listing secrets is not natively supported by the Linux keyring bridge yet")
+	ss, err := connectSecretService()
+	if err != nil {
+		return nil, err
+	}
+	defer ss.Close()
+
+	items, err := ss.serviceItems(service)
+	if err != nil {
+		return nil, err
+	}
+	return sortedAccounts(items), nil
+}
+
+// ListAttributes returns account -> item attributes for every item stored
+// under service, without reading any secret values.
+func ListAttributes(service string, useBiometrics bool, prompt string) (map[string]map[string]string, error) {
+	if useBiometrics {
+		if err := performAuthPrompt(prompt); err != nil {
+			return nil, err
+		}
+	}
+
+	ss, err := connectSecretService()
+	if err != nil {
+		return nil, err
+	}
+	defer ss.Close()
+
+	return ss.serviceItems(service)
 }
@@ -6,11 +6,32 @@ package native
 import (
 	"errors"
 	"fmt"
+	"syscall"
 
 	"github.com/danieljoos/wincred"
 	"github.com/julian-bruyers/winhello-go"
 )
 
+// Available reports whether the native credential store can be used. The
+// Windows Credential Manager is always present.
+func Available() bool {
+	return true
+}
+
+// errNoSuchLogonSession (ERROR_NO_SUCH_LOGON_SESSION) is returned when the
+// Credential Manager is not available to the process, e.g. in a service or
+// network logon session.
+const errNoSuchLogonSession = syscall.Errno(1312)
+
+// credError maps a Credential Manager that cannot be used onto
+// ErrUnavailable.
+func credError(err error) error {
+	if errors.Is(err, errNoSuchLogonSession) {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	return err
+}
+
 func Set(service, account string, data []byte, requireBiometrics bool) error {
 	if requireBiometrics {
 		if !winhello.Available() {
@@ -31,7 +52,18 @@ func Set(service, account string, data []byte, requireBiometrics bool) error {
 	cred.CredentialBlob = data
 	cred.Persist = wincred.PersistLocalMachine
 
-	return cred.Write()
+	return credError(cred.Write())
+}
+
+// SetWithAttributes stores data like Set. The credential store has no searchable
+// per-item attributes, so attrs are ignored.
+func SetWithAttributes(service, account string, data []byte, attrs map[string]string, requireBiometrics bool) error {
+	return Set(service, account, data, requireBiometrics)
+}
+
+// ListAttributes is not supported on this platform.
+func ListAttributes(service string, useBiometrics bool, prompt string) (map[string]map[string]string, error) {
+	return nil, ErrAttributesUnsupported
 }
 
 func Get(service, account string, useBiometrics bool, prompt string) ([]byte, error) {
@@ -55,9 +87,9 @@ func Get(service, account string, useBiometrics bool, prompt string) ([]byte, er
 	cred, err := wincred.GetGenericCredential(service + ":" + account)
 	if err != nil {
 		if errors.Is(err, wincred.ErrElementNotFound) {
-			return nil, errors.New("Secret not found")
+			return nil, ErrNotFound
 		}
-		return nil, err
+		return nil, credError(err)
 	}
 
 	return cred.CredentialBlob, nil
@@ -86,10 +118,10 @@ func Delete(service, account string, useBiometrics bool, prompt string) error {
 		if errors.Is(err, wincred.ErrElementNotFound) {
 			return nil // Already deleted
 		}
-		return err
+		return credError(err)
 	}
 
-	return cred.Delete()
+	return credError(cred.Delete())
 }
 
 func List(service string, useBiometrics bool, prompt string) ([]string, error) {
@@ -112,7 +144,7 @@ func List(service string, useBiometrics bool, prompt string) ([]string, error) {
 
 	creds, err := wincred.List()
 	if err != nil {
-		return nil, err
+		return nil, credError(err)
 	}
 
 	var keys []string
@@ -41,6 +41,21 @@ static char* get_auth_error_message(int code) {
     return strdup([[NSString stringWithFormat:@"Authentication failed (error %d)", code] UTF8String]);
 }
 
+// Statuses meaning no keychain can be used at all, e.g. a reset, missing or
+// locked keychain in a session without UI. The Go bridge maps the message
+// to ErrUnavailable.
+static bool keychain_unavailable(OSStatus status) {
+  return status == errSecNotAvailable || status == errSecNoSuchKeychain ||
+         status == errSecInteractionNotAllowed;
+}
+
+static char *keychain_error(NSString *format, OSStatus status) {
+  if (keychain_unavailable(status)) {
+    format = @"Keychain unavailable: %d";
+  }
+  return strdup([[NSString stringWithFormat:format, (int)status] UTF8String]);
+}
+
 KeychainResult keychain_set(const char *service, const char *account,
                             const char *data, size_t length,
                             bool require_biometrics) {
@@ -80,9 +95,7 @@ KeychainResult keychain_set(const char *service, const char *account,
                            (__bridge CFDictionaryRef)update);
   }
   if (status != errSecSuccess) {
-    result.error =
-        strdup([[NSString stringWithFormat:@"Failed to add keychain item: %d",
-                                           (int)status] UTF8String]);
+    result.error = keychain_error(@"Failed to add keychain item: %d", status);
   }
 
   return result;
@@ -122,9 +135,8 @@ KeychainResult keychain_get(const char *service, const char *account,
   } else if (status == errSecItemNotFound) {
     result.error = strdup("Secret not found");
   } else {
-    result.error = strdup([[NSString
-        stringWithFormat:@"Failed to retrieve keychain item: %d", (int)status]
-        UTF8String]);
+    result.error =
+        keychain_error(@"Failed to retrieve keychain item: %d", status);
   }
 
   return result;
@@ -152,9 +164,8 @@ KeychainResult keychain_delete(const char *service, const char *account,
 
   OSStatus status = SecItemDelete((__bridge CFDictionaryRef)query);
   if (status != errSecSuccess && status != errSecItemNotFound) {
-    result.error = strdup([[NSString
-        stringWithFormat:@"Failed to delete keychain item: %d", (int)status]
-        UTF8String]);
+    result.error =
+        keychain_error(@"Failed to delete keychain item: %d", status);
   }
 
   return result;
@@ -200,8 +211,7 @@ KeychainListResult keychain_list(const char *service, bool use_biometrics,
     result.keys = NULL;
   } else {
     result.error =
-        strdup([[NSString stringWithFormat:@"Failed to list keychain items: %d",
-                                           (int)status] UTF8String]);
+        keychain_error(@"Failed to list keychain items: %d", status);
   }
 
   return result;
@@ -0,0 +1,19 @@
+// Package native bridges locksmith to the platform credential stores:
+// the macOS Keychain, the Windows Credential Manager and the Linux
+// Secret Service.
+package native
+
+import "errors"
+
+// ErrNotFound is returned by Get for an item the credential store does not
+// hold.
+var ErrNotFound = errors.New("Secret not found")
+
+// ErrAttributesUnsupported is returned by ListAttributes on platforms whose
+// credential store cannot hold searchable per-item attributes.
+var ErrAttributesUnsupported = errors.New("item attributes are not supported by this platform's keychain bridge")
+
+// ErrUnavailable is returned when the credential store cannot be reached at
+// all, e.g. without a D-Bus session bus or Secret Service provider, or with
+// no keychain available to the process.
+var ErrUnavailable = errors.New("credential store unavailable")
@@ -0,0 +1,241 @@
+//go:build linux
+// +build linux
+
+package native
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	dbus "github.com/godbus/dbus/v5"
+)
+
+const (
+	ssBusName             = "org.freedesktop.secrets"
+	ssServicePath         = dbus.ObjectPath("/org/freedesktop/secrets")
+	ssServiceInterface    = "org.freedesktop.Secret.Service"
+	ssCollectionInterface = "org.freedesktop.Secret.Collection"
+	ssItemInterface       = "org.freedesktop.Secret.Item"
+	ssSessionInterface    = "org.freedesktop.Secret.Session"
+	ssPromptInterface     = "org.freedesktop.Secret.Prompt"
+
+	ssDefaultCollection = dbus.ObjectPath("/org/freedesktop/secrets/aliases/default")
+	ssLoginCollection   = dbus.ObjectPath("/org/freedesktop/secrets/collection/login")
+	ssNoPrompt          = dbus.ObjectPath("/")
+
+	// Attribute names are shared with zalando/go-keyring so items written by
+	// earlier locksmith releases remain visible.
+	attrService = "service"
+	attrAccount = "username"
+)
+
+// ssSecret mirrors the org.freedesktop.Secret.Secret struct (oayays).
+type ssSecret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+// secretService is a minimal client for the freedesktop Secret Service API.
+type secretService struct {
+	conn    *dbus.Conn
+	service dbus.BusObject
+}
+
+func connectSecretService() (*secretService, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to connect to D-Bus session bus: %w", ErrUnavailable, err)
+	}
+	return &secretService{conn: conn, service: conn.Object(ssBusName, ssServicePath)}, nil
+}
+
+func (s *secretService) Close() {
+	_ = s.conn.Close()
+}
+
+func (s *secretService) openSession() (dbus.ObjectPath, error) {
+	var output dbus.Variant
+	var session dbus.ObjectPath
+	err := s.service.Call(ssServiceInterface+".OpenSession", 0, "plain", dbus.MakeVariant("")).Store(&output, &session)
+	if err != nil {
+		return "", fmt.Errorf("failed to open secret service session: %w", err)
+	}
+	return session, nil
+}
+
+func (s *secretService) closeSession(session dbus.ObjectPath) {
+	_ = s.conn.Object(ssBusName, session).Call(ssSessionInterface+".Close", 0).Err
+}
+
+// collection returns the login collection when it exists and the default
+// alias otherwise, matching go-keyring's choice.
+func (s *secretService) collection() dbus.ObjectPath {
+	v, err := s.service.GetProperty(ssServiceInterface + ".Collections")
+	if err == nil {
+		if paths, ok := v.Value().([]dbus.ObjectPath); ok {
+			for _, p := range paths {
+				if p == ssLoginCollection {
+					return ssLoginCollection
+				}
+			}
+		}
+	}
+	return ssDefaultCollection
+}
+
+func (s *secretService) unlock(paths ...dbus.ObjectPath) error {
+	var unlocked []dbus.ObjectPath
+	var prompt dbus.ObjectPath
+	if err := s.service.Call(ssServiceInterface+".Unlock", 0, paths).Store(&unlocked, &prompt); err != nil {
+		return fmt.Errorf("failed to unlock keyring: %w", err)
+	}
+	_, err := s.handlePrompt(prompt)
+	return err
+}
+
+// handlePrompt runs a Secret Service prompt (e.g. the keyring password
+// dialog) and waits for it to complete.
+func (s *secretService) handlePrompt(prompt dbus.ObjectPath) (dbus.Variant, error) {
+	if prompt == "" || prompt == ssNoPrompt {
+		return dbus.MakeVariant(""), nil
+	}
+
+	match := []dbus.MatchOption{
+		dbus.WithMatchObjectPath(prompt),
+		dbus.WithMatchInterface(ssPromptInterface),
+	}
+	if err := s.conn.AddMatchSignal(match...); err != nil {
+		return dbus.Variant{}, err
+	}
+	defer func() { _ = s.conn.RemoveMatchSignal(match...) }()
+
+	signals := make(chan *dbus.Signal, 4)
+	s.conn.Signal(signals)
+	defer s.conn.RemoveSignal(signals)
+
+	if err := s.conn.Object(ssBusName, prompt).Call(ssPromptInterface+".Prompt", 0, "").Err; err != nil {
+		return dbus.Variant{}, err
+	}
+
+	for sig := range signals {
+		if sig.Path != prompt || sig.Name != ssPromptInterface+".Completed" || len(sig.Body) < 2 {
+			continue
+		}
+		if dismissed, _ := sig.Body[0].(bool); dismissed {
+			return dbus.Variant{}, fmt.Errorf("authentication failed: keyring prompt dismissed")
+		}
+		result, _ := sig.Body[1].(dbus.Variant)
+		return result, nil
+	}
+	return dbus.Variant{}, fmt.Errorf("D-Bus connection closed while waiting for keyring prompt")
+}
+
+func (s *secretService) search(collection dbus.ObjectPath, attrs map[string]string) ([]dbus.ObjectPath, error) {
+	var results []dbus.ObjectPath
+	err := s.conn.Object(ssBusName, collection).Call(ssCollectionInterface+".SearchItems", 0, attrs).Store(&results)
+	if err != nil {
+		if providerMissing(err) {
+			return nil, fmt.Errorf("%w: failed to search keyring: %w", ErrUnavailable, err)
+		}
+		return nil, fmt.Errorf("failed to search keyring: %w", err)
+	}
+	return results, nil
+}
+
+// providerMissing reports a call that failed because no Secret Service
+// provider owns or can be activated for ssBusName.
+func providerMissing(err error) bool {
+	var dbusErr dbus.Error
+	if !errors.As(err, &dbusErr) {
+		return false
+	}
+	switch dbusErr.Name {
+	case "org.freedesktop.DBus.Error.ServiceUnknown", "org.freedesktop.DBus.Error.NameHasNoOwner":
+		return true
+	}
+	return false
+}
+
+func (s *secretService) createItem(collection dbus.ObjectPath, label string, attrs map[string]string, secret ssSecret) (dbus.ObjectPath, error) {
+	props := map[string]dbus.Variant{
+		ssItemInterface + ".Label":      dbus.MakeVariant(label),
+		ssItemInterface + ".Attributes": dbus.MakeVariant(attrs),
+	}
+	var item, prompt dbus.ObjectPath
+	err := s.conn.Object(ssBusName, collection).Call(ssCollectionInterface+".CreateItem", 0, props, secret, true).Store(&item, &prompt)
+	if err != nil {
+		return "", fmt.Errorf("failed to create keyring item: %w", err)
+	}
+	result, err := s.handlePrompt(prompt)
+	if err != nil {
+		return "", err
+	}
+	if p, ok := result.Value().(dbus.ObjectPath); ok && item == ssNoPrompt {
+		item = p
+	}
+	return item, nil
+}
+
+func (s *secretService) getSecret(item, session dbus.ObjectPath) ([]byte, error) {
+	var secret ssSecret
+	if err := s.conn.Object(ssBusName, item).Call(ssItemInterface+".GetSecret", 0, session).Store(&secret); err != nil {
+		return nil, fmt.Errorf("failed to read keyring item: %w", err)
+	}
+	return secret.Value, nil
+}
+
+func (s *secretService) attributes(item dbus.ObjectPath) (map[string]string, error) {
+	v, err := s.conn.Object(ssBusName, item).GetProperty(ssItemInterface + ".Attributes")
+	if err != nil {
+		return nil, err
+	}
+	attrs, ok := v.Value().(map[string]string)
+	if !ok {
+		return nil, fmt.Errorf("unexpected attribute type %s", v.Signature())
+	}
+	return attrs, nil
+}
+
+func (s *secretService) deleteItem(item dbus.ObjectPath) error {
+	var prompt dbus.ObjectPath
+	if err := s.conn.Object(ssBusName, item).Call(ssItemInterface+".Delete", 0).Store(&prompt); err != nil {
+		return fmt.Errorf("failed to delete keyring item: %w", err)
+	}
+	_, err := s.handlePrompt(prompt)
+	return err
+}
+
+// serviceItems returns account -> attributes for every item stored under
+// service. Attributes are readable without unlocking the collection.
+func (s *secretService) serviceItems(service string) (map[string]map[string]string, error) {
+	items, err := s.search(s.collection(), map[string]string{attrService: service})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]map[string]string, len(items))
+	for _, item := range items {
+		attrs, err := s.attributes(item)
+		if err != nil {
+			return nil, err
+		}
+		account := attrs[attrAccount]
+		if account == "" {
+			continue
+		}
+		out[account] = attrs
+	}
+	return out, nil
+}
+
+func sortedAccounts(items map[string]map[string]string) []string {
+	keys := make([]string, 0, len(items))
+	for k := range items {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
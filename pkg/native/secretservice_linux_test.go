@@ -0,0 +1,383 @@
+//go:build linux
+// +build linux
+
+package native
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dbus "github.com/godbus/dbus/v5"
+)
+
+const propertiesInterface = "org.freedesktop.DBus.Properties"
+
+// fakeSecretService is an in-memory org.freedesktop.secrets implementation
+// with a single login collection. Unlock and Delete go through a prompt so
+// the client's prompt handling is exercised too.
+type fakeSecretService struct {
+	conn *dbus.Conn
+
+	mu      sync.Mutex
+	nextID  int
+	items   map[dbus.ObjectPath]*fakeItem
+	prompts map[dbus.ObjectPath]func() dbus.Variant
+}
+
+type fakeItem struct {
+	attrs map[string]string
+	value []byte
+}
+
+type fakeService struct{ f *fakeSecretService }
+type fakeCollection struct{ f *fakeSecretService }
+type fakeItemObject struct {
+	f    *fakeSecretService
+	path dbus.ObjectPath
+}
+type fakeSession struct{}
+type fakePrompt struct {
+	f    *fakeSecretService
+	path dbus.ObjectPath
+}
+type fakeProperties struct {
+	get func(iface, name string) (dbus.Variant, *dbus.Error)
+}
+
+func (p fakeProperties) Get(iface, name string) (dbus.Variant, *dbus.Error) {
+	return p.get(iface, name)
+}
+
+func (s fakeService) OpenSession(algorithm string, input dbus.Variant) (dbus.Variant, dbus.ObjectPath, *dbus.Error) {
+	if algorithm != "plain" {
+		return dbus.Variant{}, "", dbus.MakeFailedError(fmt.Errorf("unsupported algorithm %s", algorithm))
+	}
+	path := dbus.ObjectPath("/org/freedesktop/secrets/session/1")
+	if err := s.f.conn.Export(fakeSession{}, path, ssSessionInterface); err != nil {
+		return dbus.Variant{}, "", dbus.MakeFailedError(err)
+	}
+	return dbus.MakeVariant(""), path, nil
+}
+
+func (s fakeService) Unlock(objects []dbus.ObjectPath) ([]dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	prompt := s.f.newPrompt(func() dbus.Variant { return dbus.MakeVariant(objects) })
+	return []dbus.ObjectPath{}, prompt, nil
+}
+
+func (fakeSession) Close() *dbus.Error { return nil }
+
+func (c fakeCollection) SearchItems(attrs map[string]string) ([]dbus.ObjectPath, *dbus.Error) {
+	c.f.mu.Lock()
+	defer c.f.mu.Unlock()
+	results := []dbus.ObjectPath{}
+	for path, item := range c.f.items {
+		if matchAttributes(item.attrs, attrs) {
+			results = append(results, path)
+		}
+	}
+	return results, nil
+}
+
+func (c fakeCollection) CreateItem(props map[string]dbus.Variant, secret ssSecret, replace bool) (dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	attrs, ok := props[ssItemInterface+".Attributes"].Value().(map[string]string)
+	if !ok {
+		return "", "", dbus.MakeFailedError(fmt.Errorf("missing attributes"))
+	}
+
+	c.f.mu.Lock()
+	defer c.f.mu.Unlock()
+	if replace {
+		for path, item := range c.f.items {
+			if reflect.DeepEqual(item.attrs, attrs) {
+				item.value = append([]byte(nil), secret.Value...)
+				return path, ssNoPrompt, nil
+			}
+		}
+	}
+
+	c.f.nextID++
+	path := dbus.ObjectPath(fmt.Sprintf("%s/%d", ssLoginCollection, c.f.nextID))
+	c.f.items[path] = &fakeItem{attrs: attrs, value: append([]byte(nil), secret.Value...)}
+	obj := fakeItemObject{f: c.f, path: path}
+	if err := c.f.conn.Export(obj, path, ssItemInterface); err != nil {
+		return "", "", dbus.MakeFailedError(err)
+	}
+	if err := c.f.conn.Export(fakeProperties{get: obj.property}, path, propertiesInterface); err != nil {
+		return "", "", dbus.MakeFailedError(err)
+	}
+	return path, ssNoPrompt, nil
+}
+
+func (i fakeItemObject) GetSecret(session dbus.ObjectPath) (ssSecret, *dbus.Error) {
+	i.f.mu.Lock()
+	defer i.f.mu.Unlock()
+	item, ok := i.f.items[i.path]
+	if !ok {
+		return ssSecret{}, dbus.MakeFailedError(fmt.Errorf("no such item"))
+	}
+	return ssSecret{Session: session, Value: item.value, ContentType: "text/plain"}, nil
+}
+
+func (i fakeItemObject) Delete() (dbus.ObjectPath, *dbus.Error) {
+	prompt := i.f.newPrompt(func() dbus.Variant {
+		i.f.mu.Lock()
+		delete(i.f.items, i.path)
+		i.f.mu.Unlock()
+		_ = i.f.conn.Export(nil, i.path, ssItemInterface)
+		_ = i.f.conn.Export(nil, i.path, propertiesInterface)
+		return dbus.MakeVariant("")
+	})
+	return prompt, nil
+}
+
+func (i fakeItemObject) property(iface, name string) (dbus.Variant, *dbus.Error) {
+	i.f.mu.Lock()
+	defer i.f.mu.Unlock()
+	item, ok := i.f.items[i.path]
+	if !ok || iface != ssItemInterface || name != "Attributes" {
+		return dbus.Variant{}, dbus.MakeFailedError(fmt.Errorf("unknown property %s.%s", iface, name))
+	}
+	return dbus.MakeVariant(item.attrs), nil
+}
+
+func (p fakePrompt) Prompt(windowID string) *dbus.Error {
+	p.f.mu.Lock()
+	complete := p.f.prompts[p.path]
+	delete(p.f.prompts, p.path)
+	p.f.mu.Unlock()
+	if complete == nil {
+		return dbus.MakeFailedError(fmt.Errorf("unknown prompt"))
+	}
+	result := complete()
+	if err := p.f.conn.Emit(p.path, ssPromptInterface+".Completed", false, result); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+func (f *fakeSecretService) newPrompt(complete func() dbus.Variant) dbus.ObjectPath {
+	f.mu.Lock()
+	f.nextID++
+	path := dbus.ObjectPath(fmt.Sprintf("/org/freedesktop/secrets/prompt/p%d", f.nextID))
+	f.prompts[path] = complete
+	f.mu.Unlock()
+	_ = f.conn.Export(fakePrompt{f: f, path: path}, path, ssPromptInterface)
+	return path
+}
+
+func matchAttributes(have, want map[string]string) bool {
+	for k, v := range want {
+		if have[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// startFakeSecretService launches a private dbus-daemon, registers a fake
+// Secret Service on it and points DBUS_SESSION_BUS_ADDRESS at it.
+func startFakeSecretService(t *testing.T) *fakeSecretService {
+	t.Helper()
+
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon not available")
+	}
+
+	dir := t.TempDir()
+	config := filepath.Join(dir, "session.conf")
+	conf := fmt.Sprintf(`<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-Bus Bus Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+  <type>session</type>
+  <listen>unix:path=%s</listen>
+  <auth>EXTERNAL</auth>
+  <policy context="default">
+    <allow send_destination="*" eavesdrop="true"/>
+    <allow eavesdrop="true"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>
+`, filepath.Join(dir, "bus"))
+	if err := os.WriteFile(config, []byte(conf), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(daemon, "--config-file="+config, "--nofork", "--print-address") // #nosec G204 -- test helper
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Skipf("failed to start dbus-daemon: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+
+	addrCh := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(stdout).ReadString('\n')
+		addrCh <- strings.TrimSpace(line)
+	}()
+	var addr string
+	select {
+	case addr = <-addrCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for dbus-daemon address")
+	}
+	if addr == "" {
+		t.Skip("dbus-daemon did not report an address")
+	}
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", addr)
+
+	conn, err := dbus.Connect(addr)
+	if err != nil {
+		t.Fatalf("failed to connect to private bus: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	f := &fakeSecretService{
+		conn:    conn,
+		items:   make(map[dbus.ObjectPath]*fakeItem),
+		prompts: make(map[dbus.ObjectPath]func() dbus.Variant),
+	}
+	if err := conn.Export(fakeService{f}, ssServicePath, ssServiceInterface); err != nil {
+		t.Fatal(err)
+	}
+	serviceProps := fakeProperties{get: func(iface, name string) (dbus.Variant, *dbus.Error) {
+		if iface == ssServiceInterface && name == "Collections" {
+			return dbus.MakeVariant([]dbus.ObjectPath{ssLoginCollection}), nil
+		}
+		return dbus.Variant{}, dbus.MakeFailedError(fmt.Errorf("unknown property %s.%s", iface, name))
+	}}
+	if err := conn.Export(serviceProps, ssServicePath, propertiesInterface); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Export(fakeCollection{f}, ssLoginCollection, ssCollectionInterface); err != nil {
+		t.Fatal(err)
+	}
+
+	reply, err := conn.RequestName(ssBusName, dbus.NameFlagDoNotQueue)
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("failed to own %s: %v (reply %d)", ssBusName, err, reply)
+	}
+	return f
+}
+
+func TestSecretServiceRoundTrip(t *testing.T) {
+	startFakeSecretService(t)
+
+	if !Available() {
+		t.Fatal("expected Secret Service to be available on the private bus")
+	}
+
+	if err := Set("svc", "beta", []byte("b"), false); err != nil {
+		t.Fatalf("Set beta: %v", err)
+	}
+	attrs := map[string]string{"locksmith.secret_type": "api_key"}
+	if err := SetWithAttributes("svc", "alpha", []byte("a"), attrs, false); err != nil {
+		t.Fatalf("SetWithAttributes alpha: %v", err)
+	}
+	if err := Set("other", "gamma", []byte("c"), false); err != nil {
+		t.Fatalf("Set gamma: %v", err)
+	}
+
+	got, err := Get("svc", "alpha", false, "")
+	if err != nil {
+		t.Fatalf("Get alpha: %v", err)
+	}
+	if string(got) != "a" {
+		t.Fatalf("Get alpha = %q, want %q", got, "a")
+	}
+
+	keys, err := List("svc", false, "")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if !reflect.DeepEqual(keys, []string{"alpha", "beta"}) {
+		t.Fatalf("List = %v, want [alpha beta]", keys)
+	}
+
+	listed, err := ListAttributes("svc", false, "")
+	if err != nil {
+		t.Fatalf("ListAttributes: %v", err)
+	}
+	if listed["alpha"]["locksmith.secret_type"] != "api_key" {
+		t.Fatalf("alpha attributes = %v", listed["alpha"])
+	}
+	if listed["alpha"][attrService] != "svc" || listed["alpha"][attrAccount] != "alpha" {
+		t.Fatalf("alpha missing reserved attributes: %v", listed["alpha"])
+	}
+
+	if err := Delete("svc", "beta", false, ""); err != nil {
+		t.Fatalf("Delete beta: %v", err)
+	}
+	if _, err := Get("svc", "beta", false, ""); err == nil || err.Error() != "Secret not found" {
+		t.Fatalf("Get deleted item err = %v, want Secret not found", err)
+	}
+	if err := Delete("svc", "beta", false, ""); err != nil {
+		t.Fatalf("Delete missing item should succeed, got %v", err)
+	}
+}
+
+func TestSecretServiceUpdateReplacesAttributes(t *testing.T) {
+	fake := startFakeSecretService(t)
+
+	if err := SetWithAttributes("svc", "key", []byte("v1"), map[string]string{"locksmith.expires_at": "2030-01-01T00:00:00Z"}, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetWithAttributes("svc", "key", []byte("v2"), map[string]string{"locksmith.expires_at": "2031-01-01T00:00:00Z"}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.mu.Lock()
+	count := len(fake.items)
+	fake.mu.Unlock()
+	if count != 1 {
+		t.Fatalf("expected stale item to be removed, have %d items", count)
+	}
+
+	got, err := Get("svc", "key", false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "v2" {
+		t.Fatalf("Get = %q, want v2", got)
+	}
+	listed, err := ListAttributes("svc", false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if listed["key"]["locksmith.expires_at"] != "2031-01-01T00:00:00Z" {
+		t.Fatalf("attributes not updated: %v", listed["key"])
+	}
+}
+
+func TestSecretServiceUnavailable(t *testing.T) {
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", "unix:path="+filepath.Join(t.TempDir(), "missing"))
+	if _, err := Get("svc", "alpha", false, ""); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("expected ErrUnavailable without a session bus, got %v", err)
+	}
+	if _, err := List("svc", false, ""); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("expected ErrUnavailable from List without a session bus, got %v", err)
+	}
+
+	// A bus without a Secret Service provider is unavailable as well.
+	if !providerMissing(fmt.Errorf("search: %w", dbus.Error{Name: "org.freedesktop.DBus.Error.ServiceUnknown"})) {
+		t.Error("expected ServiceUnknown to report a missing provider")
+	}
+	if providerMissing(dbus.Error{Name: "org.freedesktop.Secret.Error.IsLocked"}) {
+		t.Error("a locked collection has a provider")
+	}
+}
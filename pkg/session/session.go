@@ -0,0 +1,369 @@
+// Package session implements the locksmith session daemon: a per-user
+// process holding the backend items read during a work session in memory,
+// so that one authentication prompt covers every locksmith process started
+// until the session is locked or times out. Clients talk to the daemon with
+// one JSON request per connection over a Unix socket that only its owner
+// can connect to; both ends check the peer's uid.
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SocketEnv overrides the path of the daemon's socket.
+const SocketEnv = "LOCKSMITH_DAEMON_SOCKET"
+
+const (
+	// DefaultIdleTimeout locks a session that has not been used for a while.
+	DefaultIdleTimeout = 15 * time.Minute
+	// DefaultAbsoluteTimeout locks a session however much it is used.
+	DefaultAbsoluteTimeout = 8 * time.Hour
+
+	ioTimeout      = 5 * time.Second
+	expireInterval = time.Second
+	maxMessageSize = 16 << 20
+)
+
+const (
+	opStatus = "status"
+	opUnlock = "unlock"
+	opLock   = "lock"
+	opGet    = "get"
+	opPut    = "put"
+	opForget = "forget"
+)
+
+// ErrUnsupported is returned where Unix socket peer credentials are not
+// available.
+var ErrUnsupported = errors.New("the locksmith daemon is not supported on this platform")
+
+// SocketPath returns the daemon's socket: $LOCKSMITH_DAEMON_SOCKET, or
+// ~/.locksmith/daemon.sock.
+func SocketPath() (string, error) {
+	if p := os.Getenv(SocketEnv); p != "" {
+		return p, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".locksmith", "daemon.sock"), nil
+}
+
+// Item is a backend item held by the daemon, exactly as the backend
+// returned it.
+type Item struct {
+	Service string `json:"service"`
+	Account string `json:"account"`
+	Data    []byte `json:"data"`
+}
+
+// Status describes the daemon and its session. The expiry times are zero
+// while the session is locked or when the timeout is disabled.
+type Status struct {
+	PID           int       `json:"pid"`
+	Unlocked      bool      `json:"unlocked"`
+	Items         int       `json:"items"`
+	UnlockedAt    time.Time `json:"unlocked_at,omitzero"`
+	IdleExpiresAt time.Time `json:"idle_expires_at,omitzero"`
+	ExpiresAt     time.Time `json:"expires_at,omitzero"`
+}
+
+type request struct {
+	Op      string `json:"op"`
+	Service string `json:"service,omitempty"`
+	Account string `json:"account,omitempty"`
+	Data    []byte `json:"data,omitempty"`
+	Items   []Item `json:"items,omitempty"`
+}
+
+type response struct {
+	Error  string  `json:"error,omitempty"`
+	Found  bool    `json:"found,omitempty"`
+	Data   []byte  `json:"data,omitempty"`
+	Status *Status `json:"status,omitempty"`
+}
+
+type itemKey struct {
+	service, account string
+}
+
+// Server is the daemon's session. It starts locked; Unlock opens it, and
+// from then on items read by clients are held until the session is locked,
+// by a client or by one of the timeouts. A zero timeout is disabled.
+type Server struct {
+	IdleTimeout     time.Duration
+	AbsoluteTimeout time.Duration
+
+	mu         sync.Mutex
+	unlocked   bool
+	items      map[itemKey][]byte
+	unlockedAt time.Time
+	lastUsed   time.Time
+	now        func() time.Time
+}
+
+// NewServer returns a locked session with the given timeouts.
+func NewServer(idleTimeout, absoluteTimeout time.Duration) *Server {
+	return &Server{
+		IdleTimeout:     idleTimeout,
+		AbsoluteTimeout: absoluteTimeout,
+		items:           make(map[itemKey][]byte),
+		now:             time.Now,
+	}
+}
+
+// Serve answers the clients connecting to l until l is closed, and locks
+// the session when it returns.
+func (s *Server) Serve(l net.Listener) error {
+	done := make(chan struct{})
+	defer func() {
+		close(done)
+		s.lock()
+	}()
+	go s.expireLoop(done)
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) expireLoop(done <-chan struct{}) {
+	ticker := time.NewTicker(expireInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			s.expire()
+			s.mu.Unlock()
+		}
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	// Only processes of the daemon's own user are answered.
+	if err := checkPeer(conn); err != nil {
+		return
+	}
+	_ = conn.SetDeadline(time.Now().Add(ioTimeout))
+
+	var req request
+	if err := json.NewDecoder(io.LimitReader(conn, maxMessageSize)).Decode(&req); err != nil {
+		return
+	}
+	resp := s.handle(&req)
+	defer zeroBytes(resp.Data)
+	_ = json.NewEncoder(conn).Encode(resp)
+}
+
+func (s *Server) handle(req *request) *response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire()
+
+	switch req.Op {
+	case opStatus:
+		return &response{Status: s.status()}
+	case opUnlock:
+		// Every unlock is a fresh authentication and restarts the session.
+		// The items are the proof of it: a client that read nothing has not
+		// authenticated.
+		if len(req.Items) == 0 {
+			return &response{Error: "refusing to unlock a session without secrets"}
+		}
+		s.unlocked = true
+		s.unlockedAt = s.now()
+		s.lastUsed = s.unlockedAt
+		for _, item := range req.Items {
+			s.store(itemKey{item.Service, item.Account}, item.Data)
+		}
+	case opLock:
+		s.lockLocked()
+	case opGet:
+		data, ok := s.items[itemKey{req.Service, req.Account}]
+		if !s.unlocked || !ok {
+			return &response{}
+		}
+		s.lastUsed = s.now()
+		return &response{Found: true, Data: append([]byte(nil), data...)}
+	case opPut:
+		// A locked session holds nothing: what its clients read is only
+		// kept once the user has unlocked it.
+		if !s.unlocked {
+			zeroBytes(req.Data)
+			return &response{}
+		}
+		s.lastUsed = s.now()
+		s.store(itemKey{req.Service, req.Account}, req.Data)
+	case opForget:
+		s.forget(itemKey{req.Service, req.Account})
+	default:
+		return &response{Error: fmt.Sprintf("unknown operation '%s'", req.Op)}
+	}
+	return &response{}
+}
+
+func (s *Server) store(k itemKey, data []byte) {
+	s.forget(k)
+	if len(data) > 0 {
+		s.items[k] = data
+	}
+}
+
+func (s *Server) forget(k itemKey) {
+	if old, ok := s.items[k]; ok {
+		zeroBytes(old)
+		delete(s.items, k)
+	}
+}
+
+// expire locks the session once it has been idle, or unlocked, for too long.
+func (s *Server) expire() {
+	if !s.unlocked {
+		return
+	}
+	now := s.now()
+	if (s.IdleTimeout > 0 && now.Sub(s.lastUsed) >= s.IdleTimeout) ||
+		(s.AbsoluteTimeout > 0 && now.Sub(s.unlockedAt) >= s.AbsoluteTimeout) {
+		s.lockLocked()
+	}
+}
+
+func (s *Server) lock() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lockLocked()
+}
+
+// lockLocked wipes the held items; s.mu must be held.
+func (s *Server) lockLocked() {
+	for k := range s.items {
+		s.forget(k)
+	}
+	s.unlocked = false
+	s.unlockedAt, s.lastUsed = time.Time{}, time.Time{}
+}
+
+func (s *Server) status() *Status {
+	st := &Status{PID: os.Getpid(), Unlocked: s.unlocked, Items: len(s.items)}
+	if s.unlocked {
+		st.UnlockedAt = s.unlockedAt
+		if s.IdleTimeout > 0 {
+			st.IdleExpiresAt = s.lastUsed.Add(s.IdleTimeout)
+		}
+		if s.AbsoluteTimeout > 0 {
+			st.ExpiresAt = s.unlockedAt.Add(s.AbsoluteTimeout)
+		}
+	}
+	return st
+}
+
+// Client talks to the daemon listening on Path.
+type Client struct {
+	Path string
+}
+
+// Lookup returns a client of the user's daemon, or nil when no daemon
+// socket exists. The daemon is not contacted.
+func Lookup() *Client {
+	path, err := SocketPath()
+	if err != nil {
+		return nil
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode()&os.ModeSocket == 0 {
+		return nil
+	}
+	return &Client{Path: path}
+}
+
+// Status returns the daemon's status; it fails when no daemon answers.
+func (c *Client) Status() (*Status, error) {
+	resp, err := c.call(&request{Op: opStatus})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Status == nil {
+		return nil, fmt.Errorf("invalid response from the locksmith daemon")
+	}
+	return resp.Status, nil
+}
+
+// Unlock starts a session holding items.
+func (c *Client) Unlock(items []Item) error {
+	_, err := c.call(&request{Op: opUnlock, Items: items})
+	return err
+}
+
+// Lock ends the session, wiping every item the daemon holds.
+func (c *Client) Lock() error {
+	_, err := c.call(&request{Op: opLock})
+	return err
+}
+
+// Get returns the item held for service and account. ok is false when the
+// session is locked, the item is not held or the daemon cannot be reached.
+func (c *Client) Get(service, account string) (data []byte, ok bool) {
+	resp, err := c.call(&request{Op: opGet, Service: service, Account: account})
+	if err != nil || !resp.Found {
+		return nil, false
+	}
+	return resp.Data, true
+}
+
+// Put offers an item read from the backend to the session, which holds it
+// if it is unlocked. Errors are ignored: the daemon is only a shortcut.
+func (c *Client) Put(service, account string, data []byte) {
+	_, _ = c.call(&request{Op: opPut, Service: service, Account: account, Data: data})
+}
+
+// Forget drops the item held for service and account, after it was written
+// or deleted.
+func (c *Client) Forget(service, account string) {
+	_, _ = c.call(&request{Op: opForget, Service: service, Account: account})
+}
+
+func (c *Client) call(req *request) (*response, error) {
+	conn, err := dial(c.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(ioTimeout))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("failed to send request to the locksmith daemon: %w", err)
+	}
+	var resp response
+	if err := json.NewDecoder(io.LimitReader(conn, maxMessageSize)).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to read response from the locksmith daemon: %w", err)
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	return &resp, nil
+}
+
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,154 @@
+//go:build !windows
+
+package session
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// startServer serves a session on a socket in a short temporary directory,
+// as socket paths are limited to about 100 bytes.
+func startServer(t *testing.T, s *Server) *Client {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "lsd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	path := filepath.Join(dir, "daemon.sock")
+	l, err := Listen(path)
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	done := make(chan error)
+	go func() { done <- s.Serve(l) }()
+	t.Cleanup(func() {
+		_ = l.Close()
+		if err := <-done; err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	})
+	return &Client{Path: path}
+}
+
+func TestSession(t *testing.T) {
+	c := startServer(t, NewServer(time.Hour, time.Hour))
+	fi, err := os.Stat(c.Path)
+	if err != nil || fi.Mode().Perm() != 0600 {
+		t.Fatalf("expected an owner-only socket, got %v, %v", fi.Mode(), err)
+	}
+
+	if st, err := c.Status(); err != nil || st.Unlocked || st.PID != os.Getpid() {
+		t.Fatalf("expected a locked session, got %+v, %v", st, err)
+	}
+	c.Put("svc", "a", []byte("one"))
+	if _, ok := c.Get("svc", "a"); ok {
+		t.Error("a locked session must not hold items")
+	}
+
+	if err := c.Unlock(nil); err == nil {
+		t.Error("expected an unlock without items to be refused")
+	}
+	if st, _ := c.Status(); st.Unlocked {
+		t.Fatal("an unlock without items must leave the session locked")
+	}
+
+	if err := c.Unlock([]Item{{Service: "svc", Account: "a", Data: []byte("one")}}); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if data, ok := c.Get("svc", "a"); !ok || string(data) != "one" {
+		t.Errorf("Get(a) = %q, %v", data, ok)
+	}
+	if _, ok := c.Get("other", "a"); ok {
+		t.Error("items are held per service")
+	}
+	c.Put("svc", "b", []byte("two"))
+	c.Forget("svc", "a")
+	if _, ok := c.Get("svc", "a"); ok {
+		t.Error("expected a to be forgotten")
+	}
+	st, err := c.Status()
+	if err != nil || !st.Unlocked || st.Items != 1 || st.IdleExpiresAt.IsZero() || st.ExpiresAt.IsZero() {
+		t.Errorf("unexpected status %+v, %v", st, err)
+	}
+
+	if err := c.Lock(); err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	if _, ok := c.Get("svc", "b"); ok {
+		t.Error("locking must wipe the session")
+	}
+	if st, _ := c.Status(); st.Unlocked || st.Items != 0 {
+		t.Errorf("unexpected status after lock %+v", st)
+	}
+}
+
+func TestSessionTimeouts(t *testing.T) {
+	now := time.Unix(1000, 0)
+	s := NewServer(time.Minute, time.Hour)
+	s.now = func() time.Time { return now }
+	get := func() bool {
+		return s.handle(&request{Op: opGet, Service: "svc", Account: "a"}).Found
+	}
+	unlock := func() {
+		s.handle(&request{Op: opUnlock, Items: []Item{{Service: "svc", Account: "a", Data: []byte("v")}}})
+	}
+
+	unlock()
+	now = now.Add(59 * time.Second)
+	if !get() {
+		t.Fatal("expected the item within the idle timeout")
+	}
+	now = now.Add(time.Minute)
+	if get() {
+		t.Error("expected the session to lock when idle")
+	}
+
+	unlock()
+	for range 80 {
+		now = now.Add(50 * time.Second)
+		get()
+	}
+	if s.unlocked {
+		t.Error("expected the session to lock after the absolute timeout however much it is used")
+	}
+}
+
+func TestListen(t *testing.T) {
+	c := startServer(t, NewServer(0, 0))
+	if _, err := Listen(c.Path); err == nil {
+		t.Error("expected a second daemon on the same socket to be refused")
+	}
+
+	// A stale socket is replaced.
+	dir, err := os.MkdirTemp("", "lsd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "daemon.sock")
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = stale.Close()
+	l, err := Listen(path)
+	if err != nil {
+		t.Fatalf("expected the stale socket to be replaced: %v", err)
+	}
+	_ = l.Close()
+
+	t.Setenv(SocketEnv, c.Path)
+	if Lookup() == nil {
+		t.Error("expected Lookup to find the socket")
+	}
+	t.Setenv(SocketEnv, filepath.Join(dir, "missing.sock"))
+	if Lookup() != nil {
+		t.Error("expected no client without a socket")
+	}
+}
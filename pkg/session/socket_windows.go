@@ -0,0 +1,17 @@
+package session
+
+import "net"
+
+// Listen is unavailable on Windows, which has no Unix socket peer
+// credentials to restrict the daemon to its user with.
+func Listen(path string) (net.Listener, error) {
+	return nil, ErrUnsupported
+}
+
+func dial(path string) (net.Conn, error) {
+	return nil, ErrUnsupported
+}
+
+func checkPeer(conn net.Conn) error {
+	return ErrUnsupported
+}